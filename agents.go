@@ -0,0 +1,116 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"gomanus/internal/agent"
+
+	"github.com/pterm/pterm"
+)
+
+// parseAgentFlag 从命令行参数中取出 --agent <名称> 或 --agent=<名称>，返回其余参数和代理名称
+func parseAgentFlag(args []string) ([]string, string) {
+	var rest []string
+	var name string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--agent" && i+1 < len(args):
+			name = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--agent="):
+			name = strings.TrimPrefix(args[i], "--agent=")
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+	return rest, strings.ToLower(name)
+}
+
+// agentKeys 返回排序后的代理名称
+func agentKeys(agents map[string]agent.Runner) []string {
+	keys := make([]string, 0, len(agents))
+	for key := range agents {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// handleAgentCommand 处理 /agent 命令，返回新的指定代理，空字符串表示由分类器自动选择
+//
+//	/agent          列出可用代理
+//	/agent <名称>   之后的输入都交给指定代理处理
+//	/agent auto     恢复根据输入类型自动选择代理
+func handleAgentCommand(input string, agents map[string]agent.Runner, profiles []agent.AgentProfile, selected string) string {
+	name := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(input, "/agent")))
+	switch name {
+	case "":
+		listAgents(agents, profiles, selected)
+		return selected
+	case "auto":
+		pterm.Success.Println("✅ 已恢复自动分类，系统会根据输入类型选择代理")
+		return ""
+	}
+
+	if _, exists := agents[name]; !exists {
+		pterm.Warning.Printf("⚠️  代理 %s 不存在，可用代理: %s\n", name, strings.Join(agentKeys(agents), ", "))
+		return selected
+	}
+	pterm.Success.Printf("✅ 之后的输入将由代理 %s 处理，输入 /agent auto 恢复自动分类\n", name)
+	return name
+}
+
+// handleStrategyCommand 处理 /strategy 命令，返回新的执行策略，空字符串表示使用代理配置的策略
+//
+//	/strategy           列出可用的执行策略
+//	/strategy <名称>    之后的任务使用指定的执行策略
+//	/strategy default   恢复使用代理配置的执行策略
+func handleStrategyCommand(input string, selected string) string {
+	name := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(input, "/strategy")))
+	switch name {
+	case "":
+		current := selected
+		if current == "" {
+			current = "代理配置的策略"
+		}
+		pterm.Info.Printf("当前执行策略: %s，可用策略: %s\n", current, strings.Join(agent.StrategyNames(), ", "))
+		return selected
+	case "default":
+		pterm.Success.Println("✅ 已恢复使用代理配置的执行策略")
+		return ""
+	}
+
+	if _, err := agent.NewStrategy(name); err != nil {
+		pterm.Warning.Printf("⚠️  %v\n", err)
+		return selected
+	}
+	pterm.Success.Printf("✅ 之后的任务将使用执行策略 %s\n", name)
+	return name
+}
+
+// listAgents 列出已创建的代理
+func listAgents(agents map[string]agent.Runner, profiles []agent.AgentProfile, selected string) {
+	data := pterm.TableData{{"名称", "策略", "模型", "说明"}}
+	for _, profile := range profiles {
+		if _, exists := agents[profile.Key]; !exists {
+			continue
+		}
+		key := profile.Key
+		if key == selected {
+			key += " *"
+		}
+		model := profile.Model
+		if model == "" {
+			model = "默认"
+		}
+		data = append(data, []string{key, profile.Strategy, model, profile.Description})
+	}
+
+	if selected == "" {
+		pterm.Info.Println("当前根据输入类型自动选择代理，可用代理:")
+	} else {
+		pterm.Info.Printf("当前指定的代理: %s\n", selected)
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(data).Render()
+}
@@ -3,9 +3,10 @@ package agent
 import (
 	"context"
 	"fmt"
-	"strings"
 	"sync"
+	"time"
 
+	"gomanus/internal/checkpoint"
 	"gomanus/internal/llm"
 	"gomanus/internal/schema"
 	"gomanus/pkg/logger"
@@ -46,19 +47,44 @@ type BaseAgent struct {
 	Memory      *schema.Memory
 	MaxSteps    int
 	CurrentStep int
+	TokensUsed  int // 本次运行中LLM请求消耗的token总数
 	mu          sync.Mutex
+
+	// 本次运行的结构化结果，stepCalls为当前步骤中尚未归入步骤记录的工具调用
+	result    *RunResult
+	stepCalls []ToolCallRecord
+	runBegan  time.Time
+	failure   string // 代理在本次运行中报告的失败原因，例如terminate的status为failure
+
+	// 循环检测与恢复的运行期状态
+	loopDetector       *LoopDetector
+	loopRecovery       int
+	toolChoiceOverride string
+	originalLLM        *llm.LLM
+	runStart           int
+
+	// 检查点，Checkpoints为nil时不保存
+	Checkpoints        *checkpoint.Store
+	RunID              string
+	runRequest         string
+	runMode            string
+	checkpointing      bool
+	stateProvider      CheckpointStateProvider
+	completedToolCalls map[string]string
+	checkpointMu       sync.Mutex
 }
 
 // NewBaseAgent 创建新的基础代理
 func NewBaseAgent(name string, llmInstance *llm.LLM) *BaseAgent {
 	return &BaseAgent{
-		Name:        name,
-		Description: "基础代理",
-		LLM:         llmInstance,
-		Memory:      schema.NewMemory(),
-		MaxSteps:    300,
-		CurrentStep: 0,
-		State:       StateIdle,
+		Name:         name,
+		Description:  "基础代理",
+		LLM:          llmInstance,
+		Memory:       schema.NewMemory(),
+		MaxSteps:     300,
+		CurrentStep:  0,
+		State:        StateIdle,
+		loopDetector: NewLoopDetector(),
 	}
 }
 
@@ -67,31 +93,30 @@ type Stepper interface {
 	Step(ctx context.Context) (string, error)
 }
 
+// finalAnswerer 由自行生成最终回答的步骤执行器实现，例如总结计划的规划代理
+type finalAnswerer interface {
+	FinalAnswer() string
+}
+
 // Run 运行代理的主循环
-func (a *BaseAgent) Run(ctx context.Context, request string) (string, error) {
+func (a *BaseAgent) Run(ctx context.Context, request string) (*RunResult, error) {
 	return a.RunWithStepper(ctx, request, a)
 }
 
 // RunWithStepper 使用指定的步骤执行器运行代理
-func (a *BaseAgent) RunWithStepper(ctx context.Context, request string, stepper Stepper) (string, error) {
+// 运行开始后即使出错也会返回记录了已执行步骤的结果
+func (a *BaseAgent) RunWithStepper(ctx context.Context, request string, stepper Stepper) (*RunResult, error) {
 	// 检查代理状态
-	a.mu.Lock()
-	if a.State != StateIdle {
-		a.mu.Unlock()
-		return "", fmt.Errorf("无法从状态 %s 运行代理", a.State)
+	if err := a.beginRun(); err != nil {
+		return nil, err
 	}
 
-	// 重置步骤计数并设置状态为运行中
-	a.State = StateRunning
-	a.CurrentStep = 0
-	a.mu.Unlock()
+	// 记录本次运行在记忆中的起点，循环检测只考虑本次运行的消息
+	a.runStart = len(a.Memory.GetMessages())
+	a.startCheckpointing(ctx, request, stepper)
 
 	// 确保在函数返回时将状态重置为空闲
-	defer func() {
-		a.mu.Lock()
-		a.State = StateIdle
-		a.mu.Unlock()
-	}()
+	defer a.endRun()
 
 	// 如果有请求，添加到记忆中
 	if request != "" {
@@ -100,13 +125,18 @@ func (a *BaseAgent) RunWithStepper(ctx context.Context, request string, stepper
 
 		// 立即向AI咨询，生成初始步骤
 		logger.Info("向AI咨询初始步骤...")
+		stepBegan := time.Now()
 		initialStep, err := stepper.Step(ctx)
 		if err != nil {
-			a.mu.Lock()
-			a.State = StateError
-			a.mu.Unlock()
+			if ctx.Err() != nil {
+				a.recordStep(a.CurrentStep+1, "", time.Since(stepBegan), "执行被取消")
+				return a.finishRun(stepper, RunStatusCancelled, ""), a.interrupt(ctx, a.CurrentStep+1)
+			}
+			a.recordStep(a.CurrentStep+1, "", time.Since(stepBegan), err.Error())
+			a.SetState(StateError)
+			a.saveCheckpoint(checkpoint.StatusError)
 			logger.Error("初始步骤生成失败: %v", err)
-			return "", fmt.Errorf("初始步骤生成失败: %w", err)
+			return a.finishRun(stepper, RunStatusFailure, ""), fmt.Errorf("初始步骤生成失败: %w", err)
 		}
 
 		// 记录初始步骤结果
@@ -115,18 +145,168 @@ func (a *BaseAgent) RunWithStepper(ctx context.Context, request string, stepper
 		stepNum := a.CurrentStep
 		a.mu.Unlock()
 
-		stepResult := fmt.Sprintf("步骤 %d: %s", stepNum, initialStep)
-		logger.Info(stepResult)
+		logger.Info("步骤 %d: %s", stepNum, initialStep)
+		a.recordStep(stepNum, initialStep, time.Since(stepBegan), "")
 
 		// 如果子类没有实现Step方法，这里可能已经得到了最终结果
 		// 检查是否需要继续执行更多步骤
 		if a.GetState() == StateFinished {
-			return initialStep, nil
+			a.saveCheckpoint(checkpoint.StatusFinished)
+			return a.finishRun(stepper, RunStatusSuccess, initialStep), nil
+		}
+		a.saveCheckpoint(checkpoint.StatusRunning)
+	}
+
+	return a.runSteps(ctx, stepper)
+}
+
+// beginRun 检查代理是否空闲，并将状态设置为运行中
+func (a *BaseAgent) beginRun() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.State != StateIdle {
+		return fmt.Errorf("无法从状态 %s 运行代理", a.State)
+	}
+
+	// 重置步骤计数并设置状态为运行中
+	a.State = StateRunning
+	a.CurrentStep = 0
+	a.TokensUsed = 0
+	a.result = &RunResult{Agent: a.Name}
+	a.stepCalls = nil
+	a.runBegan = time.Now()
+	a.failure = ""
+	return nil
+}
+
+// reportFailure 记录代理没有完成任务，正常结束的运行以失败状态结束
+func (a *BaseAgent) reportFailure(reason string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.failure = reason
+}
+
+// takeFailure 返回并清除代理报告的失败原因
+func (a *BaseAgent) takeFailure() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	failure := a.failure
+	a.failure = ""
+	return failure
+}
+
+// endRun 在运行结束后清理运行期状态，并将状态重置为空闲
+func (a *BaseAgent) endRun() {
+	a.resetLoopRecovery()
+	a.stopCheckpointing()
+	a.mu.Lock()
+	a.State = StateIdle
+	a.mu.Unlock()
+}
+
+// recordUsage 累计一次LLM请求消耗的token数
+func (a *BaseAgent) recordUsage(usage schema.Usage) {
+	a.mu.Lock()
+	a.TokensUsed += usage.TotalTokens
+	a.mu.Unlock()
+}
+
+// GetTokensUsed 返回本次运行中已消耗的token数
+func (a *BaseAgent) GetTokensUsed() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.TokensUsed
+}
+
+// recordToolCalls 记录当前步骤中的工具调用，步骤结束时归入步骤记录
+func (a *BaseAgent) recordToolCalls(records ...ToolCallRecord) {
+	a.mu.Lock()
+	a.stepCalls = append(a.stepCalls, records...)
+	a.mu.Unlock()
+}
+
+// takeToolCalls 取出尚未归入步骤记录的工具调用
+func (a *BaseAgent) takeToolCalls() []ToolCallRecord {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	records := a.stepCalls
+	a.stepCalls = nil
+	return records
+}
+
+// recordStep 把一个步骤和其中的工具调用记录到本次运行的结果中
+func (a *BaseAgent) recordStep(number int, output string, duration time.Duration, note string) {
+	calls := a.takeToolCalls()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.result == nil {
+		return
+	}
+	a.result.Steps = append(a.result.Steps, StepRecord{
+		Number:    number,
+		Output:    output,
+		ToolCalls: calls,
+		Duration:  duration,
+		Note:      note,
+	})
+}
+
+// finishRun 以指定状态结束本次运行的结果，失败和取消的运行没有最终回答
+// 代理报告了失败的运行以失败状态结束，保留代理的回答说明失败的原因
+func (a *BaseAgent) finishRun(stepper Stepper, status RunStatus, lastOutput string) *RunResult {
+	failure := a.takeFailure()
+	var answer string
+	if status == RunStatusSuccess || status == RunStatusBudgetExceeded {
+		answer = a.finalAnswer(stepper, lastOutput)
+	}
+	if status == RunStatusSuccess && failure != "" {
+		status = RunStatusFailure
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	result := a.result
+	if result == nil {
+		result = &RunResult{Agent: a.Name}
+	}
+	result.RunID = a.RunID
+	result.Status = status
+	result.Answer = answer
+	result.TokensUsed = a.TokensUsed
+	result.Artifacts = collectArtifacts(result.Steps)
+	result.Duration = time.Since(a.runBegan)
+	if status == RunStatusFailure && failure != "" {
+		result.Warnings = append(result.Warnings, failure)
+	}
+	a.result = nil
+	return result
+}
+
+// finalAnswer 提取本次运行的最终回答，依次使用步骤执行器生成的回答、terminate的message参数、
+// 最后的助手回答和最后一个步骤的结果
+func (a *BaseAgent) finalAnswer(stepper Stepper, lastOutput string) string {
+	if answerer, ok := stepper.(finalAnswerer); ok {
+		if answer := answerer.FinalAnswer(); answer != "" {
+			return answer
 		}
 	}
 
-	// 执行步骤直到达到最大步骤数或代理状态变为已完成
-	var results []string
+	messages := a.Memory.GetMessages()
+	if a.runStart <= len(messages) {
+		messages = messages[a.runStart:]
+	}
+	if answer := stepSummary(messages, lastOutput); answer != "" {
+		return answer
+	}
+	return "未执行任何步骤"
+}
+
+// runSteps 执行步骤直到达到最大步骤数或代理状态变为已完成
+func (a *BaseAgent) runSteps(ctx context.Context, stepper Stepper) (*RunResult, error) {
+	status := RunStatusSuccess
+	var lastOutput string
 	for a.CurrentStep < a.MaxSteps && a.GetState() != StateFinished {
 		a.mu.Lock()
 		a.CurrentStep++
@@ -136,48 +316,61 @@ func (a *BaseAgent) RunWithStepper(ctx context.Context, request string, stepper
 		logger.Info("执行步骤 %d/%d", stepNum, a.MaxSteps)
 
 		// 执行单个步骤
+		stepBegan := time.Now()
 		result, err := stepper.Step(ctx)
 		if err != nil {
-			a.mu.Lock()
-			a.State = StateError
-			a.mu.Unlock()
+			// 被用户取消时记录中断，而不是作为错误处理
+			if ctx.Err() != nil {
+				a.recordStep(stepNum, "", time.Since(stepBegan), "执行被取消")
+				return a.finishRun(stepper, RunStatusCancelled, lastOutput), a.interrupt(ctx, stepNum)
+			}
+			a.recordStep(stepNum, "", time.Since(stepBegan), err.Error())
+			a.SetState(StateError)
+			a.saveCheckpoint(checkpoint.StatusError)
 			logger.Error("步骤 %d 执行失败: %v", stepNum, err)
-			return "", fmt.Errorf("步骤 %d 执行失败: %w", stepNum, err)
+			return a.finishRun(stepper, RunStatusFailure, lastOutput), fmt.Errorf("步骤 %d 执行失败: %w", stepNum, err)
 		}
-
-		// 记录步骤结果
-		stepResult := fmt.Sprintf("步骤 %d: %s", stepNum, result)
-		logger.Info(stepResult)
-		results = append(results, stepResult)
-
-		// 检查是否陷入循环
-		if a.isStuck() {
-			a.handleStuckState()
+		lastOutput = result
+		logger.Info("步骤 %d: %s", stepNum, result)
+
+		// 检查是否陷入循环，并分级恢复，多次恢复无效被强制终止时视为失败
+		var note string
+		if signal := a.detectLoop(); signal.Kind != LoopNone {
+			note = a.handleStuckState(signal)
+			if note != "" && a.GetState() == StateFinished {
+				status = RunStatusFailure
+			}
 		}
+		a.recordStep(stepNum, result, time.Since(stepBegan), note)
+
+		// 每个步骤结束后保存检查点
+		a.saveCheckpoint(checkpoint.StatusRunning)
 
 		// 添加上下文取消检查
 		select {
 		case <-ctx.Done():
-			logger.Warn("代理执行被上下文取消")
-			results = append(results, "执行被取消")
-			return strings.Join(results, "\n"), ctx.Err()
+			return a.finishRun(stepper, RunStatusCancelled, lastOutput), a.interrupt(ctx, stepNum)
 		default:
 			// 继续执行
 		}
 	}
 
 	// 检查是否达到最大步骤数
-	if a.CurrentStep >= a.MaxSteps {
-		maxStepsMsg := fmt.Sprintf("终止: 达到最大步骤数 (%d)", a.MaxSteps)
-		logger.Warn(maxStepsMsg)
-		results = append(results, maxStepsMsg)
+	if a.GetState() != StateFinished && a.CurrentStep >= a.MaxSteps {
+		logger.Warn("终止: 达到最大步骤数 (%d)", a.MaxSteps)
+		status = RunStatusBudgetExceeded
 	}
+	a.saveCheckpoint(checkpoint.StatusFinished)
 
-	// 返回所有步骤的结果
-	if len(results) == 0 {
-		return "未执行任何步骤", nil
-	}
-	return strings.Join(results, "\n"), nil
+	return a.finishRun(stepper, status, lastOutput), nil
+}
+
+// interrupt 在记忆中记录任务被用户中断，并保存中断状态的检查点
+func (a *BaseAgent) interrupt(ctx context.Context, stepNum int) error {
+	logger.Warn("代理执行在第 %d 步被上下文取消", stepNum)
+	a.AddMessage(schema.NewSystemMessage(fmt.Sprintf("用户在第 %d 步中断了任务，任务尚未完成。", stepNum)))
+	a.saveCheckpoint(checkpoint.StatusInterrupted)
+	return ctx.Err()
 }
 
 // Step 执行代理的单个步骤，需要被子类实现
@@ -246,49 +439,6 @@ func (a *BaseAgent) GetName() string {
 	return a.Name
 }
 
-// isStuck 检查代理是否陷入循环
-func (a *BaseAgent) isStuck() bool {
-	messages := a.Memory.GetMessages()
-	if len(messages) < 4 {
-		return false
-	}
-
-	// 获取最后一条助手消息
-	var lastAssistantMsg schema.Message
-	for i := len(messages) - 1; i >= 0; i-- {
-		if messages[i].Role == "assistant" {
-			lastAssistantMsg = messages[i]
-			break
-		}
-	}
-
-	// 如果没有找到助手消息或内容为空，则不认为陷入循环
-	if lastAssistantMsg.Role == "" || lastAssistantMsg.Content == "" {
-		return false
-	}
-
-	// 统计相同内容的助手消息数量
-	duplicateCount := 0
-	for i := len(messages) - 1; i >= 0; i-- {
-		if messages[i].Role == "assistant" && messages[i].Content == lastAssistantMsg.Content {
-			duplicateCount++
-		}
-	}
-
-	// 设置阈值为2，如果有2个或以上相同内容的助手消息，则认为陷入循环
-	duplicateThreshold := 2
-	return duplicateCount >= duplicateThreshold
-}
-
-// handleStuckState 处理代理陷入循环的情况
-func (a *BaseAgent) handleStuckState() {
-	stuckPrompt := "检测到重复响应，任务可能已完成或遇到问题，正在终止执行。"
-	logger.Warn("代理检测到循环状态，强制终止: %s", stuckPrompt)
-	a.AddMessage(schema.NewSystemMessage(stuckPrompt))
-	// 强制设置状态为完成，避免无限循环
-	a.SetState(StateFinished)
-}
-
 // GetMaxSteps 获取代理的最大步骤数
 func (a *BaseAgent) GetMaxSteps() int {
 	return a.MaxSteps
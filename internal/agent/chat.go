@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"gomanus/internal/llm"
 	"gomanus/internal/schema"
@@ -13,8 +14,9 @@ import (
 // ChatAgent 专门用于聊天对话的代理，不使用工具
 type ChatAgent struct {
 	*BaseAgent
-	SystemPrompt string
-	mu           sync.Mutex
+	SystemPrompt   string
+	promptTemplate promptRenderer // 设置后在每次运行开始时重新渲染SystemPrompt
+	mu             sync.Mutex
 }
 
 // NewChatAgent 创建新的聊天代理
@@ -29,38 +31,29 @@ func NewChatAgent(name string, llm *llm.LLM) *ChatAgent {
 		CurrentStep: 0,
 	}
 
-	systemPrompt := `你是一个友好的AI助手，专门用于聊天对话。你的任务是：
-
-1. 进行自然、友好的对话
-2. 回答用户的问题
-3. 提供信息和建议
-4. 保持轻松愉快的交流氛围
-
-重要提示：
-- 你在聊天模式下，不需要使用任何工具
-- 直接用文字回答用户的问题
-- 保持对话的连贯性和友好性
-- 如果用户需要执行具体任务，建议他们切换到任务模式`
-
 	return &ChatAgent{
-		BaseAgent:    baseAgent,
-		SystemPrompt: systemPrompt,
+		BaseAgent:      baseAgent,
+		promptTemplate: templatePrompt(name, nil, "chat"),
 	}
 }
 
 // Run 重写Run方法，专门用于聊天
-func (a *ChatAgent) Run(ctx context.Context, request string) (string, error) {
+func (a *ChatAgent) Run(ctx context.Context, request string) (*RunResult, error) {
 	logger.Info("聊天代理开始运行...")
 
 	// 检查上下文是否已取消
 	if ctx.Err() != nil {
-		return "", ctx.Err()
+		return nil, ctx.Err()
 	}
+	began := time.Now()
 
 	// 清空记忆，确保每次聊天都是独立的
 	a.Memory = schema.NewMemory()
 
-	// 添加系统提示
+	// 渲染并添加系统提示
+	if a.promptTemplate != nil {
+		a.SystemPrompt = a.promptTemplate()
+	}
 	a.AddMessage(schema.NewSystemMessage(a.SystemPrompt))
 
 	// 添加用户输入
@@ -70,11 +63,21 @@ func (a *ChatAgent) Run(ctx context.Context, request string) (string, error) {
 	messages := a.Memory.GetMessages()
 	response, err := a.LLM.AskWithOptions(ctx, messages, nil, nil, nil)
 	if err != nil {
-		return "", fmt.Errorf("聊天请求失败: %w", err)
+		if ctx.Err() != nil {
+			return &RunResult{Agent: a.Name, Status: RunStatusCancelled, Duration: time.Since(began)}, ctx.Err()
+		}
+		return &RunResult{Agent: a.Name, Status: RunStatusFailure, Duration: time.Since(began)}, fmt.Errorf("聊天请求失败: %w", err)
 	}
 
 	logger.Debug("聊天代理完成，返回响应: %s", response.Content)
-	return response.Content, nil
+	return &RunResult{
+		Agent:      a.Name,
+		Answer:     response.Content,
+		Status:     RunStatusSuccess,
+		Steps:      []StepRecord{{Number: 1, Output: response.Content, Duration: time.Since(began)}},
+		TokensUsed: response.Usage.TotalTokens,
+		Duration:   time.Since(began),
+	}, nil
 }
 
 // Step 重写Step方法，聊天代理不需要循环执行
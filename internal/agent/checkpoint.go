@@ -0,0 +1,230 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gomanus/internal/checkpoint"
+	"gomanus/internal/policy"
+	"gomanus/internal/schema"
+	"gomanus/pkg/logger"
+)
+
+// CheckpointStateProvider 由需要在检查点中保存额外状态的步骤执行器实现
+type CheckpointStateProvider interface {
+	CheckpointState() (json.RawMessage, error)
+	RestoreCheckpointState(data json.RawMessage) error
+}
+
+// actor 由能够单独执行待完成工具调用的步骤执行器实现
+type actor interface {
+	Act(ctx context.Context) (string, error)
+}
+
+// startCheckpointing 为新的运行分配运行ID并开始保存检查点
+func (a *BaseAgent) startCheckpointing(ctx context.Context, request string, stepper Stepper) {
+	a.checkpointMu.Lock()
+	defer a.checkpointMu.Unlock()
+
+	a.RunID = checkpoint.NewRunID()
+	a.runRequest = request
+	a.runMode = policy.ScopeFromContext(ctx).Mode
+	a.completedToolCalls = make(map[string]string)
+	a.stateProvider, _ = stepper.(CheckpointStateProvider)
+	a.checkpointing = a.Checkpoints != nil
+
+	if a.checkpointing {
+		logger.Info("开始运行 %s，检查点将保存到磁盘", a.RunID)
+	}
+}
+
+// stopCheckpointing 在运行结束后停止保存检查点
+func (a *BaseAgent) stopCheckpointing() {
+	a.checkpointMu.Lock()
+	defer a.checkpointMu.Unlock()
+
+	a.checkpointing = false
+	a.stateProvider = nil
+	a.completedToolCalls = nil
+}
+
+// saveCheckpoint 保存当前运行的检查点，未启用检查点时不做任何事
+func (a *BaseAgent) saveCheckpoint(status string) {
+	a.checkpointMu.Lock()
+	defer a.checkpointMu.Unlock()
+
+	if !a.checkpointing {
+		return
+	}
+
+	messages := a.Memory.GetMessages()
+	cp := &checkpoint.Checkpoint{
+		RunID:              a.RunID,
+		Agent:              a.Name,
+		Mode:               a.runMode,
+		Request:            a.runRequest,
+		Status:             status,
+		CurrentStep:        a.CurrentStep,
+		RunStart:           a.runStart,
+		Messages:           append([]schema.Message(nil), messages...),
+		PendingToolCalls:   pendingToolCalls(messages),
+		CompletedToolCalls: make(map[string]string, len(a.completedToolCalls)),
+	}
+	for id, content := range a.completedToolCalls {
+		cp.CompletedToolCalls[id] = content
+	}
+
+	if a.stateProvider != nil {
+		state, err := a.stateProvider.CheckpointState()
+		if err != nil {
+			logger.Warn("获取代理状态失败，检查点将不包含代理状态: %v", err)
+		} else {
+			cp.AgentState = state
+		}
+	}
+
+	if err := a.Checkpoints.Save(cp); err != nil {
+		logger.Error("保存检查点失败: %v", err)
+	}
+}
+
+// recordToolCompletion 记录已完成的工具调用并立即保存检查点，恢复时不会重复执行
+func (a *BaseAgent) recordToolCompletion(toolCallID, content string) {
+	a.checkpointMu.Lock()
+	if !a.checkpointing {
+		a.checkpointMu.Unlock()
+		return
+	}
+	a.completedToolCalls[toolCallID] = content
+	a.checkpointMu.Unlock()
+
+	a.saveCheckpoint(checkpoint.StatusRunning)
+}
+
+// completedToolResult 返回恢复的运行中已经完成的工具调用结果
+func (a *BaseAgent) completedToolResult(toolCallID string) (string, bool) {
+	a.checkpointMu.Lock()
+	defer a.checkpointMu.Unlock()
+
+	content, ok := a.completedToolCalls[toolCallID]
+	return content, ok
+}
+
+// clearCompletedToolCalls 在工具结果写入记忆后清除已完成调用的记录
+func (a *BaseAgent) clearCompletedToolCalls() {
+	a.checkpointMu.Lock()
+	defer a.checkpointMu.Unlock()
+
+	if a.completedToolCalls != nil {
+		a.completedToolCalls = make(map[string]string)
+	}
+}
+
+// ResumeWithStepper 从检查点恢复运行，已完成的工具调用不会被重新执行
+func (a *BaseAgent) ResumeWithStepper(ctx context.Context, cp *checkpoint.Checkpoint, stepper Stepper) (*RunResult, error) {
+	if !cp.Resumable() {
+		return nil, fmt.Errorf("运行 %s 的状态为 %s，无法恢复", cp.RunID, cp.Status)
+	}
+	if cp.Agent != a.Name {
+		return nil, fmt.Errorf("运行 %s 属于代理 %s，而不是 %s", cp.RunID, cp.Agent, a.Name)
+	}
+
+	if err := a.beginRun(); err != nil {
+		return nil, err
+	}
+	defer a.endRun()
+
+	// 恢复记忆和步骤
+	a.Memory = &schema.Memory{Messages: append([]schema.Message(nil), cp.Messages...)}
+	a.CurrentStep = cp.CurrentStep
+	a.runStart = cp.RunStart
+
+	a.checkpointMu.Lock()
+	a.RunID = cp.RunID
+	a.runRequest = cp.Request
+	a.runMode = cp.Mode
+	a.completedToolCalls = make(map[string]string, len(cp.CompletedToolCalls))
+	for id, content := range cp.CompletedToolCalls {
+		a.completedToolCalls[id] = content
+	}
+	a.stateProvider, _ = stepper.(CheckpointStateProvider)
+	a.checkpointing = a.Checkpoints != nil
+	a.checkpointMu.Unlock()
+
+	// 恢复代理特有的状态
+	if provider, ok := stepper.(CheckpointStateProvider); ok && len(cp.AgentState) > 0 {
+		if err := provider.RestoreCheckpointState(cp.AgentState); err != nil {
+			return a.finishRun(stepper, RunStatusFailure, ""), fmt.Errorf("恢复代理状态失败: %w", err)
+		}
+	}
+
+	if cp.Mode != "" {
+		ctx = policy.WithMode(ctx, cp.Mode)
+	}
+	logger.Info("从第 %d 步恢复运行 %s", cp.CurrentStep, cp.RunID)
+
+	// 先完成中断时尚未完成的工具调用
+	if len(cp.PendingToolCalls) > 0 {
+		if act, ok := stepper.(actor); ok {
+			logger.Info("继续执行 %d 个未完成的工具调用", len(cp.PendingToolCalls))
+			actBegan := time.Now()
+			output, err := act.Act(ctx)
+			if err != nil {
+				a.recordStep(cp.CurrentStep, "", time.Since(actBegan), err.Error())
+				a.SetState(StateError)
+				a.saveCheckpoint(checkpoint.StatusError)
+				return a.finishRun(stepper, RunStatusFailure, ""), fmt.Errorf("恢复未完成的工具调用失败: %w", err)
+			}
+			a.recordStep(cp.CurrentStep, output, time.Since(actBegan), "完成中断前未完成的工具调用")
+			a.saveCheckpoint(checkpoint.StatusRunning)
+		}
+	}
+
+	if a.GetState() == StateFinished {
+		a.saveCheckpoint(checkpoint.StatusFinished)
+		return a.finishRun(stepper, RunStatusSuccess, ""), nil
+	}
+
+	// 工具结果之后再提示继续，避免打断工具调用与结果的顺序
+	if cp.Status == checkpoint.StatusInterrupted {
+		a.AddMessage(schema.NewSystemMessage("用户要求继续执行之前被中断的任务。"))
+	}
+	return a.runSteps(ctx, stepper)
+}
+
+// pendingToolCalls 返回最后一条助手消息中尚未得到结果的工具调用
+func pendingToolCalls(messages []schema.Message) []schema.ToolCall {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role != "assistant" || len(messages[i].ToolCalls) == 0 {
+			continue
+		}
+
+		done := make(map[string]bool)
+		for _, msg := range messages[i+1:] {
+			if msg.Role == "tool" && msg.Content != "" {
+				done[msg.ToolCallID] = true
+			}
+		}
+
+		var pending []schema.ToolCall
+		for _, tc := range messages[i].ToolCalls {
+			if !done[tc.ID] {
+				pending = append(pending, tc)
+			}
+		}
+		return pending
+	}
+	return nil
+}
+
+// lastAssistantContent 返回最后一条非空助手消息的内容
+func lastAssistantContent(messages []schema.Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "assistant" && messages[i].Content != "" {
+			return messages[i].Content
+		}
+	}
+	return ""
+}
@@ -22,7 +22,7 @@ const (
 // ClassifierAgent 用于分类用户输入的代理
 type ClassifierAgent struct {
 	*BaseAgent
-	SystemPrompt string
+	SystemPrompt string // 固定的系统提示，为空时每次分类都渲染classifier模板
 }
 
 // NewClassifierAgent 创建新的分类代理
@@ -37,37 +37,13 @@ func NewClassifierAgent(name string, llm *llm.LLM) *ClassifierAgent {
 		CurrentStep: 0,
 	}
 
-	systemPrompt := `你是一个智能输入分类器，需要判断用户输入属于以下哪种类型：
-
-1. **chat（聊天）**：
-   - 日常对话、问候、闲聊
-   - 询问信息、知识问答
-   - 情感表达、观点讨论
-   - 不需要执行具体任务的交流
-   - 例如："你好"、"今天天气怎么样？"、"什么是人工智能？"
-
-2. **task（任务）**：
-   - 需要执行具体操作的请求
-   - 文件操作、搜索、计算等
-   - 明确的行动指令
-   - 例如："帮我搜索关于机器学习的资料"、"保存这个文件"、"计算一下这个数据"
-
-3. **plan（计划）**：
-   - 复杂的多步骤任务
-   - 需要制定详细计划的项目
-   - 包含"计划"、"规划"、"方案"等关键词
-   - 例如："制定一个学习计划"、"规划项目开发流程"、"plan:制定营销策略"
-
-请仔细分析用户输入，只返回以下三个词之一：chat、task、plan
-不要返回任何其他内容，不要解释原因。`
-
 	return &ClassifierAgent{
-		BaseAgent:    baseAgent,
-		SystemPrompt: systemPrompt,
+		BaseAgent: baseAgent,
 	}
 }
 
 // ClassifyInput 分类用户输入
+// 每次分类使用独立的消息列表，可以被多个会话同时调用
 func (a *ClassifierAgent) ClassifyInput(ctx context.Context, input string) (InputType, error) {
 	logger.Info("开始分类用户输入: %s", input)
 
@@ -76,17 +52,13 @@ func (a *ClassifierAgent) ClassifyInput(ctx context.Context, input string) (Inpu
 		return "", ctx.Err()
 	}
 
-	// 清空记忆，确保每次分类都是独立的
-	a.Memory = schema.NewMemory()
-
-	// 添加系统提示
-	a.AddMessage(schema.NewSystemMessage(a.SystemPrompt))
-
-	// 添加用户输入
-	a.AddMessage(schema.NewUserMessage(input))
+	// 每次分类只包含系统提示和用户输入
+	messages := []schema.Message{
+		schema.NewSystemMessage(a.systemPrompt()),
+		schema.NewUserMessage(input),
+	}
 
 	// 向LLM发送请求
-	messages := a.Memory.GetMessages()
 	response, err := a.LLM.AskWithOptions(ctx, messages, nil, nil, nil)
 	if err != nil {
 		return "", fmt.Errorf("LLM分类失败: %w", err)
@@ -111,6 +83,14 @@ func (a *ClassifierAgent) ClassifyInput(ctx context.Context, input string) (Inpu
 	}
 }
 
+// systemPrompt 返回本次分类使用的系统提示
+func (a *ClassifierAgent) systemPrompt() string {
+	if a.SystemPrompt != "" {
+		return a.SystemPrompt
+	}
+	return renderPrompt(promptData(a.Name, nil), "classifier")
+}
+
 // fallbackClassify 备用分类逻辑
 func (a *ClassifierAgent) fallbackClassify(input string) InputType {
 	inputLower := strings.ToLower(input)
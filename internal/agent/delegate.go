@@ -0,0 +1,228 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gomanus/internal/config"
+	"gomanus/internal/llm"
+	"gomanus/internal/schema"
+	"gomanus/internal/tool"
+	"gomanus/pkg/logger"
+)
+
+// 未配置时委托子任务的默认限制
+const (
+	defaultDelegationMaxDepth      = 2
+	defaultDelegationMaxConcurrent = 2
+	defaultDelegationMaxIterations = 15
+	defaultDelegationTimeout       = 600 * time.Second
+)
+
+// delegationDepthKey 是上下文中记录当前委托嵌套深度的键
+type delegationDepthKey struct{}
+
+// withDelegationDepth 返回记录了委托嵌套深度的上下文
+func withDelegationDepth(ctx context.Context, depth int) context.Context {
+	return context.WithValue(ctx, delegationDepthKey{}, depth)
+}
+
+// delegationDepth 返回上下文中的委托嵌套深度，顶层代理为0
+func delegationDepth(ctx context.Context) int {
+	depth, _ := ctx.Value(delegationDepthKey{}).(int)
+	return depth
+}
+
+// delegationSlots 是子代理的并发名额，每一层嵌套深度有独立的名额
+// 子代理再委托时使用下一层的名额，不会等待祖先代理占用的名额而死锁
+type delegationSlots struct {
+	limit int
+	mu    sync.Mutex
+	pools map[int]chan struct{}
+}
+
+// pool 返回从指定深度发起委托时使用的名额
+func (s *delegationSlots) pool(depth int) chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pools == nil {
+		s.pools = make(map[int]chan struct{})
+	}
+	pool, ok := s.pools[depth]
+	if !ok {
+		pool = make(chan struct{}, s.limit)
+		s.pools[depth] = pool
+	}
+	return pool
+}
+
+// DelegateTool 把独立的子任务交给一个新的子代理执行，只把子代理的最终回答返回给调用者
+// 子代理有自己的记忆和预算，可以只使用部分工具，用于在大型任务中保持主代理的上下文简短
+type DelegateTool struct {
+	*tool.BaseTool
+	llm        *llm.LLM
+	tools      *tool.ToolCollection
+	parameters map[string]interface{}
+	MaxDepth   int        // 委托的最大嵌套深度，1表示子代理不能再委托
+	Budget     StepBudget // 每个子代理的预算
+	slots      *delegationSlots
+	count      int64
+}
+
+// NewDelegateTool 创建委托工具，子代理从tools中选择可用的工具
+func NewDelegateTool(llmInstance *llm.LLM, tools *tool.ToolCollection) *DelegateTool {
+	description := "把一个独立、边界清晰的子任务委托给新的子代理执行。子代理拥有独立的上下文，只返回最终结果。" +
+		"适合需要大量搜索、阅读或修改文件的子任务，可以避免中间过程占用当前上下文。" +
+		"子代理看不到当前对话，请在task和context中写清楚完成子任务所需的全部信息。"
+
+	maxDepth := defaultDelegationMaxDepth
+	maxConcurrent := defaultDelegationMaxConcurrent
+	budget := StepBudget{MaxIterations: defaultDelegationMaxIterations, Timeout: defaultDelegationTimeout}
+	if delegationCfg, err := config.GetDelegationConfig(); err != nil {
+		logger.Warn("获取委托配置失败，使用默认值: %v", err)
+	} else {
+		if delegationCfg.MaxDepth > 0 {
+			maxDepth = delegationCfg.MaxDepth
+		}
+		if delegationCfg.MaxConcurrent > 0 {
+			maxConcurrent = delegationCfg.MaxConcurrent
+		}
+		if delegationCfg.MaxIterations > 0 {
+			budget.MaxIterations = delegationCfg.MaxIterations
+		}
+		if delegationCfg.Timeout > 0 {
+			budget.Timeout = time.Duration(delegationCfg.Timeout) * time.Second
+		}
+		budget.MaxTokens = delegationCfg.MaxTokens
+	}
+
+	parameters := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"task": map[string]interface{}{
+				"type":        "string",
+				"description": "子任务的完整描述，包括期望返回的结果",
+			},
+			"context": map[string]interface{}{
+				"type":        "string",
+				"description": "(可选) 完成子任务需要的背景信息，例如已知的事实、文件路径或约束",
+			},
+			"tools": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "(可选) 子代理可以使用的工具名称，留空则可以使用全部工具",
+			},
+		},
+		"required": []string{"task"},
+	}
+
+	return &DelegateTool{
+		BaseTool:   tool.NewBaseTool("delegate_task", description),
+		llm:        llmInstance,
+		tools:      tools,
+		parameters: parameters,
+		MaxDepth:   maxDepth,
+		Budget:     budget,
+		slots:      &delegationSlots{limit: maxConcurrent},
+	}
+}
+
+// DelegateToolFactory 是delegate_task在工具注册表中的工厂，子任务的限制在 [delegation] 中配置
+func DelegateToolFactory(deps tool.Dependencies, settings tool.Settings) (tool.Tool, error) {
+	if err := settings.Decode(&struct{}{}); err != nil {
+		return nil, err
+	}
+	return NewDelegateTool(deps.LLM, deps.Tools), nil
+}
+
+// Parameters 返回工具参数定义
+func (t *DelegateTool) Parameters() map[string]interface{} {
+	return t.parameters
+}
+
+// ForSession 返回从会话的工具集合中选择工具的委托工具，所有会话共享并发名额
+func (t *DelegateTool) ForSession(tools *tool.ToolCollection) tool.Tool {
+	return &DelegateTool{
+		BaseTool:   t.BaseTool,
+		llm:        t.llm,
+		tools:      tools,
+		parameters: t.parameters,
+		MaxDepth:   t.MaxDepth,
+		Budget:     t.Budget,
+		slots:      t.slots,
+	}
+}
+
+// Execute 创建子代理执行子任务，同一层同时运行的子代理数量受并发上限限制
+func (t *DelegateTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	task, ok := params["task"].(string)
+	if !ok || strings.TrimSpace(task) == "" {
+		return nil, fmt.Errorf("无效的任务参数")
+	}
+	background, _ := params["context"].(string)
+
+	depth := delegationDepth(ctx)
+	if depth >= t.MaxDepth {
+		return nil, fmt.Errorf("已达到委托的最大嵌套深度 (%d)，请直接完成此任务", t.MaxDepth)
+	}
+
+	var requested []string
+	if names, ok := params["tools"].([]interface{}); ok {
+		for _, name := range names {
+			if s, ok := name.(string); ok && s != "" {
+				requested = append(requested, s)
+			}
+		}
+	}
+	subTools := t.subagentTools(requested, depth+1 < t.MaxDepth)
+	if subTools.Count() == 0 {
+		return nil, fmt.Errorf("指定的工具均不可用: %s", strings.Join(requested, ", "))
+	}
+
+	// 等待当前深度空闲的并发名额
+	slots := t.slots.pool(depth)
+	select {
+	case slots <- struct{}{}:
+		defer func() { <-slots }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	name := fmt.Sprintf("subagent_%d", atomic.AddInt64(&t.count, 1))
+	subagent := NewToolCallAgent(name, t.llm, subTools)
+	subagent.SystemPrompt = renderPrompt(promptData(name, subTools), "subagent")
+
+	prompt := "子任务:\n" + task
+	if background != "" {
+		prompt += "\n\n背景信息:\n" + background
+	}
+	subagent.AddMessage(schema.NewUserMessage(prompt))
+
+	logger.Info("委托子任务给 %s (深度 %d): %s", name, depth+1, task)
+	summary, err := runStepLoop(withDelegationDepth(ctx, depth+1), subagent, t.Budget)
+	if err != nil {
+		return nil, fmt.Errorf("子任务执行失败: %w", err)
+	}
+	logger.Info("%s 完成子任务", name)
+
+	return fmt.Sprintf("子任务结果:\n%s", summary), nil
+}
+
+// subagentTools 返回子代理可以使用的工具，子代理不使用规划工具，达到深度上限时也不能再委托
+func (t *DelegateTool) subagentTools(requested []string, allowDelegate bool) *tool.ToolCollection {
+	var allow []string
+	if len(requested) > 0 {
+		// 子代理需要terminate结束执行
+		allow = append(requested, "terminate")
+	}
+
+	deny := []string{"planning"}
+	if !allowDelegate {
+		deny = append(deny, t.Name())
+	}
+	return t.tools.View(tool.ViewOptions{Allow: allow, Deny: deny})
+}
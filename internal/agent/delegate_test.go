@@ -0,0 +1,94 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"gomanus/internal/config"
+	"gomanus/internal/llm"
+	"gomanus/internal/policy"
+	"gomanus/internal/schema"
+	"gomanus/internal/tool"
+)
+
+// probeTool 记录被执行的次数
+type probeTool struct {
+	*tool.BaseTool
+	calls atomic.Int32
+}
+
+func (p *probeTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	p.calls.Add(1)
+	return "ok", nil
+}
+
+// delegateStub 让主代理把调用probe的子任务委托给子代理，子代理和主代理看到工具结果后调用terminate
+func delegateStub(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Messages []stubMessage `json:"messages"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	subagent := false
+	for _, message := range body.Messages {
+		if message.Role == "user" && strings.HasPrefix(message.Content, "子任务") {
+			subagent = true
+		}
+	}
+	name, args := "terminate", map[string]interface{}{"status": "success", "message": "完成"}
+	if body.Messages[len(body.Messages)-1].Role == "user" {
+		if subagent {
+			name, args = "probe", map[string]interface{}{}
+		} else {
+			name, args = "delegate_task", map[string]interface{}{"task": "调用probe"}
+		}
+	}
+	arguments, _ := json.Marshal(args)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"choices": []interface{}{map[string]interface{}{
+			"message": map[string]interface{}{
+				"content": "",
+				"tool_calls": []interface{}{map[string]interface{}{
+					"id":       "call_" + name,
+					"type":     "function",
+					"function": map[string]interface{}{"name": name, "arguments": string(arguments)},
+				}},
+			},
+		}},
+	})
+}
+
+func TestDelegatedTaskKeepsAgentPolicy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(delegateStub))
+	defer server.Close()
+	model := &llm.LLM{Model: "stub", BaseURL: server.URL + "/", APIType: "openai", Client: server.Client()}
+
+	engine, err := policy.NewEngine(&config.PolicyConfig{Enabled: true, Rules: []config.PolicyRule{
+		{Name: "manus_no_probe", Tool: "probe", Effect: "deny", Agents: []string{"Manus"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	probe := &probeTool{BaseTool: tool.NewBaseTool("probe", "测试工具")}
+	tools := tool.NewToolCollection()
+	tools.SetPolicy(engine)
+	for _, tl := range []tool.Tool{probe, tool.NewTerminate(), NewDelegateTool(model, tools)} {
+		if err := tools.AddTool(tl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manus := NewToolCallAgent("Manus", model, tools)
+	manus.AddMessage(schema.NewUserMessage("任务"))
+	if _, err := runStepLoop(context.Background(), manus, StepBudget{MaxIterations: 5}); err != nil {
+		t.Fatalf("运行失败: %v", err)
+	}
+	if n := probe.calls.Load(); n != 0 {
+		t.Errorf("子代理执行了被Manus的规则拒绝的工具 %d 次", n)
+	}
+}
@@ -0,0 +1,167 @@
+package agent
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gomanus/internal/config"
+	"gomanus/internal/llm"
+	"gomanus/internal/tool"
+	"gomanus/pkg/logger"
+)
+
+// ExecutorProfile 描述执行某一类计划步骤的专用执行器
+type ExecutorProfile struct {
+	Name         string   // 执行器名称，同时也是对应的步骤类型
+	Description  string   // 在规划提示中展示的说明
+	SystemPrompt string   // 执行器的系统提示，为空时使用executor_<名称>模板，没有该模板时使用executor模板
+	Tools        []string // 执行器可以使用的工具
+	Model        string   // 使用的模型（llm_types中的名称），为空则使用规划代理的模型
+	StepTypes    []string // 映射到此执行器的其他步骤类型
+}
+
+// builtinExecutorProfiles 是内置的执行器配置，配置文件中的同名执行器会覆盖其中的字段
+// 内置执行器的系统提示是 executor_<名称> 模板
+var builtinExecutorProfiles = map[string]ExecutorProfile{
+	"research": {
+		Name:        "research",
+		Description: "信息检索，搜索网络、百科和网页以收集资料",
+		Tools:       []string{"google_search", "zhihu_search", "baidu_baike_search", "wikipedia_search", "browser_use", "terminate"},
+		StepTypes:   []string{"search", "browse"},
+	},
+	"code": {
+		Name:        "code",
+		Description: "编写、运行和调试代码",
+		Tools:       []string{"file_operator", "terminal_executor", "terminate"},
+		StepTypes:   []string{"coding"},
+	},
+	"file": {
+		Name:        "file",
+		Description: "读取、整理和保存文件",
+		Tools:       []string{"file_operator", "terminate"},
+		StepTypes:   []string{"write", "read"},
+	},
+	"shell": {
+		Name:        "shell",
+		Description: "执行终端命令，例如安装依赖、查看系统信息",
+		Tools:       []string{"terminal_executor", "terminate"},
+		StepTypes:   []string{"terminal", "command"},
+	},
+}
+
+// LoadExecutorProfiles 合并内置执行器和配置文件中的执行器配置
+// 未配置任何执行器时启用全部内置执行器，否则只启用配置中enabled为true的执行器
+func LoadExecutorProfiles() []ExecutorProfile {
+	executorsCfg, err := config.GetExecutorsConfig()
+	if err != nil {
+		logger.Warn("获取执行器配置失败，使用内置执行器: %v", err)
+	}
+
+	var profiles []ExecutorProfile
+	if len(executorsCfg) == 0 {
+		for _, profile := range builtinExecutorProfiles {
+			profiles = append(profiles, profile)
+		}
+	} else {
+		for name, cfg := range executorsCfg {
+			if !cfg.Enabled {
+				continue
+			}
+
+			profile := builtinExecutorProfiles[name]
+			profile.Name = name
+			if cfg.Description != "" {
+				profile.Description = cfg.Description
+			}
+			if cfg.SystemPrompt != "" {
+				profile.SystemPrompt = cfg.SystemPrompt
+			}
+			if len(cfg.Tools) > 0 {
+				profile.Tools = cfg.Tools
+			}
+			if cfg.Model != "" {
+				profile.Model = cfg.Model
+			}
+			if len(cfg.StepTypes) > 0 {
+				profile.StepTypes = cfg.StepTypes
+			}
+			profiles = append(profiles, profile)
+		}
+	}
+
+	// 按名称排序，保证规划提示中的顺序稳定
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].Name < profiles[j].Name
+	})
+	return profiles
+}
+
+// NewExecutorAgent 根据执行器配置创建执行器代理，只能使用配置中列出的工具
+func NewExecutorAgent(profile ExecutorProfile, defaultLLM *llm.LLM, tools *tool.ToolCollection) (*ToolCallAgent, error) {
+	if len(profile.Tools) == 0 {
+		return nil, fmt.Errorf("执行器 %s 没有配置可用的工具", profile.Name)
+	}
+
+	subset := tools.Subset(profile.Tools)
+	if subset.Count() == 0 {
+		return nil, fmt.Errorf("执行器 %s 配置的工具均未启用: %s", profile.Name, strings.Join(profile.Tools, ", "))
+	}
+
+	executorLLM := defaultLLM
+	if profile.Model != "" {
+		var err error
+		executorLLM, err = llm.NewLLM(profile.Model)
+		if err != nil {
+			return nil, fmt.Errorf("创建执行器 %s 的模型失败: %w", profile.Name, err)
+		}
+	}
+
+	executor := NewToolCallAgent(profile.Name+"_executor", executorLLM, subset)
+	executor.Description = profile.Description
+	if profile.SystemPrompt != "" {
+		executor.SystemPrompt = profile.SystemPrompt
+	} else {
+		executor.promptTemplate = templatePrompt(executor.Name, subset, "executor_"+profile.Name, "executor")
+		executor.refreshSystemPrompt()
+	}
+	return executor, nil
+}
+
+// RegisterExecutorProfiles 根据执行器配置创建并注册执行器，创建失败的执行器会被跳过
+func (a *PlanningAgent) RegisterExecutorProfiles(profiles []ExecutorProfile, tools *tool.ToolCollection) {
+	for _, profile := range profiles {
+		executor, err := NewExecutorAgent(profile, a.LLM, tools)
+		if err != nil {
+			logger.Warn("跳过执行器 %s: %v", profile.Name, err)
+			continue
+		}
+
+		a.AddExecutor(profile.Name, executor)
+		for _, stepType := range profile.StepTypes {
+			a.AddExecutor(strings.ToLower(stepType), executor)
+		}
+		a.ExecutorProfiles = append(a.ExecutorProfiles, profile)
+		logger.Info("注册执行器 %s，可用工具 %d 个", profile.Name, executor.Tools.Count())
+	}
+}
+
+// stepTypesPrompt 生成规划提示中可用步骤类型的说明
+func (a *PlanningAgent) stepTypesPrompt() string {
+	if len(a.ExecutorProfiles) == 0 {
+		return "如果步骤涉及特定类型的操作，请使用方括号标记，例如[SEARCH]表示搜索操作，" +
+			"[CODE]表示编码操作。这将帮助系统选择合适的工具来执行该步骤。"
+	}
+
+	var sb strings.Builder
+	sb.WriteString("请在每个步骤开头使用方括号标记步骤类型，系统会根据类型选择专用的执行器。可用的步骤类型：\n")
+	for _, profile := range a.ExecutorProfiles {
+		tags := []string{"[" + strings.ToUpper(profile.Name) + "]"}
+		for _, stepType := range profile.StepTypes {
+			tags = append(tags, "["+strings.ToUpper(stepType)+"]")
+		}
+		sb.WriteString(fmt.Sprintf("- %s: %s\n", strings.Join(tags, "/"), profile.Description))
+	}
+	sb.WriteString("不属于以上类型的步骤可以不加标记，将由通用执行器执行。")
+	return sb.String()
+}
@@ -0,0 +1,41 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	"gomanus/internal/tool"
+)
+
+func TestNewExecutorAgentSystemPrompt(t *testing.T) {
+	tools := tool.NewToolCollection()
+	for _, tl := range []tool.Tool{tool.NewFileOperator(), tool.NewTerminate()} {
+		if err := tools.AddTool(tl); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		profile ExecutorProfile
+		want    string
+	}{
+		{"内置执行器使用同名模板", builtinExecutorProfiles["file"], "文件处理助手"},
+		{"配置的系统提示优先", ExecutorProfile{Name: "file", SystemPrompt: "只整理文件", Tools: []string{"file_operator"}}, "只整理文件"},
+		{"没有同名模板时使用通用模板", ExecutorProfile{Name: "translate", Tools: []string{"file_operator"}}, "任务执行助手"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor, err := NewExecutorAgent(tt.profile, nil, tools)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(executor.SystemPrompt, tt.want) {
+				t.Errorf("系统提示为 %q，期望包含 %q", executor.SystemPrompt, tt.want)
+			}
+			if clone := executor.Clone(); clone.SystemPrompt != executor.SystemPrompt {
+				t.Errorf("复制的执行器的系统提示为 %q，期望 %q", clone.SystemPrompt, executor.SystemPrompt)
+			}
+		})
+	}
+}
@@ -0,0 +1,335 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gomanus/internal/config"
+	"gomanus/internal/llm"
+	"gomanus/internal/schema"
+	"gomanus/pkg/logger"
+)
+
+// LoopKind 表示检测到的循环类型
+type LoopKind string
+
+const (
+	LoopNone             LoopKind = ""
+	LoopRepeatedAnswer   LoopKind = "repeated_answer"    // 重复给出相同的文字回答
+	LoopRepeatedToolCall LoopKind = "repeated_tool_call" // 重复发起相同参数的工具调用
+	LoopOscillation      LoopKind = "oscillation"        // 在两种动作之间来回切换
+	LoopNoProgress       LoopKind = "no_progress"        // 连续多步没有产生新信息
+)
+
+// LoopSignal 表示一次循环检测的结果
+type LoopSignal struct {
+	Kind   LoopKind
+	Detail string
+}
+
+// 循环恢复的级别，每次检测到循环后逐级升级
+const (
+	recoveryHint = iota + 1
+	recoveryForceToolChoice
+	recoveryEscalateModel
+	recoveryTerminate
+)
+
+// LoopDetector 根据代理的历史动作检测循环
+type LoopDetector struct {
+	RepeatThreshold     int // 相同签名连续出现的次数阈值
+	OscillationCycles   int // A/B交替出现的周期数阈值
+	NoProgressThreshold int // 连续无进展的步数阈值
+}
+
+// NewLoopDetector 根据运行时配置创建循环检测器
+func NewLoopDetector() *LoopDetector {
+	detector := &LoopDetector{
+		RepeatThreshold:     3,
+		OscillationCycles:   2,
+		NoProgressThreshold: 5,
+	}
+
+	runtimeCfg, err := config.GetRuntimeConfig()
+	if err != nil {
+		return detector
+	}
+	if runtimeCfg.LoopRepeatThreshold > 1 {
+		detector.RepeatThreshold = runtimeCfg.LoopRepeatThreshold
+	}
+	if runtimeCfg.LoopNoProgressThreshold > 1 {
+		detector.NoProgressThreshold = runtimeCfg.LoopNoProgressThreshold
+	}
+	return detector
+}
+
+// loopAction 表示一次助手响应及其产生的工具结果
+type loopAction struct {
+	Signature string
+	HasTools  bool
+	Content   string
+	Results   []string
+}
+
+// Detect 检查消息历史中是否存在循环
+func (d *LoopDetector) Detect(messages []schema.Message) LoopSignal {
+	actions := collectActions(messages)
+	if len(actions) < 2 {
+		return LoopSignal{}
+	}
+
+	last := actions[len(actions)-1]
+
+	// 相同的文字回答出现两次，说明模型认为任务已经完成
+	if !last.HasTools && last.Content != "" {
+		for i := len(actions) - 2; i >= 0; i-- {
+			if !actions[i].HasTools && actions[i].Content == last.Content {
+				return LoopSignal{Kind: LoopRepeatedAnswer, Detail: "重复给出了相同的回答"}
+			}
+		}
+	}
+
+	// 相同的工具调用签名连续出现
+	if last.HasTools && len(actions) >= d.RepeatThreshold {
+		repeated := true
+		for _, action := range actions[len(actions)-d.RepeatThreshold:] {
+			if action.Signature != last.Signature {
+				repeated = false
+				break
+			}
+		}
+		if repeated {
+			return LoopSignal{
+				Kind:   LoopRepeatedToolCall,
+				Detail: fmt.Sprintf("连续 %d 次发起相同的工具调用: %s", d.RepeatThreshold, last.Signature),
+			}
+		}
+	}
+
+	// A/B交替出现
+	window := d.OscillationCycles * 2
+	if len(actions) >= window {
+		recent := actions[len(actions)-window:]
+		a, b := recent[0].Signature, recent[1].Signature
+		oscillating := a != b
+		for i, action := range recent {
+			expected := a
+			if i%2 == 1 {
+				expected = b
+			}
+			if action.Signature != expected {
+				oscillating = false
+				break
+			}
+		}
+		if oscillating {
+			return LoopSignal{
+				Kind:   LoopOscillation,
+				Detail: fmt.Sprintf("在两种动作之间来回切换: %s 与 %s", a, b),
+			}
+		}
+	}
+
+	// 连续多步没有产生新信息
+	if streak := noProgressStreak(actions); streak >= d.NoProgressThreshold {
+		return LoopSignal{
+			Kind:   LoopNoProgress,
+			Detail: fmt.Sprintf("连续 %d 步没有产生新的信息", streak),
+		}
+	}
+
+	return LoopSignal{}
+}
+
+// collectActions 从消息历史中提取助手的动作序列
+func collectActions(messages []schema.Message) []loopAction {
+	var actions []loopAction
+	index := make(map[string]int) // 工具调用ID -> 动作下标
+
+	for _, msg := range messages {
+		switch msg.Role {
+		case "assistant":
+			action := loopAction{
+				Content:  strings.TrimSpace(msg.Content),
+				HasTools: len(msg.ToolCalls) > 0,
+			}
+			if action.HasTools {
+				action.Signature = toolCallSignature(msg.ToolCalls)
+				for _, tc := range msg.ToolCalls {
+					index[tc.ID] = len(actions)
+				}
+			} else {
+				action.Signature = "text:" + action.Content
+			}
+			actions = append(actions, action)
+		case "tool":
+			// 忽略占位的空工具消息
+			if msg.Content == "" {
+				continue
+			}
+			if i, ok := index[msg.ToolCallID]; ok {
+				actions[i].Results = append(actions[i].Results, msg.Content)
+			}
+		}
+	}
+
+	return actions
+}
+
+// noProgressStreak 统计末尾连续没有产生新信息的动作数量
+func noProgressStreak(actions []loopAction) int {
+	seen := make(map[string]bool)
+	progress := make([]bool, len(actions))
+
+	for i, action := range actions {
+		for _, result := range action.Results {
+			if !seen[result] && !isFailureResult(result) {
+				progress[i] = true
+			}
+			seen[result] = true
+		}
+		if !action.HasTools && action.Content != "" && !seen["text:"+action.Content] {
+			progress[i] = true
+			seen["text:"+action.Content] = true
+		}
+	}
+
+	streak := 0
+	for i := len(progress) - 1; i >= 0 && !progress[i]; i-- {
+		streak++
+	}
+	return streak
+}
+
+// isFailureResult 判断工具结果是否为错误信息
+func isFailureResult(result string) bool {
+	return strings.HasPrefix(result, "执行工具失败") ||
+		strings.HasPrefix(result, "找不到工具") ||
+		strings.HasPrefix(result, "解析工具参数失败") ||
+		strings.HasPrefix(result, `{"error":`)
+}
+
+// toolCallSignature 生成一组工具调用的规范化签名，参数按键排序以忽略顺序差异
+func toolCallSignature(calls []schema.ToolCall) string {
+	parts := make([]string, 0, len(calls))
+	for _, tc := range calls {
+		args := tc.Function.Arguments
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(args), &parsed); err == nil {
+			if canonical, err := json.Marshal(parsed); err == nil {
+				args = string(canonical)
+			}
+		}
+		parts = append(parts, tc.Function.Name+"("+args+")")
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ";")
+}
+
+// detectLoop 检查本次运行中是否陷入循环，没有循环时清除之前的恢复状态
+func (a *BaseAgent) detectLoop() LoopSignal {
+	if a.loopDetector == nil {
+		a.loopDetector = NewLoopDetector()
+	}
+
+	messages := a.Memory.GetMessages()
+	if a.runStart > 0 && a.runStart <= len(messages) {
+		messages = messages[a.runStart:]
+	}
+	signal := a.loopDetector.Detect(messages)
+
+	// 恢复后不再出现循环，清除恢复级别，之后再陷入循环时重新从提示开始
+	if signal.Kind == LoopNone && a.loopRecovery > 0 {
+		logger.Info("代理已摆脱循环，清除恢复级别 %d", a.loopRecovery)
+		a.loopRecovery = 0
+		a.toolChoiceOverride = ""
+	}
+	return signal
+}
+
+// handleStuckState 分级处理循环：提示、强制工具选择、升级模型，最后终止执行
+// 返回值用于记录到步骤结果中
+func (a *BaseAgent) handleStuckState(signal LoopSignal) string {
+	// 重复给出相同回答表示任务已经完成，直接结束
+	if signal.Kind == LoopRepeatedAnswer {
+		logger.Info("代理重复给出相同回答，视为任务完成")
+		a.SetState(StateFinished)
+		return ""
+	}
+
+	a.loopRecovery++
+	logger.Warn("代理检测到循环 (%s): %s，恢复级别 %d", signal.Kind, signal.Detail, a.loopRecovery)
+
+	if a.loopRecovery == recoveryEscalateModel && !a.escalateModel() {
+		a.loopRecovery = recoveryTerminate
+	}
+
+	switch a.loopRecovery {
+	case recoveryHint:
+		hint := fmt.Sprintf("检测到你可能陷入了循环：%s。请不要重复之前的动作，"+
+			"回顾已经获得的结果，换一种方法继续；如果任务已经完成或无法继续，请调用terminate工具结束。", signal.Detail)
+		a.AddMessage(schema.NewSystemMessage(hint))
+		return "检测到循环，已提示代理调整策略"
+	case recoveryForceToolChoice:
+		if signal.Kind == LoopNoProgress {
+			a.toolChoiceOverride = "required"
+		} else {
+			a.toolChoiceOverride = "none"
+		}
+		hint := fmt.Sprintf("你仍然在重复之前的动作：%s。请先总结目前已经获得的信息，并说明接下来要采取的不同动作。", signal.Detail)
+		a.AddMessage(schema.NewSystemMessage(hint))
+		return fmt.Sprintf("检测到循环，下一步强制工具选择为 %s", a.toolChoiceOverride)
+	case recoveryEscalateModel:
+		a.AddMessage(schema.NewSystemMessage("之前的尝试陷入了循环，现在由更强的模型接手。请重新审视任务并采取不同的方法。"))
+		return fmt.Sprintf("检测到循环，已升级模型为 %s", a.LLM.Model)
+	default:
+		result := fmt.Sprintf("终止: 代理陷入循环且多次恢复无效 (%s)。%s", signal.Kind, signal.Detail)
+		logger.Warn("%s", result)
+		a.AddMessage(schema.NewAssistantMessage(result))
+		a.SetState(StateFinished)
+		return result
+	}
+}
+
+// escalateModel 切换到配置的升级模型，本次运行结束后恢复
+func (a *BaseAgent) escalateModel() bool {
+	runtimeCfg, err := config.GetRuntimeConfig()
+	if err != nil || runtimeCfg.EscalationModel == "" {
+		logger.Info("未配置升级模型，跳过模型升级")
+		return false
+	}
+
+	escalated, err := llm.NewLLM(runtimeCfg.EscalationModel)
+	if err != nil {
+		logger.Error("创建升级模型失败: %v", err)
+		return false
+	}
+
+	if a.originalLLM == nil {
+		a.originalLLM = a.LLM
+	}
+	a.LLM = escalated
+	return true
+}
+
+// nextToolChoice 返回下一次请求使用的工具选择，强制设置只生效一次
+func (a *BaseAgent) nextToolChoice() string {
+	if a.toolChoiceOverride != "" {
+		choice := a.toolChoiceOverride
+		a.toolChoiceOverride = ""
+		return choice
+	}
+	return "auto"
+}
+
+// resetLoopRecovery 在运行结束时恢复模型并清除循环恢复状态
+func (a *BaseAgent) resetLoopRecovery() {
+	if a.originalLLM != nil {
+		a.LLM = a.originalLLM
+		a.originalLLM = nil
+	}
+	a.loopRecovery = 0
+	a.toolChoiceOverride = ""
+}
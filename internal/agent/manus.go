@@ -3,7 +3,9 @@ package agent
 import (
 	"context"
 	"fmt"
-	"gomanus/internal/config"
+	"strings"
+
+	"gomanus/internal/checkpoint"
 	"gomanus/internal/llm"
 	"gomanus/internal/schema"
 	"gomanus/internal/tool"
@@ -13,7 +15,7 @@ import (
 // Manus 是gomanus的主代理，继承自ToolCallAgent
 type Manus struct {
 	*ToolCallAgent
-	SystemPrompt string
+	Verifier *VerifierAgent // 验证最终回答的代理，为nil时不验证
 }
 
 // NewManus 创建新的Manus代理
@@ -21,93 +23,64 @@ func NewManus(name string, llm *llm.LLM, tools *tool.ToolCollection) *Manus {
 	toolCallAgent := NewToolCallAgent(name, llm, tools)
 	toolCallAgent.Description = "GoManus AI智能体 - gomanus的主智能体"
 
-	// 获取工具配置
-	toolsConfig, err := config.GetToolsConfig()
-	if err != nil {
-		logger.Error("获取工具配置失败: %v", err)
-		toolsConfig = &config.ToolsConfig{} // 使用默认配置
-	}
-
-	// 创建包含工具说明的系统提示
-	systemPrompt := "你是GoManus，一个强大的AI助手，能够使用各种工具帮助用户完成任务。\n\n你可以使用以下工具：\n\n"
-
-	// 动态添加启用的工具说明
-	var toolDescriptions []string
-
-	if toolsConfig.ZhihuSearch {
-		toolDescriptions = append(toolDescriptions, `zhihu_search - 执行知乎搜索并返回相关问题和回答的链接列表
-   参数:
-   - query: 搜索查询（必填）
-   - num_results: 返回结果数量（可选，默认10）
-   - search_type: 搜索类型（可选，"general"综合、"question"问题、"article"文章，默认"general"）`)
-	}
-
-	if toolsConfig.BaiduBaikeSearch {
-		toolDescriptions = append(toolDescriptions, `baidu_baike_search - 执行百度百科搜索并返回相关词条的链接和摘要
-   参数:
-   - query: 搜索查询（必填）
-   - num_results: 返回结果数量（可选，默认5）`)
-	}
-
-	if toolsConfig.FileOperator {
-		toolDescriptions = append(toolDescriptions, `file_operator - 对文件进行读取和保存操作，支持txt、md、pdf、png、jpg等格式
-   参数:
-   - operation: 操作类型（必填，"read"表示读取，"write"表示写入）
-   - file_path: 文件路径（必填）
-   - content: 要保存的内容（写入操作必填）
-   - mode: 文件打开模式（写入操作可选，"w"写入或"a"追加，默认"w"）
-   - encoding: 文件编码格式（读取操作可选，默认"utf-8"）
-   - max_size: 读取文件的最大大小（读取操作可选，默认10MB）
-   
-   注意：当读取png或jpg图像文件时，系统会自动调用视觉模型对图像内容进行分析，并返回详细的文本描述。`)
-	}
-
-	if toolsConfig.BrowserUse {
-		toolDescriptions = append(toolDescriptions, `browser_use - 与网页浏览器交互，执行各种操作
-   参数:
-   - action: 要执行的浏览器操作（必填，可选值: "navigate", "get_html", "execute_js", "new_tab", "close_tab"）
-   - url: 'navigate'或'new_tab'操作的URL
-   - script: 'execute_js'操作的JavaScript代码
-   - tab_id: 操作的标签页ID`)
-	}
-
-	if toolsConfig.Terminate {
-		toolDescriptions = append(toolDescriptions, `terminate - 终止当前执行
-   参数:
-   - status: 终止状态（必填，可选值: "success", "failure"）
-   - message: 终止消息（可选）`)
-	}
-
-	// 添加工具描述到系统提示
-	for i, desc := range toolDescriptions {
-		systemPrompt += fmt.Sprintf("%d. %s\n\n", i+1, desc)
-	}
-
-	systemPrompt += "当用户请求需要使用这些工具的任务时，请主动调用适当的工具来完成任务。每个工具都有特定的用途，请根据用户的需求选择最合适的工具。"
+	// 系统提示模板在每次运行开始时根据当前可用的工具渲染
+	toolCallAgent.promptTemplate = templatePrompt(name, tools, "manus")
 
 	return &Manus{
 		ToolCallAgent: toolCallAgent,
-		SystemPrompt:  systemPrompt,
 	}
 }
 
-// SetSystemPrompt 设置系统提示
+// SetSystemPrompt 设置固定的系统提示，不再使用提示模板
 func (a *Manus) SetSystemPrompt(prompt string) {
 	a.SystemPrompt = prompt
+	a.promptTemplate = nil
 }
 
-// Run 重写Run方法，添加系统提示并确保与AI交互
-func (a *Manus) Run(ctx context.Context, request string) (string, error) {
+// Run 重写Run方法，渲染系统提示并由执行策略驱动与AI的交互
+func (a *Manus) Run(ctx context.Context, request string) (*RunResult, error) {
 	logger.Info("GoManus代理开始运行...")
 
-	// 添加系统提示
-	if a.SystemPrompt != "" {
-		logger.Info("添加系统提示: %s", a.SystemPrompt)
-		a.AddMessage(schema.NewSystemMessage(a.SystemPrompt))
+	// 系统提示不写入记忆，由执行策略在请求时附带：原生函数调用附带SystemPrompt，文本ReAct使用自己的提示
+	a.refreshSystemPrompt()
+	logger.Info("使用系统提示: %s", a.SystemPrompt)
+
+	strategy, err := a.resolveStrategy(ctx)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("GoManus代理使用执行策略: %s", strategy.Name())
+
+	// 由执行策略驱动推理循环，传递自身作为原生的stepper
+	result, err := strategy.Execute(ctx, a.ToolCallAgent, a, request)
+	if err != nil || a.Verifier == nil || !result.Succeeded() {
+		return result, err
 	}
 
-	// 使用BaseAgent的RunWithStepper方法，传递自身作为stepper
-	return a.BaseAgent.RunWithStepper(ctx, request, a)
+	// 由验证代理检查最终回答，未通过时把意见作为新的请求继续执行
+	_, verdict, err := a.Verifier.VerifyWithRetries(ctx, request, "", result.Answer,
+		func(ctx context.Context, feedback string) (string, error) {
+			retryResult, err := strategy.Execute(ctx, a.ToolCallAgent, a, feedback)
+			result.Extend(retryResult)
+			if err != nil {
+				return "", err
+			}
+			return result.Answer, nil
+		})
+	if err != nil {
+		return result, err
+	}
+	if verdict != nil && !verdict.Pass {
+		result.Warnings = append(result.Warnings, "最终回答未通过验证: "+strings.Join(verdict.Reasons, "; "))
+	}
+	return result, nil
+}
+
+// Resume 从检查点恢复中断的运行，使用原生的函数调用循环继续执行
+func (a *Manus) Resume(ctx context.Context, cp *checkpoint.Checkpoint) (*RunResult, error) {
+	logger.Info("GoManus代理从检查点恢复运行: %s", cp.RunID)
+	a.refreshSystemPrompt()
+	return a.BaseAgent.ResumeWithStepper(ctx, cp, a)
 }
 
 // Think 重写Think方法，使用系统提示
@@ -127,10 +100,11 @@ func (a *Manus) Think(ctx context.Context) (bool, error) {
 		systemMsgs = []schema.Message{schema.NewSystemMessage(a.SystemPrompt)}
 	}
 
-	response, err := a.LLM.AskTool(ctx, messages, systemMsgs, a.Tools.GetToolDefinitions(), "auto")
+	response, err := a.LLM.AskTool(ctx, messages, systemMsgs, a.Tools.GetToolDefinitions(), a.nextToolChoice())
 	if err != nil {
 		return false, fmt.Errorf("发送消息到LLM失败: %w", err)
 	}
+	a.recordUsage(response.Usage)
 
 	// 将LLM响应添加到记忆中
 	a.AddMessage(schema.Message{
@@ -159,7 +133,7 @@ func (a *Manus) Think(ctx context.Context) (bool, error) {
 }
 
 // ProcessMessage 处理用户消息
-func (a *Manus) ProcessMessage(ctx context.Context, message string) (string, error) {
+func (a *Manus) ProcessMessage(ctx context.Context, message string) (*RunResult, error) {
 	logger.Info("处理用户消息: %s", message)
 
 	// 重置代理状态
@@ -0,0 +1,221 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"gomanus/internal/tool"
+	"gomanus/pkg/logger"
+)
+
+// defaultMaxParallelSteps 是未配置时同时执行的计划步骤的默认数量
+const defaultMaxParallelSteps = 3
+
+// planStepResult 表示一个计划步骤的执行结果
+type planStepResult struct {
+	Step   tool.PlanStep
+	Output string
+	Err    error
+}
+
+// Step 实现BaseAgent.Step接口，每一步并行执行所有依赖已经完成的计划步骤
+func (a *PlanningAgent) Step(ctx context.Context) (string, error) {
+	// 检查是否取消
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+
+	steps, err := a.PlanningTool.GetSteps(a.ActivePlanID)
+	if err != nil {
+		return "", fmt.Errorf("获取计划步骤失败: %w", err)
+	}
+
+	ready := readySteps(steps)
+	if len(ready) == 0 {
+		return a.finishPlan(ctx, steps)
+	}
+
+	ready = a.parallelBatch(ready)
+
+	// 获取计划状态，所有并行步骤使用同一份快照
+	planStatus, err := a.GetPlanText(ctx)
+	if err != nil {
+		logger.Warn("获取计划状态失败: %v", err)
+		planStatus = fmt.Sprintf("计划ID: %s", a.ActivePlanID)
+	}
+
+	// 将步骤标记为进行中
+	for _, step := range ready {
+		logger.Info("执行计划步骤 %s: %s", step.ID, step.Description)
+		if err := a.MarkStepStatus(ctx, step.Index, "in_progress", ""); err != nil {
+			logger.Warn("标记步骤为进行中失败: %v", err)
+		}
+	}
+
+	results := a.runPlanSteps(ctx, ready, planStatus)
+
+	// 只在协调者中修改计划状态，避免并发写入
+	var summaries []string
+	var issues []string // 需要重新规划处理的问题
+	for _, result := range results {
+		step := result.Step
+		switch {
+		case result.Err != nil && ctx.Err() != nil:
+			// 被取消的步骤恢复为未开始，恢复运行时重新执行
+			if err := a.MarkStepStatus(ctx, step.Index, "not_started", ""); err != nil {
+				logger.Warn("重置步骤状态失败: %v", err)
+			}
+		case result.Err != nil:
+			logger.Warn("步骤 %s 执行失败: %v", step.ID, result.Err)
+			if err := a.MarkStepStatus(ctx, step.Index, "blocked", fmt.Sprintf("错误: %v", result.Err)); err != nil {
+				logger.Warn("标记步骤为阻塞状态失败: %v", err)
+			}
+			summaries = append(summaries, fmt.Sprintf("步骤 %s 失败: %s\n%v", step.ID, step.Description, result.Err))
+			issues = append(issues, fmt.Sprintf("步骤 %s (%s) 执行失败: %v", step.ID, step.Description, result.Err))
+		default:
+			a.stepOutputs[step.ID] = result.Output
+			// 执行器的总结作为步骤备注
+			if err := a.MarkStepStatus(ctx, step.Index, "completed", result.Output); err != nil {
+				logger.Warn("标记步骤为已完成失败: %v", err)
+			}
+			summaries = append(summaries, fmt.Sprintf("步骤 %s 完成: %s\n\n%s", step.ID, step.Description, result.Output))
+			if reason := replanSignal(result.Output); reason != "" {
+				issues = append(issues, fmt.Sprintf("步骤 %s 发现了新的信息: %s", step.ID, reason))
+			}
+		}
+	}
+
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+
+	// 步骤失败或发现新信息时，在预算内重新规划剩余步骤
+	if len(issues) > 0 && a.replan(ctx, issues) {
+		summaries = append(summaries, fmt.Sprintf("计划已重新规划 (%d/%d)", a.replans, a.MaxReplans))
+	}
+
+	// 没有可以继续执行的步骤时立即完成计划
+	steps, err = a.PlanningTool.GetSteps(a.ActivePlanID)
+	if err != nil {
+		return "", fmt.Errorf("获取计划步骤失败: %w", err)
+	}
+	if len(readySteps(steps)) == 0 {
+		final, err := a.finishPlan(ctx, steps)
+		if err != nil {
+			return "", err
+		}
+		summaries = append(summaries, final)
+	}
+
+	return strings.Join(summaries, "\n\n"), nil
+}
+
+// parallelBatch 从可以执行的步骤中选出本轮并行执行的步骤，最多MaxParallelSteps个
+// 浏览器工具的标签页和Cookie在会话内共享，可以使用browser_use的步骤每轮只执行一个，其余的留到下一轮
+func (a *PlanningAgent) parallelBatch(ready []tool.PlanStep) []tool.PlanStep {
+	limit := a.MaxParallelSteps
+	if limit < 1 {
+		limit = 1
+	}
+
+	var batch []tool.PlanStep
+	browsing := false
+	for _, step := range ready {
+		if len(batch) >= limit {
+			break
+		}
+		executor := a.GetExecutor(a.ExtractStepType(step.Description))
+		if _, err := executor.Tools.GetTool("browser_use"); err == nil {
+			if browsing {
+				continue
+			}
+			browsing = true
+		}
+		batch = append(batch, step)
+	}
+	return batch
+}
+
+// runPlanSteps 并行执行一组步骤，每个步骤使用独立的执行器实例，返回的结果与步骤顺序一致
+func (a *PlanningAgent) runPlanSteps(ctx context.Context, steps []tool.PlanStep, planStatus string) []planStepResult {
+	results := make([]planStepResult, len(steps))
+	if len(steps) > 1 {
+		logger.Info("并行执行 %d 个计划步骤", len(steps))
+	}
+
+	var wg sync.WaitGroup
+	for i, step := range steps {
+		wg.Add(1)
+		go func(i int, step tool.PlanStep) {
+			defer wg.Done()
+
+			// 复制执行器，避免并行步骤共享记忆和状态
+			executor := a.GetExecutor(a.ExtractStepType(step.Description)).Clone()
+			output, err := a.ExecuteStep(ctx, executor, step, planStatus)
+			results[i] = planStepResult{Step: step, Output: output, Err: err}
+		}(i, step)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// finishPlan 在没有可执行的步骤时生成总结并结束运行，有步骤没有完成或跳过时运行以失败状态结束
+func (a *PlanningAgent) finishPlan(ctx context.Context, steps []tool.PlanStep) (string, error) {
+	var unfinished []string
+	for _, step := range steps {
+		if step.Status != "completed" && step.Status != "skipped" {
+			unfinished = append(unfinished, step.ID)
+		}
+	}
+	if len(unfinished) > 0 {
+		failure := fmt.Sprintf("计划中有 %d 个步骤无法完成: %s", len(unfinished), strings.Join(unfinished, ", "))
+		logger.Warn("%s", failure)
+		// 仍然生成总结说明已完成的部分，运行以失败状态结束
+		a.reportFailure(failure)
+	}
+
+	final, err := a.FinalizePlan(ctx)
+	if err != nil {
+		return "", fmt.Errorf("完成计划失败: %w", err)
+	}
+
+	a.summary = final
+	a.SetState(StateFinished)
+	return final, nil
+}
+
+// FinalAnswer 返回计划完成后的总结，作为运行的最终回答
+func (a *PlanningAgent) FinalAnswer() string {
+	return a.summary
+}
+
+// readySteps 返回尚未开始且依赖的步骤都已完成的步骤
+func readySteps(steps []tool.PlanStep) []tool.PlanStep {
+	status := make(map[string]string, len(steps))
+	for _, step := range steps {
+		status[step.ID] = step.Status
+	}
+
+	var ready []tool.PlanStep
+	for _, step := range steps {
+		if step.Status != "not_started" && step.Status != "in_progress" {
+			continue
+		}
+
+		// 跳过的步骤视为不再需要，不阻塞依赖它的步骤
+		satisfied := true
+		for _, dep := range step.DependsOn {
+			if status[dep] != "completed" && status[dep] != "skipped" {
+				satisfied = false
+				break
+			}
+		}
+		if satisfied {
+			ready = append(ready, step)
+		}
+	}
+	return ready
+}
@@ -0,0 +1,74 @@
+package agent
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gomanus/internal/tool"
+)
+
+func TestParallelBatchRunsOneBrowserStep(t *testing.T) {
+	tools := tool.NewToolCollection()
+	for _, tl := range []tool.Tool{tool.NewBrowserUseTool(), tool.NewFileOperator(), tool.NewTerminate()} {
+		if err := tools.AddTool(tl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	planner := NewPlanningAgent("Planner", nil, tools)
+	planner.MaxParallelSteps = 3
+	planner.AddExecutor("file", NewToolCallAgent("file_executor", nil, tools.Subset([]string{"file_operator", "terminate"})))
+
+	steps := []tool.PlanStep{
+		{ID: "s1", Description: "打开网页"},
+		{ID: "s2", Description: "[FILE] 整理文件"},
+		{ID: "s3", Description: "打开另一个网页"},
+		{ID: "s4", Description: "[FILE] 保存结果"},
+		{ID: "s5", Description: "[FILE] 保存备份"},
+	}
+	var ids []string
+	for _, step := range planner.parallelBatch(steps) {
+		ids = append(ids, step.ID)
+	}
+	if want := []string{"s1", "s2", "s4"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("本轮执行的步骤为 %v，期望 %v", ids, want)
+	}
+}
+
+func TestPlanWithBlockedStepFails(t *testing.T) {
+	model := scriptedLLM(t, func(messages []stubMessage) (string, string, map[string]interface{}) {
+		system := messages[0].Content
+		switch {
+		case strings.Contains(system, "总结助手"):
+			return "只完成了一部分", "", nil
+		case strings.Contains(system, "创建一个详细的计划"):
+			return "", "planning", map[string]interface{}{"command": "create", "title": "计划", "steps": []string{"查找资料"}}
+		default:
+			// 执行器报告无法完成步骤
+			return "", "terminate", map[string]interface{}{"status": "failure", "message": "网站无法访问"}
+		}
+	})
+	tools := tool.NewToolCollection()
+	tools.AddTool(tool.NewTerminate())
+	planner := NewPlanningAgent("Planner", model, tools)
+	planner.MaxReplans = 0
+
+	result, err := planner.Run(context.Background(), "调研")
+	if err != nil {
+		t.Fatalf("运行失败: %v", err)
+	}
+	if result.Status != RunStatusFailure {
+		t.Errorf("运行状态为 %s，期望 %s", result.Status, RunStatusFailure)
+	}
+	if !strings.Contains(result.Answer, "只完成了一部分") {
+		t.Errorf("回答为 %q，期望包含计划总结", result.Answer)
+	}
+	steps, err := planner.PlanningTool.GetSteps(planner.ActivePlanID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 1 || steps[0].Status != "blocked" {
+		t.Errorf("步骤为 %+v，期望被阻塞", steps)
+	}
+}
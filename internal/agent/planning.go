@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"gomanus/internal/checkpoint"
+	"gomanus/internal/config"
 	"gomanus/internal/llm"
 	"gomanus/internal/schema"
 	"gomanus/internal/tool"
@@ -19,34 +21,61 @@ type PlanningAgent struct {
 	*ToolCallAgent
 	PlanningTool   *tool.PlanningTool
 	ExecutorAgents map[string]*ToolCallAgent
+	ExecutorProfiles []ExecutorProfile // 已注册的专用执行器，用于生成规划提示
 	ActivePlanID   string
-	CurrentStep    int
-	MaxSteps       int
+	MaxParallelSteps int               // 同时执行的无依赖步骤的最大数量
+	MaxReplans     int               // 每次运行中重新规划的最大次数
+	replans        int               // 本次运行中已经重新规划的次数
+	stepOutputs    map[string]string // 步骤ID -> 执行结果，传递给下游步骤
+	Verifier       *VerifierAgent    // 验证步骤结果的代理，为nil时不验证
+	StepBudget     StepBudget        // 执行单个步骤的预算
+	PlannerTemplate string           // 创建计划时使用的提示模板，为空则使用内置的planner模板
+	summary        string            // 计划完成后的总结，作为运行的最终回答
 }
 
 // NewPlanningAgent 创建新的规划代理
+// 规划工具只添加到规划代理自己的工具视图中，不修改传入的集合
 func NewPlanningAgent(name string, llm *llm.LLM, tools *tool.ToolCollection) *PlanningAgent {
-	toolCallAgent := NewToolCallAgent(name, llm, tools)
-	toolCallAgent.Description = "规划代理 - 用于任务规划和执行"
-
 	// 创建规划工具
 	planningTool := tool.NewPlanningTool()
-	
-	// 将规划工具添加到工具集合中
-	if err := tools.AddTool(planningTool); err != nil {
-		logger.Error("添加规划工具失败: %v", err)
-	}
+	tools = tools.View(tool.ViewOptions{Extra: []tool.Tool{planningTool}})
+
+	toolCallAgent := NewToolCallAgent(name, llm, tools)
+	toolCallAgent.Description = "规划代理 - 用于任务规划和执行"
+	toolCallAgent.Strategy = planExecuteStrategy{}
 
 	// 生成基于纳秒时间戳的唯一计划ID
 	activePlanID := fmt.Sprintf("plan_%d", time.Now().UnixNano())
 
+	// 获取并行执行步骤和重新规划的上限
+	maxParallelSteps := defaultMaxParallelSteps
+	maxReplans := defaultMaxReplans
+	stepBudget := StepBudget{MaxIterations: defaultStepMaxIterations, Timeout: defaultStepTimeout}
+	if planningCfg, err := config.GetPlanningConfig(); err != nil {
+		logger.Warn("获取规划配置失败，使用默认值: %v", err)
+	} else {
+		if planningCfg.MaxParallelSteps > 0 {
+			maxParallelSteps = planningCfg.MaxParallelSteps
+		}
+		maxReplans = planningCfg.MaxReplans
+		if planningCfg.StepMaxIterations > 0 {
+			stepBudget.MaxIterations = planningCfg.StepMaxIterations
+		}
+		if planningCfg.StepTimeout > 0 {
+			stepBudget.Timeout = time.Duration(planningCfg.StepTimeout) * time.Second
+		}
+		stepBudget.MaxTokens = planningCfg.StepMaxTokens
+	}
+
 	return &PlanningAgent{
-		ToolCallAgent:  toolCallAgent,
-		PlanningTool:   planningTool,
-		ExecutorAgents: make(map[string]*ToolCallAgent),
-		ActivePlanID:   activePlanID,
-		CurrentStep:    -1, // -1表示尚未开始执行步骤
-		MaxSteps:       100, // 默认最大步骤数
+		ToolCallAgent:    toolCallAgent,
+		PlanningTool:     planningTool,
+		ExecutorAgents:   make(map[string]*ToolCallAgent),
+		ActivePlanID:     activePlanID,
+		MaxParallelSteps: maxParallelSteps,
+		MaxReplans:       maxReplans,
+		stepOutputs:      make(map[string]string),
+		StepBudget:       stepBudget,
 	}
 }
 
@@ -69,12 +98,28 @@ func (a *PlanningAgent) GetExecutor(stepType string) *ToolCallAgent {
 }
 
 // Run 重写Run方法，实现规划和执行流程
-func (a *PlanningAgent) Run(ctx context.Context, request string) (string, error) {
+func (a *PlanningAgent) Run(ctx context.Context, request string) (*RunResult, error) {
 	logger.Info("规划代理开始运行...")
 
+	// 请求指定了其他执行策略时，由该策略使用规划代理的模型和工具处理请求
+	strategy, err := a.resolveStrategy(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if strategy.Name() != StrategyPlanExecute {
+		logger.Info("规划代理使用执行策略: %s", strategy.Name())
+		return strategy.Execute(ctx, a.ToolCallAgent, a.ToolCallAgent, request)
+	}
+
+	// 每次运行使用新的计划
+	a.ActivePlanID = fmt.Sprintf("plan_%d", time.Now().UnixNano())
+	a.stepOutputs = make(map[string]string)
+	a.replans = 0
+	a.summary = ""
+
 	// 创建初始计划
 	if err := a.CreateInitialPlan(ctx, request); err != nil {
-		return "", fmt.Errorf("创建初始计划失败: %w", err)
+		return nil, fmt.Errorf("创建初始计划失败: %w", err)
 	}
 	
 	// 获取计划步骤数量并设置最大步骤数
@@ -99,10 +144,8 @@ func (a *PlanningAgent) CreateInitialPlan(ctx context.Context, request string) e
 	logger.Info("创建初始计划，ID: %s", a.ActivePlanID)
 
 	// 创建系统消息
-	systemMessage := schema.NewSystemMessage(
-		"你是一个规划助手。你的任务是创建一个详细的计划，包含清晰的步骤来完成用户的请求。" +
-		"每个步骤应该具体且可执行。如果步骤涉及特定类型的操作，请使用方括号标记，例如[SEARCH]表示搜索操作，" +
-		"[CODE]表示编码操作。这将帮助系统选择合适的工具来执行该步骤。")
+	data := promptData(a.Name, nil).With("StepTypes", a.stepTypesPrompt())
+	systemMessage := schema.NewSystemMessage(renderPrompt(data, a.PlannerTemplate, "planner"))
 
 	// 创建用户消息
 	userMessage := schema.NewUserMessage(
@@ -141,13 +184,26 @@ func (a *PlanningAgent) CreateInitialPlan(ctx context.Context, request string) e
 				args["plan_id"] = a.ActivePlanID
 				args["command"] = "create" // 确保是创建命令
 
+				args, err = tool.ValidateParams(a.PlanningTool, args)
+				if err != nil {
+					logger.Error("规划工具参数无效: %v", err)
+					return err
+				}
+
 				// 执行规划工具
-				_, err := a.PlanningTool.Execute(ctx, args)
+				result, err := a.PlanningTool.Execute(ctx, args)
 				if err != nil {
 					logger.Error("执行规划工具失败: %v", err)
 					return err
 				}
 
+				// 记录工具结果，保持工具调用与结果成对出现
+				a.AddMessage(schema.Message{
+					Role:       "tool",
+					ToolCallID: toolCall.ID,
+					Content:    fmt.Sprintf("%v", result),
+				})
+
 				logger.Info("成功创建初始计划")
 				return nil
 			}
@@ -172,110 +228,24 @@ func (a *PlanningAgent) CreateInitialPlan(ctx context.Context, request string) e
 	return nil
 }
 
-// ExecutePlan 执行计划
+// ExecutePlan 执行计划，直到所有步骤完成或无法继续
 func (a *PlanningAgent) ExecutePlan(ctx context.Context) (string, error) {
 	logger.Info("开始执行计划: %s", a.ActivePlanID)
-	
-	// 初始化步骤索引
-	a.CurrentStep = 0
-	
+
 	// 记录结果
 	var results []string
-
-	for {
-		// 获取当前步骤信息
-		stepIndex, stepInfo, err := a.GetCurrentStepInfo(ctx)
+	for a.GetState() != StateFinished {
+		result, err := a.Step(ctx)
 		if err != nil {
-			return "", fmt.Errorf("获取当前步骤信息失败: %w", err)
+			return "", err
 		}
-		
-		// 如果没有更多步骤，完成计划
-		if stepIndex == -1 {
-			finalResult, err := a.FinalizePlan(ctx)
-			if err != nil {
-				return "", fmt.Errorf("完成计划失败: %w", err)
-			}
-			results = append(results, finalResult)
-			break
-		}
-		
-		// 更新当前步骤索引
-		a.CurrentStep = stepIndex
-		
-		// 获取步骤类型和执行器
-		stepType := a.ExtractStepType(stepInfo)
-		executor := a.GetExecutor(stepType)
-		
-		// 执行当前步骤
-		stepResult, err := a.ExecuteStep(ctx, executor, stepInfo)
-		if err != nil {
-			return "", fmt.Errorf("执行步骤 %d 失败: %w", stepIndex, err)
-		}
-		
-		// 记录步骤结果
-		results = append(results, stepResult)
-		
-		// 标记步骤为已完成
-		a.MarkStepCompleted(ctx)
-		
-		// 增加步骤索引
-		a.CurrentStep++
+		results = append(results, result)
 	}
-	
+
 	// 返回所有结果
 	return strings.Join(results, "\n\n"), nil
 }
 
-// GetCurrentStepInfo 获取当前步骤信息
-func (a *PlanningAgent) GetCurrentStepInfo(ctx context.Context) (int, string, error) {
-	// 获取计划信息
-	args := map[string]interface{}{
-		"command": "get",
-		"plan_id": a.ActivePlanID,
-	}
-
-	result, err := a.PlanningTool.Execute(ctx, args)
-	if err != nil {
-		return -1, "", fmt.Errorf("获取计划失败: %w", err)
-	}
-
-	planText := fmt.Sprintf("%v", result)
-	
-	// 解析计划文本，查找未完成的步骤
-	lines := strings.Split(planText, "\n")
-	stepRegex := regexp.MustCompile(`^(\d+)\. (\[.\]) (.+)$`)
-	
-	for _, line := range lines {
-		matches := stepRegex.FindStringSubmatch(line)
-		if len(matches) == 4 {
-			stepNum, _ := strconv.Atoi(matches[1])
-			statusMark := matches[2]
-			stepText := matches[3]
-			
-			// 查找未开始或进行中的步骤
-			if statusMark == "[ ]" || statusMark == "[→]" {
-				// 将步骤标记为进行中
-				markArgs := map[string]interface{}{
-					"command":     "mark_step",
-					"plan_id":     a.ActivePlanID,
-					"step_index":  stepNum - 1, // 步骤索引从0开始
-					"step_status": "in_progress",
-				}
-				
-				_, err := a.PlanningTool.Execute(ctx, markArgs)
-				if err != nil {
-					logger.Warn("标记步骤为进行中失败: %v", err)
-				}
-				
-				return stepNum - 1, stepText, nil
-			}
-		}
-	}
-	
-	// 没有找到未完成的步骤
-	return -1, "", nil
-}
-
 // ExtractStepType 从步骤文本中提取步骤类型
 func (a *PlanningAgent) ExtractStepType(stepText string) string {
 	// 查找方括号中的类型标记，例如[SEARCH]
@@ -289,64 +259,77 @@ func (a *PlanningAgent) ExtractStepType(stepText string) string {
 	return ""
 }
 
-// ExecuteStep 执行单个步骤
-func (a *PlanningAgent) ExecuteStep(ctx context.Context, executor *ToolCallAgent, stepText string) (string, error) {
-	// 获取计划状态
-	planStatus, err := a.GetPlanText(ctx)
-	if err != nil {
-		logger.Warn("获取计划状态失败: %v", err)
-		planStatus = fmt.Sprintf("计划ID: %s", a.ActivePlanID)
+// ExecuteStep 执行单个步骤，上游步骤的结果会附加到步骤提示中
+func (a *PlanningAgent) ExecuteStep(ctx context.Context, executor *ToolCallAgent, step tool.PlanStep, planStatus string) (string, error) {
+	// 执行器的工具调用按规划代理的名称检查权限策略
+	ctx = a.policyContext(ctx)
+
+	// 收集依赖步骤的结果
+	var upstream strings.Builder
+	for _, dep := range step.DependsOn {
+		if output, ok := a.stepOutputs[dep]; ok {
+			upstream.WriteString(fmt.Sprintf("\n步骤 %s 的结果:\n%s\n", dep, output))
+		}
 	}
-	
+	if upstream.Len() == 0 {
+		upstream.WriteString("无\n")
+	}
+
 	// 创建步骤提示
 	stepPrompt := fmt.Sprintf(`
 当前计划状态:
 %s
 
+上游步骤的结果:
+%s
 你的当前任务:
-你正在执行步骤 %d: "%s"
+你正在执行步骤 %d (%s): "%s"
 
-请使用适当的工具执行此步骤。完成后，提供一个总结说明你完成了什么。
-`, planStatus, a.CurrentStep+1, stepText)
+请使用适当的工具执行此步骤，可以多次调用工具直到完成。完成后调用terminate工具结束此步骤，并在message参数中总结你完成了什么。
+如果执行中发现了会影响后续步骤的新信息（例如计划中的假设不成立），请在总结的最后单独一行写出 "REPLAN: 原因"。
+`, planStatus, upstream.String(), step.Index+1, step.ID, step.Description)
 	
 	// 重置执行器的步骤计数
 	executor.ResetSteps()
 	
 	// 添加步骤提示到执行器的记忆中
 	executor.Memory.Clear()
-	executor.AddMessage(schema.NewSystemMessage("你是一个任务执行助手。请使用适当的工具执行给定的步骤。"))
-	executor.AddMessage(schema.NewUserMessage(stepPrompt))
-	
-	// 直接调用执行器的Step方法，避免状态冲突
-	stepResult, err := executor.Step(ctx)
-	if err != nil {
-		return "", fmt.Errorf("执行步骤失败: %w", err)
+	if executor.SystemPrompt == "" {
+		// 专用执行器在请求时附带自己的系统提示
+		executor.AddMessage(schema.NewSystemMessage(renderPrompt(promptData(executor.Name, executor.Tools), "executor")))
 	}
+	executor.AddMessage(schema.NewUserMessage(stepPrompt))
 	
-	// 标记步骤为已完成
-	a.MarkStepCompleted(ctx)
+	// 执行器的工具调用和token消耗计入规划代理的运行结果
+	defer func() {
+		a.recordToolCalls(executor.takeToolCalls()...)
+		a.recordUsage(schema.Usage{TotalTokens: executor.GetTokensUsed()})
+	}()
 	
-	return fmt.Sprintf("步骤 %d 完成: %s\n\n%s", a.CurrentStep+1, stepText, stepResult), nil
-}
-
-// MarkStepCompleted 标记当前步骤为已完成
-func (a *PlanningAgent) MarkStepCompleted(ctx context.Context) {
-	if a.CurrentStep < 0 {
-		return
+	// 在预算内循环执行，直到执行器调用terminate或给出最终回答
+	stepResult, err := runStepLoop(ctx, executor, a.StepBudget)
+	if err != nil {
+		return "", err
 	}
 	
-	// 标记步骤为已完成
-	args := map[string]interface{}{
-		"command":     "mark_step",
-		"plan_id":     a.ActivePlanID,
-		"step_index":  a.CurrentStep,
-		"step_status": "completed",
+	if a.Verifier == nil {
+		return stepResult, nil
 	}
 	
-	_, err := a.PlanningTool.Execute(ctx, args)
+	// 由验证代理检查步骤结果，未通过时把意见反馈给执行器再次尝试
+	stepResult, verdict, err := a.Verifier.VerifyWithRetries(ctx, step.Description, "原始任务："+a.runRequest, stepResult,
+		func(ctx context.Context, feedback string) (string, error) {
+			executor.AddMessage(schema.NewUserMessage(feedback))
+			return runStepLoop(ctx, executor, a.StepBudget)
+		})
 	if err != nil {
-		logger.Warn("标记步骤为已完成失败: %v", err)
+		return "", err
 	}
+	if verdict != nil && !verdict.Pass {
+		return "", fmt.Errorf("步骤未通过验证: %s", strings.Join(verdict.Reasons, "; "))
+	}
+	
+	return stepResult, nil
 }
 
 // GetPlanText 获取计划文本
@@ -381,8 +364,7 @@ func (a *PlanningAgent) FinalizePlan(ctx context.Context) (string, error) {
 `, planText)
 	
 	// 创建系统消息
-	systemMessage := schema.NewSystemMessage(
-		"你是一个总结助手。请简明扼要地总结已完成的计划和结果。")
+	systemMessage := schema.NewSystemMessage(renderPrompt(promptData(a.Name, nil), "summary"))
 	
 	// 创建用户消息
 	userMessage := schema.NewUserMessage(summaryPrompt)
@@ -441,53 +423,6 @@ func (a *PlanningAgent) GetStepsCount(planText string) int {
 	return total
 }
 
-// Step 实现BaseAgent.Step接口
-func (a *PlanningAgent) Step(ctx context.Context) (string, error) {
-	// 检查是否取消
-	select {
-	case <-ctx.Done():
-		return "", ctx.Err()
-	default:
-	}
-
-	// 获取当前步骤信息
-	stepIndex, stepText, err := a.GetCurrentStepInfo(ctx)
-	if err != nil {
-		return "", fmt.Errorf("获取当前步骤信息失败: %w", err)
-	}
-
-	// 记录当前执行的步骤
-	logger.Info("执行计划步骤: %s", stepText)
-
-	// 将步骤标记为进行中
-	if err := a.MarkStepStatus(ctx, stepIndex, "in_progress", ""); err != nil {
-		logger.Warn("标记步骤为进行中失败: %v", err)
-	}
-
-	// 提取步骤类型
-	stepType := a.ExtractStepType(stepText)
-	
-	// 获取适合当前步骤的执行器
-	executor := a.GetExecutor(stepType)
-
-	// 执行步骤
-	result, err := a.ExecuteStep(ctx, executor, stepText)
-	if err != nil {
-		// 标记步骤为阻塞状态
-		if markErr := a.MarkStepStatus(ctx, stepIndex, "blocked", fmt.Sprintf("错误: %v", err)); markErr != nil {
-			logger.Warn("标记步骤为阻塞状态失败: %v", markErr)
-		}
-		return "", fmt.Errorf("执行步骤失败: %w", err)
-	}
-
-	// 标记步骤为已完成
-	if err := a.MarkStepStatus(ctx, stepIndex, "completed", fmt.Sprintf("结果: %s", result)); err != nil {
-		logger.Warn("标记步骤为已完成失败: %v", err)
-	}
-
-	return result, nil
-}
-
 // MarkStepStatus 标记步骤状态
 func (a *PlanningAgent) MarkStepStatus(ctx context.Context, stepIndex int, status string, note string) error {
 	args := map[string]interface{}{
@@ -498,9 +433,66 @@ func (a *PlanningAgent) MarkStepStatus(ctx context.Context, stepIndex int, statu
 	}
 	
 	if note != "" {
-		args["step_note"] = note
+		args["step_notes"] = note
 	}
 	
 	_, err := a.PlanningTool.Execute(ctx, args)
 	return err
 }
+
+// planningCheckpointState 表示规划代理保存在检查点中的状态
+type planningCheckpointState struct {
+	ActivePlanID string             `json:"active_plan_id"`
+	MaxSteps     int                `json:"max_steps"`
+	Plan         *tool.PlanSnapshot `json:"plan,omitempty"`
+	StepOutputs  map[string]string  `json:"step_outputs,omitempty"`
+	Replans      int                `json:"replans,omitempty"`
+}
+
+// CheckpointState 实现CheckpointStateProvider接口，保存计划状态
+func (a *PlanningAgent) CheckpointState() (json.RawMessage, error) {
+	state := planningCheckpointState{
+		ActivePlanID: a.ActivePlanID,
+		MaxSteps:     a.MaxSteps,
+		StepOutputs:  a.stepOutputs,
+		Replans:      a.replans,
+	}
+
+	plan, err := a.PlanningTool.ExportPlan(a.ActivePlanID)
+	if err == nil {
+		state.Plan = plan
+	}
+
+	return json.Marshal(state)
+}
+
+// RestoreCheckpointState 实现CheckpointStateProvider接口，恢复计划状态
+func (a *PlanningAgent) RestoreCheckpointState(data json.RawMessage) error {
+	var state planningCheckpointState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("解析计划状态失败: %w", err)
+	}
+
+	if state.Plan != nil {
+		if err := a.PlanningTool.ImportPlan(state.Plan); err != nil {
+			return err
+		}
+	}
+
+	a.ActivePlanID = state.ActivePlanID
+	if state.MaxSteps > 0 {
+		a.MaxSteps = state.MaxSteps
+	}
+	a.replans = state.Replans
+	a.stepOutputs = make(map[string]string, len(state.StepOutputs))
+	for id, output := range state.StepOutputs {
+		a.stepOutputs[id] = output
+	}
+	return nil
+}
+
+// Resume 从检查点恢复计划的执行
+func (a *PlanningAgent) Resume(ctx context.Context, cp *checkpoint.Checkpoint) (*RunResult, error) {
+	logger.Info("规划代理从检查点恢复运行: %s", cp.RunID)
+	return a.BaseAgent.ResumeWithStepper(ctx, cp, a)
+}
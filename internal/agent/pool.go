@@ -0,0 +1,340 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gomanus/internal/checkpoint"
+	"gomanus/internal/llm"
+	"gomanus/internal/tool"
+	"gomanus/pkg/logger"
+)
+
+// Factory 根据代理配置为每个会话创建独立的代理实例
+// 模型客户端、验证代理、检查点存储和无状态的工具在会话之间共享，
+// 记忆、计划和保存了会话状态的工具（实现了tool.SessionScoped）每个会话独立
+type Factory struct {
+	Profiles       []AgentProfile
+	LLM            *llm.LLM
+	Tools          *tool.ToolCollection
+	AnswerVerifier *VerifierAgent    // 验证任务代理最终回答的代理，为nil时不验证
+	StepVerifier   *VerifierAgent    // 验证计划步骤结果的代理，为nil时不验证
+	Checkpoints    *checkpoint.Store // 检查点存储，为nil时不保存
+	Classifier     *ClassifierAgent  // 根据输入类型选择代理的分类器，可以被多个会话同时使用
+}
+
+// NewFactory 创建代理工厂
+func NewFactory(profiles []AgentProfile, llmInstance *llm.LLM, tools *tool.ToolCollection) *Factory {
+	return &Factory{
+		Profiles: profiles,
+		LLM:      llmInstance,
+		Tools:    tools,
+	}
+}
+
+// Build 使用指定的工具集合创建一组代理，返回的map以代理名称为键
+// 创建失败的代理不包含在结果中，错误按代理名称记录在skipped中
+func (f *Factory) Build(tools *tool.ToolCollection) (agents map[string]Runner, skipped map[string]error) {
+	agents = make(map[string]Runner, len(f.Profiles))
+	skipped = make(map[string]error)
+	for _, profile := range f.Profiles {
+		runner, err := BuildAgent(profile, f.LLM, tools)
+		if err != nil {
+			skipped[profile.Key] = err
+			continue
+		}
+		agents[profile.Key] = runner
+	}
+
+	// 任务代理作为规划代理的默认执行器
+	manus, _ := agents[AgentManus].(*Manus)
+	for _, runner := range agents {
+		switch a := runner.(type) {
+		case *Manus:
+			a.Verifier = f.AnswerVerifier
+			a.Checkpoints = f.Checkpoints
+		case *PlanningAgent:
+			a.Verifier = f.StepVerifier
+			a.Checkpoints = f.Checkpoints
+			if manus != nil {
+				a.AddExecutor("default", manus.ToolCallAgent)
+			}
+		}
+	}
+	return agents, skipped
+}
+
+// NewSession 创建拥有独立代理实例的会话，缺少内置的任务代理或聊天代理时返回错误
+func (f *Factory) NewSession(id string) (*Session, error) {
+	tools := f.Tools.ForSession()
+	agents, skipped := f.Build(tools)
+	for key, err := range skipped {
+		logger.Warn("会话 %s 跳过代理 %s: %v", id, key, err)
+	}
+	if agents[AgentManus] == nil || agents[AgentChat] == nil {
+		return nil, fmt.Errorf("缺少内置代理 %s 或 %s，请检查代理配置", AgentManus, AgentChat)
+	}
+
+	session := &Session{
+		ID:         id,
+		Agents:     agents,
+		Skipped:    skipped,
+		Classifier: f.Classifier,
+		tools:      tools,
+	}
+	session.touch()
+	return session, nil
+}
+
+// Session 是一个用户会话，拥有独立的代理实例和记忆
+// 同一会话中的请求依次执行，不同会话可以同时运行
+type Session struct {
+	ID         string
+	Agents     map[string]Runner // 代理名称 -> 代理
+	Skipped    map[string]error  // 创建失败而被跳过的代理
+	Classifier *ClassifierAgent
+
+	tools    *tool.ToolCollection // 会话的工具集合，其中会话独立的工具在会话关闭时释放
+	mu       sync.Mutex           // 保证同一会话中的请求依次执行
+	busy     atomic.Int32         // 正在执行和等待执行的请求数量
+	lastUsed atomic.Int64         // 最近一次使用的时间（UnixNano）
+}
+
+// Keys 返回会话中代理的名称，按名称排序
+func (s *Session) Keys() []string {
+	keys := make([]string, 0, len(s.Agents))
+	for key := range s.Agents {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Run 使用指定的代理处理请求，会话中已有请求在执行时等待其完成
+func (s *Session) Run(ctx context.Context, key string, request string) (*RunResult, error) {
+	runner, exists := s.Agents[key]
+	if !exists {
+		return nil, fmt.Errorf("会话 %s 中不存在代理 %s", s.ID, key)
+	}
+
+	release, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return runner.Run(ctx, request)
+}
+
+// Resume 使用会话中保存检查点的代理恢复运行
+func (s *Session) Resume(ctx context.Context, cp *checkpoint.Checkpoint) (*RunResult, error) {
+	var resumer Resumer
+	for _, runner := range s.Agents {
+		if r, ok := runner.(Resumer); ok && runner.GetName() == cp.Agent {
+			resumer = r
+			break
+		}
+	}
+	if resumer == nil {
+		return nil, fmt.Errorf("无法恢复代理 %s 的运行", cp.Agent)
+	}
+
+	release, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return resumer.Resume(ctx, cp)
+}
+
+// acquire 等待会话空闲，返回释放函数
+func (s *Session) acquire(ctx context.Context) (func(), error) {
+	s.busy.Add(1)
+	s.touch()
+
+	locked := make(chan struct{})
+	go func() {
+		s.mu.Lock()
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+		return func() {
+			s.mu.Unlock()
+			s.touch()
+			s.busy.Add(-1)
+		}, nil
+	case <-ctx.Done():
+		// 取得锁后立即释放，避免阻塞之后的请求
+		go func() {
+			<-locked
+			s.mu.Unlock()
+			s.busy.Add(-1)
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// Close 释放会话独立的工具，例如浏览器工具在共享的Chromium中打开的标签页
+func (s *Session) Close() error {
+	if s.tools == nil {
+		return nil
+	}
+	return s.tools.Close()
+}
+
+// Busy 检查会话是否有正在执行的请求
+func (s *Session) Busy() bool {
+	return s.busy.Load() > 0
+}
+
+// touch 更新会话最近一次使用的时间
+func (s *Session) touch() {
+	s.lastUsed.Store(time.Now().UnixNano())
+}
+
+// idleSince 返回会话最近一次使用的时间
+func (s *Session) idleSince() time.Time {
+	return time.Unix(0, s.lastUsed.Load())
+}
+
+// Pool 管理多个会话，每个会话在第一次使用时由工厂创建
+type Pool struct {
+	factory     *Factory
+	MaxSessions int           // 同时存在的最大会话数，0表示不限制
+	IdleTimeout time.Duration // 空闲超过该时间的会话会被回收，0表示不回收
+	mu          sync.Mutex
+	sessions    map[string]*Session
+}
+
+// NewPool 创建会话池
+func NewPool(factory *Factory, maxSessions int, idleTimeout time.Duration) *Pool {
+	return &Pool{
+		factory:     factory,
+		MaxSessions: maxSessions,
+		IdleTimeout: idleTimeout,
+		sessions:    make(map[string]*Session),
+	}
+}
+
+// Get 返回指定ID的会话，不存在时创建新的会话
+// 会话数量达到上限时回收最久未使用的空闲会话，所有会话都在执行请求时返回错误
+func (p *Pool) Get(id string) (*Session, error) {
+	p.mu.Lock()
+	session, evicted, err := p.getLocked(id)
+	p.mu.Unlock()
+
+	// 在锁外关闭被回收的会话，关闭浏览器标签页不阻塞其他会话
+	closeSessions(evicted)
+	return session, err
+}
+
+// getLocked 查找或创建会话，返回需要关闭的被回收的会话，调用者需要持有p.mu
+func (p *Pool) getLocked(id string) (*Session, []*Session, error) {
+	evicted := p.evictIdle()
+	if session, exists := p.sessions[id]; exists {
+		session.touch()
+		return session, evicted, nil
+	}
+
+	if p.MaxSessions > 0 && len(p.sessions) >= p.MaxSessions {
+		oldest := p.evictOldest()
+		if oldest == nil {
+			return nil, evicted, fmt.Errorf("会话数量已达上限 (%d)，且所有会话都在执行请求", p.MaxSessions)
+		}
+		evicted = append(evicted, oldest)
+	}
+
+	session, err := p.factory.NewSession(id)
+	if err != nil {
+		return nil, evicted, fmt.Errorf("创建会话 %s 失败: %w", id, err)
+	}
+	p.sessions[id] = session
+	logger.Info("创建会话 %s，当前会话数 %d", id, len(p.sessions))
+	return session, evicted, nil
+}
+
+// Reap 定期回收空闲超时的会话，直到ctx被取消，IdleTimeout为0时直接返回
+// 没有新的请求时Get不会执行回收，长期运行的服务需要在后台调用Reap
+func (p *Pool) Reap(ctx context.Context) {
+	if p.IdleTimeout <= 0 {
+		return
+	}
+	ticker := time.NewTicker(p.IdleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			evicted := p.evictIdle()
+			p.mu.Unlock()
+			closeSessions(evicted)
+		}
+	}
+}
+
+// Remove 移除指定的会话，会话中正在执行的请求不受影响
+func (p *Pool) Remove(id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.sessions, id)
+}
+
+// Len 返回当前的会话数量
+func (p *Pool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.sessions)
+}
+
+// evictIdle 从会话池中移除空闲超时的会话并返回它们，调用者需要持有p.mu
+func (p *Pool) evictIdle() []*Session {
+	if p.IdleTimeout <= 0 {
+		return nil
+	}
+	var evicted []*Session
+	for id, session := range p.sessions {
+		if !session.Busy() && time.Since(session.idleSince()) > p.IdleTimeout {
+			logger.Info("会话 %s 空闲超时，已回收", id)
+			delete(p.sessions, id)
+			evicted = append(evicted, session)
+		}
+	}
+	return evicted
+}
+
+// evictOldest 从会话池中移除最久未使用的空闲会话并返回它，没有空闲会话时返回nil
+func (p *Pool) evictOldest() *Session {
+	var oldestID string
+	var oldest time.Time
+	for id, session := range p.sessions {
+		if session.Busy() {
+			continue
+		}
+		if oldestID == "" || session.idleSince().Before(oldest) {
+			oldestID, oldest = id, session.idleSince()
+		}
+	}
+	if oldestID == "" {
+		return nil
+	}
+	logger.Info("会话数量已达上限，回收最久未使用的会话 %s", oldestID)
+	session := p.sessions[oldestID]
+	delete(p.sessions, oldestID)
+	return session
+}
+
+// closeSessions 关闭被回收的会话
+func closeSessions(sessions []*Session) {
+	for _, session := range sessions {
+		if err := session.Close(); err != nil {
+			logger.Warn("关闭会话 %s 失败: %v", session.ID, err)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gomanus/internal/llm"
+	"gomanus/internal/schema"
+	"gomanus/internal/tool"
+	"gomanus/pkg/logger"
+)
+
+// TestMain 关闭测试中的日志输出，日志的锁会在goroutine之间建立同步关系，掩盖数据竞争
+func TestMain(m *testing.M) {
+	logger.SetLevel(logger.LevelFatal)
+	os.Exit(m.Run())
+}
+
+// stubLLM 是一个兼容OpenAI接口的模型桩：收到新请求时先调用planning创建以请求命名的计划，
+// 看到计划创建的结果后调用terminate结束，并检查同一会话的请求没有同时进入模型
+// 桩中只使用每个会话独立的计数器，不在会话之间引入同步，以免掩盖数据竞争
+type stubLLM struct {
+	t        *testing.T
+	inflight map[string]*atomic.Int32 // 会话 -> 正在处理的模型请求数，测试开始前创建
+}
+
+// stubMessage 是请求体中的一条消息
+type stubMessage struct {
+	Role      string `json:"role"`
+	Content   string `json:"content"`
+	ToolCalls []struct {
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	} `json:"tool_calls"`
+}
+
+func (s *stubLLM) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Messages []stubMessage `json:"messages"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// 本次请求对应的用户输入是最后一条用户消息
+	request := ""
+	last := body.Messages[len(body.Messages)-1]
+	for i := len(body.Messages) - 1; i >= 0; i-- {
+		if body.Messages[i].Role == "user" {
+			request = body.Messages[i].Content
+			break
+		}
+	}
+	session, _, _ := strings.Cut(request, "/")
+
+	inflight := s.inflight[session]
+	if inflight.Add(1) > 1 {
+		s.t.Errorf("会话 %s 的请求同时进入了模型", session)
+	}
+	defer inflight.Add(-1)
+	// 留出时间让其他会话的请求交错执行
+	time.Sleep(time.Millisecond)
+
+	var name string
+	var args map[string]interface{}
+	switch {
+	case last.Role == "user":
+		name = "planning"
+		args = map[string]interface{}{"command": "create", "plan_id": request, "title": request, "steps": []string{"查找", "总结"}}
+	case last.Role == "tool":
+		name = "terminate"
+		args = map[string]interface{}{"status": "success", "message": "完成 " + request}
+	default:
+		s.t.Errorf("意外的最后一条消息: %+v", last)
+		http.Error(w, "unexpected", http.StatusBadRequest)
+		return
+	}
+	arguments, _ := json.Marshal(args)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"choices": []interface{}{map[string]interface{}{
+			"message": map[string]interface{}{
+				"content": "",
+				"tool_calls": []interface{}{map[string]interface{}{
+					"id":       fmt.Sprintf("call_%s_%d", request, len(body.Messages)),
+					"type":     "function",
+					"function": map[string]interface{}{"name": name, "arguments": string(arguments)},
+				}},
+			},
+		}},
+		"usage": map[string]interface{}{"prompt_tokens": 10, "completion_tokens": 5},
+	})
+}
+
+func TestPoolRunsSessionsConcurrently(t *testing.T) {
+	const sessions = 8
+	const requests = 6
+	stub := &stubLLM{t: t, inflight: make(map[string]*atomic.Int32)}
+	for i := 0; i < sessions; i++ {
+		stub.inflight[fmt.Sprintf("s%d", i)] = new(atomic.Int32)
+	}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+	model := &llm.LLM{Model: "stub", BaseURL: server.URL + "/", APIType: "openai", Client: server.Client()}
+
+	// 规划工具不是会话独立的工具，所有会话共享同一个实例
+	planning := tool.NewPlanningTool()
+	tools := tool.NewToolCollection()
+	tools.AddTool(planning)
+	tools.AddTool(tool.NewTerminate())
+	profiles := []AgentProfile{builtinAgentProfiles[AgentManus], builtinAgentProfiles[AgentChat]}
+	pool := NewPool(NewFactory(profiles, model, tools), 0, 0)
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+
+	for i := 0; i < sessions; i++ {
+		id := fmt.Sprintf("s%d", i)
+		session, err := pool.Get(id)
+		if err != nil {
+			t.Fatalf("创建会话失败: %v", err)
+		}
+
+		// 运行期间同时读取会话的记忆
+		manus := session.Agents[AgentManus].(*Manus)
+		go func() {
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					manus.Memory.GetMessages()
+					time.Sleep(100 * time.Microsecond)
+				}
+			}
+		}()
+
+		// 同一会话的多个请求同时提交，由会话依次执行
+		for j := 0; j < requests; j++ {
+			wg.Add(1)
+			go func(request string) {
+				defer wg.Done()
+				session, err := pool.Get(id)
+				if err != nil {
+					t.Errorf("获取会话失败: %v", err)
+					return
+				}
+				result, err := session.Run(context.Background(), AgentManus, request)
+				if err != nil {
+					t.Errorf("请求 %s 失败: %v", request, err)
+					return
+				}
+				if !result.Succeeded() || !strings.Contains(result.Answer, "完成 "+request) {
+					t.Errorf("请求 %s 的结果不正确: status=%s answer=%q", request, result.Status, result.Answer)
+				}
+			}(fmt.Sprintf("%s/r%d", id, j))
+		}
+	}
+	wg.Wait()
+	close(done)
+
+	if pool.Len() != sessions {
+		t.Errorf("会话数量为 %d，期望 %d", pool.Len(), sessions)
+	}
+
+	// 每个请求的消息在记忆中连续出现，没有和同一会话的其他请求交错
+	for i := 0; i < sessions; i++ {
+		session, _ := pool.Get(fmt.Sprintf("s%d", i))
+		messages := session.Agents[AgentManus].(*Manus).Memory.GetMessages()
+		var runs [][]schema.Message
+		for _, msg := range messages {
+			if msg.Role == "user" {
+				runs = append(runs, nil)
+			}
+			if len(runs) > 0 {
+				runs[len(runs)-1] = append(runs[len(runs)-1], msg)
+			}
+		}
+		if len(runs) != requests {
+			t.Errorf("会话 s%d 记录了 %d 个请求，期望 %d", i, len(runs), requests)
+		}
+		for _, run := range runs {
+			request := run[0].Content
+			var calls []string
+			for _, msg := range run {
+				if msg.Role == "tool" && msg.Content != "" && !strings.Contains(msg.Content, request) {
+					t.Errorf("请求 %s 的记忆中出现了其他请求的工具结果: %q", request, msg.Content)
+				}
+				for _, call := range msg.ToolCalls {
+					calls = append(calls, call.Function.Name)
+				}
+			}
+			if strings.Join(calls, ",") != "planning,terminate" {
+				t.Errorf("请求 %s 的工具调用为 %v，期望先planning后terminate", request, calls)
+			}
+		}
+	}
+
+	// 共享的规划工具保存了所有会话创建的计划
+	listed, err := planning.Execute(context.Background(), map[string]interface{}{"command": "list"})
+	if err != nil {
+		t.Fatalf("列出计划失败: %v", err)
+	}
+	for i := 0; i < sessions; i++ {
+		for j := 0; j < requests; j++ {
+			if id := fmt.Sprintf("s%d/r%d", i, j); !strings.Contains(fmt.Sprint(listed), id) {
+				t.Errorf("计划列表中没有 %s", id)
+			}
+		}
+	}
+}
+
+func TestSessionAcquireCancelled(t *testing.T) {
+	session := &Session{ID: "s"}
+	release, err := session.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("获取空闲会话失败: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := session.acquire(ctx); err == nil {
+		t.Fatal("会话忙碌时等待超时应该返回错误")
+	}
+	if !session.Busy() {
+		t.Error("会话在执行请求时应该是忙碌的")
+	}
+
+	release()
+	// 超时的等待在取得锁后立即释放，之后的请求不会被阻塞
+	again, err := session.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("释放后获取会话失败: %v", err)
+	}
+	again()
+	deadline := time.Now().Add(time.Second)
+	for session.Busy() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if session.Busy() {
+		t.Error("所有请求结束后会话应该是空闲的")
+	}
+}
+
+// closableTool 是会话独立的工具，记录每个会话实例是否被关闭
+type closableTool struct {
+	*tool.BaseTool
+	closed *atomic.Bool
+}
+
+func (c *closableTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	return nil, nil
+}
+
+func (c *closableTool) ForSession(tools *tool.ToolCollection) tool.Tool {
+	return &closableTool{BaseTool: c.BaseTool, closed: new(atomic.Bool)}
+}
+
+func (c *closableTool) Close() error {
+	c.closed.Store(true)
+	return nil
+}
+
+func TestPoolEvictionClosesSessionTools(t *testing.T) {
+	shared := &closableTool{BaseTool: tool.NewBaseTool("closable", "会话独立的工具"), closed: new(atomic.Bool)}
+	tools := tool.NewToolCollection()
+	tools.AddTool(shared)
+	tools.AddTool(tool.NewTerminate())
+	profiles := []AgentProfile{builtinAgentProfiles[AgentManus], builtinAgentProfiles[AgentChat]}
+	pool := NewPool(NewFactory(profiles, nil, tools), 1, time.Hour)
+
+	sessionTool := func(session *Session) *closableTool {
+		t.Helper()
+		found, err := session.tools.GetTool("closable")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return found.(*closableTool)
+	}
+
+	first, err := pool.Get("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := pool.Get("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sessionTool(first).closed.Load() {
+		t.Error("达到会话上限时回收的会话没有关闭它的工具")
+	}
+
+	// 空闲超时的会话在下一次使用会话池时回收，即使请求的是已有的会话
+	second.lastUsed.Store(time.Now().Add(-2 * time.Hour).UnixNano())
+	if _, err := pool.Get("b"); err != nil {
+		t.Fatal(err)
+	}
+	if !sessionTool(second).closed.Load() {
+		t.Error("空闲超时的会话没有关闭它的工具")
+	}
+	if shared.closed.Load() {
+		t.Error("回收会话时关闭了共享的工具")
+	}
+}
@@ -0,0 +1,226 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gomanus/internal/checkpoint"
+	"gomanus/internal/config"
+	"gomanus/internal/llm"
+	"gomanus/internal/prompt"
+	"gomanus/internal/tool"
+	"gomanus/pkg/logger"
+)
+
+// 内置代理的名称，分类器的三种模式分别交给这些代理处理
+const (
+	AgentManus    = "manus"
+	AgentChat     = "chat"
+	AgentPlanning = "planning"
+)
+
+// Runner 是可以直接处理用户请求的代理
+type Runner interface {
+	GetName() string
+	Run(ctx context.Context, request string) (*RunResult, error)
+}
+
+// Resumer 是可以从检查点恢复运行的代理
+type Resumer interface {
+	Runner
+	Resume(ctx context.Context, cp *checkpoint.Checkpoint) (*RunResult, error)
+}
+
+// AgentProfile 描述一个可以通过配置声明的代理
+type AgentProfile struct {
+	Key          string   // 配置中的名称，用于 /agent 和 --agent 选择代理
+	Name         string   // 代理名称，记录在检查点和权限策略中
+	Description  string   // 代理的说明
+	SystemPrompt string   // 系统提示，为空则使用提示模板
+	PromptFile   string   // 系统提示的模板文件，优先于SystemPrompt
+	Template     string   // 提示模板名称，为空时依次查找与代理同名的模板和策略的默认模板
+	Model        string   // 使用的模型（llm_types中的名称），为空则使用默认模型
+	Tools        []string // 可以使用的工具，为空则可以使用全部工具
+	ExcludeTools []string // 不能使用的工具，优先于Tools
+	MaxSteps     int      // 最大步骤数，0表示使用默认值
+	Strategy     string   // 执行策略
+}
+
+// builtinAgentProfiles 是内置的代理，配置文件中的同名代理会覆盖其中的字段
+var builtinAgentProfiles = map[string]AgentProfile{
+	AgentManus: {
+		Key:         AgentManus,
+		Name:        "Manus",
+		Description: "通用任务代理，使用工具完成具体任务",
+		Strategy:    StrategyReact,
+	},
+	AgentChat: {
+		Key:         AgentChat,
+		Name:        "ChatAgent",
+		Description: "聊天代理，用于日常对话和问答",
+		Strategy:    StrategyChat,
+	},
+	AgentPlanning: {
+		Key:         AgentPlanning,
+		Name:        "PlanningAgent",
+		Description: "规划代理，制定多步骤计划并执行",
+		Strategy:    StrategyPlanExecute,
+	},
+}
+
+// LoadAgentProfiles 合并内置代理和配置文件中的代理，按名称排序返回
+// 未启用规划工具时不包含内置的规划代理
+func LoadAgentProfiles() []AgentProfile {
+	profiles := make(map[string]AgentProfile, len(builtinAgentProfiles))
+	for key, profile := range builtinAgentProfiles {
+		profiles[key] = profile
+	}
+	if toolsCfg, err := config.GetToolsConfig(); err == nil && !toolsCfg.Enabled("planning") {
+		delete(profiles, AgentPlanning)
+	}
+
+	agentsCfg, err := config.GetAgentsConfig()
+	if err != nil {
+		logger.Warn("获取代理配置失败，只使用内置代理: %v", err)
+	}
+	for key, cfg := range agentsCfg {
+		key = strings.ToLower(key)
+		profile, exists := profiles[key]
+		if !exists {
+			profile = AgentProfile{Key: key, Name: key, Strategy: StrategyReact}
+		}
+		if cfg.Description != "" {
+			profile.Description = cfg.Description
+		}
+		if cfg.SystemPrompt != "" {
+			profile.SystemPrompt = cfg.SystemPrompt
+		}
+		if cfg.SystemPromptFile != "" {
+			profile.PromptFile = cfg.SystemPromptFile
+		}
+		if cfg.PromptTemplate != "" {
+			profile.Template = cfg.PromptTemplate
+		}
+		if cfg.Model != "" {
+			profile.Model = cfg.Model
+		}
+		if len(cfg.Tools) > 0 {
+			profile.Tools = cfg.Tools
+		}
+		if len(cfg.ExcludeTools) > 0 {
+			profile.ExcludeTools = cfg.ExcludeTools
+		}
+		if cfg.MaxSteps > 0 {
+			profile.MaxSteps = cfg.MaxSteps
+		}
+		if cfg.Strategy != "" {
+			profile.Strategy = cfg.Strategy
+		}
+		profiles[key] = profile
+	}
+
+	result := make([]AgentProfile, 0, len(profiles))
+	for _, profile := range profiles {
+		result = append(result, profile)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key < result[j].Key
+	})
+	return result
+}
+
+// BuildAgent 根据代理配置创建代理，执行策略决定创建的代理类型
+func BuildAgent(profile AgentProfile, defaultLLM *llm.LLM, tools *tool.ToolCollection) (Runner, error) {
+	agentLLM := defaultLLM
+	if profile.Model != "" {
+		var err error
+		agentLLM, err = llm.NewLLM(profile.Model)
+		if err != nil {
+			return nil, fmt.Errorf("创建代理 %s 的模型失败: %w", profile.Key, err)
+		}
+	}
+
+	// 每个代理使用基础集合的视图，按配置过滤工具，不影响其他代理
+	agentTools := tools
+	if len(profile.Tools) > 0 || len(profile.ExcludeTools) > 0 {
+		var allow []string
+		if len(profile.Tools) > 0 {
+			allow = profile.Tools
+		}
+		agentTools = tools.View(tool.ViewOptions{Allow: allow, Deny: profile.ExcludeTools})
+	}
+
+	switch profile.Strategy {
+	case StrategyReact, StrategyReactText, StrategyReflexion:
+		manus := NewManus(profile.Name, agentLLM, agentTools)
+		applyProfile(manus.BaseAgent, profile)
+		manus.promptTemplate = profilePrompt(profile, agentTools, "manus")
+		manus.Strategy, _ = NewStrategy(profile.Strategy)
+		return manus, nil
+	case StrategyPlanExecute:
+		planning := NewPlanningAgent(profile.Name, agentLLM, agentTools)
+		applyProfile(planning.BaseAgent, profile)
+		planning.SystemPrompt = profile.SystemPrompt
+		planning.PlannerTemplate = profile.Template
+		if planning.PlannerTemplate == "" {
+			planning.PlannerTemplate = profile.Key
+		}
+		planning.RegisterExecutorProfiles(LoadExecutorProfiles(), planning.Tools)
+		return planning, nil
+	case StrategyChat:
+		chat := NewChatAgent(profile.Name, agentLLM)
+		applyProfile(chat.BaseAgent, profile)
+		chat.promptTemplate = profilePrompt(profile, nil, "chat")
+		return chat, nil
+	default:
+		return nil, fmt.Errorf("代理 %s 的执行策略 '%s' 未知，可选: %s、%s",
+			profile.Key, profile.Strategy, strings.Join(StrategyNames(), "、"), StrategyChat)
+	}
+}
+
+// profilePrompt 返回渲染代理系统提示的promptRenderer，优先级为模板文件、配置中的系统提示、提示模板
+func profilePrompt(profile AgentProfile, tools *tool.ToolCollection, defaultTemplate string) promptRenderer {
+	return func() string {
+		return profileSystemPrompt(profile, tools, defaultTemplate)
+	}
+}
+
+// profileSystemPrompt 生成代理的系统提示，优先级为模板文件、配置中的系统提示、提示模板
+func profileSystemPrompt(profile AgentProfile, tools *tool.ToolCollection, defaultTemplate string) string {
+	data := promptData(profile.Name, tools)
+	if profile.PromptFile != "" {
+		text, err := prompt.RenderFile(profile.PromptFile, data)
+		if err == nil {
+			return text
+		}
+		logger.Warn("渲染代理 %s 的系统提示文件失败，使用默认提示: %v", profile.Key, err)
+	}
+	if profile.SystemPrompt != "" {
+		return profile.SystemPrompt
+	}
+	return renderPrompt(data, profile.Template, profile.Key, defaultTemplate)
+}
+
+// applyProfile 设置代理配置中与策略无关的字段
+func applyProfile(base *BaseAgent, profile AgentProfile) {
+	if profile.Description != "" {
+		base.Description = profile.Description
+	}
+	if profile.MaxSteps > 0 {
+		base.MaxSteps = profile.MaxSteps
+	}
+}
+
+// Mode 返回代理对应的交互模式，用于权限策略中的模式条件
+func (p AgentProfile) Mode() InputType {
+	switch p.Strategy {
+	case StrategyPlanExecute:
+		return InputTypePlan
+	case StrategyChat:
+		return InputTypeChat
+	default:
+		return InputTypeTask
+	}
+}
@@ -0,0 +1,36 @@
+package agent
+
+import (
+	"gomanus/internal/prompt"
+	"gomanus/internal/tool"
+	"gomanus/pkg/logger"
+)
+
+// promptData 创建渲染系统提示使用的变量，tools 为nil时模板中没有工具列表
+func promptData(name string, tools *tool.ToolCollection) prompt.Data {
+	if tools == nil {
+		return prompt.NewData(name, nil)
+	}
+	return prompt.NewData(name, tools.GetToolDefinitions())
+}
+
+// promptRenderer 渲染代理的系统提示，在每次运行开始时调用，
+// 使模板中的日期和工具列表（包括之后挂载的MCP工具和热加载的插件工具）保持最新
+type promptRenderer func() string
+
+// templatePrompt 返回渲染提示模板的promptRenderer，tools 为nil时模板中没有工具列表
+func templatePrompt(name string, tools *tool.ToolCollection, names ...string) promptRenderer {
+	return func() string {
+		return renderPrompt(promptData(name, tools), names...)
+	}
+}
+
+// renderPrompt 按顺序渲染第一个存在的提示模板，失败时记录错误并返回空字符串
+func renderPrompt(data prompt.Data, names ...string) string {
+	text, err := prompt.Render(data, names...)
+	if err != nil {
+		logger.Error("渲染系统提示失败: %v", err)
+		return ""
+	}
+	return text
+}
@@ -25,7 +25,7 @@ func NewReActAgent(name string, llm *llm.LLM) *ReActAgent {
 }
 
 // Run 重写Run方法以确保使用正确的Step实现
-func (a *ReActAgent) Run(ctx context.Context, request string) (string, error) {
+func (a *ReActAgent) Run(ctx context.Context, request string) (*RunResult, error) {
 	return a.BaseAgent.RunWithStepper(ctx, request, a)
 }
 
@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gomanus/internal/schema"
+	"gomanus/internal/tool"
+	"gomanus/pkg/logger"
+)
+
+// defaultMaxReplans 是无法读取配置时每次运行中重新规划的默认次数
+const defaultMaxReplans = 3
+
+// replanSignalRegex 匹配执行器在步骤总结中给出的重新规划请求，例如 "REPLAN: 发现需要先安装依赖"
+var replanSignalRegex = regexp.MustCompile(`(?m)^\s*REPLAN[:：]\s*(.+)$`)
+
+// replanSignal 从步骤结果中提取重新规划的原因，没有请求时返回空字符串
+func replanSignal(output string) string {
+	matches := replanSignalRegex.FindStringSubmatch(output)
+	if len(matches) < 2 {
+		return ""
+	}
+	return strings.TrimSpace(matches[1])
+}
+
+// replan 让规划模型根据失败或新发现的信息调整剩余的步骤，返回计划是否被修改
+func (a *PlanningAgent) replan(ctx context.Context, issues []string) bool {
+	if a.replans >= a.MaxReplans {
+		logger.Warn("已达到重新规划次数上限 (%d)，不再调整计划", a.MaxReplans)
+		return false
+	}
+	logger.Info("第 %d/%d 次重新规划: %s", a.replans+1, a.MaxReplans, strings.Join(issues, "; "))
+
+	planText, err := a.GetPlanText(ctx)
+	if err != nil {
+		logger.Warn("获取计划状态失败，跳过重新规划: %v", err)
+		return false
+	}
+
+	data := promptData(a.Name, nil).With("PlanID", a.ActivePlanID).With("StepTypes", a.stepTypesPrompt())
+	systemMessage := schema.NewSystemMessage(renderPrompt(data, "replan"))
+
+	userMessage := schema.NewUserMessage(fmt.Sprintf(
+		"原始任务：%s\n\n当前计划状态:\n%s\n\n需要处理的问题:\n- %s",
+		a.runRequest, planText, strings.Join(issues, "\n- ")))
+
+	response, err := a.LLM.AskTool(ctx, []schema.Message{systemMessage, userMessage}, nil,
+		[]map[string]interface{}{a.PlanningTool.GetToolDefinition()}, "required")
+	if err != nil {
+		logger.Warn("调用LLM重新规划失败: %v", err)
+		return false
+	}
+
+	changed := false
+	for _, toolCall := range response.ToolCalls {
+		if toolCall.Function.Name != a.PlanningTool.Name() {
+			continue
+		}
+
+		var args map[string]interface{}
+		if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &args); err != nil {
+			logger.Warn("解析重新规划参数失败: %v", err)
+			continue
+		}
+
+		// 只允许修改当前计划
+		command, _ := args["command"].(string)
+		if command != "update" && command != "mark_step" {
+			logger.Warn("忽略重新规划中的命令: %s", command)
+			continue
+		}
+		args["plan_id"] = a.ActivePlanID
+		if command == "update" {
+			if reason, _ := args["reason"].(string); reason == "" {
+				args["reason"] = strings.Join(issues, "; ")
+			}
+		}
+
+		args, err := tool.ValidateParams(a.PlanningTool, args)
+		if err != nil {
+			logger.Warn("重新规划命令 %s 的参数无效: %v", command, err)
+			continue
+		}
+		if _, err := a.PlanningTool.Execute(ctx, args); err != nil {
+			logger.Warn("执行重新规划命令 %s 失败: %v", command, err)
+			continue
+		}
+		changed = true
+	}
+
+	if !changed {
+		logger.Warn("重新规划没有修改计划")
+		return false
+	}
+	// 只有修改了计划的重新规划才计入次数，获取计划或调用模型失败时不消耗预算
+	a.replans++
+
+	// 新增的步骤需要更多的执行轮次
+	if steps, err := a.PlanningTool.GetSteps(a.ActivePlanID); err == nil {
+		remaining := 0
+		for _, step := range steps {
+			if step.Status != "completed" && step.Status != "skipped" {
+				remaining++
+			}
+		}
+		if needed := a.CurrentStep + remaining + 1; needed > a.MaxSteps {
+			a.MaxSteps = needed
+		}
+	}
+
+	logger.Info("计划已重新规划")
+	return true
+}
@@ -0,0 +1,70 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gomanus/internal/llm"
+	"gomanus/internal/tool"
+)
+
+// replanStub 按顺序返回预设的planning工具调用，nil表示返回服务器错误
+type replanStub struct {
+	calls []map[string]interface{}
+}
+
+func (s *replanStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if len(s.calls) == 0 || s.calls[0] == nil {
+		if len(s.calls) > 0 {
+			s.calls = s.calls[1:]
+		}
+		http.Error(w, "unavailable", http.StatusInternalServerError)
+		return
+	}
+	args, _ := json.Marshal(s.calls[0])
+	s.calls = s.calls[1:]
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"choices": []interface{}{map[string]interface{}{
+			"message": map[string]interface{}{
+				"content": "",
+				"tool_calls": []interface{}{map[string]interface{}{
+					"id":       "call_replan",
+					"type":     "function",
+					"function": map[string]interface{}{"name": "planning", "arguments": string(args)},
+				}},
+			},
+		}},
+	})
+}
+
+func TestReplanCountsOnlySuccessfulUpdates(t *testing.T) {
+	stub := &replanStub{calls: []map[string]interface{}{
+		nil,
+		{"command": "create", "title": "新计划", "steps": []string{"a"}},
+		{"command": "mark_step", "step_index": 1, "step_status": "skipped"},
+	}}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+	model := &llm.LLM{Model: "stub", BaseURL: server.URL + "/", APIType: "openai", Client: server.Client()}
+
+	planner := NewPlanningAgent("Planner", model, tool.NewToolCollection())
+	planner.MaxReplans = 1
+	ctx := context.Background()
+	if _, err := planner.PlanningTool.Execute(ctx, map[string]interface{}{
+		"command": "create", "plan_id": planner.ActivePlanID, "title": "计划", "steps": []interface{}{"查找", "总结"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, want := range []bool{false, false, true, false} {
+		if got := planner.replan(ctx, []string{"步骤失败"}); got != want {
+			t.Errorf("第 %d 次重新规划返回 %v，期望 %v", i+1, got, want)
+		}
+	}
+	if planner.replans != 1 {
+		t.Errorf("重新规划次数为 %d，期望 1", planner.replans)
+	}
+}
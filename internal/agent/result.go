@@ -0,0 +1,116 @@
+package agent
+
+import (
+	"time"
+)
+
+// RunStatus 表示一次运行的结束状态
+type RunStatus string
+
+const (
+	RunStatusSuccess        RunStatus = "success"         // 代理完成了任务
+	RunStatusFailure        RunStatus = "failure"         // 执行出错，或代理陷入循环被强制终止
+	RunStatusCancelled      RunStatus = "cancelled"       // 被用户取消
+	RunStatusBudgetExceeded RunStatus = "budget_exceeded" // 达到最大步骤数时仍未完成
+)
+
+// ToolCallRecord 记录步骤中的一次工具调用
+type ToolCallRecord struct {
+	Name      string        `json:"name"`
+	Arguments string        `json:"arguments"`
+	Result    string        `json:"result"`
+	Failed    bool          `json:"failed"`
+	Duration  time.Duration `json:"duration"`
+	Artifacts []string      `json:"artifacts,omitempty"` // 工具调用产生的文件
+}
+
+// StepRecord 记录运行中的一个步骤
+type StepRecord struct {
+	Number    int              `json:"number"`
+	Output    string           `json:"output"` // 步骤执行器返回的结果
+	ToolCalls []ToolCallRecord `json:"tool_calls,omitempty"`
+	Duration  time.Duration    `json:"duration"`
+	Note      string           `json:"note,omitempty"` // 循环恢复、执行错误等附加说明
+}
+
+// RunResult 是代理处理一次请求的结构化结果
+// 前端只需要展示Answer，步骤详情按需查看
+type RunResult struct {
+	RunID      string        `json:"run_id,omitempty"`
+	Agent      string        `json:"agent"`
+	Answer     string        `json:"answer"` // 给用户的最终回答
+	Status     RunStatus     `json:"status"`
+	Steps      []StepRecord  `json:"steps,omitempty"`
+	TokensUsed int           `json:"tokens_used"`
+	Artifacts  []string      `json:"artifacts,omitempty"` // 运行中产生的文件
+	Warnings   []string      `json:"warnings,omitempty"`  // 需要提示用户的问题，例如回答未通过验证
+	Duration   time.Duration `json:"duration"`
+}
+
+// Succeeded 检查运行是否完成了任务
+func (r *RunResult) Succeeded() bool {
+	return r != nil && r.Status == RunStatusSuccess
+}
+
+// ToolCallCount 返回运行中的工具调用总数
+func (r *RunResult) ToolCallCount() int {
+	count := 0
+	for _, step := range r.Steps {
+		count += len(step.ToolCalls)
+	}
+	return count
+}
+
+// Extend 合并重试产生的运行结果，最终回答和状态以后一次运行为准，步骤接着之前的编号
+func (r *RunResult) Extend(next *RunResult) {
+	if next == nil {
+		return
+	}
+
+	offset := 0
+	if len(r.Steps) > 0 {
+		offset = r.Steps[len(r.Steps)-1].Number
+	}
+	for _, step := range next.Steps {
+		step.Number += offset
+		r.Steps = append(r.Steps, step)
+	}
+
+	if next.RunID != "" {
+		r.RunID = next.RunID
+	}
+	r.Answer = next.Answer
+	r.Status = next.Status
+	r.TokensUsed += next.TokensUsed
+	r.Duration += next.Duration
+	r.Artifacts = appendUnique(r.Artifacts, next.Artifacts...)
+	r.Warnings = append(r.Warnings, next.Warnings...)
+}
+
+// collectArtifacts 按首次出现的顺序收集步骤中工具调用产生的文件
+func collectArtifacts(steps []StepRecord) []string {
+	var artifacts []string
+	for _, step := range steps {
+		for _, call := range step.ToolCalls {
+			artifacts = appendUnique(artifacts, call.Artifacts...)
+		}
+	}
+	return artifacts
+}
+
+// appendUnique 追加列表中还没有的元素
+func appendUnique(list []string, items ...string) []string {
+	for _, item := range items {
+		exists := false
+		for _, existing := range list {
+			if existing == item {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			list = append(list, item)
+		}
+	}
+	return list
+}
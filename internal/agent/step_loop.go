@@ -0,0 +1,134 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gomanus/internal/schema"
+	"gomanus/pkg/logger"
+)
+
+// 未配置时单个计划步骤的默认预算
+const (
+	defaultStepMaxIterations = 10
+	defaultStepTimeout       = 300 * time.Second
+)
+
+// StepBudget 限制执行单个计划步骤时的资源消耗，字段为0表示不限制
+type StepBudget struct {
+	MaxIterations int           // 思考-行动循环的最大轮数
+	Timeout       time.Duration // 步骤的最长执行时间
+	MaxTokens     int           // 步骤可以消耗的最大token数
+}
+
+// runStepLoop 让执行器循环思考和行动，直到调用terminate、给出不再调用工具的最终回答或超出预算
+// 返回执行器对本步骤的总结
+func runStepLoop(ctx context.Context, executor *ToolCallAgent, budget StepBudget) (string, error) {
+	stepCtx := ctx
+	if budget.Timeout > 0 {
+		var cancel context.CancelFunc
+		stepCtx, cancel = context.WithTimeout(ctx, budget.Timeout)
+		defer cancel()
+	}
+
+	executor.SetState(StateRunning)
+	executor.takeFailure()
+	defer func() {
+		executor.resetLoopRecovery()
+		executor.SetState(StateIdle)
+	}()
+
+	var lastResult string
+	for iteration := 1; ; iteration++ {
+		if budget.MaxIterations > 0 && iteration > budget.MaxIterations {
+			return "", fmt.Errorf("步骤超出预算: 执行了 %d 轮仍未完成", budget.MaxIterations)
+		}
+		executor.CurrentStep++
+		logger.Info("执行器 %s 第 %d 轮", executor.Name, iteration)
+
+		result, err := executor.Step(stepCtx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			if stepCtx.Err() != nil {
+				return "", fmt.Errorf("步骤超出预算: 执行时间超过 %s", budget.Timeout)
+			}
+			return "", fmt.Errorf("执行步骤失败: %w", err)
+		}
+		lastResult = result
+
+		messages := executor.Memory.GetMessages()
+		if executor.GetState() == StateFinished || isFinalAnswer(messages) {
+			break
+		}
+
+		if budget.MaxTokens > 0 {
+			if used := executor.GetTokensUsed(); used >= budget.MaxTokens {
+				return "", fmt.Errorf("步骤超出预算: 已消耗 %d 个token (上限 %d)", used, budget.MaxTokens)
+			}
+		}
+
+		// 检查是否陷入循环，多次恢复无效时作为失败交给重新规划处理
+		if signal := executor.detectLoop(); signal.Kind != LoopNone {
+			recovery := executor.handleStuckState(signal)
+			if executor.GetState() == StateFinished {
+				if signal.Kind == LoopRepeatedAnswer {
+					break
+				}
+				return "", fmt.Errorf("步骤陷入循环: %s", recovery)
+			}
+		}
+	}
+
+	// 执行器通过terminate报告失败时作为步骤失败处理
+	if failure := executor.takeFailure(); failure != "" {
+		return "", errors.New(failure)
+	}
+	return stepSummary(executor.Memory.GetMessages(), lastResult), nil
+}
+
+// terminateFailure 返回terminate调用报告的失败原因，调用没有报告失败时返回空字符串
+func terminateFailure(params map[string]interface{}) string {
+	if status, _ := params["status"].(string); status != "failure" {
+		return ""
+	}
+	if message, _ := params["message"].(string); message != "" {
+		return "代理报告任务失败: " + message
+	}
+	return "代理报告任务失败"
+}
+
+// isFinalAnswer 判断最后一条消息是否为不再调用工具的助手回答
+func isFinalAnswer(messages []schema.Message) bool {
+	if len(messages) == 0 {
+		return false
+	}
+	last := messages[len(messages)-1]
+	return last.Role == "assistant" && len(last.ToolCalls) == 0
+}
+
+// stepSummary 提取执行器对步骤的总结，依次使用terminate的message参数、最后的助手回答和最后一轮的结果
+func stepSummary(messages []schema.Message, lastResult string) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		for _, call := range messages[i].ToolCalls {
+			if call.Function.Name != "terminate" {
+				continue
+			}
+			var args struct {
+				Message string `json:"message"`
+			}
+			if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err == nil && args.Message != "" {
+				return args.Message
+			}
+		}
+	}
+
+	if content := lastAssistantContent(messages); content != "" {
+		return content
+	}
+	return lastResult
+}
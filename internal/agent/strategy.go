@@ -0,0 +1,250 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gomanus/internal/schema"
+	"gomanus/internal/tool"
+	"gomanus/pkg/logger"
+)
+
+// 代理的执行策略，除chat外都可以在请求时通过 WithStrategy 切换
+const (
+	StrategyReact       = "react"        // 使用模型原生的函数调用循环调用工具直到完成任务
+	StrategyReactText   = "react_text"   // 文本格式的 Thought/Action/Observation 循环，不依赖模型的函数调用
+	StrategyPlanExecute = "plan_execute" // 先制定计划，再由执行器执行各个步骤
+	StrategyReflexion   = "reflexion"    // 完成后自我评审，未达成目标时反思并重试
+	StrategyChat        = "chat"         // 直接对话，不使用工具
+)
+
+// defaultReflexionRetries 是反思策略在评审未通过后重试的默认次数
+const defaultReflexionRetries = 2
+
+// Strategy 定义代理处理一次请求的推理控制循环
+type Strategy interface {
+	Name() string
+	// Execute 使用代理的记忆和工具处理请求，stepper 为代理的原生步骤实现
+	Execute(ctx context.Context, agent *ToolCallAgent, stepper Stepper, request string) (*RunResult, error)
+}
+
+// strategyFactories 是可以由使用工具的代理选择的执行策略
+var strategyFactories = map[string]func() Strategy{
+	StrategyReact:       func() Strategy { return reactStrategy{} },
+	StrategyReactText:   func() Strategy { return reactTextStrategy{} },
+	StrategyPlanExecute: func() Strategy { return planExecuteStrategy{} },
+	StrategyReflexion:   func() Strategy { return reflexionStrategy{MaxRetries: defaultReflexionRetries} },
+}
+
+// NewStrategy 根据名称创建执行策略
+func NewStrategy(name string) (Strategy, error) {
+	factory, exists := strategyFactories[name]
+	if !exists {
+		return nil, fmt.Errorf("未知的执行策略 '%s'，可选: %s", name, strings.Join(StrategyNames(), "、"))
+	}
+	return factory(), nil
+}
+
+// StrategyNames 返回可以选择的执行策略名称
+func StrategyNames() []string {
+	names := make([]string, 0, len(strategyFactories))
+	for name := range strategyFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// strategyKey 是上下文中记录本次请求指定的执行策略的键
+type strategyKey struct{}
+
+// WithStrategy 在上下文中指定本次请求使用的执行策略，覆盖代理配置中的策略
+func WithStrategy(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, strategyKey{}, name)
+}
+
+// strategyFromContext 返回上下文中指定的执行策略名称
+func strategyFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(strategyKey{}).(string)
+	return name
+}
+
+// reactStrategy 使用模型原生的函数调用循环执行，直到代理调用terminate或给出最终回答
+type reactStrategy struct{}
+
+// Name 返回策略名称
+func (reactStrategy) Name() string { return StrategyReact }
+
+// Execute 执行原生函数调用循环
+func (reactStrategy) Execute(ctx context.Context, agent *ToolCallAgent, stepper Stepper, request string) (*RunResult, error) {
+	return agent.BaseAgent.RunWithStepper(ctx, request, stepper)
+}
+
+// reactTextStrategy 让模型以文本输出 Thought/Action/Action Input，由代理解析并执行工具
+// 适用于不支持函数调用的模型，也便于和原生函数调用对比效果
+type reactTextStrategy struct{}
+
+// Name 返回策略名称
+func (reactTextStrategy) Name() string { return StrategyReactText }
+
+// Execute 执行文本格式的ReAct循环
+func (reactTextStrategy) Execute(ctx context.Context, agent *ToolCallAgent, stepper Stepper, request string) (*RunResult, error) {
+	return agent.BaseAgent.RunWithStepper(ctx, request, &textReActStepper{agent: agent})
+}
+
+var (
+	textFinalAnswerRegex = regexp.MustCompile(`(?s)Final Answer[:：]\s*(.*)`)
+	textActionRegex      = regexp.MustCompile(`(?s)Action[:：]\s*([\w\-]+)\s*(?:\n\s*Action Input[:：]\s*(.*?))?\s*(?:\nObservation[:：]|$)`)
+)
+
+// textReActStepper 执行文本ReAct循环的一个步骤：请求模型、解析动作、执行工具并记录观察结果
+type textReActStepper struct {
+	agent *ToolCallAgent
+}
+
+// Step 执行一次思考和行动
+func (s *textReActStepper) Step(ctx context.Context) (string, error) {
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+
+	a := s.agent
+	system := schema.NewSystemMessage(renderPrompt(promptData(a.Name, a.Tools), "react_text"))
+	response, err := a.LLM.AskTool(ctx, a.Memory.GetMessages(), []schema.Message{system}, nil, "")
+	if err != nil {
+		return "", fmt.Errorf("发送消息到LLM失败: %w", err)
+	}
+	a.recordUsage(response.Usage)
+	a.AddMessage(schema.NewAssistantMessage(response.Content))
+
+	// 优先识别动作，模型有时会在动作之后提前写出最终回答
+	match := textActionRegex.FindStringSubmatch(response.Content)
+	if match == nil {
+		answer := strings.TrimSpace(response.Content)
+		if final := textFinalAnswerRegex.FindStringSubmatch(response.Content); final != nil {
+			answer = strings.TrimSpace(final[1])
+		}
+		a.SetState(StateFinished)
+		return answer, nil
+	}
+
+	name := match[1]
+	params := map[string]interface{}{}
+	if input := jsonObject(match[2]); input != "" {
+		if err := json.Unmarshal([]byte(input), &params); err != nil {
+			observation := fmt.Sprintf("Observation: Action Input 不是有效的JSON: %v", err)
+			a.AddMessage(schema.NewUserMessage(observation))
+			return observation, nil
+		}
+	}
+
+	logger.Info("代理 %s 执行文本动作: %s", a.Name, name)
+	began := time.Now()
+	result, err := a.Tools.ExecuteTool(a.policyContext(ctx), name, params)
+	record := ToolCallRecord{Name: name, Arguments: jsonObject(match[2]), Duration: time.Since(began)}
+	var observation string
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		observation = fmt.Sprintf("Observation: 错误: %v", err)
+		record.Result, record.Failed = err.Error(), true
+	} else {
+		observation = fmt.Sprintf("Observation: %v", result)
+		record.Result = fmt.Sprintf("%v", result)
+		if t, err := a.Tools.GetTool(name); err == nil {
+			record.Artifacts = tool.ArtifactsOf(t, params)
+		}
+	}
+	a.AddMessage(schema.NewUserMessage(observation))
+	a.recordToolCalls(record)
+
+	if name == "terminate" && err == nil {
+		a.SetState(StateFinished)
+		if failure := terminateFailure(params); failure != "" {
+			a.reportFailure(failure)
+		}
+		if message, ok := params["message"].(string); ok && message != "" {
+			return message, nil
+		}
+	}
+	return observation, nil
+}
+
+// jsonObject 提取文本中第一个 { 到最后一个 } 之间的JSON对象
+func jsonObject(text string) string {
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return ""
+	}
+	return text[start : end+1]
+}
+
+// planExecuteStrategy 先为请求制定计划，再由代理作为默认执行器执行各个步骤
+type planExecuteStrategy struct{}
+
+// Name 返回策略名称
+func (planExecuteStrategy) Name() string { return StrategyPlanExecute }
+
+// Execute 创建临时的规划代理执行请求，规划代理使用代理的模型和工具
+func (planExecuteStrategy) Execute(ctx context.Context, agent *ToolCallAgent, stepper Stepper, request string) (*RunResult, error) {
+	planner := NewPlanningAgent(agent.Name+"_planner", agent.LLM, agent.Tools)
+	planner.AddExecutor("default", agent)
+	planner.RegisterExecutorProfiles(LoadExecutorProfiles(), agent.Tools)
+
+	result, err := planner.Run(ctx, request)
+	if result != nil {
+		result.Agent = agent.Name
+	}
+	if err != nil {
+		return result, err
+	}
+	agent.AddMessage(schema.NewUserMessage(request))
+	agent.AddMessage(schema.NewAssistantMessage(result.Answer))
+	return result, nil
+}
+
+// reflexionStrategy 完成任务后由评审者检查结果，未达成目标时让代理反思失败原因后重试
+type reflexionStrategy struct {
+	MaxRetries int
+}
+
+// Name 返回策略名称
+func (reflexionStrategy) Name() string { return StrategyReflexion }
+
+// Execute 执行并在评审未通过时反思重试
+func (r reflexionStrategy) Execute(ctx context.Context, agent *ToolCallAgent, stepper Stepper, request string) (*RunResult, error) {
+	result, err := agent.BaseAgent.RunWithStepper(ctx, request, stepper)
+	if err != nil || result.Status == RunStatusCancelled {
+		return result, err
+	}
+
+	critic := NewVerifierAgent(agent.Name+"_critic", agent.LLM)
+	critic.SystemPrompt = renderPrompt(promptData(critic.Name, nil), "reflexion")
+	critic.MaxRetries = r.MaxRetries
+
+	_, verdict, err := critic.VerifyWithRetries(ctx, request, "", result.Answer,
+		func(ctx context.Context, feedback string) (string, error) {
+			reflection := "请先反思上一次尝试为什么没有达成目标，总结教训，再换一种方法重新完成任务。\n" + feedback
+			retryResult, err := agent.BaseAgent.RunWithStepper(ctx, reflection, stepper)
+			result.Extend(retryResult)
+			if err != nil {
+				return "", err
+			}
+			return result.Answer, nil
+		})
+	if err != nil {
+		return result, err
+	}
+	if verdict != nil && !verdict.Pass {
+		logger.Warn("反思 %d 次后结果仍未通过评审: %s", r.MaxRetries, strings.Join(verdict.Reasons, "; "))
+		result.Warnings = append(result.Warnings, "反思后结果仍未通过评审: "+strings.Join(verdict.Reasons, "; "))
+	}
+	return result, nil
+}
@@ -0,0 +1,201 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"gomanus/internal/policy"
+	"gomanus/internal/schema"
+	"gomanus/internal/tool"
+	"gomanus/pkg/logger"
+)
+
+// defaultMaxConcurrentTools 是未配置时工具调用的默认并发数
+const defaultMaxConcurrentTools = 4
+
+// toolCallOutcome 表示单个工具调用的执行结果
+type toolCallOutcome struct {
+	Call    schema.ToolCall
+	Content string // 写入记忆的工具消息内容
+	Summary string // 步骤结果中的摘要
+	Failed  bool
+
+	Duration  time.Duration // 工具的执行时间
+	Artifacts []string      // 工具调用产生的文件
+}
+
+// record 返回用于运行结果的工具调用记录
+func (o toolCallOutcome) record() ToolCallRecord {
+	return ToolCallRecord{
+		Name:      o.Call.Function.Name,
+		Arguments: o.Call.Function.Arguments,
+		Result:    o.Content,
+		Failed:    o.Failed,
+		Duration:  o.Duration,
+		Artifacts: o.Artifacts,
+	}
+}
+
+// executeToolCalls 执行一组工具调用，返回的结果与调用顺序一致
+// 连续的并发安全调用会在并发上限内同时执行，不安全的调用单独执行
+func (a *ToolCallAgent) executeToolCalls(ctx context.Context, calls []schema.ToolCall) []toolCallOutcome {
+	outcomes := make([]toolCallOutcome, len(calls))
+
+	limit := a.MaxConcurrentTools
+	if limit < 1 {
+		limit = 1
+	}
+
+	var batch []int
+	flush := func() {
+		a.runToolBatch(ctx, calls, batch, outcomes, limit)
+		batch = batch[:0]
+	}
+
+	for i, tc := range calls {
+		if limit > 1 && a.isConcurrencySafe(tc) {
+			batch = append(batch, i)
+			continue
+		}
+
+		// 不安全的调用作为屏障：先完成之前的批次，再单独执行
+		flush()
+		outcomes[i] = a.executeToolCall(ctx, tc)
+	}
+	flush()
+
+	return outcomes
+}
+
+// runToolBatch 在并发上限内执行一批工具调用
+func (a *ToolCallAgent) runToolBatch(ctx context.Context, calls []schema.ToolCall, batch []int, outcomes []toolCallOutcome, limit int) {
+	if len(batch) == 0 {
+		return
+	}
+	if len(batch) == 1 {
+		outcomes[batch[0]] = a.executeToolCall(ctx, calls[batch[0]])
+		return
+	}
+
+	logger.Info("并发执行 %d 个工具调用 (并发上限 %d)", len(batch), limit)
+
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for _, idx := range batch {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				outcomes[idx] = cancelledOutcome(calls[idx], ctx.Err())
+				return
+			}
+
+			outcomes[idx] = a.executeToolCall(ctx, calls[idx])
+		}(idx)
+	}
+	wg.Wait()
+}
+
+// isConcurrencySafe 检查工具调用是否可以并发执行，工具可以根据调用的参数判断
+func (a *ToolCallAgent) isConcurrencySafe(tc schema.ToolCall) bool {
+	t, err := a.Tools.GetTool(tc.Function.Name)
+	if err != nil {
+		// 找不到的工具只会返回错误消息，可以并发处理
+		return true
+	}
+	var params map[string]interface{}
+	if err := json.Unmarshal([]byte(tc.Function.Arguments), &params); err != nil {
+		// 参数无法解析的调用只会返回错误消息，可以并发处理
+		return true
+	}
+	return tool.IsCallConcurrencySafe(t, params)
+}
+
+// executeToolCall 执行单个工具调用，恢复的运行中已经完成的调用直接使用检查点中的结果
+func (a *ToolCallAgent) executeToolCall(ctx context.Context, tc schema.ToolCall) toolCallOutcome {
+	if content, ok := a.completedToolResult(tc.ID); ok {
+		logger.Info("工具调用 %s (%s) 已在中断前完成，跳过执行", tc.Function.Name, tc.ID)
+		return toolCallOutcome{
+			Call:    tc,
+			Content: content,
+			Summary: fmt.Sprintf("工具 %s 执行结果(已恢复): %s", tc.Function.Name, content),
+			Failed:  isFailureResult(content),
+		}
+	}
+
+	began := time.Now()
+	outcome := a.runToolCall(ctx, tc)
+	outcome.Duration = time.Since(began)
+
+	// 被取消的调用没有真正完成，恢复时需要重新执行
+	if ctx.Err() == nil {
+		a.recordToolCompletion(tc.ID, outcome.Content)
+	}
+	return outcome
+}
+
+// runToolCall 查找并执行工具
+func (a *ToolCallAgent) runToolCall(ctx context.Context, tc schema.ToolCall) toolCallOutcome {
+	logger.Info("执行工具调用: %s", tc.Function.Name)
+
+	// 检查上下文是否已取消
+	if ctx.Err() != nil {
+		return cancelledOutcome(tc, ctx.Err())
+	}
+
+	// 查找工具
+	t, err := a.Tools.GetTool(tc.Function.Name)
+	if err != nil {
+		errMsg := fmt.Sprintf("找不到工具 %s: %v", tc.Function.Name, err)
+		logger.Error("%s", errMsg)
+		return toolCallOutcome{Call: tc, Content: errMsg, Summary: errMsg, Failed: true}
+	}
+
+	// 解析参数
+	var params map[string]interface{}
+	if err := json.Unmarshal([]byte(tc.Function.Arguments), &params); err != nil {
+		errMsg := fmt.Sprintf("解析工具参数失败: %v", err)
+		logger.Error("%s", errMsg)
+		return toolCallOutcome{Call: tc, Content: errMsg, Summary: errMsg, Failed: true}
+	}
+
+	// 执行工具（由工具集合检查权限策略）
+	result, err := a.Tools.ExecuteTool(ctx, tc.Function.Name, params)
+	if err != nil {
+		errMsg := fmt.Sprintf("执行工具失败: %v", err)
+		logger.Error("%s", errMsg)
+
+		// 被策略拒绝或参数无效时，向模型返回结构化的错误，便于模型修正后重试
+		content := errMsg
+		var denied *policy.DeniedError
+		var invalid *tool.ValidationError
+		if errors.As(err, &denied) {
+			content = denied.ToolMessage()
+		} else if errors.As(err, &invalid) {
+			content = invalid.ToolMessage()
+		}
+		return toolCallOutcome{Call: tc, Content: content, Summary: errMsg, Failed: true}
+	}
+
+	resultStr := fmt.Sprintf("%v", result)
+	return toolCallOutcome{
+		Call:      tc,
+		Content:   resultStr,
+		Summary:   fmt.Sprintf("工具 %s 执行结果: %s", tc.Function.Name, resultStr),
+		Artifacts: tool.ArtifactsOf(t, params),
+	}
+}
+
+// cancelledOutcome 构造因上下文取消而未执行的工具调用结果
+func cancelledOutcome(tc schema.ToolCall, err error) toolCallOutcome {
+	errMsg := fmt.Sprintf("工具 %s 未执行: %v", tc.Function.Name, err)
+	return toolCallOutcome{Call: tc, Content: errMsg, Summary: errMsg, Failed: true}
+}
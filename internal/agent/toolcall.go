@@ -5,7 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"gomanus/internal/checkpoint"
+	"gomanus/internal/config"
 	"gomanus/internal/llm"
+	"gomanus/internal/policy"
 	"gomanus/internal/schema"
 	"gomanus/internal/tool"
 	"gomanus/pkg/logger"
@@ -14,7 +17,11 @@ import (
 // ToolCallAgent 实现了工具调用的代理
 type ToolCallAgent struct {
 	*ReActAgent
-	Tools *tool.ToolCollection
+	Tools              *tool.ToolCollection
+	SystemPrompt       string         // 每次请求LLM时附带的系统提示，为空则不附带
+	MaxConcurrentTools int            // 同一响应中工具调用的最大并发数
+	Strategy           Strategy       // 处理请求的执行策略，请求上下文中指定的策略优先
+	promptTemplate     promptRenderer // 设置后在每次运行开始时重新渲染SystemPrompt
 }
 
 // NewToolCallAgent 创建新的工具调用代理
@@ -22,15 +29,102 @@ func NewToolCallAgent(name string, llm *llm.LLM, tools *tool.ToolCollection) *To
 	reactAgent := NewReActAgent(name, llm)
 	reactAgent.Description = "工具调用代理 - 能够使用工具执行任务"
 	
+	// 获取运行时配置中的并发上限
+	maxConcurrentTools := defaultMaxConcurrentTools
+	if runtimeCfg, err := config.GetRuntimeConfig(); err != nil {
+		logger.Warn("获取运行时配置失败，使用默认并发数: %v", err)
+	} else if runtimeCfg.MaxConcurrentTools > 0 {
+		maxConcurrentTools = runtimeCfg.MaxConcurrentTools
+	}
+	
 	return &ToolCallAgent{
-		ReActAgent: reactAgent,
-		Tools:      tools,
+		ReActAgent:         reactAgent,
+		Tools:              tools,
+		MaxConcurrentTools: maxConcurrentTools,
+		Strategy:           reactStrategy{},
+	}
+}
+
+// Clone 创建共享模型和工具、但拥有独立记忆和状态的副本，用于并行执行
+func (a *ToolCallAgent) Clone() *ToolCallAgent {
+	clone := NewToolCallAgent(a.Name, a.LLM, a.Tools)
+	clone.Description = a.Description
+	clone.SystemPrompt = a.SystemPrompt
+	clone.promptTemplate = a.promptTemplate
+	clone.MaxConcurrentTools = a.MaxConcurrentTools
+	clone.Strategy = a.Strategy
+	clone.MaxSteps = a.MaxSteps
+	clone.refreshSystemPrompt()
+	return clone
+}
+
+// policyContext 在上下文中标记权限策略使用的代理名称
+// 子代理和执行器代替父代理完成任务，上下文中已有代理名称时沿用父代理的名称，使代理范围的规则同样约束委托的任务
+func (a *ToolCallAgent) policyContext(ctx context.Context) context.Context {
+	if policy.ScopeFromContext(ctx).Agent != "" {
+		return ctx
+	}
+	return policy.WithAgent(ctx, a.Name)
+}
+
+// refreshSystemPrompt 使用提示模板重新渲染系统提示，没有模板时保留固定的系统提示
+func (a *ToolCallAgent) refreshSystemPrompt() {
+	if a.promptTemplate != nil {
+		a.SystemPrompt = a.promptTemplate()
+	}
+}
+
+// Run 由执行策略驱动推理循环，原生函数调用的步骤使用ToolCallAgent自身的Step
+func (a *ToolCallAgent) Run(ctx context.Context, request string) (*RunResult, error) {
+	strategy, err := a.resolveStrategy(ctx)
+	if err != nil {
+		return nil, err
 	}
+	return strategy.Execute(ctx, a, a, request)
 }
 
-// Run 重写Run方法以确保使用正确的Step实现
-func (a *ToolCallAgent) Run(ctx context.Context, request string) (string, error) {
-	return a.BaseAgent.RunWithStepper(ctx, request, a)
+// resolveStrategy 返回本次请求使用的执行策略，请求上下文中指定的策略优先于代理配置的策略
+func (a *ToolCallAgent) resolveStrategy(ctx context.Context) (Strategy, error) {
+	strategy := a.Strategy
+	if strategy == nil {
+		strategy = reactStrategy{}
+	}
+	if name := strategyFromContext(ctx); name != "" && name != strategy.Name() {
+		return NewStrategy(name)
+	}
+	return strategy, nil
+}
+
+// Step 执行单个步骤，使用ToolCallAgent自身的Think和Act
+func (a *ToolCallAgent) Step(ctx context.Context) (string, error) {
+	// 检查上下文是否已取消
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	
+	// 思考
+	logger.Info("代理 %s 正在思考...", a.Name)
+	shouldAct, err := a.Think(ctx)
+	if err != nil {
+		return "", fmt.Errorf("思考失败: %w", err)
+	}
+	
+	// 如果不需要行动，返回最后的助手消息
+	if !shouldAct {
+		if content := lastAssistantContent(a.Memory.GetMessages()); content != "" {
+			return content, nil
+		}
+		return "思考完成，无需行动", nil
+	}
+	
+	// 行动
+	logger.Info("代理 %s 正在行动...", a.Name)
+	result, err := a.Act(ctx)
+	if err != nil {
+		return "", fmt.Errorf("行动失败: %w", err)
+	}
+	
+	return result, nil
 }
 
 // Think 思考下一步行动，解析LLM响应中的工具调用
@@ -41,12 +135,19 @@ func (a *ToolCallAgent) Think(ctx context.Context) (bool, error) {
 		return false, fmt.Errorf("没有消息可处理")
 	}
 	
+	// 准备系统消息
+	var systemMsgs []schema.Message
+	if a.SystemPrompt != "" {
+		systemMsgs = []schema.Message{schema.NewSystemMessage(a.SystemPrompt)}
+	}
+	
 	// 向LLM发送请求
 	logger.Info("向LLM发送请求...")
-	response, err := a.LLM.AskTool(ctx, messages, nil, a.Tools.GetToolDefinitions(), "auto")
+	response, err := a.LLM.AskTool(ctx, messages, systemMsgs, a.Tools.GetToolDefinitions(), a.nextToolChoice())
 	if err != nil {
 		return false, fmt.Errorf("发送消息到LLM失败: %w", err)
 	}
+	a.recordUsage(response.Usage)
 	
 	// 将LLM响应添加到记忆中
 	a.AddMessage(schema.Message{
@@ -95,78 +196,42 @@ func (a *ToolCallAgent) Act(ctx context.Context) (string, error) {
 		return "", fmt.Errorf("没有找到工具调用")
 	}
 	
-	// 执行每个工具调用
+	// 在执行前保存检查点，记录待完成的工具调用
+	a.saveCheckpoint(checkpoint.StatusRunning)
+	
+	// 在上下文中标记调用方代理，供权限策略使用
+	ctx = a.policyContext(ctx)
+	
+	// 执行工具调用，独立的调用会并发执行
+	outcomes := a.executeToolCalls(ctx, llmResponse.ToolCalls)
+	
+	// 按原始调用顺序添加工具结果
 	var results []string
-	for _, tc := range llmResponse.ToolCalls {
-		logger.Info("执行工具调用: %s", tc.Function.Name)
-		
-		// 查找工具
-		tool, err := a.Tools.GetTool(tc.Function.Name)
-		if err != nil {
-			errMsg := fmt.Sprintf("找不到工具 %s: %v", tc.Function.Name, err)
-			logger.Error(errMsg)
-			
-			// 添加错误消息
-			a.AddMessage(schema.Message{
-				Role:       "tool",
-				ToolCallID: tc.ID,
-				Content:    errMsg,
-			})
-			
-			results = append(results, errMsg)
-			continue
-		}
-		
-		// 解析参数
-		var params map[string]interface{}
-		if err := json.Unmarshal([]byte(tc.Function.Arguments), &params); err != nil {
-			errMsg := fmt.Sprintf("解析工具参数失败: %v", err)
-			logger.Error(errMsg)
-			
-			// 添加错误消息
-			a.AddMessage(schema.Message{
-				Role:       "tool",
-				ToolCallID: tc.ID,
-				Content:    errMsg,
-			})
-			
-			results = append(results, errMsg)
-			continue
-		}
-		
-		// 执行工具
-		result, err := tool.Execute(ctx, params)
-		if err != nil {
-			errMsg := fmt.Sprintf("执行工具失败: %v", err)
-			logger.Error(errMsg)
-			
-			// 添加错误消息
-			a.AddMessage(schema.Message{
-				Role:       "tool",
-				ToolCallID: tc.ID,
-				Content:    errMsg,
-			})
-			
-			results = append(results, errMsg)
-			continue
-		}
-		
-		// 添加工具结果
-		resultStr := fmt.Sprintf("%v", result)
+	for _, outcome := range outcomes {
 		a.AddMessage(schema.Message{
 			Role:       "tool",
-			ToolCallID: tc.ID,
-			Content:    resultStr,
+			ToolCallID: outcome.Call.ID,
+			Content:    outcome.Content,
 		})
 		
 		// 检查是否是terminate工具，如果是则设置代理状态为完成
-		if tc.Function.Name == "terminate" {
+		if outcome.Call.Function.Name == "terminate" && !outcome.Failed {
 			logger.Info("检测到terminate工具调用，设置代理状态为完成")
 			a.SetState(StateFinished)
+			var params map[string]interface{}
+			if err := json.Unmarshal([]byte(outcome.Call.Function.Arguments), &params); err == nil {
+				if failure := terminateFailure(params); failure != "" {
+					a.reportFailure(failure)
+				}
+			}
 		}
 		
-		results = append(results, fmt.Sprintf("工具 %s 执行结果: %s", tc.Function.Name, resultStr))
+		results = append(results, outcome.Summary)
+		a.recordToolCalls(outcome.record())
 	}
 	
+	// 结果已写入记忆，不再需要单独记录已完成的调用
+	a.clearCompletedToolCalls()
+	
 	return fmt.Sprintf("执行了 %d 个工具调用:\n%s", len(results), results), nil
 }
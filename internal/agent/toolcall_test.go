@@ -0,0 +1,86 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gomanus/internal/llm"
+	"gomanus/internal/tool"
+)
+
+// scriptedReply 根据请求中的消息决定模型的回复，name为空时只返回文本内容
+type scriptedReply func(messages []stubMessage) (content, name string, args map[string]interface{})
+
+// scriptedLLM 创建按reply回复的模型桩，测试结束时关闭
+func scriptedLLM(t *testing.T, reply scriptedReply) *llm.LLM {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []stubMessage `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		content, name, args := reply(body.Messages)
+		message := map[string]interface{}{"content": content}
+		if name != "" {
+			arguments, _ := json.Marshal(args)
+			message["tool_calls"] = []interface{}{map[string]interface{}{
+				"id":       "call_" + name,
+				"type":     "function",
+				"function": map[string]interface{}{"name": name, "arguments": string(arguments)},
+			}}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []interface{}{map[string]interface{}{"message": message}},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return &llm.LLM{Model: "stub", BaseURL: server.URL + "/", APIType: "openai", Client: server.Client()}
+}
+
+func TestRunStatusFollowsTerminateStatus(t *testing.T) {
+	tests := []struct {
+		status      string
+		want        RunStatus
+		wantWarning bool
+	}{
+		{"success", RunStatusSuccess, false},
+		{"failure", RunStatusFailure, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			model := scriptedLLM(t, func(messages []stubMessage) (string, string, map[string]interface{}) {
+				return "", "terminate", map[string]interface{}{"status": tt.status, "message": "没有找到资料"}
+			})
+			tools := tool.NewToolCollection()
+			tools.AddTool(tool.NewTerminate())
+			agent := NewToolCallAgent("Manus", model, tools)
+
+			result, err := agent.Run(context.Background(), "查找资料")
+			if err != nil {
+				t.Fatalf("运行失败: %v", err)
+			}
+			if result.Status != tt.want {
+				t.Errorf("运行状态为 %s，期望 %s", result.Status, tt.want)
+			}
+			if result.Answer != "没有找到资料" {
+				t.Errorf("回答为 %q，期望保留terminate的总结", result.Answer)
+			}
+			if got := len(result.Warnings) > 0 && strings.Contains(result.Warnings[0], "没有找到资料"); got != tt.wantWarning {
+				t.Errorf("警告为 %v", result.Warnings)
+			}
+
+			// 失败不会延续到下一次运行
+			if tt.status == "failure" {
+				if failure := agent.takeFailure(); failure != "" {
+					t.Errorf("运行结束后仍有失败原因: %s", failure)
+				}
+			}
+		})
+	}
+}
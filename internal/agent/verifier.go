@@ -0,0 +1,139 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gomanus/internal/llm"
+	"gomanus/internal/schema"
+	"gomanus/pkg/logger"
+)
+
+// defaultVerifierRetries 是未配置时验证失败后重试的默认次数
+const defaultVerifierRetries = 2
+
+// Verdict 表示验证代理对一次执行结果的判断
+type Verdict struct {
+	Pass       bool     `json:"pass"`
+	Reasons    []string `json:"reasons"`
+	Suggestion string   `json:"suggestion"`
+}
+
+// Feedback 生成反馈给执行者的说明
+func (v *Verdict) Feedback() string {
+	feedback := "验证未通过，原因：\n- " + strings.Join(v.Reasons, "\n- ")
+	if v.Suggestion != "" {
+		feedback += "\n改进建议：" + v.Suggestion
+	}
+	return feedback + "\n请根据以上意见继续完成任务。"
+}
+
+// VerifierAgent 检查执行结果是否达成了目标
+type VerifierAgent struct {
+	*BaseAgent
+	SystemPrompt string // 固定的系统提示，为空时每次验证都渲染verifier模板
+	MaxRetries   int    // 验证失败后允许重试的次数
+}
+
+// NewVerifierAgent 创建新的验证代理
+func NewVerifierAgent(name string, llm *llm.LLM) *VerifierAgent {
+	baseAgent := &BaseAgent{
+		Name:        name,
+		Description: "验证代理 - 检查执行结果是否达成目标",
+		State:       StateIdle,
+		LLM:         llm,
+		Memory:      schema.NewMemory(),
+		MaxSteps:    1, // 验证只需要一步
+		CurrentStep: 0,
+	}
+
+	return &VerifierAgent{
+		BaseAgent:  baseAgent,
+		MaxRetries: defaultVerifierRetries,
+	}
+}
+
+// Verify 检查结果是否达成目标，background 用于补充原始任务等背景信息
+// 每次验证使用独立的消息列表，可以被并行执行的步骤同时调用
+func (a *VerifierAgent) Verify(ctx context.Context, goal, background, result string) (*Verdict, error) {
+	logger.Info("开始验证执行结果，目标: %s", goal)
+
+	// 检查上下文是否已取消
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	prompt := fmt.Sprintf("目标：%s\n\n执行结果：\n%s", goal, result)
+	if background != "" {
+		prompt = fmt.Sprintf("背景：%s\n\n%s", background, prompt)
+	}
+	messages := []schema.Message{
+		schema.NewSystemMessage(a.systemPrompt()),
+		schema.NewUserMessage(prompt),
+	}
+
+	response, err := a.LLM.AskWithOptions(ctx, messages, nil, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("LLM验证失败: %w", err)
+	}
+
+	verdict, err := parseVerdict(response.Content)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("验证结果: pass=%v, 理由: %s", verdict.Pass, strings.Join(verdict.Reasons, "; "))
+	return verdict, nil
+}
+
+// systemPrompt 返回本次验证使用的系统提示
+func (a *VerifierAgent) systemPrompt() string {
+	if a.SystemPrompt != "" {
+		return a.SystemPrompt
+	}
+	return renderPrompt(promptData(a.Name, nil), "verifier")
+}
+
+// parseVerdict 从模型响应中解析验证结果，兼容代码块包裹的JSON
+func parseVerdict(content string) (*Verdict, error) {
+	start := strings.Index(content, "{")
+	end := strings.LastIndex(content, "}")
+	if start < 0 || end <= start {
+		return nil, fmt.Errorf("验证结果不是有效的JSON: %s", content)
+	}
+
+	var verdict Verdict
+	if err := json.Unmarshal([]byte(content[start:end+1]), &verdict); err != nil {
+		return nil, fmt.Errorf("解析验证结果失败: %w", err)
+	}
+	if !verdict.Pass && len(verdict.Reasons) == 0 {
+		verdict.Reasons = []string{"结果没有达成目标"}
+	}
+	return &verdict, nil
+}
+
+// VerifyWithRetries 验证结果，未通过时把意见交给retry重新执行，直到通过或用完重试次数
+// 返回最后一次的结果和验证结论，验证本身出错时结论为nil，结果按未验证处理
+func (a *VerifierAgent) VerifyWithRetries(ctx context.Context, goal, background, result string,
+	retry func(ctx context.Context, feedback string) (string, error)) (string, *Verdict, error) {
+	for attempt := 0; ; attempt++ {
+		verdict, err := a.Verify(ctx, goal, background, result)
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", nil, ctx.Err()
+			}
+			logger.Warn("验证执行结果失败，跳过验证: %v", err)
+			return result, nil, nil
+		}
+		if verdict.Pass || attempt >= a.MaxRetries {
+			return result, verdict, nil
+		}
+
+		logger.Info("结果未通过验证，第 %d/%d 次重试", attempt+1, a.MaxRetries)
+		result, err = retry(ctx, verdict.Feedback())
+		if err != nil {
+			return "", verdict, err
+		}
+	}
+}
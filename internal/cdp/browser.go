@@ -0,0 +1,274 @@
+package cdp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"gomanus/pkg/logger"
+)
+
+// devToolsPattern 匹配Chromium启动后在标准错误中输出的调试地址
+var devToolsPattern = regexp.MustCompile(`DevTools listening on (ws://\S+)`)
+
+// LaunchOptions 是启动Chromium的选项
+type LaunchOptions struct {
+	Path     string   // 可执行文件，为空时自动查找
+	Headless bool     // 是否以无界面模式运行
+	Args     []string // 额外的命令行参数
+}
+
+// Browser 是一个通过CDP连接的浏览器，可能由Launch启动，也可能是Connect连接的已运行的浏览器
+type Browser struct {
+	conn        *Conn
+	cmd         *exec.Cmd // 由Launch启动的浏览器进程
+	userDataDir string    // 由Launch创建的临时用户数据目录
+	exited      chan struct{}
+}
+
+// FindChrome 在PATH和常见的安装位置中查找Chromium或Chrome
+func FindChrome() (string, error) {
+	names := []string{"chromium", "chromium-browser", "google-chrome", "google-chrome-stable", "chrome", "headless_shell"}
+	for _, name := range names {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+
+	var candidates []string
+	switch runtime.GOOS {
+	case "darwin":
+		candidates = []string{
+			"/Applications/Google Chrome.app/Contents/MacOS/Google Chrome",
+			"/Applications/Chromium.app/Contents/MacOS/Chromium",
+		}
+	case "windows":
+		for _, dir := range []string{os.Getenv("ProgramFiles"), os.Getenv("ProgramFiles(x86)"), os.Getenv("LocalAppData")} {
+			if dir != "" {
+				candidates = append(candidates, filepath.Join(dir, "Google", "Chrome", "Application", "chrome.exe"))
+			}
+		}
+	}
+	for _, path := range candidates {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("没有找到Chromium或Chrome，请安装浏览器或配置chrome_path")
+}
+
+// Launch 启动Chromium并连接它的调试地址，浏览器使用临时的用户数据目录，Close时删除
+func Launch(ctx context.Context, opts LaunchOptions) (*Browser, error) {
+	path := opts.Path
+	if path == "" {
+		found, err := FindChrome()
+		if err != nil {
+			return nil, err
+		}
+		path = found
+	}
+
+	userDataDir, err := os.MkdirTemp("", "gomanus-chromium-")
+	if err != nil {
+		return nil, fmt.Errorf("创建浏览器数据目录失败: %w", err)
+	}
+	args := []string{
+		"--remote-debugging-port=0",
+		"--user-data-dir=" + userDataDir,
+		"--no-first-run",
+		"--no-default-browser-check",
+		"--disable-background-networking",
+		"--disable-sync",
+		"--disable-extensions",
+		"--mute-audio",
+	}
+	if opts.Headless {
+		args = append(args, "--headless=new", "--hide-scrollbars")
+	}
+	// Chromium拒绝以root用户运行沙箱，容器中常见这种情况
+	if runtime.GOOS == "linux" && os.Geteuid() == 0 {
+		args = append(args, "--no-sandbox")
+	}
+	args = append(args, opts.Args...)
+	args = append(args, "about:blank")
+
+	cmd := exec.Command(path, args...)
+	detachProcess(cmd)
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		os.RemoveAll(userDataDir)
+		return nil, fmt.Errorf("创建标准错误管道失败: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		os.RemoveAll(userDataDir)
+		return nil, fmt.Errorf("启动浏览器 %s 失败: %w", path, err)
+	}
+
+	b := &Browser{cmd: cmd, userDataDir: userDataDir, exited: make(chan struct{})}
+	wsURL := make(chan string, 1)
+	go b.readStderr(stderr, wsURL)
+
+	select {
+	case address, ok := <-wsURL:
+		if !ok {
+			b.Close()
+			return nil, fmt.Errorf("浏览器 %s 启动后没有输出调试地址", path)
+		}
+		conn, err := Dial(ctx, address)
+		if err != nil {
+			b.Close()
+			return nil, fmt.Errorf("连接浏览器失败: %w", err)
+		}
+		b.conn = conn
+		logger.Info("已启动浏览器 %s (PID %d)", path, cmd.Process.Pid)
+		return b, nil
+	case <-ctx.Done():
+		b.Close()
+		return nil, fmt.Errorf("等待浏览器启动超时: %w", ctx.Err())
+	}
+}
+
+// readStderr 从标准错误中找到调试地址，之后继续读取输出直到进程退出，避免浏览器因管道写满而阻塞
+func (b *Browser) readStderr(stderr io.Reader, wsURL chan<- string) {
+	defer close(b.exited)
+	found := false
+	var lines []string
+	scanner := bufio.NewScanner(stderr)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if found {
+			continue
+		}
+		if match := devToolsPattern.FindStringSubmatch(line); match != nil {
+			found = true
+			wsURL <- match[1]
+			continue
+		}
+		if len(lines) < 20 {
+			lines = append(lines, line)
+		}
+	}
+	if !found {
+		if len(lines) > 0 {
+			logger.Warn("浏览器的输出: %s", strings.Join(lines, "\n"))
+		}
+		close(wsURL)
+	}
+	b.cmd.Wait()
+}
+
+// Connect 连接已运行的浏览器，endpoint可以是ws://开头的调试地址，
+// 也可以是 http://127.0.0.1:9222 这样的调试端口地址，此时从 /json/version 获取调试地址
+func Connect(ctx context.Context, endpoint string) (*Browser, error) {
+	wsURL := endpoint
+	if strings.HasPrefix(endpoint, "http://") || strings.HasPrefix(endpoint, "https://") {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(endpoint, "/")+"/json/version", nil)
+		if err != nil {
+			return nil, fmt.Errorf("无效的浏览器地址: %w", err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("获取浏览器调试地址失败: %w", err)
+		}
+		defer resp.Body.Close()
+		var version struct {
+			WebSocketDebuggerURL string `json:"webSocketDebuggerUrl"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&version); err != nil {
+			return nil, fmt.Errorf("解析浏览器版本信息失败: %w", err)
+		}
+		if version.WebSocketDebuggerURL == "" {
+			return nil, fmt.Errorf("浏览器没有返回调试地址")
+		}
+		wsURL = version.WebSocketDebuggerURL
+	}
+
+	conn, err := Dial(ctx, wsURL)
+	if err != nil {
+		return nil, fmt.Errorf("连接浏览器失败: %w", err)
+	}
+	return &Browser{conn: conn}, nil
+}
+
+// Alive 检查与浏览器的连接是否正常
+func (b *Browser) Alive() bool {
+	return b.conn != nil && b.conn.Err() == nil
+}
+
+// NewPage 在新的浏览器上下文中打开空白页面，每个上下文有独立的Cookie和缓存
+func (b *Browser) NewPage(ctx context.Context) (*Page, error) {
+	var browserContext struct {
+		BrowserContextID string `json:"browserContextId"`
+	}
+	if err := b.conn.Call(ctx, "", "Target.createBrowserContext", map[string]interface{}{"disposeOnDetach": true}, &browserContext); err != nil {
+		return nil, fmt.Errorf("创建浏览器上下文失败: %w", err)
+	}
+
+	var target struct {
+		TargetID string `json:"targetId"`
+	}
+	err := b.conn.Call(ctx, "", "Target.createTarget", map[string]interface{}{
+		"url":              "about:blank",
+		"browserContextId": browserContext.BrowserContextID,
+	}, &target)
+	if err != nil {
+		b.conn.Call(ctx, "", "Target.disposeBrowserContext", map[string]interface{}{"browserContextId": browserContext.BrowserContextID}, nil)
+		return nil, fmt.Errorf("创建页面失败: %w", err)
+	}
+
+	page := &Page{
+		conn:      b.conn,
+		targetID:  target.TargetID,
+		contextID: browserContext.BrowserContextID,
+		blockedCh: make(chan struct{}, 1),
+	}
+	var attached struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := b.conn.Call(ctx, "", "Target.attachToTarget", map[string]interface{}{"targetId": target.TargetID, "flatten": true}, &attached); err != nil {
+		page.Close(ctx)
+		return nil, fmt.Errorf("连接页面失败: %w", err)
+	}
+	page.sessionID = attached.SessionID
+
+	if err := page.call(ctx, "Page.enable", nil, nil); err != nil {
+		page.Close(ctx)
+		return nil, fmt.Errorf("启用页面事件失败: %w", err)
+	}
+	return page, nil
+}
+
+// Close 断开与浏览器的连接，由Launch启动的浏览器会被关闭并删除临时数据目录
+func (b *Browser) Close() error {
+	if b.conn != nil && b.cmd != nil {
+		// 先请求浏览器正常退出，超时后再结束进程
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		b.conn.Call(ctx, "", "Browser.close", nil, nil)
+		cancel()
+	}
+	if b.conn != nil {
+		b.conn.Close()
+	}
+	if b.cmd == nil {
+		return nil
+	}
+
+	select {
+	case <-b.exited:
+	case <-time.After(3 * time.Second):
+		b.cmd.Process.Kill()
+		<-b.exited
+	}
+	return os.RemoveAll(b.userDataDir)
+}
@@ -0,0 +1,224 @@
+// Package cdp 实现Chrome DevTools协议的客户端，用于驱动本地的Chromium浏览器
+package cdp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"gomanus/pkg/logger"
+)
+
+// message 是CDP连接上的一条消息：带ID的是请求或响应，不带ID的是事件
+type message struct {
+	ID        int64           `json:"id,omitempty"`
+	SessionID string          `json:"sessionId,omitempty"`
+	Method    string          `json:"method,omitempty"`
+	Params    json.RawMessage `json:"params,omitempty"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     *Error          `json:"error,omitempty"`
+}
+
+// Error 是浏览器返回的协议错误
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    string `json:"data,omitempty"`
+}
+
+// Error 实现error接口
+func (e *Error) Error() string {
+	if e.Data != "" {
+		return fmt.Sprintf("CDP错误 %d: %s (%s)", e.Code, e.Message, e.Data)
+	}
+	return fmt.Sprintf("CDP错误 %d: %s", e.Code, e.Message)
+}
+
+// Event 是浏览器发送的事件，SessionID是产生事件的页面会话，浏览器级别的事件为空
+type Event struct {
+	SessionID string
+	Method    string
+	Params    json.RawMessage
+}
+
+// subscription 是一个事件处理函数
+type subscription struct {
+	method  string
+	handler func(Event)
+}
+
+// Conn 是与浏览器之间的CDP连接，可以被多个goroutine同时使用
+type Conn struct {
+	ws     *wsConn
+	nextID atomic.Int64
+
+	mu       sync.Mutex
+	pending  map[int64]chan *message
+	handlers map[int64]subscription
+	nextSub  int64
+	err      error // 连接断开的原因，断开后新的请求直接失败
+	done     chan struct{}
+}
+
+// Dial 连接浏览器或页面的WebSocket调试地址
+func Dial(ctx context.Context, wsURL string) (*Conn, error) {
+	ws, err := dialWebSocket(ctx, wsURL)
+	if err != nil {
+		return nil, err
+	}
+	c := &Conn{
+		ws:       ws,
+		pending:  make(map[int64]chan *message),
+		handlers: make(map[int64]subscription),
+		done:     make(chan struct{}),
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+// Call 调用CDP方法并把结果解码到result中，sessionID为空时调用浏览器级别的方法，params和result可以为nil
+func (c *Conn) Call(ctx context.Context, sessionID, method string, params, result interface{}) error {
+	msg := &message{ID: c.nextID.Add(1), SessionID: sessionID, Method: method}
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return fmt.Errorf("编码 %s 的参数失败: %w", method, err)
+		}
+		msg.Params = data
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("编码 %s 的请求失败: %w", method, err)
+	}
+
+	ch := make(chan *message, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	c.pending[msg.ID] = ch
+	c.mu.Unlock()
+
+	if err := c.ws.writeText(data); err != nil {
+		c.forget(msg.ID)
+		return fmt.Errorf("发送 %s 失败: %w", method, err)
+	}
+
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			return c.Err()
+		}
+		if resp.Error != nil {
+			return fmt.Errorf("%s: %w", method, resp.Error)
+		}
+		if result != nil && len(resp.Result) > 0 {
+			if err := json.Unmarshal(resp.Result, result); err != nil {
+				return fmt.Errorf("解析 %s 的结果失败: %w", method, err)
+			}
+		}
+		return nil
+	case <-ctx.Done():
+		c.forget(msg.ID)
+		return ctx.Err()
+	}
+}
+
+// On 登记事件处理函数，返回取消登记的函数
+// 处理函数在读取消息的goroutine中调用，不能阻塞，需要调用CDP方法时应该启动新的goroutine
+func (c *Conn) On(method string, handler func(Event)) func() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextSub++
+	id := c.nextSub
+	c.handlers[id] = subscription{method: method, handler: handler}
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.handlers, id)
+	}
+}
+
+// Err 返回连接断开的原因，连接正常时返回nil
+func (c *Conn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Done 返回在连接断开时关闭的通道
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close 断开连接，等待中的请求会失败
+func (c *Conn) Close() error {
+	err := c.ws.close()
+	<-c.done
+	return err
+}
+
+// forget 取消等待请求的响应
+func (c *Conn) forget(id int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, id)
+}
+
+// readLoop 读取消息，把响应交给等待中的请求，把事件交给处理函数
+func (c *Conn) readLoop() {
+	defer close(c.done)
+	for {
+		data, err := c.ws.readMessage()
+		if err != nil {
+			c.fail(fmt.Errorf("与浏览器的连接已断开: %w", err))
+			return
+		}
+		var msg message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			logger.Debug("忽略无法解析的CDP消息: %v", err)
+			continue
+		}
+
+		if msg.ID != 0 {
+			c.mu.Lock()
+			ch, exists := c.pending[msg.ID]
+			delete(c.pending, msg.ID)
+			c.mu.Unlock()
+			if exists {
+				ch <- &msg
+			}
+			continue
+		}
+
+		event := Event{SessionID: msg.SessionID, Method: msg.Method, Params: msg.Params}
+		c.mu.Lock()
+		var handlers []func(Event)
+		for _, sub := range c.handlers {
+			if sub.method == msg.Method {
+				handlers = append(handlers, sub.handler)
+			}
+		}
+		c.mu.Unlock()
+		for _, handler := range handlers {
+			handler(event)
+		}
+	}
+}
+
+// fail 连接断开时让所有等待中的请求失败
+func (c *Conn) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+}
@@ -0,0 +1,230 @@
+package cdp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readRequest 读取客户端发送的一条CDP请求
+func (p *wsPeer) readRequest() (message, error) {
+	frame, err := p.readFrame()
+	if err != nil {
+		return message{}, err
+	}
+	if !frame.fin || frame.opcode != opText {
+		return message{}, fmt.Errorf("请求不是完整的文本帧: fin=%v opcode=%d", frame.fin, frame.opcode)
+	}
+	var msg message
+	if err := json.Unmarshal(frame.payload, &msg); err != nil {
+		return message{}, fmt.Errorf("解析请求失败: %w", err)
+	}
+	return msg, nil
+}
+
+// send 把v编码为JSON并作为一条文本消息发送
+func (p *wsPeer) send(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return p.writeFrame(wsFrame{fin: true, opcode: opText, payload: data})
+}
+
+// dialConn 建立CDP连接，返回连接和服务器一端
+func dialConn(t *testing.T) (*Conn, *wsPeer) {
+	t.Helper()
+	server, peers := servePeers(t)
+	conn, err := Dial(context.Background(), wsURL(server, "/"))
+	if err != nil {
+		t.Fatalf("连接失败: %v", err)
+	}
+	peer := <-peers
+	t.Cleanup(func() {
+		peer.conn.Close()
+		conn.Close()
+	})
+	return conn, peer
+}
+
+// callResult 是在goroutine中执行的Call的结果
+type callResult struct {
+	value map[string]interface{}
+	err   error
+}
+
+// goCall 在goroutine中调用CDP方法
+func goCall(ctx context.Context, conn *Conn, sessionID, method string, params interface{}) <-chan callResult {
+	done := make(chan callResult, 1)
+	go func() {
+		var value map[string]interface{}
+		err := conn.Call(ctx, sessionID, method, params, &value)
+		done <- callResult{value, err}
+	}()
+	return done
+}
+
+func TestConnMatchesResponsesByID(t *testing.T) {
+	conn, peer := dialConn(t)
+
+	first := goCall(context.Background(), conn, "s1", "Runtime.evaluate", map[string]interface{}{"expression": "1"})
+	firstReq, err := peer.readRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := goCall(context.Background(), conn, "", "Browser.getVersion", nil)
+	secondReq, err := peer.readRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if firstReq.SessionID != "s1" || firstReq.Method != "Runtime.evaluate" || string(firstReq.Params) != `{"expression":"1"}` {
+		t.Errorf("第一个请求不正确: %+v", firstReq)
+	}
+	if secondReq.SessionID != "" || secondReq.Method != "Browser.getVersion" || secondReq.Params != nil {
+		t.Errorf("第二个请求不正确: %+v", secondReq)
+	}
+	if firstReq.ID == secondReq.ID {
+		t.Fatalf("两个请求使用了相同的ID %d", firstReq.ID)
+	}
+
+	// 先回复后发送的请求，再发送一个没有对应请求的响应
+	for _, reply := range []map[string]interface{}{
+		{"id": secondReq.ID, "result": map[string]interface{}{"method": secondReq.Method}},
+		{"id": 9999, "result": map[string]interface{}{"method": "unknown"}},
+		{"id": firstReq.ID, "sessionId": "s1", "result": map[string]interface{}{"method": firstReq.Method}},
+	} {
+		if err := peer.send(reply); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		done   <-chan callResult
+		method string
+	}{{first, "Runtime.evaluate"}, {second, "Browser.getVersion"}} {
+		result := <-tt.done
+		if result.err != nil {
+			t.Errorf("%s 失败: %v", tt.method, result.err)
+		} else if result.value["method"] != tt.method {
+			t.Errorf("%s 收到了 %v 的结果", tt.method, result.value["method"])
+		}
+	}
+}
+
+func TestConnCallErrors(t *testing.T) {
+	conn, peer := dialConn(t)
+
+	// 浏览器返回的协议错误
+	done := goCall(context.Background(), conn, "", "Page.navigate", nil)
+	req, err := peer.readRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer.send(map[string]interface{}{"id": req.ID, "error": map[string]interface{}{"code": -32000, "message": "Cannot navigate", "data": "invalid url"}})
+	result := <-done
+	var cdpErr *Error
+	if !errors.As(result.err, &cdpErr) || cdpErr.Code != -32000 {
+		t.Fatalf("错误为 %v，期望CDP错误 -32000", result.err)
+	}
+	if want := "Page.navigate: CDP错误 -32000: Cannot navigate (invalid url)"; result.err.Error() != want {
+		t.Errorf("错误为 %q，期望 %q", result.err, want)
+	}
+
+	// 等待超时的请求不影响之后的请求，迟到的响应被丢弃
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done = goCall(ctx, conn, "", "Slow.method", nil)
+	slow, err := peer.readRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := <-done; !errors.Is(result.err, context.DeadlineExceeded) {
+		t.Fatalf("超时的请求返回 %v，期望超时错误", result.err)
+	}
+	peer.send(map[string]interface{}{"id": slow.ID, "result": map[string]interface{}{"late": true}})
+
+	done = goCall(context.Background(), conn, "", "Fast.method", nil)
+	fast, err := peer.readRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer.send(map[string]interface{}{"id": fast.ID, "result": map[string]interface{}{"fast": true}})
+	if result := <-done; result.err != nil || result.value["fast"] != true {
+		t.Errorf("超时之后的请求结果为 %+v", result)
+	}
+}
+
+func TestConnDispatchesEvents(t *testing.T) {
+	conn, peer := dialConn(t)
+
+	loaded := make(chan Event, 10)
+	stop := conn.On("Page.loadEventFired", func(event Event) { loaded <- event })
+	other := make(chan Event, 10)
+	conn.On("Page.frameNavigated", func(event Event) { other <- event })
+
+	// 事件在读取下一条消息之前处理，请求返回时之前的事件已经分发完毕
+	flush := func() {
+		t.Helper()
+		done := goCall(context.Background(), conn, "", "Sync", nil)
+		req, err := peer.readRequest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		peer.send(map[string]interface{}{"id": req.ID, "result": map[string]interface{}{}})
+		if result := <-done; result.err != nil {
+			t.Fatal(result.err)
+		}
+	}
+
+	peer.send(map[string]interface{}{"method": "Page.loadEventFired", "sessionId": "s1", "params": map[string]interface{}{"timestamp": 1.5}})
+	flush()
+	select {
+	case event := <-loaded:
+		if event.SessionID != "s1" || event.Method != "Page.loadEventFired" || string(event.Params) != `{"timestamp":1.5}` {
+			t.Errorf("收到的事件不正确: %+v", event)
+		}
+	default:
+		t.Fatal("没有收到登记的事件")
+	}
+	if len(other) != 0 {
+		t.Error("其他事件的处理函数不应该被调用")
+	}
+
+	stop()
+	peer.send(map[string]interface{}{"method": "Page.loadEventFired", "sessionId": "s1"})
+	flush()
+	if len(loaded) != 0 {
+		t.Error("取消登记后不应该再收到事件")
+	}
+}
+
+func TestConnFailsPendingCallsOnDisconnect(t *testing.T) {
+	conn, peer := dialConn(t)
+
+	done := goCall(context.Background(), conn, "", "Page.navigate", nil)
+	if _, err := peer.readRequest(); err != nil {
+		t.Fatal(err)
+	}
+	peer.conn.Close()
+
+	result := <-done
+	if result.err == nil || !strings.Contains(result.err.Error(), "与浏览器的连接已断开") {
+		t.Fatalf("连接断开时等待中的请求返回 %v", result.err)
+	}
+	select {
+	case <-conn.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("连接断开后Done没有关闭")
+	}
+	if conn.Err() != result.err {
+		t.Errorf("Err返回 %v，期望 %v", conn.Err(), result.err)
+	}
+	if err := conn.Call(context.Background(), "", "Page.reload", nil, nil); err != conn.Err() {
+		t.Errorf("断开后的请求返回 %v，期望 %v", err, conn.Err())
+	}
+}
@@ -0,0 +1,475 @@
+package cdp
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 页面操作使用的等待时间
+const (
+	pollInterval       = 100 * time.Millisecond
+	navigationStartGap = 500 * time.Millisecond // 点击或执行脚本后等待导航开始的时间，超过后认为没有导航
+)
+
+// blockedByClient 是请求被拦截后导航返回的错误
+const blockedByClient = "net::ERR_BLOCKED_BY_CLIENT"
+
+// Page 是浏览器中的一个页面，所有方法都通过页面的会话调用
+type Page struct {
+	conn      *Conn
+	targetID  string
+	contextID string
+	sessionID string
+
+	mu         sync.Mutex
+	blocked    error         // 最近一次被拦截的导航的原因
+	blockedCh  chan struct{} // 导航被拦截时收到值，让等待加载的方法立即返回
+	stopFilter func()        // 取消导航拦截的事件登记
+}
+
+// call 在页面的会话中调用CDP方法
+func (p *Page) call(ctx context.Context, method string, params, result interface{}) error {
+	return p.conn.Call(ctx, p.sessionID, method, params, result)
+}
+
+// FilterNavigation 拦截页面中所有文档的请求，包括导航、重定向、点击链接和提交表单，
+// check返回错误时请求被阻止，导航方法返回该错误
+func (p *Page) FilterNavigation(ctx context.Context, check func(url string) error) error {
+	stop := p.conn.On("Fetch.requestPaused", func(event Event) {
+		if event.SessionID != p.sessionID {
+			return
+		}
+		var paused struct {
+			RequestID string `json:"requestId"`
+			Request   struct {
+				URL string `json:"url"`
+			} `json:"request"`
+		}
+		if err := json.Unmarshal(event.Params, &paused); err != nil {
+			return
+		}
+		// 事件处理函数不能阻塞读取，继续或阻止请求需要在新的goroutine中调用
+		go func() {
+			callCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := check(paused.Request.URL); err != nil {
+				p.mu.Lock()
+				p.blocked = err
+				p.mu.Unlock()
+				select {
+				case p.blockedCh <- struct{}{}:
+				default:
+				}
+				p.call(callCtx, "Fetch.failRequest", map[string]interface{}{"requestId": paused.RequestID, "errorReason": "BlockedByClient"}, nil)
+				return
+			}
+			p.call(callCtx, "Fetch.continueRequest", map[string]interface{}{"requestId": paused.RequestID}, nil)
+		}()
+	})
+
+	err := p.call(ctx, "Fetch.enable", map[string]interface{}{
+		"patterns": []map[string]interface{}{{"urlPattern": "*", "resourceType": "Document", "requestStage": "Request"}},
+	}, nil)
+	if err != nil {
+		stop()
+		return fmt.Errorf("启用请求拦截失败: %w", err)
+	}
+	p.mu.Lock()
+	p.stopFilter = stop
+	p.mu.Unlock()
+	return nil
+}
+
+// Navigate 打开URL并等待页面加载完成
+func (p *Page) Navigate(ctx context.Context, url string) error {
+	loaded, stop := p.waitEvent("Page.loadEventFired")
+	defer stop()
+	p.clearBlocked()
+
+	var result struct {
+		LoaderID  string `json:"loaderId"`
+		ErrorText string `json:"errorText"`
+	}
+	if err := p.call(ctx, "Page.navigate", map[string]interface{}{"url": url}, &result); err != nil {
+		return fmt.Errorf("打开 %s 失败: %w", url, err)
+	}
+	if result.ErrorText != "" {
+		if err := p.blockedErr(result.ErrorText); err != nil {
+			return err
+		}
+		return fmt.Errorf("打开 %s 失败: %s", url, result.ErrorText)
+	}
+	// 没有loaderId表示在同一个文档中导航，例如只改变了片段
+	if result.LoaderID == "" {
+		return nil
+	}
+	return p.wait(ctx, loaded)
+}
+
+// Back 返回历史记录中的上一个页面，check用于在返回前检查上一个页面的地址
+func (p *Page) Back(ctx context.Context, check func(url string) error) error {
+	var history struct {
+		CurrentIndex int `json:"currentIndex"`
+		Entries      []struct {
+			ID  int    `json:"id"`
+			URL string `json:"url"`
+		} `json:"entries"`
+	}
+	if err := p.call(ctx, "Page.getNavigationHistory", nil, &history); err != nil {
+		return fmt.Errorf("获取历史记录失败: %w", err)
+	}
+	if history.CurrentIndex <= 0 || history.CurrentIndex >= len(history.Entries) {
+		return errNoHistory
+	}
+	previous := history.Entries[history.CurrentIndex-1]
+	if previous.URL == "about:blank" {
+		return errNoHistory
+	}
+	if check != nil {
+		if err := check(previous.URL); err != nil {
+			return err
+		}
+	}
+	return p.runAndWait(ctx, func() error {
+		return p.call(ctx, "Page.navigateToHistoryEntry", map[string]interface{}{"entryId": previous.ID}, nil)
+	})
+}
+
+// errNoHistory 表示没有可以返回的页面
+var errNoHistory = errors.New("没有可以返回的页面")
+
+// IsNoHistory 检查错误是否表示没有可以返回的页面
+func IsNoHistory(err error) bool {
+	return errors.Is(err, errNoHistory)
+}
+
+// Evaluate 在页面中执行JavaScript表达式，等待返回的Promise完成，返回可以序列化为JSON的结果
+func (p *Page) Evaluate(ctx context.Context, expression string) (interface{}, error) {
+	var result struct {
+		Result struct {
+			Type                string          `json:"type"`
+			Value               json.RawMessage `json:"value"`
+			UnserializableValue string          `json:"unserializableValue"`
+			Description         string          `json:"description"`
+		} `json:"result"`
+		ExceptionDetails *struct {
+			Text      string `json:"text"`
+			Exception *struct {
+				Description string `json:"description"`
+			} `json:"exception"`
+		} `json:"exceptionDetails"`
+	}
+	err := p.call(ctx, "Runtime.evaluate", map[string]interface{}{
+		"expression":    expression,
+		"returnByValue": true,
+		"awaitPromise":  true,
+		"userGesture":   true,
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	if details := result.ExceptionDetails; details != nil {
+		message := details.Text
+		if details.Exception != nil && details.Exception.Description != "" {
+			message = details.Exception.Description
+		}
+		return nil, fmt.Errorf("脚本执行出错: %s", message)
+	}
+
+	switch {
+	case result.Result.UnserializableValue != "":
+		return result.Result.UnserializableValue, nil
+	case len(result.Result.Value) > 0:
+		var value interface{}
+		if err := json.Unmarshal(result.Result.Value, &value); err != nil {
+			return nil, fmt.Errorf("解析脚本结果失败: %w", err)
+		}
+		return value, nil
+	case result.Result.Type == "undefined":
+		return nil, nil
+	default:
+		// 函数、DOM节点等不能序列化的对象返回它们的描述
+		return result.Result.Description, nil
+	}
+}
+
+// Run 执行可能引起导航的脚本，例如提交表单，发生导航时等待新页面加载完成
+func (p *Page) Run(ctx context.Context, expression string) (interface{}, error) {
+	var value interface{}
+	err := p.runAndWait(ctx, func() error {
+		var err error
+		value, err = p.Evaluate(ctx, expression)
+		return err
+	})
+	return value, err
+}
+
+// Snapshot 是页面当前的地址、标题和渲染后的HTML
+type Snapshot struct {
+	URL   string `json:"url"`
+	Title string `json:"title"`
+	HTML  string `json:"html"`
+}
+
+// Snapshot 获取页面当前的地址、标题和渲染后的HTML
+func (p *Page) Snapshot(ctx context.Context) (*Snapshot, error) {
+	var result struct {
+		Result struct {
+			Value Snapshot `json:"value"`
+		} `json:"result"`
+	}
+	err := p.call(ctx, "Runtime.evaluate", map[string]interface{}{
+		"expression":    `({url: location.href, title: document.title, html: document.documentElement ? document.documentElement.outerHTML : ""})`,
+		"returnByValue": true,
+	}, &result)
+	if err != nil {
+		return nil, fmt.Errorf("获取页面内容失败: %w", err)
+	}
+	return &result.Result.Value, nil
+}
+
+// Click 滚动到选择器匹配的第一个元素并用鼠标点击它的中心，点击引起导航时等待新页面加载完成
+func (p *Page) Click(ctx context.Context, selector string) error {
+	value, err := p.Evaluate(ctx, fmt.Sprintf(`(() => {
+	const el = document.querySelector(%s);
+	if (!el) return null;
+	el.scrollIntoView({block: "center", inline: "center"});
+	const rect = el.getBoundingClientRect();
+	return {x: rect.left + rect.width / 2, y: rect.top + rect.height / 2, width: rect.width, height: rect.height};
+})()`, jsString(selector)))
+	if err != nil {
+		return err
+	}
+	box, ok := value.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("没有找到匹配 %s 的元素", selector)
+	}
+	width, _ := box["width"].(float64)
+	height, _ := box["height"].(float64)
+	if width == 0 || height == 0 {
+		return fmt.Errorf("匹配 %s 的元素不可见", selector)
+	}
+	x, _ := box["x"].(float64)
+	y, _ := box["y"].(float64)
+
+	return p.runAndWait(ctx, func() error {
+		for _, eventType := range []string{"mouseMoved", "mousePressed", "mouseReleased"} {
+			params := map[string]interface{}{"type": eventType, "x": x, "y": y}
+			if eventType != "mouseMoved" {
+				params["button"] = "left"
+				params["clickCount"] = 1
+			}
+			if err := p.call(ctx, "Input.dispatchMouseEvent", params, nil); err != nil {
+				return fmt.Errorf("点击 %s 失败: %w", selector, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Type 清空选择器匹配的第一个输入元素的内容，然后像键盘输入一样输入文本
+func (p *Page) Type(ctx context.Context, selector, text string) error {
+	value, err := p.Evaluate(ctx, fmt.Sprintf(`(() => {
+	const el = document.querySelector(%s);
+	if (!el) return false;
+	el.scrollIntoView({block: "center"});
+	el.focus();
+	if ("value" in el) {
+		el.value = "";
+		el.dispatchEvent(new Event("input", {bubbles: true}));
+	} else if (el.isContentEditable) {
+		document.execCommand("selectAll");
+	}
+	return true;
+})()`, jsString(selector)))
+	if err != nil {
+		return err
+	}
+	if found, _ := value.(bool); !found {
+		return fmt.Errorf("没有找到匹配 %s 的元素", selector)
+	}
+	if err := p.call(ctx, "Input.insertText", map[string]interface{}{"text": text}, nil); err != nil {
+		return fmt.Errorf("输入文本失败: %w", err)
+	}
+	return nil
+}
+
+// WaitFor 等待选择器匹配的元素出现，直到ctx结束
+func (p *Page) WaitFor(ctx context.Context, selector string) error {
+	expression := fmt.Sprintf(`document.querySelector(%s) !== null`, jsString(selector))
+	for {
+		value, err := p.Evaluate(ctx, expression)
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+		if found, _ := value.(bool); found {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("等待匹配 %s 的元素超时", selector)
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// Screenshot 截取页面的PNG图片，fullPage为true时截取整个页面而不只是可见区域
+func (p *Page) Screenshot(ctx context.Context, fullPage bool) ([]byte, error) {
+	params := map[string]interface{}{"format": "png"}
+	if fullPage {
+		var metrics struct {
+			CSSContentSize struct {
+				Width  float64 `json:"width"`
+				Height float64 `json:"height"`
+			} `json:"cssContentSize"`
+		}
+		if err := p.call(ctx, "Page.getLayoutMetrics", nil, &metrics); err != nil {
+			return nil, fmt.Errorf("获取页面尺寸失败: %w", err)
+		}
+		params["captureBeyondViewport"] = true
+		params["clip"] = map[string]interface{}{
+			"x":      0,
+			"y":      0,
+			"width":  math.Ceil(metrics.CSSContentSize.Width),
+			"height": math.Ceil(metrics.CSSContentSize.Height),
+			"scale":  1,
+		}
+	}
+	var result struct {
+		Data string `json:"data"`
+	}
+	if err := p.call(ctx, "Page.captureScreenshot", params, &result); err != nil {
+		return nil, fmt.Errorf("截图失败: %w", err)
+	}
+	return base64.StdEncoding.DecodeString(result.Data)
+}
+
+// PDF 把页面打印为PDF，只有无界面模式的浏览器支持
+func (p *Page) PDF(ctx context.Context) ([]byte, error) {
+	var result struct {
+		Data string `json:"data"`
+	}
+	if err := p.call(ctx, "Page.printToPDF", map[string]interface{}{"printBackground": true}, &result); err != nil {
+		return nil, fmt.Errorf("生成PDF失败: %w", err)
+	}
+	return base64.StdEncoding.DecodeString(result.Data)
+}
+
+// Close 关闭页面并销毁它的浏览器上下文
+func (p *Page) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if p.stopFilter != nil {
+		p.stopFilter()
+		p.stopFilter = nil
+	}
+	p.mu.Unlock()
+
+	err := p.conn.Call(ctx, "", "Target.closeTarget", map[string]interface{}{"targetId": p.targetID}, nil)
+	if p.contextID != "" {
+		p.conn.Call(ctx, "", "Target.disposeBrowserContext", map[string]interface{}{"browserContextId": p.contextID}, nil)
+	}
+	return err
+}
+
+// runAndWait 执行可能引起导航的操作：操作后短时间内主框架开始加载时，等待加载完成
+func (p *Page) runAndWait(ctx context.Context, action func() error) error {
+	started, stopStarted := p.waitEvent("Page.frameStartedLoading")
+	defer stopStarted()
+	loaded, stopLoaded := p.waitEvent("Page.loadEventFired")
+	defer stopLoaded()
+	p.clearBlocked()
+
+	if err := action(); err != nil {
+		return err
+	}
+	select {
+	case <-started:
+	case <-loaded:
+		return nil
+	case <-p.blockedCh:
+		return p.blockedErr(blockedByClient)
+	case <-time.After(navigationStartGap):
+		return p.blockedErr(blockedByClient)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if err := p.wait(ctx, loaded); err != nil {
+		return err
+	}
+	return p.blockedErr(blockedByClient)
+}
+
+// waitEvent 返回在页面主框架收到指定事件时接收到值的通道
+func (p *Page) waitEvent(method string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	stop := p.conn.On(method, func(event Event) {
+		if event.SessionID != p.sessionID {
+			return
+		}
+		if method == "Page.frameStartedLoading" {
+			var params struct {
+				FrameID string `json:"frameId"`
+			}
+			// 页面主框架的ID与目标ID相同，忽略iframe的加载
+			if json.Unmarshal(event.Params, &params) != nil || params.FrameID != p.targetID {
+				return
+			}
+		}
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	})
+	return ch, stop
+}
+
+// wait 等待页面加载完成
+func (p *Page) wait(ctx context.Context, loaded <-chan struct{}) error {
+	select {
+	case <-loaded:
+		return nil
+	case <-p.blockedCh:
+		if err := p.blockedErr(blockedByClient); err != nil {
+			return err
+		}
+		return fmt.Errorf("页面的导航被阻止")
+	case <-p.conn.Done():
+		return p.conn.Err()
+	case <-ctx.Done():
+		return fmt.Errorf("等待页面加载超时: %w", ctx.Err())
+	}
+}
+
+// clearBlocked 清除之前被拦截的导航
+func (p *Page) clearBlocked() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.blocked = nil
+	select {
+	case <-p.blockedCh:
+	default:
+	}
+}
+
+// blockedErr 导航因请求被拦截而失败时返回拦截的原因
+func (p *Page) blockedErr(errorText string) error {
+	if !strings.Contains(errorText, blockedByClient) {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.blocked
+}
+
+// jsString 把字符串编码为JavaScript字符串字面量
+func jsString(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
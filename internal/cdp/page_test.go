@@ -0,0 +1,625 @@
+package cdp
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// deferredReply 表示处理函数稍后自己回复请求
+type deferredReply struct{}
+
+// fakeBrowser 是按方法名回复CDP请求的模拟浏览器，页面的目标ID为target1，会话ID为session1
+type fakeBrowser struct {
+	t    *testing.T
+	peer *wsPeer
+
+	mu       sync.Mutex
+	handlers map[string]func(req message) interface{}
+	calls    []message
+}
+
+// startFakeBrowser 启动模拟浏览器，通过endpoint返回的地址连接它并打开一个页面
+func startFakeBrowser(t *testing.T, endpoint func(server *httptest.Server) string) (*fakeBrowser, *Page) {
+	t.Helper()
+	f := &fakeBrowser{t: t, handlers: make(map[string]func(req message) interface{})}
+	f.handle("Target.createBrowserContext", func(req message) interface{} {
+		return map[string]interface{}{"browserContextId": "ctx1"}
+	})
+	f.handle("Target.createTarget", func(req message) interface{} {
+		return map[string]interface{}{"targetId": "target1"}
+	})
+	f.handle("Target.attachToTarget", func(req message) interface{} {
+		return map[string]interface{}{"sessionId": "session1"}
+	})
+	for _, method := range []string{"Page.enable", "Target.closeTarget", "Target.disposeBrowserContext"} {
+		f.handle(method, func(req message) interface{} { return nil })
+	}
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	mux.HandleFunc("/json/version", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"webSocketDebuggerUrl": wsURL(server, "/devtools/browser/test")})
+	})
+	mux.HandleFunc("/devtools/browser/test", func(w http.ResponseWriter, r *http.Request) {
+		peer, err := upgrade(w, r, "")
+		if err != nil {
+			t.Errorf("升级连接失败: %v", err)
+			return
+		}
+		f.peer = peer
+		go f.serve()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	browser, err := Connect(ctx, endpoint(server))
+	if err != nil {
+		t.Fatalf("连接浏览器失败: %v", err)
+	}
+	t.Cleanup(func() { browser.Close() })
+	page, err := browser.NewPage(ctx)
+	if err != nil {
+		t.Fatalf("打开页面失败: %v", err)
+	}
+	return f, page
+}
+
+// handle 设置方法的处理函数，返回值是请求的结果，返回deferredReply{}时不自动回复
+func (f *fakeBrowser) handle(method string, handler func(req message) interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handlers[method] = handler
+}
+
+// serve 依次处理请求，没有处理函数的方法返回协议错误
+func (f *fakeBrowser) serve() {
+	defer f.peer.conn.Close()
+	for {
+		req, err := f.peer.readRequest()
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.calls = append(f.calls, req)
+		handler := f.handlers[req.Method]
+		f.mu.Unlock()
+		if handler == nil {
+			f.peer.send(map[string]interface{}{"id": req.ID, "error": map[string]interface{}{"code": -32601, "message": fmt.Sprintf("'%s' wasn't found", req.Method)}})
+			continue
+		}
+		if result := handler(req); result != (deferredReply{}) {
+			f.reply(req, result)
+		}
+	}
+}
+
+// reply 回复请求
+func (f *fakeBrowser) reply(req message, result interface{}) {
+	if result == nil {
+		result = map[string]interface{}{}
+	}
+	if err := f.peer.send(map[string]interface{}{"id": req.ID, "sessionId": req.SessionID, "result": result}); err != nil {
+		f.t.Errorf("回复 %s 失败: %v", req.Method, err)
+	}
+}
+
+// event 发送指定会话的事件
+func (f *fakeBrowser) event(sessionID, method string, params interface{}) {
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	if err := f.peer.send(map[string]interface{}{"sessionId": sessionID, "method": method, "params": params}); err != nil {
+		f.t.Errorf("发送事件 %s 失败: %v", method, err)
+	}
+}
+
+// loadLater 稍后发送页面加载完成的事件，发送前设置loaded，用于检查调用者是否等待了加载
+func (f *fakeBrowser) loadLater(loaded *atomic.Bool) {
+	go func() {
+		// 其他页面的加载事件不能让调用者提前返回
+		f.event("other-session", "Page.loadEventFired", nil)
+		time.Sleep(20 * time.Millisecond)
+		loaded.Store(true)
+		f.event("session1", "Page.loadEventFired", nil)
+	}()
+}
+
+// requests 返回收到的指定方法的请求
+func (f *fakeBrowser) requests(method string) []message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var found []message
+	for _, call := range f.calls {
+		if call.Method == method {
+			found = append(found, call)
+		}
+	}
+	return found
+}
+
+// params 解码请求的参数
+func params(req message) map[string]interface{} {
+	var values map[string]interface{}
+	json.Unmarshal(req.Params, &values)
+	return values
+}
+
+func TestBrowserNewPage(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint func(server *httptest.Server) string
+	}{
+		{"调试端口地址", func(server *httptest.Server) string { return server.URL + "/" }},
+		{"WebSocket地址", func(server *httptest.Server) string { return wsURL(server, "/devtools/browser/test") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, page := startFakeBrowser(t, tt.endpoint)
+			if page.targetID != "target1" || page.contextID != "ctx1" || page.sessionID != "session1" {
+				t.Errorf("页面为 target=%s context=%s session=%s", page.targetID, page.contextID, page.sessionID)
+			}
+
+			want := []struct {
+				method  string
+				session string
+				params  map[string]interface{}
+			}{
+				{"Target.createBrowserContext", "", map[string]interface{}{"disposeOnDetach": true}},
+				{"Target.createTarget", "", map[string]interface{}{"url": "about:blank", "browserContextId": "ctx1"}},
+				{"Target.attachToTarget", "", map[string]interface{}{"targetId": "target1", "flatten": true}},
+				{"Page.enable", "session1", nil},
+			}
+			f.mu.Lock()
+			calls := append([]message(nil), f.calls...)
+			f.mu.Unlock()
+			if len(calls) != len(want) {
+				t.Fatalf("收到 %d 个请求，期望 %d 个", len(calls), len(want))
+			}
+			for i, call := range calls {
+				if call.Method != want[i].method || call.SessionID != want[i].session || !reflect.DeepEqual(params(call), want[i].params) {
+					t.Errorf("第 %d 个请求为 %s(%s) %s，期望 %s(%s) %v", i+1, call.Method, call.SessionID, call.Params, want[i].method, want[i].session, want[i].params)
+				}
+			}
+
+			if err := page.Close(context.Background()); err != nil {
+				t.Fatalf("关闭页面失败: %v", err)
+			}
+			closed := f.requests("Target.closeTarget")
+			disposed := f.requests("Target.disposeBrowserContext")
+			if len(closed) != 1 || params(closed[0])["targetId"] != "target1" || len(disposed) != 1 || params(disposed[0])["browserContextId"] != "ctx1" {
+				t.Errorf("关闭页面时应该关闭目标并销毁上下文: %v %v", closed, disposed)
+			}
+		})
+	}
+}
+
+// startPage 启动模拟浏览器并通过调试端口地址打开页面
+func startPage(t *testing.T) (*fakeBrowser, *Page) {
+	t.Helper()
+	return startFakeBrowser(t, func(server *httptest.Server) string { return server.URL })
+}
+
+func TestPageNavigate(t *testing.T) {
+	f, page := startPage(t)
+	var loaded atomic.Bool
+	f.handle("Page.navigate", func(req message) interface{} {
+		switch params(req)["url"] {
+		case "http://missing.test/":
+			return map[string]interface{}{"frameId": "target1", "errorText": "net::ERR_NAME_NOT_RESOLVED"}
+		case "http://example.test/#top":
+			// 同一文档中的导航没有loaderId，也不会触发加载事件
+			return map[string]interface{}{"frameId": "target1"}
+		}
+		f.loadLater(&loaded)
+		return map[string]interface{}{"frameId": "target1", "loaderId": "loader1"}
+	})
+
+	tests := []struct {
+		name     string
+		url      string
+		wantLoad bool
+		wantErr  string
+	}{
+		{name: "等待页面加载完成", url: "http://example.test/", wantLoad: true},
+		{name: "同一文档中的导航", url: "http://example.test/#top"},
+		{name: "导航失败", url: "http://missing.test/", wantErr: "打开 http://missing.test/ 失败: net::ERR_NAME_NOT_RESOLVED"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loaded.Store(false)
+			err := page.Navigate(context.Background(), tt.url)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("错误为 %v，期望 %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("导航失败: %v", err)
+			}
+			if tt.wantLoad && !loaded.Load() {
+				t.Error("Navigate在页面加载完成之前返回")
+			}
+		})
+	}
+}
+
+func TestPageEvaluate(t *testing.T) {
+	f, page := startPage(t)
+	f.handle("Runtime.evaluate", func(req message) interface{} {
+		p := params(req)
+		if p["returnByValue"] != true || p["awaitPromise"] != true {
+			t.Errorf("Runtime.evaluate 的参数不正确: %v", p)
+		}
+		switch p["expression"] {
+		case "1 + 1":
+			return map[string]interface{}{"result": map[string]interface{}{"type": "number", "value": 2}}
+		case "({a: [1, 'b']})":
+			return map[string]interface{}{"result": map[string]interface{}{"type": "object", "value": map[string]interface{}{"a": []interface{}{1, "b"}}}}
+		case "1 / 0":
+			return map[string]interface{}{"result": map[string]interface{}{"type": "number", "unserializableValue": "Infinity"}}
+		case "undefined":
+			return map[string]interface{}{"result": map[string]interface{}{"type": "undefined"}}
+		case "document.body":
+			return map[string]interface{}{"result": map[string]interface{}{"type": "object", "subtype": "node", "description": "body"}}
+		case "boom()":
+			return map[string]interface{}{
+				"result":           map[string]interface{}{"type": "object"},
+				"exceptionDetails": map[string]interface{}{"text": "Uncaught", "exception": map[string]interface{}{"description": "ReferenceError: boom is not defined"}},
+			}
+		}
+		return map[string]interface{}{"exceptionDetails": map[string]interface{}{"text": "SyntaxError"}}
+	})
+
+	tests := []struct {
+		expression string
+		want       interface{}
+		wantErr    string
+	}{
+		{expression: "1 + 1", want: float64(2)},
+		{expression: "({a: [1, 'b']})", want: map[string]interface{}{"a": []interface{}{float64(1), "b"}}},
+		{expression: "1 / 0", want: "Infinity"},
+		{expression: "undefined", want: nil},
+		{expression: "document.body", want: "body"},
+		{expression: "boom()", wantErr: "脚本执行出错: ReferenceError: boom is not defined"},
+		{expression: "(", wantErr: "脚本执行出错: SyntaxError"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			got, err := page.Evaluate(context.Background(), tt.expression)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("错误为 %v，期望 %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("执行失败: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("结果为 %#v，期望 %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPageClickAndType(t *testing.T) {
+	f, page := startPage(t)
+	f.handle("Runtime.evaluate", func(req message) interface{} {
+		expression, _ := params(req)["expression"].(string)
+		value := interface{}(nil)
+		switch {
+		case strings.Contains(expression, `"#link"`):
+			value = map[string]interface{}{"x": 10, "y": 20, "width": 50, "height": 10}
+		case strings.Contains(expression, `"#button"`):
+			value = map[string]interface{}{"x": 30, "y": 40, "width": 50, "height": 10}
+		case strings.Contains(expression, `"#hidden"`):
+			value = map[string]interface{}{"x": 0, "y": 0, "width": 0, "height": 0}
+		case strings.Contains(expression, `"#name"`):
+			value = true
+		case strings.Contains(expression, "el.focus()"):
+			value = false
+		}
+		return map[string]interface{}{"result": map[string]interface{}{"type": "object", "value": value}}
+	})
+	var loaded atomic.Bool
+	f.handle("Input.dispatchMouseEvent", func(req message) interface{} {
+		p := params(req)
+		// 点击链接引起导航，iframe的加载不算作页面导航
+		if p["type"] == "mouseReleased" && p["x"] == float64(10) {
+			f.event("session1", "Page.frameStartedLoading", map[string]interface{}{"frameId": "iframe1"})
+			f.event("session1", "Page.frameStartedLoading", map[string]interface{}{"frameId": "target1"})
+			f.loadLater(&loaded)
+		}
+		return nil
+	})
+	f.handle("Input.insertText", func(req message) interface{} { return nil })
+
+	clicks := []struct {
+		selector string
+		wantLoad bool
+		wantErr  string
+	}{
+		{selector: "#link", wantLoad: true},
+		{selector: "#button"},
+		{selector: "#hidden", wantErr: "匹配 #hidden 的元素不可见"},
+		{selector: "#missing", wantErr: "没有找到匹配 #missing 的元素"},
+	}
+	for _, tt := range clicks {
+		t.Run("click "+tt.selector, func(t *testing.T) {
+			loaded.Store(false)
+			before := len(f.requests("Input.dispatchMouseEvent"))
+			err := page.Click(context.Background(), tt.selector)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("错误为 %v，期望 %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("点击失败: %v", err)
+			}
+			if tt.wantLoad && !loaded.Load() {
+				t.Error("点击引起导航时应该等待页面加载完成")
+			}
+			events := f.requests("Input.dispatchMouseEvent")[before:]
+			var types []string
+			for _, event := range events {
+				p := params(event)
+				types = append(types, p["type"].(string))
+				if event.SessionID != "session1" || p["x"] != params(events[0])["x"] || p["y"] != params(events[0])["y"] {
+					t.Errorf("鼠标事件不正确: %s %v", event.SessionID, p)
+				}
+				if p["type"] != "mouseMoved" && (p["button"] != "left" || p["clickCount"] != float64(1)) {
+					t.Errorf("按下和松开鼠标应该使用左键单击: %v", p)
+				}
+			}
+			if strings.Join(types, ",") != "mouseMoved,mousePressed,mouseReleased" {
+				t.Errorf("鼠标事件为 %v", types)
+			}
+		})
+	}
+
+	if err := page.Type(context.Background(), "#name", "张三"); err != nil {
+		t.Fatalf("输入失败: %v", err)
+	}
+	if inserted := f.requests("Input.insertText"); len(inserted) != 1 || params(inserted[0])["text"] != "张三" {
+		t.Errorf("输入的文本为 %v", inserted)
+	}
+	if err := page.Type(context.Background(), "#missing", "x"); err == nil || err.Error() != "没有找到匹配 #missing 的元素" {
+		t.Errorf("输入到不存在的元素返回 %v", err)
+	}
+	if inserted := f.requests("Input.insertText"); len(inserted) != 1 {
+		t.Errorf("元素不存在时不应该输入文本，共输入了 %d 次", len(inserted))
+	}
+}
+
+func TestPageWaitFor(t *testing.T) {
+	f, page := startPage(t)
+	var polls atomic.Int32
+	f.handle("Runtime.evaluate", func(req message) interface{} {
+		expression, _ := params(req)["expression"].(string)
+		found := false
+		if strings.Contains(expression, `"#late"`) {
+			found = polls.Add(1) >= 3
+		}
+		return map[string]interface{}{"result": map[string]interface{}{"type": "boolean", "value": found}}
+	})
+
+	if err := page.WaitFor(context.Background(), "#late"); err != nil {
+		t.Fatalf("等待元素失败: %v", err)
+	}
+	if polls.Load() != 3 {
+		t.Errorf("检查了 %d 次，期望在第 3 次找到元素", polls.Load())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*pollInterval)
+	defer cancel()
+	if err := page.WaitFor(ctx, "#never"); err == nil || err.Error() != "等待匹配 #never 的元素超时" {
+		t.Errorf("等待不存在的元素返回 %v", err)
+	}
+}
+
+func TestPageCapture(t *testing.T) {
+	f, page := startPage(t)
+	f.handle("Page.getLayoutMetrics", func(req message) interface{} {
+		return map[string]interface{}{"cssContentSize": map[string]interface{}{"x": 0, "y": 0, "width": 800.2, "height": 1999.5}}
+	})
+	f.handle("Page.captureScreenshot", func(req message) interface{} {
+		return map[string]interface{}{"data": base64.StdEncoding.EncodeToString([]byte("png-data"))}
+	})
+	f.handle("Page.printToPDF", func(req message) interface{} {
+		return map[string]interface{}{"data": base64.StdEncoding.EncodeToString([]byte("%PDF-1.7"))}
+	})
+
+	tests := []struct {
+		name       string
+		fullPage   bool
+		wantParams map[string]interface{}
+	}{
+		{
+			name:       "可见区域",
+			wantParams: map[string]interface{}{"format": "png"},
+		},
+		{
+			name:     "整个页面",
+			fullPage: true,
+			wantParams: map[string]interface{}{
+				"format":                "png",
+				"captureBeyondViewport": true,
+				"clip":                  map[string]interface{}{"x": float64(0), "y": float64(0), "width": float64(801), "height": float64(2000), "scale": float64(1)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := page.Screenshot(context.Background(), tt.fullPage)
+			if err != nil {
+				t.Fatalf("截图失败: %v", err)
+			}
+			if string(data) != "png-data" {
+				t.Errorf("截图数据为 %q", data)
+			}
+			requests := f.requests("Page.captureScreenshot")
+			if got := params(requests[len(requests)-1]); !reflect.DeepEqual(got, tt.wantParams) {
+				t.Errorf("截图参数为 %v，期望 %v", got, tt.wantParams)
+			}
+		})
+	}
+
+	data, err := page.PDF(context.Background())
+	if err != nil {
+		t.Fatalf("生成PDF失败: %v", err)
+	}
+	if string(data) != "%PDF-1.7" {
+		t.Errorf("PDF数据为 %q", data)
+	}
+	if printed := f.requests("Page.printToPDF"); len(printed) != 1 || params(printed[0])["printBackground"] != true {
+		t.Errorf("生成PDF的请求为 %v", printed)
+	}
+}
+
+func TestPageBack(t *testing.T) {
+	f, page := startPage(t)
+	var history map[string]interface{}
+	f.handle("Page.getNavigationHistory", func(req message) interface{} { return history })
+	var loaded atomic.Bool
+	f.handle("Page.navigateToHistoryEntry", func(req message) interface{} {
+		f.event("session1", "Page.frameStartedLoading", map[string]interface{}{"frameId": "target1"})
+		f.loadLater(&loaded)
+		return nil
+	})
+	entries := []interface{}{
+		map[string]interface{}{"id": 1, "url": "about:blank"},
+		map[string]interface{}{"id": 2, "url": "http://a.test/"},
+		map[string]interface{}{"id": 3, "url": "http://b.test/"},
+	}
+	errDenied := errors.New("禁止访问")
+
+	tests := []struct {
+		name      string
+		index     int
+		deny      bool
+		wantEntry float64
+		wantErr   error
+	}{
+		{name: "返回上一个页面", index: 2, wantEntry: 2},
+		{name: "检查上一个页面的地址", index: 2, deny: true, wantErr: errDenied},
+		{name: "上一个页面是空白页", index: 1, wantErr: errNoHistory},
+		{name: "没有历史记录", index: 0, wantErr: errNoHistory},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			history = map[string]interface{}{"currentIndex": tt.index, "entries": entries}
+			before := len(f.requests("Page.navigateToHistoryEntry"))
+			loaded.Store(false)
+			var checked []string
+			err := page.Back(context.Background(), func(url string) error {
+				checked = append(checked, url)
+				if tt.deny {
+					return errDenied
+				}
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("错误为 %v，期望 %v", err, tt.wantErr)
+			}
+			navigated := f.requests("Page.navigateToHistoryEntry")[before:]
+			if tt.wantEntry == 0 {
+				if len(navigated) != 0 {
+					t.Errorf("不应该导航到历史记录: %v", navigated)
+				}
+				return
+			}
+			if !reflect.DeepEqual(checked, []string{"http://a.test/"}) {
+				t.Errorf("检查的地址为 %v", checked)
+			}
+			if len(navigated) != 1 || params(navigated[0])["entryId"] != tt.wantEntry {
+				t.Errorf("导航到的历史记录为 %v，期望 %v", navigated, tt.wantEntry)
+			}
+			if !loaded.Load() {
+				t.Error("Back在页面加载完成之前返回")
+			}
+		})
+	}
+}
+
+func TestPageFilterNavigation(t *testing.T) {
+	f, page := startPage(t)
+	// 导航的请求被暂停，模拟浏览器在页面继续或阻止请求之后才回复Page.navigate
+	var mu sync.Mutex
+	paused := make(map[string]message)
+	f.handle("Page.navigate", func(req message) interface{} {
+		url := params(req)["url"].(string)
+		mu.Lock()
+		paused["r:"+url] = req
+		mu.Unlock()
+		f.event("session1", "Fetch.requestPaused", map[string]interface{}{"requestId": "r:" + url, "request": map[string]interface{}{"url": url}})
+		return deferredReply{}
+	})
+	resume := func(req message, result map[string]interface{}) {
+		mu.Lock()
+		navigate := paused[params(req)["requestId"].(string)]
+		mu.Unlock()
+		f.reply(navigate, result)
+	}
+	f.handle("Fetch.continueRequest", func(req message) interface{} {
+		resume(req, map[string]interface{}{"frameId": "target1", "loaderId": "loader1"})
+		f.event("session1", "Page.loadEventFired", nil)
+		return nil
+	})
+	f.handle("Fetch.failRequest", func(req message) interface{} {
+		if reason := params(req)["errorReason"]; reason != "BlockedByClient" {
+			t.Errorf("阻止请求的原因为 %v", reason)
+		}
+		resume(req, map[string]interface{}{"frameId": "target1", "loaderId": "loader1", "errorText": blockedByClient})
+		return nil
+	})
+	f.handle("Fetch.enable", func(req message) interface{} { return nil })
+
+	errDenied := errors.New("禁止访问")
+	err := page.FilterNavigation(context.Background(), func(url string) error {
+		if strings.Contains(url, "blocked") {
+			return errDenied
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("启用请求拦截失败: %v", err)
+	}
+	enabled := f.requests("Fetch.enable")
+	wantPatterns := []interface{}{map[string]interface{}{"urlPattern": "*", "resourceType": "Document", "requestStage": "Request"}}
+	if len(enabled) != 1 || !reflect.DeepEqual(params(enabled[0])["patterns"], wantPatterns) {
+		t.Errorf("启用拦截的请求为 %v", enabled)
+	}
+
+	tests := []struct {
+		url     string
+		wantErr error
+	}{
+		{url: "http://allowed.test/"},
+		{url: "http://blocked.test/", wantErr: errDenied},
+		{url: "http://allowed.test/again"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := page.Navigate(ctx, tt.url); !errors.Is(err, tt.wantErr) {
+				t.Errorf("错误为 %v，期望 %v", err, tt.wantErr)
+			}
+		})
+	}
+}
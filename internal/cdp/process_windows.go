@@ -0,0 +1,13 @@
+//go:build windows
+
+package cdp
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detachProcess 让浏览器在新的进程组中运行，控制台的Ctrl+C只中断当前任务，不会结束浏览器
+func detachProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
@@ -0,0 +1,266 @@
+package cdp
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// websocketGUID 是计算握手响应中Sec-WebSocket-Accept使用的固定值
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxMessageSize 是单条消息的大小上限，整页截图和PDF的base64数据可能有几十MB
+const maxMessageSize = 128 * 1024 * 1024
+
+// WebSocket帧的操作码
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// errClosed 表示对方关闭了WebSocket连接
+var errClosed = errors.New("WebSocket连接已关闭")
+
+// wsConn 是CDP使用的最小WebSocket客户端，发送文本消息，接收时合并分片并自动回复ping
+type wsConn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	writeMu sync.Mutex
+}
+
+// dialWebSocket 连接ws或wss地址并完成握手
+func dialWebSocket(ctx context.Context, rawURL string) (*wsConn, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("无效的WebSocket地址: %w", err)
+	}
+	address := target.Host
+	if target.Port() == "" {
+		if target.Scheme == "wss" {
+			address = net.JoinHostPort(target.Hostname(), "443")
+		} else {
+			address = net.JoinHostPort(target.Hostname(), "80")
+		}
+	}
+
+	var conn net.Conn
+	switch target.Scheme {
+	case "ws":
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	case "wss":
+		dialer := tls.Dialer{Config: &tls.Config{ServerName: target.Hostname()}}
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	default:
+		return nil, fmt.Errorf("不支持的WebSocket协议 %s", target.Scheme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("连接 %s 失败: %w", address, err)
+	}
+
+	ws := &wsConn{conn: conn, reader: bufio.NewReader(conn)}
+	if err := ws.handshake(ctx, target); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ws, nil
+}
+
+// handshake 发送升级请求并检查服务器的响应
+func (ws *wsConn) handshake(ctx context.Context, target *url.URL) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		ws.conn.SetDeadline(deadline)
+		defer ws.conn.SetDeadline(time.Time{})
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("生成握手密钥失败: %w", err)
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	requestURL := *target
+	requestURL.Scheme = "http"
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        &requestURL,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-WebSocket-Key":     {key},
+			"Sec-WebSocket-Version": {"13"},
+		},
+		Host: target.Host,
+	}
+	if err := req.Write(ws.conn); err != nil {
+		return fmt.Errorf("发送WebSocket握手请求失败: %w", err)
+	}
+
+	resp, err := http.ReadResponse(ws.reader, req)
+	if err != nil {
+		return fmt.Errorf("读取WebSocket握手响应失败: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return fmt.Errorf("WebSocket握手失败: %s", resp.Status)
+	}
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	if resp.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(sum[:]) {
+		return fmt.Errorf("WebSocket握手失败: Sec-WebSocket-Accept不匹配")
+	}
+	return nil
+}
+
+// writeText 发送一条文本消息
+func (ws *wsConn) writeText(data []byte) error {
+	return ws.writeFrame(opText, data)
+}
+
+// writeFrame 发送一个完整的帧，客户端发送的帧必须使用掩码
+func (ws *wsConn) writeFrame(opcode byte, payload []byte) error {
+	header := make([]byte, 2, 14)
+	header[0] = 0x80 | opcode
+	switch length := len(payload); {
+	case length < 126:
+		header[1] = 0x80 | byte(length)
+	case length <= 0xFFFF:
+		header[1] = 0x80 | 126
+		header = binary.BigEndian.AppendUint16(header, uint16(length))
+	default:
+		header[1] = 0x80 | 127
+		header = binary.BigEndian.AppendUint64(header, uint64(length))
+	}
+	mask := make([]byte, 4)
+	if _, err := rand.Read(mask); err != nil {
+		return fmt.Errorf("生成帧掩码失败: %w", err)
+	}
+	header = append(header, mask...)
+
+	frame := make([]byte, len(header)+len(payload))
+	copy(frame, header)
+	for i, b := range payload {
+		frame[len(header)+i] = b ^ mask[i%4]
+	}
+
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	_, err := ws.conn.Write(frame)
+	return err
+}
+
+// readMessage 读取下一条文本或二进制消息，控制帧在读取过程中处理
+func (ws *wsConn) readMessage() ([]byte, error) {
+	var message []byte
+	started := false
+	for {
+		fin, opcode, payload, err := ws.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch opcode {
+		case opPing:
+			if err := ws.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			// 回复关闭帧，对方收到后会断开连接
+			ws.writeFrame(opClose, payload)
+			return nil, errClosed
+		case opText, opBinary:
+			if started {
+				return nil, fmt.Errorf("WebSocket协议错误: 分片消息没有结束就开始了新消息")
+			}
+			started = true
+			message = payload
+		case opContinuation:
+			if !started {
+				return nil, fmt.Errorf("WebSocket协议错误: 意外的后续分片")
+			}
+			if len(message)+len(payload) > maxMessageSize {
+				return nil, fmt.Errorf("WebSocket消息超过 %d 字节", maxMessageSize)
+			}
+			message = append(message, payload...)
+		default:
+			return nil, fmt.Errorf("WebSocket协议错误: 未知的操作码 %d", opcode)
+		}
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+// readFrame 读取一个帧，返回是否为最后一个分片、操作码和去掉掩码的数据
+func (ws *wsConn) readFrame() (bool, byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(ws.reader, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin := head[0]&0x80 != 0
+	opcode := head[0] & 0x0F
+	masked := head[1]&0x80 != 0
+
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(ws.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(ws.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > maxMessageSize {
+		return false, 0, nil, fmt.Errorf("WebSocket消息超过 %d 字节", maxMessageSize)
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(ws.reader, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(ws.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, opcode, payload, nil
+}
+
+// close 发送关闭帧并断开连接
+func (ws *wsConn) close() error {
+	ws.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	ws.writeFrame(opClose, []byte{0x03, 0xE8}) // 1000: 正常关闭
+	return ws.conn.Close()
+}
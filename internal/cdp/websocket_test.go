@@ -0,0 +1,356 @@
+package cdp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// wsPeer 是测试中WebSocket连接的服务器一端，直接按协议读写帧
+type wsPeer struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	writeMu sync.Mutex
+}
+
+// wsFrame 是服务器发送或收到的一个帧
+type wsFrame struct {
+	fin     bool
+	opcode  byte
+	payload []byte
+}
+
+// acceptKey 计算握手响应中的Sec-WebSocket-Accept
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// upgrade 接管HTTP连接并回复升级响应，accept为空时使用按请求计算的正确值
+func upgrade(w http.ResponseWriter, r *http.Request, accept string) (*wsPeer, error) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, fmt.Errorf("响应不支持Hijack")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	if accept == "" {
+		accept = acceptKey(r.Header.Get("Sec-WebSocket-Key"))
+	}
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", accept)
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsPeer{conn: conn, reader: rw.Reader}, nil
+}
+
+// writeFrame 发送一个不使用掩码的服务器帧
+func (p *wsPeer) writeFrame(frame wsFrame) error {
+	head := []byte{frame.opcode, 0}
+	if frame.fin {
+		head[0] |= 0x80
+	}
+	switch length := len(frame.payload); {
+	case length < 126:
+		head[1] = byte(length)
+	case length <= 0xFFFF:
+		head[1] = 126
+		head = binary.BigEndian.AppendUint16(head, uint16(length))
+	default:
+		head[1] = 127
+		head = binary.BigEndian.AppendUint64(head, uint64(length))
+	}
+	p.writeMu.Lock()
+	defer p.writeMu.Unlock()
+	_, err := p.conn.Write(append(head, frame.payload...))
+	return err
+}
+
+// readFrame 读取客户端发送的帧，客户端的帧必须使用掩码
+func (p *wsPeer) readFrame() (wsFrame, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(p.reader, head[:]); err != nil {
+		return wsFrame{}, err
+	}
+	if head[1]&0x80 == 0 {
+		return wsFrame{}, fmt.Errorf("客户端的帧没有使用掩码")
+	}
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(p.reader, ext[:]); err != nil {
+			return wsFrame{}, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(p.reader, ext[:]); err != nil {
+			return wsFrame{}, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(p.reader, mask[:]); err != nil {
+		return wsFrame{}, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(p.reader, payload); err != nil {
+		return wsFrame{}, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return wsFrame{fin: head[0]&0x80 != 0, opcode: head[0] & 0x0F, payload: payload}, nil
+}
+
+// wsURL 把测试服务器的地址转换为WebSocket地址
+func wsURL(server *httptest.Server, path string) string {
+	return "ws" + strings.TrimPrefix(server.URL, "http") + path
+}
+
+// servePeers 启动一个测试服务器，把每个升级后的连接发送到返回的通道
+func servePeers(t *testing.T) (*httptest.Server, <-chan *wsPeer) {
+	t.Helper()
+	peers := make(chan *wsPeer, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer, err := upgrade(w, r, "")
+		if err != nil {
+			t.Errorf("升级连接失败: %v", err)
+			return
+		}
+		peers <- peer
+	}))
+	t.Cleanup(server.Close)
+	return server, peers
+}
+
+// dialPeer 连接测试服务器，返回客户端和服务器两端
+func dialPeer(t *testing.T) (*wsConn, *wsPeer) {
+	t.Helper()
+	server, peers := servePeers(t)
+	ws, err := dialWebSocket(context.Background(), wsURL(server, "/"))
+	if err != nil {
+		t.Fatalf("连接失败: %v", err)
+	}
+	peer := <-peers
+	t.Cleanup(func() {
+		ws.conn.Close()
+		peer.conn.Close()
+	})
+	return ws, peer
+}
+
+func TestWebSocketHandshake(t *testing.T) {
+	tests := []struct {
+		name    string
+		respond func(w http.ResponseWriter, r *http.Request) error
+		wantErr string
+	}{
+		{
+			name: "正确的Accept",
+			respond: func(w http.ResponseWriter, r *http.Request) error {
+				_, err := upgrade(w, r, "")
+				return err
+			},
+		},
+		{
+			name: "错误的Accept",
+			respond: func(w http.ResponseWriter, r *http.Request) error {
+				_, err := upgrade(w, r, acceptKey("other"))
+				return err
+			},
+			wantErr: "Sec-WebSocket-Accept不匹配",
+		},
+		{
+			name: "服务器拒绝升级",
+			respond: func(w http.ResponseWriter, r *http.Request) error {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return nil
+			},
+			wantErr: "WebSocket握手失败: 403 Forbidden",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/devtools/browser/1" || !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") ||
+					!strings.EqualFold(r.Header.Get("Connection"), "upgrade") || r.Header.Get("Sec-WebSocket-Version") != "13" {
+					t.Errorf("握手请求不正确: %s %v", r.URL, r.Header)
+				}
+				if key, err := base64.StdEncoding.DecodeString(r.Header.Get("Sec-WebSocket-Key")); err != nil || len(key) != 16 {
+					t.Errorf("Sec-WebSocket-Key不是16字节的base64: %q", r.Header.Get("Sec-WebSocket-Key"))
+				}
+				if err := tt.respond(w, r); err != nil {
+					t.Errorf("回复握手失败: %v", err)
+				}
+			}))
+			defer server.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			ws, err := dialWebSocket(ctx, wsURL(server, "/devtools/browser/1"))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("握手失败: %v", err)
+				}
+				ws.conn.Close()
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("错误为 %v，期望包含 %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebSocketWriteFrame(t *testing.T) {
+	for _, size := range []int{0, 125, 126, 0xFFFF, 0x10000} {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			ws, peer := dialPeer(t)
+			payload := bytes.Repeat([]byte("x"), size)
+			// 大的帧需要服务器同时读取，否则写入会阻塞
+			written := make(chan error, 1)
+			go func() { written <- ws.writeText(payload) }()
+
+			frame, err := peer.readFrame()
+			if err != nil {
+				t.Fatalf("读取帧失败: %v", err)
+			}
+			if err := <-written; err != nil {
+				t.Fatalf("发送帧失败: %v", err)
+			}
+			if !frame.fin || frame.opcode != opText || !bytes.Equal(frame.payload, payload) {
+				t.Errorf("收到的帧为 fin=%v opcode=%d 长度=%d，期望长度为 %d 的完整文本帧", frame.fin, frame.opcode, len(frame.payload), size)
+			}
+		})
+	}
+}
+
+func TestWebSocketReadMessage(t *testing.T) {
+	large := strings.Repeat("y", 0x10000)
+	tests := []struct {
+		name    string
+		frames  []wsFrame
+		want    string
+		wantErr string
+		reply   *wsFrame // 客户端应该回复的控制帧
+	}{
+		{
+			name:   "单帧文本",
+			frames: []wsFrame{{true, opText, []byte("hello")}},
+			want:   "hello",
+		},
+		{
+			name:   "使用扩展长度的帧",
+			frames: []wsFrame{{true, opBinary, []byte(large)}},
+			want:   large,
+		},
+		{
+			name:   "合并分片",
+			frames: []wsFrame{{false, opText, []byte("he")}, {false, opContinuation, []byte("l")}, {true, opContinuation, []byte("lo")}},
+			want:   "hello",
+		},
+		{
+			name:   "分片之间的ping",
+			frames: []wsFrame{{false, opText, []byte("hel")}, {true, opPing, []byte("p1")}, {true, opContinuation, []byte("lo")}},
+			want:   "hello",
+			reply:  &wsFrame{true, opPong, []byte("p1")},
+		},
+		{
+			name:   "忽略pong",
+			frames: []wsFrame{{true, opPong, []byte("x")}, {true, opText, []byte("after")}},
+			want:   "after",
+		},
+		{
+			name:    "关闭帧",
+			frames:  []wsFrame{{true, opClose, []byte{0x03, 0xE8}}},
+			wantErr: errClosed.Error(),
+			reply:   &wsFrame{true, opClose, []byte{0x03, 0xE8}},
+		},
+		{
+			name:    "意外的后续分片",
+			frames:  []wsFrame{{true, opContinuation, []byte("x")}},
+			wantErr: "意外的后续分片",
+		},
+		{
+			name:    "分片没有结束就开始新消息",
+			frames:  []wsFrame{{false, opText, []byte("a")}, {true, opText, []byte("b")}},
+			wantErr: "分片消息没有结束就开始了新消息",
+		},
+		{
+			name:    "未知的操作码",
+			frames:  []wsFrame{{true, 0x3, nil}},
+			wantErr: "未知的操作码 3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws, peer := dialPeer(t)
+			go func() {
+				for _, frame := range tt.frames {
+					if err := peer.writeFrame(frame); err != nil {
+						t.Errorf("发送帧失败: %v", err)
+						return
+					}
+				}
+			}()
+
+			message, err := ws.readMessage()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("错误为 %v，期望包含 %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("读取消息失败: %v", err)
+			} else if string(message) != tt.want {
+				t.Errorf("消息长度为 %d，期望 %d", len(message), len(tt.want))
+			}
+
+			if tt.reply != nil {
+				frame, err := peer.readFrame()
+				if err != nil {
+					t.Fatalf("读取客户端的回复失败: %v", err)
+				}
+				if frame.opcode != tt.reply.opcode || !bytes.Equal(frame.payload, tt.reply.payload) {
+					t.Errorf("客户端回复了 opcode=%d %q，期望 opcode=%d %q", frame.opcode, frame.payload, tt.reply.opcode, tt.reply.payload)
+				}
+			}
+		})
+	}
+}
+
+func TestWebSocketClose(t *testing.T) {
+	ws, peer := dialPeer(t)
+	if err := ws.close(); err != nil {
+		t.Fatalf("关闭连接失败: %v", err)
+	}
+	frame, err := peer.readFrame()
+	if err != nil {
+		t.Fatalf("读取关闭帧失败: %v", err)
+	}
+	if frame.opcode != opClose || !bytes.Equal(frame.payload, []byte{0x03, 0xE8}) {
+		t.Errorf("收到 opcode=%d %v，期望正常关闭的关闭帧", frame.opcode, frame.payload)
+	}
+	if _, err := peer.readFrame(); !errors.Is(err, io.EOF) {
+		t.Errorf("关闭帧之后连接应该断开，读取结果为 %v", err)
+	}
+}
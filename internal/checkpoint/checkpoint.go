@@ -0,0 +1,177 @@
+package checkpoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gomanus/internal/schema"
+)
+
+// 运行状态
+const (
+	StatusRunning     = "running"
+	StatusFinished    = "finished"
+	StatusError       = "error"
+	StatusInterrupted = "interrupted"
+)
+
+// Checkpoint 表示一次代理运行在某个一致点上的完整状态
+type Checkpoint struct {
+	RunID              string            `json:"run_id"`
+	Agent              string            `json:"agent"`
+	Mode               string            `json:"mode,omitempty"`
+	Request            string            `json:"request"`
+	Status             string            `json:"status"`
+	CurrentStep        int               `json:"current_step"`
+	RunStart           int               `json:"run_start"`
+	Messages           []schema.Message  `json:"messages"`
+	PendingToolCalls   []schema.ToolCall `json:"pending_tool_calls,omitempty"`
+	CompletedToolCalls map[string]string `json:"completed_tool_calls,omitempty"` // 工具调用ID -> 结果
+	AgentState         json.RawMessage   `json:"agent_state,omitempty"`          // 代理特有的状态，例如计划
+	CreatedAt          time.Time         `json:"created_at"`
+	UpdatedAt          time.Time         `json:"updated_at"`
+}
+
+// Resumable 检查运行是否可以恢复
+func (c *Checkpoint) Resumable() bool {
+	return c.Status == StatusRunning || c.Status == StatusInterrupted || c.Status == StatusError
+}
+
+// NewRunID 生成新的运行ID
+func NewRunID() string {
+	return fmt.Sprintf("run_%d", time.Now().UnixNano())
+}
+
+// Store 将检查点以JSON文件的形式保存在目录中
+type Store struct {
+	dir string
+}
+
+// NewStore 创建检查点存储，并确保目录存在
+// 检查点包含完整的对话和工具输出，目录和文件只允许当前用户访问
+func NewStore(dir string) (*Store, error) {
+	if dir == "" {
+		dir = "checkpoints"
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("创建检查点目录失败: %w", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// path 返回运行ID对应的检查点文件路径
+func (s *Store) path(runID string) string {
+	return filepath.Join(s.dir, runID+".json")
+}
+
+// Save 保存检查点，先写入临时文件再重命名，避免崩溃时留下不完整的文件
+func (s *Store) Save(cp *Checkpoint) error {
+	if cp.RunID == "" {
+		return fmt.Errorf("检查点缺少运行ID")
+	}
+
+	now := time.Now()
+	if cp.CreatedAt.IsZero() {
+		cp.CreatedAt = now
+	}
+	cp.UpdatedAt = now
+
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化检查点失败: %w", err)
+	}
+
+	tmpPath := s.path(cp.RunID) + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("写入检查点失败: %w", err)
+	}
+	if err := os.Rename(tmpPath, s.path(cp.RunID)); err != nil {
+		return fmt.Errorf("保存检查点失败: %w", err)
+	}
+	return nil
+}
+
+// Load 加载指定运行ID的检查点
+func (s *Store) Load(runID string) (*Checkpoint, error) {
+	data, err := os.ReadFile(s.path(runID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("运行 %s 的检查点不存在", runID)
+		}
+		return nil, fmt.Errorf("读取检查点失败: %w", err)
+	}
+
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("解析检查点失败: %w", err)
+	}
+	return &cp, nil
+}
+
+// List 列出所有检查点，按更新时间倒序排列
+func (s *Store) List() ([]*Checkpoint, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取检查点目录失败: %w", err)
+	}
+
+	var checkpoints []*Checkpoint
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		cp, err := s.Load(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			continue
+		}
+		checkpoints = append(checkpoints, cp)
+	}
+
+	sort.Slice(checkpoints, func(i, j int) bool {
+		return checkpoints[i].UpdatedAt.After(checkpoints[j].UpdatedAt)
+	})
+	return checkpoints, nil
+}
+
+// Prune 删除已经完成的运行的检查点、超过maxAge没有更新的检查点以及写入中断留下的临时文件，
+// maxAge为0时保留所有未完成的运行，返回删除的检查点数量
+func (s *Store) Prune(maxAge time.Duration) (int, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return 0, fmt.Errorf("读取检查点目录失败: %w", err)
+	}
+
+	removed := 0
+	now := time.Now()
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(name, ".json.tmp") {
+			os.Remove(filepath.Join(s.dir, name))
+			continue
+		}
+		if !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		cp, err := s.Load(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			continue
+		}
+		if cp.Status != StatusFinished && (maxAge <= 0 || now.Sub(cp.UpdatedAt) <= maxAge) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.dir, name)); err != nil {
+			return removed, fmt.Errorf("删除检查点 %s 失败: %w", cp.RunID, err)
+		}
+		removed++
+	}
+	return removed, nil
+}
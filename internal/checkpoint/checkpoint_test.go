@@ -0,0 +1,101 @@
+package checkpoint
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestStoreSaveIsPrivate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows没有Unix文件权限")
+	}
+	dir := filepath.Join(t.TempDir(), "checkpoints")
+	store, err := NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(&Checkpoint{RunID: "run_1", Status: StatusRunning}); err != nil {
+		t.Fatalf("保存检查点失败: %v", err)
+	}
+
+	for path, want := range map[string]os.FileMode{dir: 0700, store.path("run_1"): 0600} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm != want {
+			t.Errorf("%s 的权限为 %o，期望 %o", path, perm, want)
+		}
+	}
+}
+
+func TestStorePrune(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Save会更新时间，过期的检查点直接写入文件
+	write := func(cp *Checkpoint) {
+		t.Helper()
+		data, err := json.Marshal(cp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(store.path(cp.RunID), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	old := now.Add(-10 * 24 * time.Hour)
+	write(&Checkpoint{RunID: "finished", Status: StatusFinished, UpdatedAt: now})
+	write(&Checkpoint{RunID: "running", Status: StatusRunning, UpdatedAt: now})
+	write(&Checkpoint{RunID: "old_interrupted", Status: StatusInterrupted, UpdatedAt: old})
+	write(&Checkpoint{RunID: "old_error", Status: StatusError, UpdatedAt: old})
+	if err := os.WriteFile(store.path("partial")+".tmp", []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		maxAge      time.Duration
+		wantRemoved int
+		wantKept    []string
+	}{
+		{"保留所有未完成的运行", 0, 1, []string{"old_error", "old_interrupted", "running"}},
+		{"删除过期的运行", 7 * 24 * time.Hour, 2, []string{"running"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			removed, err := store.Prune(tt.maxAge)
+			if err != nil {
+				t.Fatalf("清理检查点失败: %v", err)
+			}
+			if removed != tt.wantRemoved {
+				t.Errorf("删除了 %d 个检查点，期望 %d 个", removed, tt.wantRemoved)
+			}
+			entries, err := os.ReadDir(store.dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var kept []string
+			for _, entry := range entries {
+				kept = append(kept, entry.Name()[:len(entry.Name())-len(filepath.Ext(entry.Name()))])
+			}
+			sort.Strings(kept)
+			if len(kept) != len(tt.wantKept) {
+				t.Fatalf("保留了 %v，期望 %v", kept, tt.wantKept)
+			}
+			for i := range kept {
+				if kept[i] != tt.wantKept[i] {
+					t.Errorf("保留了 %v，期望 %v", kept, tt.wantKept)
+					break
+				}
+			}
+		})
+	}
+}
@@ -19,24 +19,159 @@ type LLMConfig struct {
 	Temperature float64 `mapstructure:"temperature"`
 }
 
-// ToolsConfig 表示工具的配置
-type ToolsConfig struct {
-	Terminate       bool `mapstructure:"terminate"`
-	GoogleSearch    bool `mapstructure:"google_search"`
-	ZhihuSearch     bool `mapstructure:"zhihu_search"`
-	BaiduBaikeSearch bool `mapstructure:"baidu_baike_search"`
-	WikipediaSearch bool `mapstructure:"wikipedia_search"`
-	BrowserUse      bool `mapstructure:"browser_use"`
-	FileOperator    bool `mapstructure:"file_operator"`
-	Planning        bool `mapstructure:"planning"`
-	TerminalExecutor bool `mapstructure:"terminal_executor"`
+// ToolConfig 表示单个工具的配置
+// [tools] 中的 name = true/false 只设置是否启用，[tools.<name>] 表中还可以设置工具自己的配置项，表中省略enabled时视为启用
+type ToolConfig struct {
+	Enabled  bool
+	Settings map[string]interface{} // 表中除enabled以外的配置项
+}
+
+// ToolsConfig 表示工具的配置，键为工具名称
+type ToolsConfig map[string]ToolConfig
+
+// Enabled 检查工具是否启用，没有配置的工具不启用
+func (c ToolsConfig) Enabled(name string) bool {
+	return c[name].Enabled
+}
+
+// PolicyRule 表示一条工具调用权限规则
+type PolicyRule struct {
+	Name           string   `mapstructure:"name"`            // 规则名称，用于审计日志
+	Tool           string   `mapstructure:"tool"`            // 匹配的工具名称，"*"或留空表示所有工具
+	Effect         string   `mapstructure:"effect"`          // "allow" 或 "deny"
+	Modes          []string `mapstructure:"modes"`           // 生效的模式（chat/task/plan），留空表示所有模式
+	Agents         []string `mapstructure:"agents"`          // 生效的代理名称，留空表示所有代理
+	Argument       string   `mapstructure:"argument"`        // 需要检查的参数名，留空表示检查所有相关参数
+	Pattern        string   `mapstructure:"pattern"`         // 参数值需要匹配的正则表达式
+	OutsideDirs    []string `mapstructure:"outside_dirs"`    // 路径参数位于这些目录之外时命中
+	OutsideDomains []string `mapstructure:"outside_domains"` // URL参数的域名不在这些域名之内时命中
+	Reason         string   `mapstructure:"reason"`          // 返回给模型的说明
+}
+
+// PolicyConfig 表示工具调用权限策略的配置
+type PolicyConfig struct {
+	Enabled       bool         `mapstructure:"enabled"`
+	DefaultEffect string       `mapstructure:"default_effect"` // 没有规则命中时的默认决策，默认为"allow"
+	AuditLog      string       `mapstructure:"audit_log"`      // 审计日志文件路径，留空表示只写入程序日志
+	Rules         []PolicyRule `mapstructure:"rules"`
+}
+
+// RuntimeConfig 表示代理运行时的配置
+type RuntimeConfig struct {
+	MaxConcurrentTools      int    `mapstructure:"max_concurrent_tools"`       // 同一响应中工具调用的最大并发数，1表示串行执行
+	LoopRepeatThreshold     int    `mapstructure:"loop_repeat_threshold"`      // 相同工具调用连续出现多少次视为循环
+	LoopNoProgressThreshold int    `mapstructure:"loop_no_progress_threshold"` // 连续多少步没有新进展视为循环
+	EscalationModel         string `mapstructure:"escalation_model"`           // 检测到循环时升级使用的模型（llm_types中的名称）
+	CheckpointEnabled       bool   `mapstructure:"checkpoint_enabled"`         // 是否在每个步骤后保存检查点
+	CheckpointDir           string `mapstructure:"checkpoint_dir"`             // 检查点保存目录
+	CheckpointRetentionDays int    `mapstructure:"checkpoint_retention_days"`  // 未完成的运行的检查点保留天数，0表示一直保留
+	MaxSessions             int    `mapstructure:"max_sessions"`               // 同时存在的最大会话数，0表示不限制
+	SessionIdleTimeout      int    `mapstructure:"session_idle_timeout"`       // 会话空闲多久后回收（秒），0表示不回收
+}
+
+// PlanningConfig 表示规划代理的配置
+type PlanningConfig struct {
+	MaxParallelSteps  int `mapstructure:"max_parallel_steps"`  // 同时执行的无依赖步骤的最大数量
+	MaxReplans        int `mapstructure:"max_replans"`         // 每次运行中重新规划的最大次数
+	StepMaxIterations int `mapstructure:"step_max_iterations"` // 单个步骤思考-行动循环的最大轮数
+	StepTimeout       int `mapstructure:"step_timeout"`        // 单个步骤的最长执行时间（秒）
+	StepMaxTokens     int `mapstructure:"step_max_tokens"`     // 单个步骤可以消耗的最大token数，0表示不限制
+}
+
+// DelegationConfig 表示委托子任务的配置
+type DelegationConfig struct {
+	MaxDepth      int `mapstructure:"max_depth"`      // 委托的最大嵌套深度，1表示子代理不能再委托
+	MaxConcurrent int `mapstructure:"max_concurrent"` // 每一层嵌套深度同时运行的子代理的最大数量
+	MaxIterations int `mapstructure:"max_iterations"` // 子代理思考-行动循环的最大轮数
+	Timeout       int `mapstructure:"timeout"`        // 子代理的最长执行时间（秒）
+	MaxTokens     int `mapstructure:"max_tokens"`     // 子代理可以消耗的最大token数，0表示不限制
+}
+
+// VerifierConfig 表示验证代理的配置
+type VerifierConfig struct {
+	Enabled    bool   `mapstructure:"enabled"`
+	Model      string `mapstructure:"model"`       // 使用的模型（llm_types中的名称），留空则使用默认模型
+	MaxRetries *int   `mapstructure:"max_retries"` // 验证未通过时重试的最大次数，未配置时使用默认值，0表示不重试
+	Steps      bool   `mapstructure:"steps"`       // 是否验证计划步骤的结果
+	Answers    bool   `mapstructure:"answers"`     // 是否验证任务模式的最终回答
+}
+
+// ExecutorConfig 表示规划代理中某一类步骤的专用执行器配置
+type ExecutorConfig struct {
+	Enabled      bool     `mapstructure:"enabled"`
+	Description  string   `mapstructure:"description"`   // 在规划提示中展示的说明
+	SystemPrompt string   `mapstructure:"system_prompt"` // 执行器的系统提示
+	Tools        []string `mapstructure:"tools"`         // 执行器可以使用的工具
+	Model        string   `mapstructure:"model"`         // 使用的模型（llm_types中的名称），留空则使用默认模型
+	StepTypes    []string `mapstructure:"step_types"`    // 映射到此执行器的其他步骤类型
+}
+
+// PromptsConfig 表示系统提示模板的配置
+type PromptsConfig struct {
+	Dir        string `mapstructure:"dir"`         // 覆盖内置模板的目录，其中的同名模板优先于内置模板
+	Language   string `mapstructure:"language"`    // 模板语言，优先使用 <dir>/<language>/ 下的模板
+	MemoryFile string `mapstructure:"memory_file"` // 用户记忆文件，内容会加入系统提示
+}
+
+// AgentConfig 表示一个声明式的代理配置
+type AgentConfig struct {
+	Description      string   `mapstructure:"description"`        // 代理的说明
+	SystemPrompt     string   `mapstructure:"system_prompt"`      // 系统提示
+	SystemPromptFile string   `mapstructure:"system_prompt_file"` // 从模板文件读取系统提示，优先于system_prompt
+	PromptTemplate   string   `mapstructure:"prompt_template"`    // 使用的提示模板名称，留空则使用策略的默认模板
+	Model            string   `mapstructure:"model"`              // 使用的模型（llm_types中的名称），留空则使用默认模型
+	Tools            []string `mapstructure:"tools"`              // 可以使用的工具，留空则可以使用全部工具
+	ExcludeTools     []string `mapstructure:"exclude_tools"`      // 不能使用的工具，优先于tools
+	MaxSteps         int      `mapstructure:"max_steps"`          // 最大步骤数
+	Strategy         string   `mapstructure:"strategy"`           // 执行策略: react、plan_execute、chat
+}
+
+// MCPServerConfig 表示一个外部MCP服务器的配置
+type MCPServerConfig struct {
+	Enabled   bool              `mapstructure:"enabled"`
+	Transport string            `mapstructure:"transport"` // stdio、http（可流式HTTP）或sse（旧版HTTP+SSE），留空时根据command和url判断
+	Command   string            `mapstructure:"command"`   // stdio传输启动服务器的命令
+	Args      []string          `mapstructure:"args"`      // 命令参数
+	Env       []string          `mapstructure:"env"`       // 额外的环境变量，格式为KEY=VALUE，值中的${VAR}会被替换
+	Dir       string            `mapstructure:"dir"`       // 服务器进程的工作目录
+	URL       string            `mapstructure:"url"`       // http和sse传输的服务器地址
+	Headers   map[string]string `mapstructure:"headers"`   // http和sse传输的请求头，值中的${VAR}会被替换
+	Timeout   int               `mapstructure:"timeout"`   // 单个请求的超时时间（秒），默认为30秒
+	Prefix    string            `mapstructure:"prefix"`    // 工具名称的前缀，默认为 mcp_<服务器名称>
+	Tools     []string          `mapstructure:"tools"`     // 只挂载这些工具（服务器中的原始名称），留空表示挂载全部工具
+}
+
+// MCPServeConfig 表示 gomanus mcp serve 对外提供工具的配置
+type MCPServeConfig struct {
+	Tools        []string `mapstructure:"tools"`         // 提供的工具，留空表示提供全部已启用的工具
+	ExcludeTools []string `mapstructure:"exclude_tools"` // 不提供的工具
+	ExposeAgent  bool     `mapstructure:"expose_agent"`  // 是否提供由代理完成整个任务的gomanus_run工具
+}
+
+// PluginsConfig 表示外部可执行插件工具的配置
+type PluginsConfig struct {
+	Enabled bool   `mapstructure:"enabled"` // 是否加载插件
+	Dir     string `mapstructure:"dir"`     // 插件目录，每个子目录是一个插件
+	Watch   bool   `mapstructure:"watch"`   // 插件目录变化时是否重新加载
+	Timeout int    `mapstructure:"timeout"` // 插件未声明超时时间时单次调用的超时秒数
 }
 
 // Config 表示应用程序的配置
 type Config struct {
-	LLM      LLMConfig            `mapstructure:"llm"`
-	LLMTypes map[string]LLMConfig `mapstructure:"llm_types"`
-	Tools    ToolsConfig          `mapstructure:"tools"`
+	LLM        LLMConfig                  `mapstructure:"llm"`
+	LLMTypes   map[string]LLMConfig       `mapstructure:"llm_types"`
+	Tools      map[string]interface{}     `mapstructure:"tools"`
+	Policy     PolicyConfig               `mapstructure:"policy"`
+	Runtime    RuntimeConfig              `mapstructure:"runtime"`
+	Planning   PlanningConfig             `mapstructure:"planning"`
+	Verifier   VerifierConfig             `mapstructure:"verifier"`
+	Delegation DelegationConfig           `mapstructure:"delegation"`
+	Executors  map[string]ExecutorConfig  `mapstructure:"executors"`
+	Agents     map[string]AgentConfig     `mapstructure:"agents"`
+	Prompts    PromptsConfig              `mapstructure:"prompts"`
+	MCPServers map[string]MCPServerConfig `mapstructure:"mcp_servers"`
+	MCPServe   MCPServeConfig             `mapstructure:"mcp_serve"`
+	Plugins    PluginsConfig              `mapstructure:"plugins"`
 }
 
 var (
@@ -109,12 +244,145 @@ func GetLLMConfig(name string) (*LLMConfig, error) {
 	return nil, fmt.Errorf("未找到名为 %s 的LLM配置", name)
 }
 
-// GetToolsConfig 获取工具配置
-func GetToolsConfig() (*ToolsConfig, error) {
+// GetToolsConfig 获取工具配置，配置格式错误时返回的错误中包含工具名称
+func GetToolsConfig() (ToolsConfig, error) {
 	cfg, err := LoadConfig("")
 	if err != nil {
 		return nil, err
 	}
-	
-	return &cfg.Tools, nil
+
+	tools := make(ToolsConfig, len(cfg.Tools))
+	for name, value := range cfg.Tools {
+		switch value := value.(type) {
+		case bool:
+			tools[name] = ToolConfig{Enabled: value}
+		case map[string]interface{}:
+			toolCfg := ToolConfig{Enabled: true, Settings: make(map[string]interface{}, len(value))}
+			for key, setting := range value {
+				if key != "enabled" {
+					toolCfg.Settings[key] = setting
+					continue
+				}
+				enabled, ok := setting.(bool)
+				if !ok {
+					return nil, fmt.Errorf("工具 %s 的enabled必须是布尔值", name)
+				}
+				toolCfg.Enabled = enabled
+			}
+			tools[name] = toolCfg
+		default:
+			return nil, fmt.Errorf("工具 %s 的配置无效: 应为布尔值或 [tools.%s] 配置表", name, name)
+		}
+	}
+	return tools, nil
+}
+
+// GetPolicyConfig 获取工具权限策略配置
+func GetPolicyConfig() (*PolicyConfig, error) {
+	cfg, err := LoadConfig("")
+	if err != nil {
+		return nil, err
+	}
+
+	return &cfg.Policy, nil
+}
+
+// GetRuntimeConfig 获取代理运行时配置
+func GetRuntimeConfig() (*RuntimeConfig, error) {
+	cfg, err := LoadConfig("")
+	if err != nil {
+		return nil, err
+	}
+
+	return &cfg.Runtime, nil
+}
+
+// GetPlanningConfig 获取规划代理配置
+func GetPlanningConfig() (*PlanningConfig, error) {
+	cfg, err := LoadConfig("")
+	if err != nil {
+		return nil, err
+	}
+
+	return &cfg.Planning, nil
+}
+
+// GetVerifierConfig 获取验证代理配置
+func GetVerifierConfig() (*VerifierConfig, error) {
+	cfg, err := LoadConfig("")
+	if err != nil {
+		return nil, err
+	}
+
+	return &cfg.Verifier, nil
+}
+
+// GetDelegationConfig 获取委托子任务配置
+func GetDelegationConfig() (*DelegationConfig, error) {
+	cfg, err := LoadConfig("")
+	if err != nil {
+		return nil, err
+	}
+
+	return &cfg.Delegation, nil
+}
+
+// GetPromptsConfig 获取系统提示模板配置
+func GetPromptsConfig() (*PromptsConfig, error) {
+	cfg, err := LoadConfig("")
+	if err != nil {
+		return nil, err
+	}
+
+	return &cfg.Prompts, nil
+}
+
+// GetAgentsConfig 获取声明式代理配置
+func GetAgentsConfig() (map[string]AgentConfig, error) {
+	cfg, err := LoadConfig("")
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg.Agents, nil
+}
+
+// GetExecutorsConfig 获取规划代理的执行器配置
+func GetExecutorsConfig() (map[string]ExecutorConfig, error) {
+	cfg, err := LoadConfig("")
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg.Executors, nil
+}
+
+// GetMCPServersConfig 获取外部MCP服务器的配置
+func GetMCPServersConfig() (map[string]MCPServerConfig, error) {
+	cfg, err := LoadConfig("")
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg.MCPServers, nil
+}
+
+// GetMCPServeConfig 获取对外提供MCP服务的配置
+func GetMCPServeConfig() (*MCPServeConfig, error) {
+	cfg, err := LoadConfig("")
+	if err != nil {
+		return nil, err
+	}
+
+	return &cfg.MCPServe, nil
+}
+
+// GetPluginsConfig 获取插件工具的配置
+func GetPluginsConfig() (*PluginsConfig, error) {
+	cfg, err := LoadConfig("")
+	if err != nil {
+		return nil, err
+	}
+
+	return &cfg.Plugins, nil
 }
@@ -221,14 +221,31 @@ func (l *LLM) AskWithOptions(
 		logger.Info("LLM响应中没有工具调用")
 	}
 
+	// 提取token用量
+	var usage schema.Usage
+	if usageRaw, ok := response["usage"].(map[string]interface{}); ok {
+		promptTokens, _ := usageRaw["prompt_tokens"].(float64)
+		completionTokens, _ := usageRaw["completion_tokens"].(float64)
+		totalTokens, _ := usageRaw["total_tokens"].(float64)
+		usage = schema.Usage{
+			PromptTokens:     int(promptTokens),
+			CompletionTokens: int(completionTokens),
+			TotalTokens:      int(totalTokens),
+		}
+		if usage.TotalTokens == 0 {
+			usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+		}
+	}
+
 	// 计算耗时
 	elapsed := time.Since(start)
-	logger.Info("LLM响应耗时: %s", elapsed)
+	logger.Info("LLM响应耗时: %s, token用量: %d", elapsed, usage.TotalTokens)
 
 	// 返回响应
 	return &schema.LLMResponse{
 		Content:   content,
 		ToolCalls: toolCalls,
+		Usage:     usage,
 	}, nil
 }
 
@@ -0,0 +1,184 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"gomanus/internal/config"
+	"gomanus/pkg/logger"
+)
+
+// defaultTimeout 是未配置超时时间时单个请求的超时时间
+const defaultTimeout = 30 * time.Second
+
+// clientInfo 是初始化时告知服务器的客户端信息
+var clientInfo = Implementation{Name: "gomanus", Version: "0.8.4"}
+
+// Client 是连接到一个MCP服务器的客户端，可以被多个会话同时使用
+type Client struct {
+	Name         string         // 配置中的服务器名称
+	ServerInfo   Implementation // 服务器在初始化时返回的信息
+	Instructions string         // 服务器提供的使用说明
+
+	transport transport
+	timeout   time.Duration
+	nextID    atomic.Int64
+}
+
+// Connect 连接MCP服务器并完成初始化握手
+func Connect(ctx context.Context, name string, cfg config.MCPServerConfig) (*Client, error) {
+	timeout := defaultTimeout
+	if cfg.Timeout > 0 {
+		timeout = time.Duration(cfg.Timeout) * time.Second
+	}
+	connectCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	headers := make(map[string]string, len(cfg.Headers))
+	for key, value := range cfg.Headers {
+		headers[key] = os.ExpandEnv(value)
+	}
+
+	var t transport
+	switch transportType(cfg) {
+	case "stdio":
+		if cfg.Command == "" {
+			return nil, fmt.Errorf("stdio传输需要配置command")
+		}
+		env := make([]string, 0, len(cfg.Env))
+		for _, item := range cfg.Env {
+			env = append(env, os.ExpandEnv(item))
+		}
+		stdio, err := startStdio(name, cfg.Command, cfg.Args, env, cfg.Dir)
+		if err != nil {
+			return nil, err
+		}
+		t = stdio
+	case "http":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("http传输需要配置url")
+		}
+		t = newHTTPTransport(name, cfg.URL, headers)
+	case "sse":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("sse传输需要配置url")
+		}
+		sse, err := startSSE(connectCtx, name, cfg.URL, headers)
+		if err != nil {
+			return nil, err
+		}
+		t = sse
+	default:
+		return nil, fmt.Errorf("未知的传输方式 '%s'，可选: stdio、http、sse", cfg.Transport)
+	}
+
+	client := &Client{Name: name, transport: t, timeout: timeout}
+	if err := client.initialize(connectCtx); err != nil {
+		t.close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// transportType 返回配置的传输方式，未配置时有command则使用stdio，否则使用http
+func transportType(cfg config.MCPServerConfig) string {
+	if cfg.Transport != "" {
+		return cfg.Transport
+	}
+	if cfg.Command != "" {
+		return "stdio"
+	}
+	return "http"
+}
+
+// initialize 完成初始化握手：发送initialize请求，再发送initialized通知
+func (c *Client) initialize(ctx context.Context) error {
+	var result initializeResult
+	err := c.call(ctx, "initialize", initializeParams{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    map[string]interface{}{},
+		ClientInfo:      clientInfo,
+	}, &result)
+	if err != nil {
+		return fmt.Errorf("初始化MCP服务器 %s 失败: %w", c.Name, err)
+	}
+	if _, ok := result.Capabilities["tools"]; !ok {
+		logger.Warn("MCP服务器 %s 没有声明工具能力", c.Name)
+	}
+	if httpT, ok := c.transport.(*httpTransport); ok {
+		httpT.setProtocolVersion(result.ProtocolVersion)
+	}
+
+	c.ServerInfo = result.ServerInfo
+	c.Instructions = result.Instructions
+	logger.Info("已连接MCP服务器 %s: %s %s (协议版本 %s)", c.Name, result.ServerInfo.Name, result.ServerInfo.Version, result.ProtocolVersion)
+
+	if err := c.transport.notify(ctx, &message{JSONRPC: "2.0", Method: "notifications/initialized"}); err != nil {
+		return fmt.Errorf("发送初始化通知失败: %w", err)
+	}
+	return nil
+}
+
+// ListTools 列出服务器提供的全部工具
+func (c *Client) ListTools(ctx context.Context) ([]ToolInfo, error) {
+	var tools []ToolInfo
+	cursor := ""
+	for {
+		params := map[string]interface{}{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		var result listToolsResult
+		if err := c.call(ctx, "tools/list", params, &result); err != nil {
+			return nil, fmt.Errorf("获取MCP服务器 %s 的工具列表失败: %w", c.Name, err)
+		}
+		tools = append(tools, result.Tools...)
+		if result.NextCursor == "" {
+			return tools, nil
+		}
+		cursor = result.NextCursor
+	}
+}
+
+// CallTool 调用服务器的工具
+func (c *Client) CallTool(ctx context.Context, name string, args map[string]interface{}) (*CallToolResult, error) {
+	var result CallToolResult
+	if err := c.call(ctx, "tools/call", callToolParams{Name: name, Arguments: args}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Close 断开与服务器的连接
+func (c *Client) Close() error {
+	return c.transport.close()
+}
+
+// call 发送请求并把结果解码到result中
+func (c *Client) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("编码请求参数失败: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	id := json.RawMessage(strconv.FormatInt(c.nextID.Add(1), 10))
+	resp, err := c.transport.call(ctx, &message{JSONRPC: "2.0", ID: id, Method: method, Params: data})
+	if err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if err := json.Unmarshal(resp.Result, result); err != nil {
+		return fmt.Errorf("解析 %s 的结果失败: %w", method, err)
+	}
+	return nil
+}
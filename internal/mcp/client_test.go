@@ -0,0 +1,414 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gomanus/internal/config"
+	"gomanus/internal/tool"
+	"gomanus/pkg/logger"
+)
+
+// TestMain 关闭测试中的日志输出
+func TestMain(m *testing.M) {
+	logger.SetLevel(logger.LevelFatal)
+	os.Exit(m.Run())
+}
+
+// stubServer 是测试用的MCP服务器，工具列表分两页返回，调用crash工具时执行crash模拟连接断开
+type stubServer struct {
+	t     *testing.T
+	crash func()
+
+	mu       sync.Mutex
+	received []string // 收到的请求和通知的方法名称
+}
+
+// handle 处理一条客户端消息，通知、客户端的响应和没有响应的请求返回nil
+func (s *stubServer) handle(msg *message) *message {
+	if msg.isResponse() {
+		return nil
+	}
+	s.mu.Lock()
+	s.received = append(s.received, msg.Method)
+	s.mu.Unlock()
+	if !msg.isRequest() {
+		return nil
+	}
+
+	var result interface{}
+	switch msg.Method {
+	case "initialize":
+		var params initializeParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil || params.ProtocolVersion != ProtocolVersion || params.ClientInfo != clientInfo {
+			return &message{JSONRPC: "2.0", ID: msg.ID, Error: &RPCError{Code: codeInvalidParams, Message: "无效的initialize参数"}}
+		}
+		result = initializeResult{
+			ProtocolVersion: ProtocolVersion,
+			Capabilities:    map[string]interface{}{"tools": map[string]interface{}{}},
+			ServerInfo:      Implementation{Name: "stub", Version: "1.0"},
+			Instructions:    "测试服务器",
+		}
+	case "tools/list":
+		var params struct {
+			Cursor string `json:"cursor"`
+		}
+		json.Unmarshal(msg.Params, &params)
+		switch params.Cursor {
+		case "":
+			result = listToolsResult{Tools: []ToolInfo{{Name: "echo", Description: "回显参数"}}, NextCursor: "page2"}
+		case "page2":
+			result = listToolsResult{Tools: []ToolInfo{{Name: "crash"}}}
+		default:
+			return &message{JSONRPC: "2.0", ID: msg.ID, Error: &RPCError{Code: codeInvalidParams, Message: "无效的cursor"}}
+		}
+	case "tools/call":
+		var params callToolParams
+		json.Unmarshal(msg.Params, &params)
+		if params.Name == "crash" {
+			s.crash()
+			return nil
+		}
+		result = CallToolResult{Content: []Content{{Type: "text", Text: fmt.Sprintf("%s: %v", params.Name, params.Arguments["text"])}}}
+	default:
+		return &message{JSONRPC: "2.0", ID: msg.ID, Error: &RPCError{Code: codeMethodNotFound, Message: msg.Method}}
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		s.t.Error(err)
+	}
+	return &message{JSONRPC: "2.0", ID: msg.ID, Result: data}
+}
+
+// methods 返回收到的消息的方法名称
+func (s *stubServer) methods() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.received...)
+}
+
+// pipeClient 通过io.Pipe连接在当前进程中运行的stdio服务器并完成初始化，serve返回表示服务器进程退出
+func pipeClient(t *testing.T, serve func(in io.Reader, out io.Writer)) (*Client, error) {
+	t.Helper()
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		serve(serverIn, serverOut)
+		serverIn.Close()
+		serverOut.Close()
+	}()
+	wait := func() error {
+		<-exited
+		return nil
+	}
+	kill := func() error {
+		serverIn.CloseWithError(io.ErrClosedPipe)
+		return nil
+	}
+
+	transport := newStdioTransport("stub", clientOut, clientIn, strings.NewReader(""), wait, kill)
+	client := &Client{Name: "stub", transport: transport, timeout: 5 * time.Second}
+	t.Cleanup(func() { client.Close() })
+	return client, client.initialize(context.Background())
+}
+
+// serveStub 以stdio方式运行stubServer
+func serveStub(stub *stubServer) func(in io.Reader, out io.Writer) {
+	return func(in io.Reader, out io.Writer) {
+		crashed := make(chan struct{})
+		stub.crash = func() { close(crashed) }
+		lines := make(chan []byte)
+		go func() {
+			defer close(lines)
+			scanner := bufio.NewScanner(in)
+			for scanner.Scan() {
+				lines <- append([]byte(nil), scanner.Bytes()...)
+			}
+		}()
+		for {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					return
+				}
+				var msg message
+				if err := json.Unmarshal(line, &msg); err != nil {
+					stub.t.Errorf("服务器收到无法解析的消息: %s", line)
+					continue
+				}
+				if resp := stub.handle(&msg); resp != nil {
+					data, _ := json.Marshal(resp)
+					out.Write(append(data, '\n'))
+				}
+			case <-crashed:
+				go func() {
+					for range lines {
+					}
+				}()
+				return
+			}
+		}
+	}
+}
+
+// checkStubClient 检查握手结果、分页获取的工具列表和工具调用
+func checkStubClient(t *testing.T, client *Client, stub *stubServer) {
+	t.Helper()
+	if client.ServerInfo.Name != "stub" || client.Instructions != "测试服务器" {
+		t.Errorf("握手结果不正确: %+v %q", client.ServerInfo, client.Instructions)
+	}
+
+	ctx := context.Background()
+	tools, err := client.ListTools(ctx)
+	if err != nil {
+		t.Fatalf("获取工具列表失败: %v", err)
+	}
+	var names []string
+	for _, info := range tools {
+		names = append(names, info.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"echo", "crash"}) {
+		t.Errorf("工具列表为 %v，期望包含两页的工具", names)
+	}
+
+	result, err := client.CallTool(ctx, "echo", map[string]interface{}{"text": "你好"})
+	if err != nil {
+		t.Fatalf("调用工具失败: %v", err)
+	}
+	if text := contentText(result.Content); text != "echo: 你好" {
+		t.Errorf("工具结果为 %q", text)
+	}
+
+	err = client.call(ctx, "resources/list", map[string]interface{}{}, &struct{}{})
+	if rpcErr, ok := err.(*RPCError); !ok || rpcErr.Code != codeMethodNotFound {
+		t.Errorf("不支持的方法返回 %v，期望RPCError", err)
+	}
+
+	want := []string{"initialize", "notifications/initialized", "tools/list", "tools/list", "tools/call", "resources/list"}
+	if got := stub.methods(); !reflect.DeepEqual(got[:min(len(got), len(want))], want) {
+		t.Errorf("服务器收到的消息为 %v，期望 %v", got, want)
+	}
+}
+
+func TestClientOverStdio(t *testing.T) {
+	stub := &stubServer{t: t}
+	client, err := pipeClient(t, serveStub(stub))
+	if err != nil {
+		t.Fatalf("初始化失败: %v", err)
+	}
+	checkStubClient(t, client, stub)
+}
+
+func TestClientOverStdioWithServer(t *testing.T) {
+	// 客户端和本包的Server通过stdio互通
+	tools := tool.NewToolCollection()
+	tools.AddTool(tool.NewTypedTool("echo", "回显参数", func(ctx context.Context, args struct {
+		Text string `json:"text" required:"true"`
+	}) (interface{}, error) {
+		return "echo: " + args.Text, nil
+	}))
+	server := NewServer(tools)
+	server.Instructions = "GoManus工具"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client, err := pipeClient(t, func(in io.Reader, out io.Writer) {
+		server.ServeStdio(ctx, in, out)
+	})
+	if err != nil {
+		t.Fatalf("初始化失败: %v", err)
+	}
+	if client.ServerInfo != clientInfo || client.Instructions != "GoManus工具" {
+		t.Errorf("握手结果不正确: %+v %q", client.ServerInfo, client.Instructions)
+	}
+
+	infos, err := client.ListTools(ctx)
+	if err != nil || len(infos) != 1 || infos[0].Name != "echo" {
+		t.Fatalf("工具列表为 %+v, %v", infos, err)
+	}
+	result, err := client.CallTool(ctx, "echo", map[string]interface{}{"text": "你好"})
+	if err != nil || result.IsError || contentText(result.Content) != "echo: 你好" {
+		t.Errorf("调用工具返回 %+v, %v", result, err)
+	}
+	result, err = client.CallTool(ctx, "echo", map[string]interface{}{})
+	if err != nil || !result.IsError || !strings.Contains(contentText(result.Content), "invalid_arguments") {
+		t.Errorf("缺少参数时返回 %+v, %v，期望工具错误", result, err)
+	}
+}
+
+func TestClientOverHTTP(t *testing.T) {
+	t.Setenv("MCP_TEST_TOKEN", "secret")
+	stub := &stubServer{t: t}
+	pong := make(chan struct{}, 1)
+	var deleted bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "未授权", http.StatusUnauthorized)
+			return
+		}
+		if r.Method == http.MethodDelete {
+			deleted = r.Header.Get(sessionHeader) == "session-1"
+			return
+		}
+		var msg message
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if msg.Method == "initialize" {
+			w.Header().Set(sessionHeader, "session-1")
+		} else if r.Header.Get(sessionHeader) != "session-1" || r.Header.Get("MCP-Protocol-Version") != ProtocolVersion {
+			http.Error(w, "缺少会话或协议版本", http.StatusBadRequest)
+			return
+		}
+		if msg.isResponse() && string(msg.ID) == `"ping-1"` {
+			pong <- struct{}{}
+		}
+
+		resp := stub.handle(&msg)
+		if resp == nil {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		data, _ := json.Marshal(resp)
+		if msg.Method != "tools/call" {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(data)
+			return
+		}
+		// 工具调用以事件流返回，先向客户端发送ping，收到回复后再返回结果
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "event: message\ndata: {\"jsonrpc\":\"2.0\",\"id\":\"ping-1\",\"method\":\"ping\"}\n\n")
+		w.(http.Flusher).Flush()
+		select {
+		case <-pong:
+		case <-time.After(5 * time.Second):
+			t.Error("客户端没有回复服务器的ping")
+		}
+		fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+	}))
+	defer srv.Close()
+
+	client, err := Connect(context.Background(), "stub", config.MCPServerConfig{
+		URL:     srv.URL,
+		Headers: map[string]string{"Authorization": "Bearer ${MCP_TEST_TOKEN}"},
+	})
+	if err != nil {
+		t.Fatalf("连接失败: %v", err)
+	}
+	checkStubClient(t, client, stub)
+	if err := client.Close(); err != nil || !deleted {
+		t.Errorf("关闭时没有结束会话: %v", err)
+	}
+}
+
+func TestClientOverSSE(t *testing.T) {
+	stub := &stubServer{t: t}
+	events := make(chan []byte, 16)
+	crashed := make(chan struct{})
+	stub.crash = func() { close(crashed) }
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/sse":
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprintf(w, ": 注释行\n\nevent: endpoint\ndata: /messages?session=1\n\n")
+			w.(http.Flusher).Flush()
+			for {
+				select {
+				case data := <-events:
+					fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+					w.(http.Flusher).Flush()
+				case <-crashed:
+					return
+				case <-r.Context().Done():
+					return
+				}
+			}
+		case r.Method == http.MethodPost && r.URL.Path == "/messages" && r.URL.Query().Get("session") == "1":
+			var msg message
+			if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if resp := stub.handle(&msg); resp != nil {
+				data, _ := json.Marshal(resp)
+				events <- data
+			}
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	client, err := Connect(context.Background(), "stub", config.MCPServerConfig{Transport: "sse", URL: srv.URL + "/sse"})
+	if err != nil {
+		t.Fatalf("连接失败: %v", err)
+	}
+	defer client.Close()
+	checkStubClient(t, client, stub)
+
+	// 事件流断开后，等待中的请求和之后的请求都失败
+	if _, err := client.CallTool(context.Background(), "crash", nil); err == nil || !strings.Contains(err.Error(), "事件流已断开") {
+		t.Errorf("事件流断开时返回 %v", err)
+	}
+	if _, err := client.CallTool(context.Background(), "echo", nil); err == nil || !strings.Contains(err.Error(), "事件流已断开") {
+		t.Errorf("事件流断开后的请求返回 %v", err)
+	}
+}
+
+func TestConnectFailsWhenInitializeFails(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"jsonrpc":"2.0","id":1,"error":{"code":-32602,"message":"不支持的协议版本"}}`)
+	}))
+	defer srv.Close()
+
+	_, err := Connect(context.Background(), "stub", config.MCPServerConfig{URL: srv.URL})
+	if err == nil || !strings.Contains(err.Error(), "不支持的协议版本") {
+		t.Errorf("初始化失败时返回 %v", err)
+	}
+}
+
+func TestMountFiltersAndPrefixesTools(t *testing.T) {
+	stub := &stubServer{t: t, crash: func() {}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg message
+		json.NewDecoder(r.Body).Decode(&msg)
+		resp := stub.handle(&msg)
+		if resp == nil {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer srv.Close()
+
+	tools := tool.NewToolCollection()
+	client, mounted, err := Mount(context.Background(), tools, "stub.server", config.MCPServerConfig{URL: srv.URL, Tools: []string{"echo"}})
+	if err != nil {
+		t.Fatalf("挂载失败: %v", err)
+	}
+	defer client.Close()
+	if !reflect.DeepEqual(mounted, []string{"mcp_stub_server_echo"}) {
+		t.Fatalf("挂载的工具为 %v", mounted)
+	}
+	result, err := tools.ExecuteTool(context.Background(), "mcp_stub_server_echo", map[string]interface{}{"text": "你好"})
+	if err != nil || result != "echo: 你好" {
+		t.Errorf("调用挂载的工具返回 %v, %v", result, err)
+	}
+}
@@ -0,0 +1,401 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"gomanus/pkg/logger"
+)
+
+// sessionHeader 是可流式HTTP传输中服务器分配的会话ID
+const sessionHeader = "Mcp-Session-Id"
+
+// httpTransport 实现可流式HTTP传输（Streamable HTTP）：每条消息是一个POST请求，
+// 服务器以JSON或SSE事件流返回响应
+type httpTransport struct {
+	name     string
+	endpoint string
+	headers  map[string]string
+	client   *http.Client
+
+	mu        sync.Mutex
+	sessionID string
+	version   string // 协商的协议版本，初始化后随每个请求发送
+}
+
+// newHTTPTransport 创建可流式HTTP传输
+func newHTTPTransport(name, endpoint string, headers map[string]string) *httpTransport {
+	return &httpTransport{
+		name:     name,
+		endpoint: endpoint,
+		headers:  headers,
+		client:   &http.Client{},
+	}
+}
+
+// setProtocolVersion 记录初始化时协商的协议版本
+func (t *httpTransport) setProtocolVersion(version string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.version = version
+}
+
+// post 发送一条消息，返回服务器的HTTP响应
+func (t *httpTransport) post(ctx context.Context, msg *message) (*http.Response, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("编码MCP消息失败: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("创建MCP请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	t.setHeaders(req)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("发送MCP请求失败: %w", err)
+	}
+	if id := resp.Header.Get(sessionHeader); id != "" {
+		t.mu.Lock()
+		t.sessionID = id
+		t.mu.Unlock()
+	}
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound && t.hasSession() {
+			return nil, fmt.Errorf("MCP服务器 %s 的会话已过期", t.name)
+		}
+		return nil, fmt.Errorf("MCP服务器返回HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+// setHeaders 设置自定义请求头、会话ID和协议版本
+func (t *httpTransport) setHeaders(req *http.Request) {
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.sessionID != "" {
+		req.Header.Set(sessionHeader, t.sessionID)
+	}
+	if t.version != "" {
+		req.Header.Set("MCP-Protocol-Version", t.version)
+	}
+}
+
+// hasSession 检查服务器是否分配了会话
+func (t *httpTransport) hasSession() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.sessionID != ""
+}
+
+// call 发送请求，从JSON响应或SSE事件流中读取对应的响应
+func (t *httpTransport) call(ctx context.Context, req *message) (*message, error) {
+	resp, err := t.post(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "text/event-stream" {
+		var result *message
+		err := readEvents(resp.Body, func(event, data string) bool {
+			msg, ok := decodeEvent(data)
+			if !ok {
+				return true
+			}
+			if msg.isResponse() && string(msg.ID) == string(req.ID) {
+				result = msg
+				return false
+			}
+			if msg.isRequest() {
+				t.reply(ctx, msg)
+			}
+			return true
+		})
+		if result != nil {
+			return result, nil
+		}
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("读取MCP事件流失败: %w", err)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取MCP响应失败: %w", err)
+	}
+	return findResponse(body, req.ID)
+}
+
+// reply 回复服务器在事件流中发来的请求
+func (t *httpTransport) reply(ctx context.Context, req *message) {
+	resp, err := t.post(ctx, replyToServer(req))
+	if err != nil {
+		logger.Warn("回复MCP服务器 %s 的请求失败: %v", t.name, err)
+		return
+	}
+	resp.Body.Close()
+}
+
+// notify 发送通知，服务器返回202
+func (t *httpTransport) notify(ctx context.Context, msg *message) error {
+	resp, err := t.post(ctx, msg)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// close 通知服务器结束会话
+func (t *httpTransport) close() error {
+	if !t.hasSession() {
+		return nil
+	}
+	req, err := http.NewRequest(http.MethodDelete, t.endpoint, nil)
+	if err != nil {
+		return err
+	}
+	t.setHeaders(req)
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("结束MCP会话失败: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// sseTransport 实现旧版的HTTP+SSE传输：客户端通过GET建立事件流，
+// 服务器在endpoint事件中告知POST消息的地址，响应通过事件流返回
+type sseTransport struct {
+	name      string
+	headers   map[string]string
+	client    *http.Client
+	endpoint  string // 服务器告知的消息地址
+	responses *dispatcher
+	cancel    context.CancelFunc
+}
+
+// startSSE 建立事件流并等待服务器告知消息地址
+func startSSE(ctx context.Context, name, streamURL string, headers map[string]string) (*sseTransport, error) {
+	base, err := url.Parse(streamURL)
+	if err != nil {
+		return nil, fmt.Errorf("无效的MCP服务器地址: %w", err)
+	}
+
+	streamCtx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(streamCtx, http.MethodGet, streamURL, nil)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("创建MCP事件流请求失败: %w", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	t := &sseTransport{
+		name:      name,
+		headers:   headers,
+		client:    &http.Client{},
+		responses: newDispatcher(),
+		cancel:    cancel,
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("连接MCP事件流失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("连接MCP事件流失败: HTTP %d", resp.StatusCode)
+	}
+
+	endpoints := make(chan string, 1)
+	go func() {
+		defer resp.Body.Close()
+		err := readEvents(resp.Body, func(event, data string) bool {
+			if event == "endpoint" {
+				select {
+				case endpoints <- strings.TrimSpace(data):
+				default:
+				}
+				return true
+			}
+			msg, ok := decodeEvent(data)
+			if !ok {
+				return true
+			}
+			switch {
+			case msg.isResponse():
+				t.responses.deliver(msg)
+			case msg.isRequest():
+				if err := t.post(context.Background(), replyToServer(msg)); err != nil {
+					logger.Warn("回复MCP服务器 %s 的请求失败: %v", name, err)
+				}
+			}
+			return true
+		})
+		if err == nil {
+			err = io.EOF
+		}
+		t.responses.fail(fmt.Errorf("MCP服务器 %s 的事件流已断开: %w", name, err))
+	}()
+
+	select {
+	case endpoint := <-endpoints:
+		ref, err := url.Parse(endpoint)
+		if err != nil {
+			t.close()
+			return nil, fmt.Errorf("MCP服务器返回了无效的消息地址: %w", err)
+		}
+		t.endpoint = base.ResolveReference(ref).String()
+		return t, nil
+	case <-ctx.Done():
+		t.close()
+		return nil, fmt.Errorf("等待MCP服务器的消息地址超时: %w", ctx.Err())
+	}
+}
+
+// post 向消息地址发送一条消息
+func (t *sseTransport) post(ctx context.Context, msg *message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("编码MCP消息失败: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("创建MCP请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("发送MCP请求失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("MCP服务器返回HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// call 发送请求，等待事件流中的响应
+func (t *sseTransport) call(ctx context.Context, req *message) (*message, error) {
+	ch, err := t.responses.register(req.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.post(ctx, req); err != nil {
+		t.responses.forget(req.ID)
+		return nil, err
+	}
+	return t.responses.wait(ctx, req.ID, ch)
+}
+
+// notify 发送通知
+func (t *sseTransport) notify(ctx context.Context, msg *message) error {
+	return t.post(ctx, msg)
+}
+
+// close 断开事件流
+func (t *sseTransport) close() error {
+	t.cancel()
+	return nil
+}
+
+// readEvents 解析SSE事件流，handle返回false时停止读取
+func readEvents(r io.Reader, handle func(event, data string) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	event := ""
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			// 空行表示一个事件结束
+			if len(data) > 0 && !handle(event, strings.Join(data, "\n")) {
+				return nil
+			}
+			event, data = "", nil
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		handle(event, strings.Join(data, "\n"))
+	}
+	return nil
+}
+
+// decodeEvent 解析事件中的JSON-RPC消息
+func decodeEvent(data string) (*message, bool) {
+	var msg message
+	if err := json.Unmarshal([]byte(data), &msg); err != nil {
+		logger.Debug("忽略无法解析的MCP事件: %v", err)
+		return nil, false
+	}
+	return &msg, true
+}
+
+// findResponse 从JSON响应体中找到对应请求的响应，响应体可以是单条消息或批量消息
+func findResponse(body []byte, id json.RawMessage) (*message, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var batch []message
+		if err := json.Unmarshal(body, &batch); err != nil {
+			return nil, fmt.Errorf("解析MCP响应失败: %w", err)
+		}
+		for i := range batch {
+			if batch[i].isResponse() && string(batch[i].ID) == string(id) {
+				return &batch[i], nil
+			}
+		}
+		return nil, fmt.Errorf("MCP响应中没有请求 %s 的结果", string(id))
+	}
+
+	var msg message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, fmt.Errorf("解析MCP响应失败: %w", err)
+	}
+	return &msg, nil
+}
@@ -0,0 +1,123 @@
+// Package mcp 实现Model Context Protocol的客户端和服务器：
+// 客户端把外部MCP服务器提供的工具挂载为GoManus的工具，服务器把GoManus的工具提供给编辑器等MCP客户端
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ProtocolVersion 是客户端请求使用的协议版本
+const ProtocolVersion = "2025-03-26"
+
+// JSON-RPC 2.0 的标准错误码
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+)
+
+// message 是一条JSON-RPC消息，可以是请求、通知或响应
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+// isRequest 检查消息是否是需要回复的请求
+func (m *message) isRequest() bool {
+	return m.Method != "" && len(m.ID) > 0
+}
+
+// isResponse 检查消息是否是响应
+func (m *message) isResponse() bool {
+	return m.Method == "" && len(m.ID) > 0
+}
+
+// RPCError 是JSON-RPC响应中的错误
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// Error 实现error接口
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("MCP错误 %d: %s", e.Code, e.Message)
+}
+
+// Implementation 描述客户端或服务器的名称和版本
+type Implementation struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// initializeParams 是initialize请求的参数
+type initializeParams struct {
+	ProtocolVersion string                 `json:"protocolVersion"`
+	Capabilities    map[string]interface{} `json:"capabilities"`
+	ClientInfo      Implementation         `json:"clientInfo"`
+}
+
+// initializeResult 是initialize请求的结果
+type initializeResult struct {
+	ProtocolVersion string                 `json:"protocolVersion"`
+	Capabilities    map[string]interface{} `json:"capabilities"`
+	ServerInfo      Implementation         `json:"serverInfo"`
+	Instructions    string                 `json:"instructions,omitempty"`
+}
+
+// ToolInfo 描述MCP服务器提供的一个工具
+type ToolInfo struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+	Annotations *ToolAnnotations       `json:"annotations,omitempty"`
+}
+
+// ToolAnnotations 是工具行为的提示信息
+type ToolAnnotations struct {
+	Title           string `json:"title,omitempty"`
+	ReadOnlyHint    *bool  `json:"readOnlyHint,omitempty"`
+	DestructiveHint *bool  `json:"destructiveHint,omitempty"`
+}
+
+// listToolsResult 是tools/list请求的结果
+type listToolsResult struct {
+	Tools      []ToolInfo `json:"tools"`
+	NextCursor string     `json:"nextCursor,omitempty"`
+}
+
+// callToolParams 是tools/call请求的参数
+type callToolParams struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+}
+
+// CallToolResult 是tools/call请求的结果
+type CallToolResult struct {
+	Content []Content `json:"content"`
+	IsError bool      `json:"isError,omitempty"`
+}
+
+// Content 是工具结果中的一段内容
+type Content struct {
+	Type     string    `json:"type"` // text、image、audio、resource
+	Text     string    `json:"text,omitempty"`
+	Data     string    `json:"data,omitempty"`
+	MimeType string    `json:"mimeType,omitempty"`
+	Resource *Resource `json:"resource,omitempty"`
+}
+
+// Resource 是嵌入在工具结果中的资源
+type Resource struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Blob     string `json:"blob,omitempty"`
+}
@@ -0,0 +1,280 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"gomanus/internal/policy"
+	"gomanus/internal/tool"
+	"gomanus/pkg/logger"
+)
+
+// ServerMode 是通过MCP服务器调用工具时的交互模式，权限策略可以用 modes = ["mcp"] 单独约束外部调用
+const ServerMode = "mcp"
+
+// ServerAgent 是通过MCP服务器调用工具时权限策略中的默认代理名称
+const ServerAgent = "mcp"
+
+// supportedVersions 是服务器支持的协议版本，客户端请求其他版本时使用ProtocolVersion
+var supportedVersions = map[string]bool{
+	"2024-11-05": true,
+	"2025-03-26": true,
+	"2025-06-18": true,
+}
+
+// Server 通过MCP协议对外提供工具集合中的工具，工具调用同样经过参数校验和权限策略检查
+type Server struct {
+	Info         Implementation
+	Instructions string // 在initialize结果中返回给客户端的使用说明
+	Agent        string // 权限策略中的代理名称，由服务器决定，不使用客户端自己声明的名称
+
+	tools   *tool.ToolCollection
+	writeMu sync.Mutex
+	out     io.Writer
+
+	mu       sync.Mutex
+	inflight map[string]context.CancelFunc // 正在执行的请求，可以被notifications/cancelled取消
+}
+
+// NewServer 创建提供指定工具的MCP服务器
+func NewServer(tools *tool.ToolCollection) *Server {
+	return &Server{
+		Info:     clientInfo,
+		Agent:    ServerAgent,
+		tools:    tools,
+		inflight: make(map[string]context.CancelFunc),
+	}
+}
+
+// ServeStdio 从in读取以换行分隔的JSON-RPC消息，把响应写入out，直到in结束或ctx被取消
+func (s *Server) ServeStdio(ctx context.Context, in io.Reader, out io.Writer) error {
+	s.out = out
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			line := append([]byte(nil), scanner.Bytes()...)
+			select {
+			case lines <- line:
+			case <-ctx.Done():
+				return
+			}
+		}
+		readErr <- scanner.Err()
+	}()
+
+	var handlers sync.WaitGroup
+	defer handlers.Wait()
+	for {
+		select {
+		case line := <-lines:
+			if len(line) == 0 {
+				continue
+			}
+			var msg message
+			if err := json.Unmarshal(line, &msg); err != nil {
+				s.write(&message{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &RPCError{Code: codeParseError, Message: "无法解析的消息: " + err.Error()}})
+				continue
+			}
+			if !msg.isRequest() {
+				s.handleNotification(&msg)
+				continue
+			}
+			// 工具调用可能很慢，每个请求单独执行，不阻塞ping和取消通知
+			requestCtx, requestCancel := context.WithCancel(ctx)
+			s.track(msg.ID, requestCancel)
+			handlers.Add(1)
+			go func(msg message) {
+				defer handlers.Done()
+				defer s.untrack(msg.ID)
+				s.write(s.handleRequest(requestCtx, &msg))
+			}(msg)
+		case err := <-readErr:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// track 记录正在执行的请求
+func (s *Server) track(id json.RawMessage, cancel context.CancelFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inflight[string(id)] = cancel
+}
+
+// untrack 移除执行完成的请求
+func (s *Server) untrack(id json.RawMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cancel, exists := s.inflight[string(id)]; exists {
+		cancel()
+		delete(s.inflight, string(id))
+	}
+}
+
+// handleNotification 处理客户端的通知
+func (s *Server) handleNotification(msg *message) {
+	switch msg.Method {
+	case "notifications/cancelled":
+		var params struct {
+			RequestID json.RawMessage `json:"requestId"`
+			Reason    string          `json:"reason"`
+		}
+		if err := json.Unmarshal(msg.Params, &params); err == nil {
+			s.mu.Lock()
+			cancel := s.inflight[string(params.RequestID)]
+			s.mu.Unlock()
+			if cancel != nil {
+				logger.Info("MCP客户端取消了请求 %s: %s", string(params.RequestID), params.Reason)
+				cancel()
+			}
+		}
+	default:
+		logger.Debug("收到MCP通知: %s", msg.Method)
+	}
+}
+
+// handleRequest 处理客户端的请求，返回响应
+func (s *Server) handleRequest(ctx context.Context, req *message) *message {
+	result, err := s.dispatch(ctx, req)
+	if err != nil {
+		var rpcErr *RPCError
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &RPCError{Code: codeInternalError, Message: err.Error()}
+		}
+		return &message{JSONRPC: "2.0", ID: req.ID, Error: rpcErr}
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return &message{JSONRPC: "2.0", ID: req.ID, Error: &RPCError{Code: codeInternalError, Message: "编码结果失败: " + err.Error()}}
+	}
+	return &message{JSONRPC: "2.0", ID: req.ID, Result: data}
+}
+
+// dispatch 按方法名称处理请求
+func (s *Server) dispatch(ctx context.Context, req *message) (interface{}, error) {
+	switch req.Method {
+	case "initialize":
+		var params initializeParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &RPCError{Code: codeInvalidParams, Message: "无效的initialize参数: " + err.Error()}
+		}
+		version := params.ProtocolVersion
+		if !supportedVersions[version] {
+			version = ProtocolVersion
+		}
+		logger.Info("MCP客户端 %s %s 已连接 (协议版本 %s)", params.ClientInfo.Name, params.ClientInfo.Version, version)
+		return initializeResult{
+			ProtocolVersion: version,
+			Capabilities:    map[string]interface{}{"tools": map[string]interface{}{"listChanged": false}},
+			ServerInfo:      s.Info,
+			Instructions:    s.Instructions,
+		}, nil
+	case "ping":
+		return map[string]interface{}{}, nil
+	case "tools/list":
+		return listToolsResult{Tools: s.listTools()}, nil
+	case "tools/call":
+		var params callToolParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &RPCError{Code: codeInvalidParams, Message: "无效的tools/call参数: " + err.Error()}
+		}
+		return s.callTool(ctx, params)
+	default:
+		return nil, &RPCError{Code: codeMethodNotFound, Message: "不支持的方法: " + req.Method}
+	}
+}
+
+// listTools 根据工具集合的工具定义生成MCP工具列表
+func (s *Server) listTools() []ToolInfo {
+	definitions := s.tools.GetToolDefinitions()
+	tools := make([]ToolInfo, 0, len(definitions))
+	for _, definition := range definitions {
+		function, _ := definition["function"].(map[string]interface{})
+		name, _ := function["name"].(string)
+		if name == "" {
+			continue
+		}
+		description, _ := function["description"].(string)
+		schema, _ := function["parameters"].(map[string]interface{})
+		if schema == nil {
+			schema = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+		}
+
+		info := ToolInfo{Name: name, Description: description, InputSchema: schema}
+		// 只有明确声明为只读的工具带有readOnlyHint，可以并发执行的工具不一定只读
+		if t, err := s.tools.GetTool(name); err == nil && tool.IsReadOnly(t) {
+			readOnly := true
+			info.Annotations = &ToolAnnotations{ReadOnlyHint: &readOnly}
+		}
+		tools = append(tools, info)
+	}
+	return tools
+}
+
+// callTool 执行工具，工具执行失败时在结果中返回错误，便于客户端的模型修正后重试
+func (s *Server) callTool(ctx context.Context, params callToolParams) (*CallToolResult, error) {
+	if _, err := s.tools.GetTool(params.Name); err != nil {
+		return nil, &RPCError{Code: codeInvalidParams, Message: err.Error()}
+	}
+
+	ctx = policy.WithScope(ctx, policy.Scope{Mode: ServerMode, Agent: s.Agent})
+
+	result, err := s.tools.ExecuteTool(ctx, params.Name, params.Arguments)
+	if err != nil {
+		text := err.Error()
+		var denied *policy.DeniedError
+		var invalid *tool.ValidationError
+		if errors.As(err, &denied) {
+			text = denied.ToolMessage()
+		} else if errors.As(err, &invalid) {
+			text = invalid.ToolMessage()
+		}
+		return &CallToolResult{Content: []Content{{Type: "text", Text: text}}, IsError: true}, nil
+	}
+	return &CallToolResult{Content: []Content{{Type: "text", Text: resultText(result)}}}, nil
+}
+
+// resultText 把工具结果转换为文本，结构化的结果编码为JSON
+func resultText(result interface{}) string {
+	switch value := result.(type) {
+	case string:
+		return value
+	case fmt.Stringer:
+		return value.String()
+	case nil:
+		return ""
+	}
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("%v", result)
+	}
+	return string(data)
+}
+
+// write 写入一条消息
+func (s *Server) write(msg *message) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		logger.Error("编码MCP响应失败: %v", err)
+		return
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if _, err := s.out.Write(append(data, '\n')); err != nil {
+		logger.Error("写入MCP响应失败: %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+package mcp
+
+import (
+	"context"
+	"testing"
+
+	"gomanus/internal/tool"
+)
+
+// parallelTool 是可以并发执行但会修改状态的工具
+type parallelTool struct {
+	*tool.BaseTool
+}
+
+func (p *parallelTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	return nil, nil
+}
+
+func (p *parallelTool) ConcurrencySafe() bool {
+	return true
+}
+
+func TestServerReadOnlyHint(t *testing.T) {
+	tools := tool.NewToolCollection()
+	tools.AddTool(tool.NewGoogleSearch())
+	tools.AddTool(&parallelTool{tool.NewBaseTool("counter", "并发递增计数器")})
+	tools.AddTool(tool.NewFileOperator())
+
+	want := map[string]bool{"google_search": true}
+	for _, info := range NewServer(tools).listTools() {
+		hinted := info.Annotations != nil && info.Annotations.ReadOnlyHint != nil && *info.Annotations.ReadOnlyHint
+		if hinted != want[info.Name] {
+			t.Errorf("工具 %s 的readOnlyHint为 %v，期望 %v", info.Name, hinted, want[info.Name])
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gomanus/internal/config"
+	"gomanus/internal/tool"
+	"gomanus/pkg/logger"
+)
+
+// maxToolNameLength 是模型接口允许的最大函数名称长度
+const maxToolNameLength = 64
+
+// invalidNameChars 匹配函数名称中不允许的字符
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// RemoteTool 把MCP服务器的一个工具包装为GoManus的工具
+type RemoteTool struct {
+	*tool.BaseTool
+	client *Client
+	info   ToolInfo
+}
+
+// NewRemoteTool 创建MCP工具，name是注册到工具集合中的名称
+func NewRemoteTool(client *Client, name string, info ToolInfo) *RemoteTool {
+	description := info.Description
+	if description == "" {
+		description = info.Name
+	}
+	return &RemoteTool{
+		BaseTool: tool.NewBaseTool(name, fmt.Sprintf("[MCP %s] %s", client.Name, description)),
+		client:   client,
+		info:     info,
+	}
+}
+
+// Parameters 返回服务器提供的参数定义
+func (t *RemoteTool) Parameters() map[string]interface{} {
+	if t.info.InputSchema == nil {
+		return map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+	}
+	return t.info.InputSchema
+}
+
+// ConcurrencySafe 只有服务器声明为只读的工具可以并发执行
+func (t *RemoteTool) ConcurrencySafe() bool {
+	return t.ReadOnly()
+}
+
+// ReadOnly 返回服务器在readOnlyHint中声明的只读性
+func (t *RemoteTool) ReadOnly() bool {
+	return t.info.Annotations != nil && t.info.Annotations.ReadOnlyHint != nil && *t.info.Annotations.ReadOnlyHint
+}
+
+// Execute 调用服务器的工具，把返回的内容转换为文本
+func (t *RemoteTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	result, err := t.client.CallTool(ctx, t.info.Name, params)
+	if err != nil {
+		return nil, fmt.Errorf("调用MCP工具 %s 失败: %w", t.info.Name, err)
+	}
+
+	text := contentText(result.Content)
+	if result.IsError {
+		return nil, fmt.Errorf("MCP工具 %s 返回错误: %s", t.info.Name, text)
+	}
+	return text, nil
+}
+
+// contentText 把工具结果中的内容拼接为文本，图片等二进制内容只保留类型说明
+func contentText(contents []Content) string {
+	var parts []string
+	for _, content := range contents {
+		switch content.Type {
+		case "text":
+			parts = append(parts, content.Text)
+		case "image", "audio":
+			parts = append(parts, fmt.Sprintf("[%s: %s]", content.Type, content.MimeType))
+		case "resource":
+			if content.Resource == nil {
+				continue
+			}
+			if content.Resource.Text != "" {
+				parts = append(parts, content.Resource.Text)
+			} else {
+				parts = append(parts, fmt.Sprintf("[资源: %s]", content.Resource.URI))
+			}
+		default:
+			parts = append(parts, fmt.Sprintf("[%s]", content.Type))
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// Mount 连接配置中的MCP服务器，把服务器的工具以带前缀的名称注册到工具集合中
+// 返回的客户端在不再使用时需要关闭
+func Mount(ctx context.Context, tools *tool.ToolCollection, name string, cfg config.MCPServerConfig) (*Client, []string, error) {
+	client, err := Connect(ctx, name, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	infos, err := client.ListTools(ctx)
+	if err != nil {
+		client.Close()
+		return nil, nil, err
+	}
+
+	allowed := make(map[string]bool, len(cfg.Tools))
+	for _, toolName := range cfg.Tools {
+		allowed[toolName] = true
+	}
+	prefix := cfg.Prefix
+	if prefix == "" {
+		prefix = "mcp_" + name
+	}
+
+	var mounted []string
+	for _, info := range infos {
+		if len(allowed) > 0 && !allowed[info.Name] {
+			continue
+		}
+		remote := NewRemoteTool(client, ToolName(prefix, info.Name), info)
+		if err := tools.AddTool(remote); err != nil {
+			logger.Warn("跳过MCP服务器 %s 的工具 %s: %v", name, info.Name, err)
+			continue
+		}
+		mounted = append(mounted, remote.Name())
+	}
+	return client, mounted, nil
+}
+
+// ToolName 生成带前缀的工具名称，替换模型接口不允许的字符并限制长度
+func ToolName(prefix, name string) string {
+	full := invalidNameChars.ReplaceAllString(prefix+"_"+name, "_")
+	if len(full) > maxToolNameLength {
+		full = full[:maxToolNameLength]
+	}
+	return full
+}
@@ -0,0 +1,268 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"gomanus/pkg/logger"
+)
+
+// transport 负责与MCP服务器交换JSON-RPC消息
+type transport interface {
+	// call 发送请求并等待对应的响应
+	call(ctx context.Context, req *message) (*message, error)
+	// notify 发送不需要响应的通知
+	notify(ctx context.Context, msg *message) error
+	// close 断开与服务器的连接
+	close() error
+}
+
+// dispatcher 把异步收到的响应交给等待中的请求，供stdio和SSE传输使用
+type dispatcher struct {
+	mu      sync.Mutex
+	pending map[string]chan *message
+	err     error // 连接断开的原因，断开后新的请求直接失败
+}
+
+// newDispatcher 创建响应分发器
+func newDispatcher() *dispatcher {
+	return &dispatcher{pending: make(map[string]chan *message)}
+}
+
+// register 登记等待响应的请求
+func (d *dispatcher) register(id json.RawMessage) (chan *message, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return nil, d.err
+	}
+	ch := make(chan *message, 1)
+	d.pending[string(id)] = ch
+	return ch, nil
+}
+
+// forget 取消等待
+func (d *dispatcher) forget(id json.RawMessage) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.pending, string(id))
+}
+
+// deliver 把响应交给等待中的请求，没有对应请求的响应被忽略
+func (d *dispatcher) deliver(msg *message) {
+	d.mu.Lock()
+	ch, exists := d.pending[string(msg.ID)]
+	delete(d.pending, string(msg.ID))
+	d.mu.Unlock()
+	if exists {
+		ch <- msg
+	} else {
+		logger.Debug("忽略未知请求的MCP响应: %s", string(msg.ID))
+	}
+}
+
+// fail 连接断开时让所有等待中的请求失败
+func (d *dispatcher) fail(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return
+	}
+	d.err = err
+	for id, ch := range d.pending {
+		close(ch)
+		delete(d.pending, id)
+	}
+}
+
+// wait 等待响应，连接断开时返回断开的原因
+func (d *dispatcher) wait(ctx context.Context, id json.RawMessage, ch chan *message) (*message, error) {
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			return nil, d.err
+		}
+		return resp, nil
+	case <-ctx.Done():
+		d.forget(id)
+		return nil, ctx.Err()
+	}
+}
+
+// stdioTransport 启动MCP服务器子进程，通过标准输入输出交换以换行分隔的JSON消息
+type stdioTransport struct {
+	name      string
+	kill      func() error // 强制结束服务器进程
+	stdin     io.WriteCloser
+	writeMu   sync.Mutex
+	responses *dispatcher
+	done      chan struct{}
+}
+
+// startStdio 启动服务器进程并开始读取输出
+func startStdio(name string, command string, args []string, env []string, dir string) (*stdioTransport, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Dir = dir
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("创建标准输入管道失败: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("创建标准输出管道失败: %w", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("创建标准错误管道失败: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("启动MCP服务器 %s 失败: %w", command, err)
+	}
+
+	return newStdioTransport(name, stdin, stdout, stderr, cmd.Wait, cmd.Process.Kill), nil
+}
+
+// newStdioTransport 通过服务器的标准输入输出管道交换消息并开始读取输出，
+// 输出读完后调用wait等待服务器退出
+func newStdioTransport(name string, stdin io.WriteCloser, stdout, stderr io.Reader, wait, kill func() error) *stdioTransport {
+	t := &stdioTransport{
+		name:      name,
+		kill:      kill,
+		stdin:     stdin,
+		responses: newDispatcher(),
+		done:      make(chan struct{}),
+	}
+	// 读完全部输出后才能调用Wait，否则Wait会关闭还没读完的管道
+	var readers sync.WaitGroup
+	readers.Add(2)
+	go func() {
+		defer readers.Done()
+		t.readLoop(stdout)
+	}()
+	go func() {
+		defer readers.Done()
+		t.logStderr(stderr)
+	}()
+	go func() {
+		readers.Wait()
+		err := wait()
+		if err == nil {
+			err = fmt.Errorf("MCP服务器 %s 已退出", name)
+		} else {
+			err = fmt.Errorf("MCP服务器 %s 已退出: %w", name, err)
+		}
+		t.responses.fail(err)
+		close(t.done)
+	}()
+	return t
+}
+
+// readLoop 读取服务器的输出，分发响应并回复服务器的请求
+func (t *stdioTransport) readLoop(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var msg message
+		if err := json.Unmarshal(line, &msg); err != nil {
+			logger.Warn("MCP服务器 %s 输出了无法解析的消息: %v", t.name, err)
+			continue
+		}
+		t.handle(&msg)
+	}
+	if err := scanner.Err(); err != nil {
+		t.responses.fail(fmt.Errorf("读取MCP服务器 %s 的输出失败: %w", t.name, err))
+	}
+}
+
+// handle 处理服务器发来的消息
+func (t *stdioTransport) handle(msg *message) {
+	switch {
+	case msg.isResponse():
+		t.responses.deliver(msg)
+	case msg.isRequest():
+		if err := t.write(replyToServer(msg)); err != nil {
+			logger.Warn("回复MCP服务器 %s 的请求失败: %v", t.name, err)
+		}
+	default:
+		logger.Debug("MCP服务器 %s 的通知: %s", t.name, msg.Method)
+	}
+}
+
+// logStderr 把服务器的标准错误输出写入日志
+func (t *stdioTransport) logStderr(stderr io.Reader) {
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		logger.Debug("[MCP %s] %s", t.name, scanner.Text())
+	}
+}
+
+// write 写入一条消息
+func (t *stdioTransport) write(msg *message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("编码MCP消息失败: %w", err)
+	}
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	_, err = t.stdin.Write(append(data, '\n'))
+	return err
+}
+
+// call 发送请求并等待响应
+func (t *stdioTransport) call(ctx context.Context, req *message) (*message, error) {
+	ch, err := t.responses.register(req.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.write(req); err != nil {
+		t.responses.forget(req.ID)
+		return nil, fmt.Errorf("发送MCP请求失败: %w", err)
+	}
+	return t.responses.wait(ctx, req.ID, ch)
+}
+
+// notify 发送通知
+func (t *stdioTransport) notify(ctx context.Context, msg *message) error {
+	return t.write(msg)
+}
+
+// close 关闭标准输入让服务器退出，超时后强制结束进程
+func (t *stdioTransport) close() error {
+	t.stdin.Close()
+	select {
+	case <-t.done:
+	case <-time.After(3 * time.Second):
+		if err := t.kill(); err != nil {
+			return fmt.Errorf("结束MCP服务器 %s 失败: %w", t.name, err)
+		}
+		<-t.done
+	}
+	return nil
+}
+
+// replyToServer 回复服务器发来的请求，客户端只支持ping
+func replyToServer(req *message) *message {
+	if req.Method == "ping" {
+		return &message{JSONRPC: "2.0", ID: req.ID, Result: json.RawMessage(`{}`)}
+	}
+	return &message{
+		JSONRPC: "2.0",
+		ID:      req.ID,
+		Error:   &RPCError{Code: codeMethodNotFound, Message: "客户端不支持该方法: " + req.Method},
+	}
+}
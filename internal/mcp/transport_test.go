@@ -0,0 +1,101 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDispatcherFailsPendingRequests(t *testing.T) {
+	d := newDispatcher()
+	first, err := d.register(json.RawMessage("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := d.register(json.RawMessage("2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 未知请求的响应被忽略，不影响等待中的请求
+	d.deliver(&message{JSONRPC: "2.0", ID: json.RawMessage("3")})
+	d.deliver(&message{JSONRPC: "2.0", ID: json.RawMessage("1"), Result: json.RawMessage(`{}`)})
+	if resp, err := d.wait(context.Background(), json.RawMessage("1"), first); err != nil || string(resp.Result) != "{}" {
+		t.Errorf("请求 1 返回 %v, %v", resp, err)
+	}
+
+	lost := errors.New("连接已断开")
+	d.fail(lost)
+	d.fail(errors.New("之后的原因被忽略"))
+	if _, err := d.wait(context.Background(), json.RawMessage("2"), second); err != lost {
+		t.Errorf("等待中的请求返回 %v，期望 %v", err, lost)
+	}
+	if _, err := d.register(json.RawMessage("4")); err != lost {
+		t.Errorf("断开后登记请求返回 %v，期望 %v", err, lost)
+	}
+}
+
+func TestDispatcherWaitHonorsContext(t *testing.T) {
+	d := newDispatcher()
+	ch, err := d.register(json.RawMessage("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := d.wait(ctx, json.RawMessage("1"), ch); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("超时返回 %v", err)
+	}
+	if len(d.pending) != 0 {
+		t.Errorf("超时的请求没有被移除: %v", d.pending)
+	}
+}
+
+func TestStdioTransportFailsWhenServerExits(t *testing.T) {
+	stub := &stubServer{t: t}
+	client, err := pipeClient(t, serveStub(stub))
+	if err != nil {
+		t.Fatalf("初始化失败: %v", err)
+	}
+
+	// 服务器在处理请求时退出，等待中的请求和之后的请求都失败
+	if _, err := client.CallTool(context.Background(), "crash", nil); err == nil || !strings.Contains(err.Error(), "MCP服务器 stub 已退出") {
+		t.Errorf("服务器退出时返回 %v", err)
+	}
+	if _, err := client.ListTools(context.Background()); err == nil || !strings.Contains(err.Error(), "已退出") {
+		t.Errorf("服务器退出后的请求返回 %v", err)
+	}
+}
+
+func TestReadEvents(t *testing.T) {
+	stream := ": 注释\nevent: endpoint\ndata: /messages\n\ndata: {\"a\":\ndata: 1}\n\nid: 7\ndata: 最后一个事件没有空行"
+	type event struct{ name, data string }
+	var got []event
+	err := readEvents(strings.NewReader(stream), func(name, data string) bool {
+		got = append(got, event{name, data})
+		return true
+	})
+	want := []event{{"endpoint", "/messages"}, {"", "{\"a\":\n1}"}, {"", "最后一个事件没有空行"}}
+	if err != nil || len(got) != len(want) {
+		t.Fatalf("解析结果为 %v, %v", got, err)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("事件 %d 为 %+v，期望 %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestFindResponseInBatch(t *testing.T) {
+	body := []byte(` [{"jsonrpc":"2.0","method":"notifications/progress"},{"jsonrpc":"2.0","id":2,"result":{"ok":true}}]`)
+	resp, err := findResponse(body, json.RawMessage("2"))
+	if err != nil || string(resp.Result) != `{"ok":true}` {
+		t.Errorf("批量响应返回 %v, %v", resp, err)
+	}
+	if _, err := findResponse(body, json.RawMessage("3")); err == nil {
+		t.Error("批量响应中没有对应的请求时应该返回错误")
+	}
+}
@@ -0,0 +1,127 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// maxAuditValue 是审计日志中单个参数值保留的最大字符数
+const maxAuditValue = 256
+
+// AuditRecord 表示一条策略审计日志，Params只包含策略检查的路径、URL和操作类型参数
+type AuditRecord struct {
+	Time   time.Time              `json:"time"`
+	Tool   string                 `json:"tool"`
+	Mode   string                 `json:"mode,omitempty"`
+	Agent  string                 `json:"agent,omitempty"`
+	Effect Effect                 `json:"effect"`
+	Rule   string                 `json:"rule"`
+	Reason string                 `json:"reason"`
+	Params map[string]interface{} `json:"params,omitempty"`
+}
+
+// AuditLogger 以JSON Lines格式追加写入策略审计日志
+type AuditLogger struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewAuditLogger 创建审计日志记录器，并确保日志目录存在
+func NewAuditLogger(path string) (*AuditLogger, error) {
+	dir := filepath.Dir(path)
+	if dir != "" && dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("创建审计日志目录失败: %w", err)
+		}
+	}
+	return &AuditLogger{path: path}, nil
+}
+
+// Write 写入一条审计记录
+func (l *AuditLogger) Write(toolName string, params map[string]interface{}, scope Scope, decision Decision) error {
+	record := AuditRecord{
+		Time:   time.Now(),
+		Tool:   toolName,
+		Mode:   scope.Mode,
+		Agent:  scope.Agent,
+		Effect: decision.Effect,
+		Rule:   decision.Rule,
+		Reason: decision.Reason,
+		Params: auditParams(params),
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("序列化审计记录失败: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("打开审计日志失败: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("写入审计日志失败: %w", err)
+	}
+	return nil
+}
+
+// auditParams 返回审计日志中记录的参数：操作类型以及策略检查的路径和URL。
+// 文件内容、命令、脚本等其他参数可能很大或包含密钥，不写入日志；URL中的用户信息和查询参数被省略
+func auditParams(params map[string]interface{}) map[string]interface{} {
+	recorded := make(map[string]interface{})
+	for _, group := range [][]string{{"action", "operation"}, pathArguments, urlArguments} {
+		for _, key := range group {
+			if s, ok := params[key].(string); ok {
+				recorded[key] = s
+			}
+		}
+	}
+	for _, key := range urlArguments {
+		if s, ok := recorded[key].(string); ok {
+			recorded[key] = redactURL(s)
+		}
+	}
+	for key, value := range recorded {
+		recorded[key] = truncateValue(value.(string))
+	}
+	if len(recorded) == 0 {
+		return nil
+	}
+	return recorded
+}
+
+// redactURL 去掉URL中的用户信息、查询参数和片段，它们可能包含令牌或密码
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "(无法解析的URL)"
+	}
+	omitted := u.User != nil || u.RawQuery != "" || u.Fragment != ""
+	u.User = nil
+	u.RawQuery = ""
+	u.ForceQuery = false
+	u.Fragment = ""
+	if omitted {
+		return u.String() + "?(已省略)"
+	}
+	return u.String()
+}
+
+// truncateValue 把参数值截断为最多maxAuditValue个字符
+func truncateValue(s string) string {
+	if utf8.RuneCountInString(s) <= maxAuditValue {
+		return s
+	}
+	return string([]rune(s)[:maxAuditValue]) + "..."
+}
@@ -0,0 +1,448 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gomanus/internal/config"
+	"gomanus/pkg/logger"
+)
+
+// Effect 表示策略决策的结果
+type Effect string
+
+const (
+	EffectAllow Effect = "allow"
+	EffectDeny  Effect = "deny"
+)
+
+// Scope 表示一次工具调用所处的范围
+type Scope struct {
+	Mode  string // 交互模式：chat、task、plan
+	Agent string // 发起调用的代理名称
+}
+
+type scopeKey struct{}
+
+// WithScope 将调用范围写入上下文
+func WithScope(ctx context.Context, scope Scope) context.Context {
+	return context.WithValue(ctx, scopeKey{}, scope)
+}
+
+// WithMode 在上下文中设置交互模式，保留已有的代理名称
+func WithMode(ctx context.Context, mode string) context.Context {
+	scope := ScopeFromContext(ctx)
+	scope.Mode = mode
+	return WithScope(ctx, scope)
+}
+
+// WithAgent 在上下文中设置代理名称，保留已有的交互模式
+func WithAgent(ctx context.Context, agent string) context.Context {
+	scope := ScopeFromContext(ctx)
+	scope.Agent = agent
+	return WithScope(ctx, scope)
+}
+
+// ScopeFromContext 从上下文中读取调用范围
+func ScopeFromContext(ctx context.Context) Scope {
+	if scope, ok := ctx.Value(scopeKey{}).(Scope); ok {
+		return scope
+	}
+	return Scope{}
+}
+
+// Decision 表示一次策略评估的结果
+type Decision struct {
+	Effect Effect
+	Rule   string
+	Reason string
+}
+
+// DeniedError 表示工具调用被策略拒绝
+type DeniedError struct {
+	Tool   string
+	Rule   string
+	Reason string
+	Scope  Scope
+}
+
+// Error 实现error接口
+func (e *DeniedError) Error() string {
+	return fmt.Sprintf("工具 %s 的调用被策略 %s 拒绝: %s", e.Tool, e.Rule, e.Reason)
+}
+
+// ToolMessage 返回提供给模型的结构化错误内容
+func (e *DeniedError) ToolMessage() string {
+	payload := map[string]interface{}{
+		"error": map[string]interface{}{
+			"type":   "permission_denied",
+			"tool":   e.Tool,
+			"rule":   e.Rule,
+			"reason": e.Reason,
+			"mode":   e.Scope.Mode,
+			"agent":  e.Scope.Agent,
+		},
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return e.Error()
+	}
+	return string(data)
+}
+
+// 没有指定参数名时，按工具参数的常见命名识别路径和URL
+var (
+	pathArguments = []string{"file_path", "path", "working_directory", "directory", "dir"}
+	urlArguments  = []string{"url"}
+)
+
+// rule 是编译后的策略规则
+type rule struct {
+	name           string
+	tool           string
+	effect         Effect
+	modes          []string
+	agents         []string
+	argument       string
+	pattern        *regexp.Regexp
+	outsideDirs    []string
+	outsideDomains []string
+	reason         string
+}
+
+// Engine 根据配置的规则对工具调用做出允许或拒绝的决策
+type Engine struct {
+	defaultEffect Effect
+	rules         []*rule
+	audit         *AuditLogger
+}
+
+// NewEngine 根据配置创建策略引擎
+func NewEngine(cfg *config.PolicyConfig) (*Engine, error) {
+	engine := &Engine{defaultEffect: EffectAllow}
+	if cfg == nil || !cfg.Enabled {
+		return engine, nil
+	}
+
+	if cfg.DefaultEffect != "" {
+		effect, err := parseEffect(cfg.DefaultEffect)
+		if err != nil {
+			return nil, fmt.Errorf("无效的默认策略: %w", err)
+		}
+		engine.defaultEffect = effect
+	}
+
+	for i, rc := range cfg.Rules {
+		r, err := compileRule(i, rc)
+		if err != nil {
+			return nil, err
+		}
+		engine.rules = append(engine.rules, r)
+	}
+
+	if cfg.AuditLog != "" {
+		audit, err := NewAuditLogger(cfg.AuditLog)
+		if err != nil {
+			return nil, err
+		}
+		engine.audit = audit
+	}
+
+	logger.Info("工具权限策略已加载: %d 条规则, 默认决策: %s", len(engine.rules), engine.defaultEffect)
+	return engine, nil
+}
+
+// compileRule 校验并编译单条规则
+func compileRule(index int, rc config.PolicyRule) (*rule, error) {
+	name := rc.Name
+	if name == "" {
+		name = fmt.Sprintf("rule_%d", index+1)
+	}
+
+	effect, err := parseEffect(rc.Effect)
+	if err != nil {
+		return nil, fmt.Errorf("策略规则 %s 无效: %w", name, err)
+	}
+
+	r := &rule{
+		name:           name,
+		tool:           rc.Tool,
+		effect:         effect,
+		modes:          rc.Modes,
+		agents:         rc.Agents,
+		argument:       rc.Argument,
+		outsideDomains: rc.OutsideDomains,
+		reason:         rc.Reason,
+	}
+
+	if rc.Pattern != "" {
+		r.pattern, err = regexp.Compile(rc.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("策略规则 %s 的正则表达式无效: %w", name, err)
+		}
+	}
+
+	for _, dir := range rc.OutsideDirs {
+		absDir, err := ResolvePath(dir)
+		if err != nil {
+			return nil, fmt.Errorf("策略规则 %s 的目录 %s 无效: %w", name, dir, err)
+		}
+		r.outsideDirs = append(r.outsideDirs, absDir)
+	}
+
+	if r.reason == "" {
+		if effect == EffectDeny {
+			r.reason = "该调用不被当前权限策略允许"
+		} else {
+			r.reason = "该调用被权限策略明确允许"
+		}
+	}
+
+	return r, nil
+}
+
+// parseEffect 解析决策字符串
+func parseEffect(s string) (Effect, error) {
+	switch Effect(strings.ToLower(strings.TrimSpace(s))) {
+	case EffectAllow:
+		return EffectAllow, nil
+	case EffectDeny:
+		return EffectDeny, nil
+	default:
+		return "", fmt.Errorf("决策必须是 'allow' 或 'deny'，实际为 '%s'", s)
+	}
+}
+
+// Evaluate 评估一次工具调用，按配置顺序返回第一条命中规则的决策
+func (e *Engine) Evaluate(toolName string, params map[string]interface{}, scope Scope) Decision {
+	for _, r := range e.rules {
+		if r.matches(toolName, params, scope) {
+			return Decision{Effect: r.effect, Rule: r.name, Reason: r.reason}
+		}
+	}
+
+	reason := "没有规则命中，使用默认决策"
+	return Decision{Effect: e.defaultEffect, Rule: "default", Reason: reason}
+}
+
+// Check 评估工具调用并记录审计日志，被拒绝时返回*DeniedError
+func (e *Engine) Check(ctx context.Context, toolName string, params map[string]interface{}) error {
+	if e == nil {
+		return nil
+	}
+
+	scope := ScopeFromContext(ctx)
+	decision := e.Evaluate(toolName, params, scope)
+	e.record(toolName, params, scope, decision)
+
+	if decision.Effect == EffectDeny {
+		return &DeniedError{
+			Tool:   toolName,
+			Rule:   decision.Rule,
+			Reason: decision.Reason,
+			Scope:  scope,
+		}
+	}
+	return nil
+}
+
+// record 将决策写入程序日志和审计日志
+func (e *Engine) record(toolName string, params map[string]interface{}, scope Scope, decision Decision) {
+	if decision.Effect == EffectDeny {
+		logger.Warn("策略拒绝工具调用: 工具=%s, 模式=%s, 代理=%s, 规则=%s, 原因=%s",
+			toolName, scope.Mode, scope.Agent, decision.Rule, decision.Reason)
+	} else {
+		logger.Debug("策略允许工具调用: 工具=%s, 模式=%s, 代理=%s, 规则=%s",
+			toolName, scope.Mode, scope.Agent, decision.Rule)
+	}
+
+	if e.audit != nil {
+		if err := e.audit.Write(toolName, params, scope, decision); err != nil {
+			logger.Error("写入策略审计日志失败: %v", err)
+		}
+	}
+}
+
+// matches 检查规则是否命中本次调用，所有配置的条件都需要满足
+func (r *rule) matches(toolName string, params map[string]interface{}, scope Scope) bool {
+	if r.tool != "" && r.tool != "*" && r.tool != toolName {
+		return false
+	}
+	if len(r.modes) > 0 && !containsFold(r.modes, scope.Mode) {
+		return false
+	}
+	if len(r.agents) > 0 && !containsFold(r.agents, scope.Agent) {
+		return false
+	}
+
+	if r.pattern != nil {
+		matched := false
+		for _, value := range r.values(params, nil) {
+			if r.pattern.MatchString(value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if len(r.outsideDirs) > 0 {
+		matched := false
+		for _, value := range r.values(params, pathArguments) {
+			if value != "" && !r.insideDirs(value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if len(r.outsideDomains) > 0 {
+		matched := false
+		for _, value := range r.urlValues(params) {
+			host, ok := hostOf(value)
+			if ok && !r.insideDomains(host) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+// values 返回需要检查的参数值；指定了argument时只检查该参数，
+// 否则检查defaults中列出的参数，defaults为nil时检查所有字符串参数
+func (r *rule) values(params map[string]interface{}, defaults []string) []string {
+	var values []string
+	if r.argument != "" {
+		if s, ok := params[r.argument].(string); ok {
+			values = append(values, s)
+		}
+		return values
+	}
+
+	if defaults == nil {
+		for _, v := range params {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+
+	for _, key := range defaults {
+		if s, ok := params[key].(string); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// urlValues 返回需要检查的URL参数值，未指定argument时还会检查其他形如URL的字符串参数
+func (r *rule) urlValues(params map[string]interface{}) []string {
+	values := r.values(params, urlArguments)
+	if r.argument != "" {
+		return values
+	}
+	for key, v := range params {
+		if s, ok := v.(string); ok && key != "url" && (strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")) {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// insideDirs 检查路径是否位于允许的目录之内，路径中的符号链接先被解析，无法解析的路径视为在目录之外
+func (r *rule) insideDirs(path string) bool {
+	absPath, err := ResolvePath(path)
+	if err != nil {
+		return false
+	}
+	for _, dir := range r.outsideDirs {
+		rel, err := filepath.Rel(dir, absPath)
+		if err != nil {
+			continue
+		}
+		if rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolvePath 返回解析了符号链接的绝对路径，路径不存在时解析最近的已存在的上级目录，再拼接其余部分
+func ResolvePath(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(absPath)
+	if err == nil {
+		return resolved, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	// 目标不存在的符号链接在写入时会创建链接指向的文件，无法确定实际位置
+	if _, err := os.Lstat(absPath); err == nil {
+		return "", fmt.Errorf("符号链接 %s 指向不存在的文件", path)
+	}
+
+	parent := filepath.Dir(absPath)
+	if parent == absPath {
+		return absPath, nil
+	}
+	resolvedParent, err := ResolvePath(parent)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(resolvedParent, filepath.Base(absPath)), nil
+}
+
+// insideDomains 检查主机名是否属于允许的域名（包括子域名）
+func (r *rule) insideDomains(host string) bool {
+	host = strings.ToLower(host)
+	for _, domain := range r.outsideDomains {
+		domain = strings.ToLower(strings.TrimPrefix(domain, "."))
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostOf 从URL字符串中提取主机名
+func hostOf(raw string) (string, bool) {
+	if raw == "" {
+		return "", false
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" {
+		return "", false
+	}
+	return u.Hostname(), true
+}
+
+// containsFold 忽略大小写检查切片是否包含指定字符串
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,227 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gomanus/internal/config"
+)
+
+func TestEngineEvaluate(t *testing.T) {
+	allowed := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(allowed, "escape")); err != nil {
+		t.Skipf("无法创建符号链接: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		cfg      *config.PolicyConfig
+		tool     string
+		params   map[string]interface{}
+		scope    Scope
+		want     Effect
+		wantRule string
+	}{
+		{
+			name:     "未启用时允许所有调用",
+			cfg:      &config.PolicyConfig{DefaultEffect: "deny", Rules: []config.PolicyRule{{Effect: "deny"}}},
+			tool:     "terminal_executor",
+			want:     EffectAllow,
+			wantRule: "default",
+		},
+		{
+			name:     "没有规则命中时使用默认决策",
+			cfg:      &config.PolicyConfig{Enabled: true, DefaultEffect: "deny", Rules: []config.PolicyRule{{Tool: "web_search", Effect: "allow"}}},
+			tool:     "terminal_executor",
+			want:     EffectDeny,
+			wantRule: "default",
+		},
+		{
+			name: "按配置顺序使用第一条命中的规则",
+			cfg: &config.PolicyConfig{Enabled: true, Rules: []config.PolicyRule{
+				{Name: "allow_ls", Tool: "terminal_executor", Effect: "allow", Argument: "command", Pattern: `^ls\b`},
+				{Name: "deny_terminal", Tool: "terminal_executor", Effect: "deny"},
+			}},
+			tool:     "terminal_executor",
+			params:   map[string]interface{}{"command": "ls -la"},
+			want:     EffectAllow,
+			wantRule: "allow_ls",
+		},
+		{
+			name: "前面的规则不命中时使用后面的规则",
+			cfg: &config.PolicyConfig{Enabled: true, Rules: []config.PolicyRule{
+				{Name: "allow_ls", Tool: "terminal_executor", Effect: "allow", Argument: "command", Pattern: `^ls\b`},
+				{Name: "deny_terminal", Tool: "terminal_executor", Effect: "deny"},
+			}},
+			tool:     "terminal_executor",
+			params:   map[string]interface{}{"command": "rm -rf /"},
+			want:     EffectDeny,
+			wantRule: "deny_terminal",
+		},
+		{
+			name:     "没有名称的规则按序号命名",
+			cfg:      &config.PolicyConfig{Enabled: true, Rules: []config.PolicyRule{{Tool: "web_search", Effect: "allow"}, {Tool: "*", Effect: "deny"}}},
+			tool:     "file_operator",
+			want:     EffectDeny,
+			wantRule: "rule_2",
+		},
+		{
+			name:     "模式匹配",
+			cfg:      &config.PolicyConfig{Enabled: true, Rules: []config.PolicyRule{{Name: "chat_readonly", Effect: "deny", Modes: []string{"chat"}}}},
+			tool:     "file_operator",
+			scope:    Scope{Mode: "CHAT"},
+			want:     EffectDeny,
+			wantRule: "chat_readonly",
+		},
+		{
+			name:     "模式不匹配",
+			cfg:      &config.PolicyConfig{Enabled: true, Rules: []config.PolicyRule{{Name: "chat_readonly", Effect: "deny", Modes: []string{"chat"}}}},
+			tool:     "file_operator",
+			scope:    Scope{Mode: "task"},
+			want:     EffectAllow,
+			wantRule: "default",
+		},
+		{
+			name:     "代理匹配",
+			cfg:      &config.PolicyConfig{Enabled: true, Rules: []config.PolicyRule{{Name: "manus_no_terminal", Tool: "terminal_executor", Effect: "deny", Agents: []string{"Manus"}}}},
+			tool:     "terminal_executor",
+			scope:    Scope{Agent: "manus"},
+			want:     EffectDeny,
+			wantRule: "manus_no_terminal",
+		},
+		{
+			name:     "代理不匹配",
+			cfg:      &config.PolicyConfig{Enabled: true, Rules: []config.PolicyRule{{Name: "manus_no_terminal", Tool: "terminal_executor", Effect: "deny", Agents: []string{"Manus"}}}},
+			tool:     "terminal_executor",
+			scope:    Scope{Agent: "Planner"},
+			want:     EffectAllow,
+			wantRule: "default",
+		},
+		{
+			name:     "没有指定参数时正则匹配任意字符串参数",
+			cfg:      &config.PolicyConfig{Enabled: true, Rules: []config.PolicyRule{{Name: "no_secrets", Effect: "deny", Pattern: `\.env$`}}},
+			tool:     "file_operator",
+			params:   map[string]interface{}{"operation": "read", "file_path": "app/.env"},
+			want:     EffectDeny,
+			wantRule: "no_secrets",
+		},
+		{
+			name:     "目录之内的路径",
+			cfg:      &config.PolicyConfig{Enabled: true, Rules: []config.PolicyRule{{Name: "workspace", Tool: "file_operator", Effect: "deny", OutsideDirs: []string{allowed}}}},
+			tool:     "file_operator",
+			params:   map[string]interface{}{"file_path": filepath.Join(allowed, "new", "a.txt")},
+			want:     EffectAllow,
+			wantRule: "default",
+		},
+		{
+			name:     "目录之外的路径",
+			cfg:      &config.PolicyConfig{Enabled: true, Rules: []config.PolicyRule{{Name: "workspace", Tool: "file_operator", Effect: "deny", OutsideDirs: []string{allowed}}}},
+			tool:     "file_operator",
+			params:   map[string]interface{}{"file_path": filepath.Join(allowed, "..", "a.txt")},
+			want:     EffectDeny,
+			wantRule: "workspace",
+		},
+		{
+			name:     "通过符号链接指向目录之外",
+			cfg:      &config.PolicyConfig{Enabled: true, Rules: []config.PolicyRule{{Name: "workspace", Tool: "file_operator", Effect: "deny", OutsideDirs: []string{allowed}}}},
+			tool:     "file_operator",
+			params:   map[string]interface{}{"file_path": filepath.Join(allowed, "escape", "a.txt")},
+			want:     EffectDeny,
+			wantRule: "workspace",
+		},
+		{
+			name:     "没有路径参数时目录规则不命中",
+			cfg:      &config.PolicyConfig{Enabled: true, Rules: []config.PolicyRule{{Name: "workspace", Effect: "deny", OutsideDirs: []string{allowed}}}},
+			tool:     "web_search",
+			params:   map[string]interface{}{"query": "/etc/passwd"},
+			want:     EffectAllow,
+			wantRule: "default",
+		},
+		{
+			name:     "允许的域名及其子域名",
+			cfg:      &config.PolicyConfig{Enabled: true, Rules: []config.PolicyRule{{Name: "domains", Tool: "browser_use", Effect: "deny", OutsideDomains: []string{".example.com"}}}},
+			tool:     "browser_use",
+			params:   map[string]interface{}{"action": "navigate", "url": "https://docs.Example.com/page"},
+			want:     EffectAllow,
+			wantRule: "default",
+		},
+		{
+			name:     "域名之外的URL",
+			cfg:      &config.PolicyConfig{Enabled: true, Rules: []config.PolicyRule{{Name: "domains", Tool: "browser_use", Effect: "deny", OutsideDomains: []string{"example.com"}}}},
+			tool:     "browser_use",
+			params:   map[string]interface{}{"action": "navigate", "url": "https://badexample.com/"},
+			want:     EffectDeny,
+			wantRule: "domains",
+		},
+		{
+			name:     "其他形如URL的参数也被检查",
+			cfg:      &config.PolicyConfig{Enabled: true, Rules: []config.PolicyRule{{Name: "domains", Effect: "deny", OutsideDomains: []string{"example.com"}}}},
+			tool:     "crawler",
+			params:   map[string]interface{}{"start": "http://evil.test/"},
+			want:     EffectDeny,
+			wantRule: "domains",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine, err := NewEngine(tt.cfg)
+			if err != nil {
+				t.Fatalf("创建策略引擎失败: %v", err)
+			}
+			decision := engine.Evaluate(tt.tool, tt.params, tt.scope)
+			if decision.Effect != tt.want || decision.Rule != tt.wantRule {
+				t.Errorf("决策为 %s（规则 %s），期望 %s（规则 %s）", decision.Effect, decision.Rule, tt.want, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestNewEngineRejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *config.PolicyConfig
+	}{
+		{"无效的默认决策", &config.PolicyConfig{Enabled: true, DefaultEffect: "maybe"}},
+		{"无效的规则决策", &config.PolicyConfig{Enabled: true, Rules: []config.PolicyRule{{Effect: "block"}}}},
+		{"无效的正则表达式", &config.PolicyConfig{Enabled: true, Rules: []config.PolicyRule{{Effect: "deny", Pattern: "("}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewEngine(tt.cfg); err == nil {
+				t.Error("应该返回错误")
+			}
+		})
+	}
+}
+
+func TestEngineCheckUsesContextScope(t *testing.T) {
+	engine, err := NewEngine(&config.PolicyConfig{Enabled: true, Rules: []config.PolicyRule{
+		{Name: "plan_no_terminal", Tool: "terminal_executor", Effect: "deny", Modes: []string{"plan"}, Agents: []string{"Manus"}, Reason: "规划模式不能执行命令"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := WithAgent(WithMode(context.Background(), "plan"), "Manus")
+	err = engine.Check(ctx, "terminal_executor", map[string]interface{}{"command": "ls"})
+	var denied *DeniedError
+	if !errors.As(err, &denied) {
+		t.Fatalf("错误为 %v，期望被拒绝", err)
+	}
+	if denied.Rule != "plan_no_terminal" || denied.Reason != "规划模式不能执行命令" || denied.Scope != (Scope{Mode: "plan", Agent: "Manus"}) {
+		t.Errorf("拒绝的信息不正确: %+v", denied)
+	}
+
+	if err := engine.Check(WithMode(ctx, "task"), "terminal_executor", nil); err != nil {
+		t.Errorf("其他模式的调用应该被允许: %v", err)
+	}
+	var nilEngine *Engine
+	if err := nilEngine.Check(ctx, "terminal_executor", nil); err != nil {
+		t.Errorf("没有策略时应该允许所有调用: %v", err)
+	}
+}
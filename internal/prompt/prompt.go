@@ -0,0 +1,287 @@
+// Package prompt 渲染代理的系统提示模板
+//
+// 模板使用text/template语法，内置的默认模板嵌入在程序中，
+// 可以在配置的提示目录中放置同名模板覆盖，查找顺序为：
+//
+//	<dir>/<language>/<name>.tmpl
+//	<dir>/<name>.tmpl
+//	内置的 templates/<language>/<name>.tmpl
+//	内置的 templates/<name>.tmpl
+package prompt
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"gomanus/internal/config"
+	"gomanus/pkg/logger"
+)
+
+//go:embed templates
+var defaultTemplates embed.FS
+
+// ToolParam 描述工具的一个参数
+type ToolParam struct {
+	Name        string
+	Type        string
+	Description string // 参数说明，以"(必填)"或"(可选)"等标注开头
+	Required    bool
+	Enum        []string
+}
+
+// ToolDoc 描述一个工具，由工具定义生成
+type ToolDoc struct {
+	Name        string
+	Description string
+	Params      []ToolParam
+}
+
+// Data 是渲染模板时可以使用的变量
+type Data struct {
+	Agent   string                 // 代理名称
+	Tools   []ToolDoc              // 代理可以使用的工具
+	Date    string                 // 当前日期
+	OS      string                 // 操作系统和架构
+	WorkDir string                 // 工作目录
+	Memory  string                 // 用户记忆文件的内容
+	Vars    map[string]interface{} // 特定模板使用的其他变量
+}
+
+// NewData 创建模板变量，toolDefs 为 ToolCollection.GetToolDefinitions 的结果
+func NewData(agent string, toolDefs []map[string]interface{}) Data {
+	workDir, err := os.Getwd()
+	if err != nil {
+		workDir = "."
+	}
+
+	return Data{
+		Agent:   agent,
+		Tools:   ToolDocs(toolDefs),
+		Date:    today(),
+		OS:      runtime.GOOS + "/" + runtime.GOARCH,
+		WorkDir: workDir,
+		Memory:  loadMemory(),
+		Vars:    map[string]interface{}{},
+	}
+}
+
+// HasTool 检查代理是否可以使用指定的工具
+func (d Data) HasTool(name string) bool {
+	for _, t := range d.Tools {
+		if t.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// With 返回设置了模板变量的副本
+func (d Data) With(key string, value interface{}) Data {
+	vars := make(map[string]interface{}, len(d.Vars)+1)
+	for k, v := range d.Vars {
+		vars[k] = v
+	}
+	vars[key] = value
+	d.Vars = vars
+	return d
+}
+
+// Render 按顺序查找并渲染第一个存在的模板，覆盖的模板渲染失败时回退到内置模板
+func Render(data Data, names ...string) (string, error) {
+	cfg := promptsConfig()
+
+	var lastErr error
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		for _, candidate := range candidates(cfg, name) {
+			text, err := candidate.read()
+			if err != nil {
+				continue
+			}
+			result, err := execute(candidate.path, text, data)
+			if err != nil {
+				logger.Warn("渲染提示模板 %s 失败: %v", candidate.path, err)
+				lastErr = err
+				continue
+			}
+			return result, nil
+		}
+	}
+
+	if lastErr != nil {
+		return "", lastErr
+	}
+	return "", fmt.Errorf("提示模板不存在: %s", strings.Join(names, ", "))
+}
+
+// RenderFile 渲染指定路径的模板文件
+func RenderFile(file string, data Data) (string, error) {
+	text, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("读取提示模板失败: %w", err)
+	}
+	return execute(file, string(text), data)
+}
+
+// ToolDocs 把工具定义转换为模板中使用的工具说明，按名称排序
+func ToolDocs(toolDefs []map[string]interface{}) []ToolDoc {
+	docs := make([]ToolDoc, 0, len(toolDefs))
+	for _, def := range toolDefs {
+		function, ok := def["function"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		doc := ToolDoc{}
+		doc.Name, _ = function["name"].(string)
+		doc.Description, _ = function["description"].(string)
+
+		if params, ok := function["parameters"].(map[string]interface{}); ok {
+			required := make(map[string]bool)
+			for _, name := range stringList(params["required"]) {
+				required[name] = true
+			}
+			properties, _ := params["properties"].(map[string]interface{})
+			for name, raw := range properties {
+				prop, _ := raw.(map[string]interface{})
+				param := ToolParam{Name: name, Required: required[name], Enum: stringList(prop["enum"])}
+				param.Type, _ = prop["type"].(string)
+				param.Description, _ = prop["description"].(string)
+				// 描述中没有标注时补充是否必填
+				if !strings.HasPrefix(param.Description, "(") {
+					marker := "(可选) "
+					if param.Required {
+						marker = "(必填) "
+					}
+					param.Description = marker + param.Description
+				}
+				doc.Params = append(doc.Params, param)
+			}
+			// 必填参数在前，其余按名称排序
+			sort.Slice(doc.Params, func(i, j int) bool {
+				if doc.Params[i].Required != doc.Params[j].Required {
+					return doc.Params[i].Required
+				}
+				return doc.Params[i].Name < doc.Params[j].Name
+			})
+		}
+		docs = append(docs, doc)
+	}
+
+	sort.Slice(docs, func(i, j int) bool {
+		return docs[i].Name < docs[j].Name
+	})
+	return docs
+}
+
+// templateSource 是一个候选的模板来源
+type templateSource struct {
+	path     string
+	embedded bool
+}
+
+// read 读取模板内容
+func (s templateSource) read() (string, error) {
+	var data []byte
+	var err error
+	if s.embedded {
+		data, err = defaultTemplates.ReadFile(s.path)
+	} else {
+		data, err = os.ReadFile(s.path)
+	}
+	return string(data), err
+}
+
+// candidates 返回模板的候选来源，配置目录中的模板优先于内置模板
+func candidates(cfg config.PromptsConfig, name string) []templateSource {
+	file := name + ".tmpl"
+	var sources []templateSource
+	if cfg.Dir != "" {
+		if cfg.Language != "" {
+			sources = append(sources, templateSource{path: filepath.Join(cfg.Dir, cfg.Language, file)})
+		}
+		sources = append(sources, templateSource{path: filepath.Join(cfg.Dir, file)})
+	}
+	if cfg.Language != "" {
+		sources = append(sources, templateSource{path: path.Join("templates", cfg.Language, file), embedded: true})
+	}
+	return append(sources, templateSource{path: path.Join("templates", file), embedded: true})
+}
+
+// execute 解析并执行模板
+func execute(name, text string, data Data) (string, error) {
+	tmpl, err := template.New(name).Funcs(template.FuncMap{
+		"inc":  func(i int) int { return i + 1 },
+		"join": strings.Join,
+	}).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("解析提示模板失败: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("执行提示模板失败: %w", err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// promptsConfig 获取提示模板配置，读取失败时只使用内置模板
+func promptsConfig() config.PromptsConfig {
+	cfg, err := config.GetPromptsConfig()
+	if err != nil {
+		return config.PromptsConfig{}
+	}
+	return *cfg
+}
+
+// today 返回当前日期和星期
+func today() string {
+	now := time.Now()
+	weekdays := []string{"星期日", "星期一", "星期二", "星期三", "星期四", "星期五", "星期六"}
+	return now.Format("2006-01-02") + " " + weekdays[now.Weekday()]
+}
+
+// loadMemory 读取用户记忆文件，文件不存在时返回空字符串
+func loadMemory() string {
+	cfg := promptsConfig()
+	if cfg.MemoryFile == "" {
+		return ""
+	}
+
+	data, err := os.ReadFile(cfg.MemoryFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warn("读取用户记忆文件失败: %v", err)
+		}
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// stringList 把JSON中的字符串数组转换为[]string
+func stringList(value interface{}) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		var result []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
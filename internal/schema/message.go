@@ -1,6 +1,7 @@
 package schema
 
 import (
+	"sync"
 	"time"
 )
 
@@ -52,9 +53,10 @@ func NewToolMessage(content, toolCallID, name string) Message {
 	}
 }
 
-// Memory 表示代理的记忆，存储消息历史
+// Memory 表示代理的记忆，存储消息历史，可以被多个协程同时访问
 type Memory struct {
 	Messages []Message
+	mu       sync.RWMutex
 }
 
 // NewMemory 创建新的记忆
@@ -66,23 +68,31 @@ func NewMemory() *Memory {
 
 // AddMessage 向记忆中添加消息
 func (m *Memory) AddMessage(msg Message) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.Messages = append(m.Messages, msg)
 }
 
-// GetMessages 获取所有消息
+// GetMessages 获取所有消息的副本
 func (m *Memory) GetMessages() []Message {
-	return m.Messages
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]Message(nil), m.Messages...)
 }
 
-// GetLastNMessages 获取最后N条消息
+// GetLastNMessages 获取最后N条消息的副本
 func (m *Memory) GetLastNMessages(n int) []Message {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	if len(m.Messages) <= n {
-		return m.Messages
+		return append([]Message(nil), m.Messages...)
 	}
-	return m.Messages[len(m.Messages)-n:]
+	return append([]Message(nil), m.Messages[len(m.Messages)-n:]...)
 }
 
 // Clear 清空记忆
 func (m *Memory) Clear() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.Messages = make([]Message, 0)
 }
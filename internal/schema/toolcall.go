@@ -13,8 +13,16 @@ type ToolCall struct {
 	Function ToolCallFunction `json:"function"` // 工具调用函数
 }
 
+// Usage 表示一次LLM请求消耗的token数量
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`     // 输入token数
+	CompletionTokens int `json:"completion_tokens"` // 输出token数
+	TotalTokens      int `json:"total_tokens"`      // 总token数
+}
+
 // LLMResponse 表示LLM的响应
 type LLMResponse struct {
 	Content   string     `json:"content"`    // 响应内容
 	ToolCalls []ToolCall `json:"tool_calls"` // 工具调用
+	Usage     Usage      `json:"usage"`      // token用量，服务端未返回时为零值
 }
@@ -10,68 +10,47 @@ import (
 
 // BaiduBaikeSearch 是一个用于执行百度百科搜索的工具
 type BaiduBaikeSearch struct {
-	*BaseTool
-	parameters map[string]interface{}
+	*TypedTool[BaiduBaikeSearchArgs]
+}
+
+// BaiduBaikeSearchArgs 是百度百科搜索工具的参数
+type BaiduBaikeSearchArgs struct {
+	Query      string `json:"query" description:"(必填) 提交给百度百科的搜索查询。" required:"true"`
+	NumResults int    `json:"num_results" description:"(可选) 返回的搜索结果数量。默认为5。" default:"5"`
 }
 
 // NewBaiduBaikeSearch 创建新的百度百科搜索工具
 func NewBaiduBaikeSearch() *BaiduBaikeSearch {
 	description := "执行百度百科搜索并返回相关词条的链接和摘要。当需要查找中文百科知识、了解概念定义或获取基础知识时使用此工具。"
-	baseTool := NewBaseTool("baidu_baike_search", description)
-
-	// 定义参数
-	parameters := map[string]interface{}{
-		"type": "object",
-		"properties": map[string]interface{}{
-			"query": map[string]interface{}{
-				"type":        "string",
-				"description": "(必填) 提交给百度百科的搜索查询。",
-			},
-			"num_results": map[string]interface{}{
-				"type":        "integer",
-				"description": "(可选) 返回的搜索结果数量。默认为5。",
-				"default":     5,
-			},
-		},
-		"required": []string{"query"},
-	}
+	b := &BaiduBaikeSearch{}
+	b.TypedTool = NewTypedTool("baidu_baike_search", description, b.search)
+	return b
+}
 
-	return &BaiduBaikeSearch{
-		BaseTool:   baseTool,
-		parameters: parameters,
-	}
+// ConcurrencySafe 返回true，搜索只读取外部数据，可以与其他工具调用并发执行
+func (b *BaiduBaikeSearch) ConcurrencySafe() bool {
+	return true
 }
 
-// Parameters 返回工具参数定义
-func (b *BaiduBaikeSearch) Parameters() map[string]interface{} {
-	return b.parameters
+// ReadOnly 返回true，搜索不修改任何状态
+func (b *BaiduBaikeSearch) ReadOnly() bool {
+	return true
 }
 
-// Execute 执行工具
-func (b *BaiduBaikeSearch) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
-	// 获取查询参数
-	query, ok := params["query"].(string)
-	if !ok || query == "" {
+// search 执行搜索，结果数量限制在1到10之间
+func (b *BaiduBaikeSearch) search(ctx context.Context, args BaiduBaikeSearchArgs) (interface{}, error) {
+	if args.Query == "" {
 		return nil, fmt.Errorf("无效的查询参数")
 	}
 
-	// 获取结果数量参数
-	numResults := 5
-	if numResultsParam, ok := params["num_results"]; ok {
-		if numResultsFloat, ok := numResultsParam.(float64); ok {
-			numResults = int(numResultsFloat)
-		}
-	}
-
-	// 限制结果数量在合理范围内
+	numResults := args.NumResults
 	if numResults < 1 {
 		numResults = 1
 	} else if numResults > 10 {
 		numResults = 10
 	}
 
-	// 执行搜索
-	results, err := b.performSearch(query, numResults)
+	results, err := b.performSearch(args.Query, numResults)
 	if err != nil {
 		return nil, fmt.Errorf("搜索失败: %v", err)
 	}
@@ -12,6 +12,67 @@ type Tool interface {
 	Execute(ctx context.Context, params map[string]interface{}) (interface{}, error)
 }
 
+// ConcurrencyAware 由可以并发执行的工具实现
+// 未实现该接口的工具可能有副作用，被视为需要独占执行
+type ConcurrencyAware interface {
+	ConcurrencySafe() bool
+}
+
+// IsConcurrencySafe 检查工具是否可以与其他工具调用并发执行
+func IsConcurrencySafe(tool Tool) bool {
+	if aware, ok := tool.(ConcurrencyAware); ok {
+		return aware.ConcurrencySafe()
+	}
+	return false
+}
+
+// CallConcurrencyAware 由并发安全性取决于调用参数的工具实现，例如读取可以并发而写入需要独占执行
+// 判断单次调用时优先使用该接口，ConcurrencySafe仍表示工具整体是否只读
+type CallConcurrencyAware interface {
+	ConcurrencySafeFor(params map[string]interface{}) bool
+}
+
+// IsCallConcurrencySafe 检查使用指定参数的一次调用是否可以与其他工具调用并发执行
+func IsCallConcurrencySafe(tool Tool, params map[string]interface{}) bool {
+	if aware, ok := tool.(CallConcurrencyAware); ok {
+		return aware.ConcurrencySafeFor(params)
+	}
+	return IsConcurrencySafe(tool)
+}
+
+// ReadOnlyAware 由明确声明是否只读的工具实现，只读的工具不修改本地或外部的状态
+// 可以并发执行不代表只读，对外提供工具时只使用该接口的声明
+type ReadOnlyAware interface {
+	ReadOnly() bool
+}
+
+// IsReadOnly 检查工具是否声明为只读，未实现ReadOnlyAware的工具不是只读的
+func IsReadOnly(tool Tool) bool {
+	if aware, ok := tool.(ReadOnlyAware); ok {
+		return aware.ReadOnly()
+	}
+	return false
+}
+
+// SessionScoped 由保存了会话状态的工具实现，例如浏览器的标签页
+// 每个会话使用ForSession返回的独立实例，tools为该会话的工具集合
+type SessionScoped interface {
+	ForSession(tools *ToolCollection) Tool
+}
+
+// ArtifactProducer 由会产生文件等产物的工具实现，返回一次成功调用产生的产物
+type ArtifactProducer interface {
+	Artifacts(params map[string]interface{}) []string
+}
+
+// ArtifactsOf 返回工具调用产生的产物，未实现ArtifactProducer的工具没有产物
+func ArtifactsOf(tool Tool, params map[string]interface{}) []string {
+	if producer, ok := tool.(ArtifactProducer); ok {
+		return producer.Artifacts(params)
+	}
+	return nil
+}
+
 // BaseTool 提供工具的基础实现
 type BaseTool struct {
 	name        string
@@ -0,0 +1,58 @@
+package tool
+
+import (
+	"context"
+	"testing"
+)
+
+// customTool 是没有声明并发安全性的工具
+type customTool struct {
+	*BaseTool
+}
+
+func (c *customTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	return nil, nil
+}
+
+func TestIsCallConcurrencySafe(t *testing.T) {
+	tests := []struct {
+		name   string
+		tool   Tool
+		params map[string]interface{}
+		want   bool
+	}{
+		{"没有声明的工具独占执行", &customTool{NewBaseTool("custom", "有副作用的工具")}, nil, false},
+		{"搜索工具可以并发", NewGoogleSearch(), map[string]interface{}{"query": "go"}, true},
+		{"终端独占执行", NewTerminalExecutor(), map[string]interface{}{"command": "ls"}, false},
+		{"读取文件可以并发", NewFileOperator(), map[string]interface{}{"operation": "read", "file_path": "a.txt"}, true},
+		{"写入文件独占执行", NewFileOperator(), map[string]interface{}{"operation": "write", "file_path": "a.txt"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsCallConcurrencySafe(tt.tool, tt.params); got != tt.want {
+				t.Errorf("IsCallConcurrencySafe = %v，期望 %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsReadOnly(t *testing.T) {
+	tests := []struct {
+		name string
+		tool Tool
+		want bool
+	}{
+		{"没有声明的工具不是只读的", &customTool{NewBaseTool("custom", "有副作用的工具")}, false},
+		{"搜索工具是只读的", NewBaiduBaikeSearch(), true},
+		{"可以并发读取的文件工具不是只读的", NewFileOperator(), false},
+		{"插件按清单声明", &PluginTool{manifest: &PluginManifest{ConcurrencySafe: true}}, false},
+		{"清单声明只读的插件", &PluginTool{manifest: &PluginManifest{ReadOnly: true}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsReadOnly(tt.tool); got != tt.want {
+				t.Errorf("IsReadOnly = %v，期望 %v", got, tt.want)
+			}
+		})
+	}
+}
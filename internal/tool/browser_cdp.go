@@ -0,0 +1,301 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gomanus/internal/cdp"
+	"gomanus/internal/policy"
+	"gomanus/pkg/logger"
+)
+
+// chromium 在第一次需要时启动或连接Chromium，由浏览器工具的所有会话共享
+type chromium struct {
+	path     string // 可执行文件，为空时自动查找
+	endpoint string // 已运行的浏览器的调试地址，设置后不启动新的浏览器
+	headless bool
+	timeout  time.Duration
+
+	mu      sync.Mutex
+	browser *cdp.Browser
+	err     error // 启动失败的原因，失败后不再重试，新的标签页使用HTTP方式加载页面；调用被取消导致的失败不记录
+}
+
+// get 返回可用的浏览器，浏览器退出或连接断开后重新启动
+func (c *chromium) get(ctx context.Context) (*cdp.Browser, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.browser != nil {
+		if c.browser.Alive() {
+			return c.browser, nil
+		}
+		logger.Warn("与浏览器的连接已断开，重新启动浏览器")
+		c.browser.Close()
+		c.browser = nil
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	launchCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	var err error
+	if c.endpoint != "" {
+		c.browser, err = cdp.Connect(launchCtx, c.endpoint)
+	} else {
+		c.browser, err = cdp.Launch(launchCtx, cdp.LaunchOptions{Path: c.path, Headless: c.headless})
+	}
+	if err != nil {
+		// 调用被取消或超时导致的失败与浏览器无关，下次需要时重新启动
+		if ctx.Err() == nil {
+			c.err = err
+		}
+		return nil, err
+	}
+	return c.browser, nil
+}
+
+// Close 关闭启动的浏览器或断开与已运行的浏览器的连接
+func (c *chromium) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.browser == nil {
+		return nil
+	}
+	err := c.browser.Close()
+	c.browser = nil
+	return err
+}
+
+// openChromiumTab 为标签页在浏览器中打开页面，页面中的所有导航都按会话的权限策略检查
+func (b *BrowserUseTool) openChromiumTab(ctx context.Context, tab *BrowserSession) error {
+	browser, err := b.chromium.get(ctx)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, b.timeout)
+	defer cancel()
+	page, err := browser.NewPage(ctx)
+	if err != nil {
+		return err
+	}
+
+	// 页面中的脚本可能在两次操作之间发起导航，使用最近一次操作的调用范围检查
+	tab.scope.Store(policy.ScopeFromContext(ctx))
+	check := func(target string) error {
+		scope, _ := tab.scope.Load().(policy.Scope)
+		return b.checkURL(policy.WithScope(context.Background(), scope), target)
+	}
+	if err := page.FilterNavigation(ctx, check); err != nil {
+		page.Close(ctx)
+		return err
+	}
+	tab.chrome = page
+	return nil
+}
+
+// chromiumContext 返回单次操作使用的带超时的context，并记录操作的调用范围
+func (b *BrowserUseTool) chromiumContext(ctx context.Context, tab *BrowserSession) (context.Context, context.CancelFunc) {
+	tab.scope.Store(policy.ScopeFromContext(ctx))
+	return context.WithTimeout(ctx, b.timeout)
+}
+
+// chromiumLoad 执行可能改变页面的操作，然后读取渲染后的页面并返回摘要
+func (b *BrowserUseTool) chromiumLoad(ctx context.Context, tab *BrowserSession, action func(ctx context.Context) error) (interface{}, error) {
+	ctx, cancel := b.chromiumContext(ctx, tab)
+	defer cancel()
+	if err := action(ctx); err != nil {
+		return nil, err
+	}
+	if err := b.refresh(ctx, tab); err != nil {
+		return nil, err
+	}
+	return b.summary(tab), nil
+}
+
+// refresh 读取浏览器中渲染后的页面，脚本修改过的内容、链接和表单都会被重新提取
+func (b *BrowserUseTool) refresh(ctx context.Context, tab *BrowserSession) error {
+	snapshot, err := tab.chrome.Snapshot(ctx)
+	if err != nil {
+		return err
+	}
+	pageURL, err := url.Parse(snapshot.URL)
+	if err != nil {
+		return fmt.Errorf("无效的页面地址: %w", err)
+	}
+	page, err := parseHTMLPage(pageURL, snapshot.HTML)
+	if err != nil {
+		return err
+	}
+	if page.Title == "" {
+		page.Title = snapshot.Title
+	}
+	page.ContentType = "text/html"
+	tab.page = page
+	tab.URL = page.URL
+	return nil
+}
+
+// chromiumSubmitForm 在浏览器中填写表单的字段并提交，没有填写的字段保留页面中的当前值
+func (b *BrowserUseTool) chromiumSubmitForm(ctx context.Context, tab *BrowserSession, formID int, fields map[string]string) (interface{}, error) {
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("编码表单字段失败: %w", err)
+	}
+	script := fmt.Sprintf(`((index, fields) => {
+	const form = document.forms[index];
+	if (!form) throw new Error("表单不存在");
+	let submitter = null;
+	for (const [name, value] of Object.entries(fields)) {
+		for (const el of Array.from(form.elements).filter(el => el.name === name)) {
+			const type = (el.type || "").toLowerCase();
+			if (type === "submit" || type === "image") {
+				if (!submitter || el.value === value) submitter = el;
+				continue;
+			}
+			if (type === "checkbox") {
+				el.checked = !["", "false", "off", "0"].includes(value.toLowerCase());
+			} else if (type === "radio") {
+				el.checked = el.value === value;
+			} else if (el.tagName === "SELECT") {
+				for (const option of el.options) option.selected = option.value === value;
+			} else {
+				el.value = value;
+			}
+			el.dispatchEvent(new Event("input", {bubbles: true}));
+			el.dispatchEvent(new Event("change", {bubbles: true}));
+		}
+	}
+	form.requestSubmit(submitter);
+})(%d, %s)`, formID-1, data)
+
+	return b.chromiumLoad(ctx, tab, func(ctx context.Context) error {
+		_, err := tab.chrome.Run(ctx, script)
+		return err
+	})
+}
+
+// chromiumBack 返回浏览器历史记录中的上一个页面
+func (b *BrowserUseTool) chromiumBack(ctx context.Context, tab *BrowserSession) (interface{}, error) {
+	return b.chromiumLoad(ctx, tab, func(ctx context.Context) error {
+		err := tab.chrome.Back(ctx, func(previous string) error {
+			return b.checkURL(ctx, previous)
+		})
+		if cdp.IsNoHistory(err) {
+			return fmt.Errorf("标签页 %s 没有可以返回的页面", tab.ID)
+		}
+		return err
+	})
+}
+
+// executeJS 在页面中执行JavaScript，返回表达式的值，脚本引起导航时等待新页面加载完成
+func (b *BrowserUseTool) executeJS(ctx context.Context, tab *BrowserSession, script string) (interface{}, error) {
+	if script == "" {
+		return nil, fmt.Errorf("execute_js操作需要script参数")
+	}
+	ctx, cancel := b.chromiumContext(ctx, tab)
+	defer cancel()
+	value, err := tab.chrome.Run(ctx, script)
+	if err != nil {
+		return nil, err
+	}
+
+	var result string
+	switch v := value.(type) {
+	case nil:
+		result = "脚本执行完成，没有返回值"
+	case string:
+		result = v
+	default:
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("编码脚本结果失败: %w", err)
+		}
+		result = string(data)
+	}
+	if len([]rune(result)) > browserPageSize {
+		result = truncateRunes(result, browserPageSize) + "\n（结果过长，已截断）"
+	}
+	return result, nil
+}
+
+// clickElement 点击选择器匹配的元素，返回点击后的页面摘要
+func (b *BrowserUseTool) clickElement(ctx context.Context, tab *BrowserSession, selector string) (interface{}, error) {
+	if selector == "" {
+		return nil, fmt.Errorf("click操作需要selector参数")
+	}
+	return b.chromiumLoad(ctx, tab, func(ctx context.Context) error {
+		return tab.chrome.Click(ctx, selector)
+	})
+}
+
+// typeText 在选择器匹配的输入元素中输入文本
+func (b *BrowserUseTool) typeText(ctx context.Context, tab *BrowserSession, selector, text string) (interface{}, error) {
+	if selector == "" {
+		return nil, fmt.Errorf("type操作需要selector参数")
+	}
+	ctx, cancel := b.chromiumContext(ctx, tab)
+	defer cancel()
+	if err := tab.chrome.Type(ctx, selector, text); err != nil {
+		return nil, err
+	}
+	return fmt.Sprintf("已在 %s 中输入文本", selector), nil
+}
+
+// waitFor 等待选择器匹配的元素出现，timeout为等待的秒数，0表示使用页面加载的超时时间
+func (b *BrowserUseTool) waitFor(ctx context.Context, tab *BrowserSession, selector string, timeout int) (interface{}, error) {
+	if selector == "" {
+		return nil, fmt.Errorf("wait_for操作需要selector参数")
+	}
+	tab.scope.Store(policy.ScopeFromContext(ctx))
+	wait := b.timeout
+	if timeout > 0 {
+		wait = time.Duration(timeout) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	if err := tab.chrome.WaitFor(ctx, selector); err != nil {
+		return nil, err
+	}
+	return fmt.Sprintf("匹配 %s 的元素已出现", selector), nil
+}
+
+// capture 把页面截图或PDF保存到文件
+func (b *BrowserUseTool) capture(ctx context.Context, tab *BrowserSession, action, filePath string, fullPage bool) (interface{}, error) {
+	if filePath == "" {
+		return nil, fmt.Errorf("%s操作需要file_path参数", action)
+	}
+	ctx, cancel := b.chromiumContext(ctx, tab)
+	defer cancel()
+
+	var data []byte
+	var err error
+	if action == "pdf" {
+		data, err = tab.chrome.PDF(ctx)
+	} else {
+		data, err = tab.chrome.Screenshot(ctx, fullPage)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if dir := filepath.Dir(filePath); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("创建目录失败: %w", err)
+		}
+	}
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
+		return nil, fmt.Errorf("保存文件失败: %w", err)
+	}
+	if action == "pdf" {
+		return fmt.Sprintf("已把页面保存为PDF: %s (%d 字节)", filePath, len(data)), nil
+	}
+	return fmt.Sprintf("已保存截图: %s (%d 字节)", filePath, len(data)), nil
+}
@@ -0,0 +1,49 @@
+package tool
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestChromiumRetriesAfterCanceledLaunch(t *testing.T) {
+	var hits atomic.Int32
+	var hang atomic.Bool
+	hang.Store(true)
+	arrived := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if hang.Load() {
+			arrived <- struct{}{}
+			<-r.Context().Done()
+			return
+		}
+		// 没有返回调试地址，是浏览器本身的问题
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	c := &chromium{endpoint: srv.URL, timeout: 5 * time.Second}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-arrived
+		cancel()
+	}()
+	if _, err := c.get(ctx); err == nil {
+		t.Fatal("调用被取消时应该返回错误")
+	}
+	if c.err != nil {
+		t.Fatalf("调用被取消导致的失败不应该被记录: %v", c.err)
+	}
+
+	hang.Store(false)
+	if _, err := c.get(context.Background()); err == nil || hits.Load() != 2 {
+		t.Fatalf("取消后再次调用应该重新连接，错误为 %v，连接了 %d 次", err, hits.Load())
+	}
+	if _, err := c.get(context.Background()); err == nil || hits.Load() != 2 {
+		t.Errorf("浏览器本身的失败应该被记录，不再重试，连接了 %d 次", hits.Load())
+	}
+}
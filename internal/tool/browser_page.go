@@ -0,0 +1,626 @@
+package tool
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// browserPageSize 是分页读取页面内容时每页的字符数
+const browserPageSize = 4000
+
+// pageLink 是页面中的一个链接，ID是click_link使用的编号
+type pageLink struct {
+	ID   int
+	Text string
+	URL  string
+}
+
+// formField 是表单中的一个字段
+type formField struct {
+	Name    string
+	Type    string // text、hidden、password、checkbox、radio、select、textarea、submit等
+	Value   string
+	Checked bool     // checkbox和radio是否默认选中
+	Options []string // select的可选值
+}
+
+// pageForm 是页面中的一个表单，ID是submit_form使用的编号
+type pageForm struct {
+	ID      int
+	Method  string // GET或POST
+	Action  string // 解析为绝对地址的提交地址
+	Enctype string
+	Fields  []formField
+}
+
+// browserPage 是加载并解析后的页面
+type browserPage struct {
+	URL         string // 跟随重定向之后的地址
+	Status      int
+	ContentType string
+	Title       string
+	Source      string // 转换为UTF-8的页面源码
+	Text        string // 可读文本，链接后标注 [编号]
+	Links       []pageLink
+	Forms       []pageForm
+}
+
+// parseHTMLPage 解析HTML页面，提取标题、可读文本、链接和表单
+func parseHTMLPage(pageURL *url.URL, source string) (*browserPage, error) {
+	root, err := html.Parse(strings.NewReader(source))
+	if err != nil {
+		return nil, fmt.Errorf("解析HTML失败: %w", err)
+	}
+
+	page := &browserPage{URL: pageURL.String(), Source: source}
+	base := pageURL
+	if node := findElement(root, atom.Base); node != nil {
+		if href := attrValue(node, "href"); href != "" {
+			if resolved, err := pageURL.Parse(href); err == nil {
+				base = resolved
+			}
+		}
+	}
+	if node := findElement(root, atom.Title); node != nil {
+		page.Title = collapseSpace(textContent(node))
+	}
+
+	linkIDs := page.collectLinks(root, base)
+	page.collectForms(root, base)
+
+	content, fullPage := readableRoot(root)
+	renderer := &textRenderer{links: linkIDs, skipChrome: fullPage}
+	renderer.render(content)
+	page.Text = renderer.String()
+	return page, nil
+}
+
+// collectLinks 按文档顺序为可以打开的链接编号，返回链接节点到编号的映射
+func (p *browserPage) collectLinks(root *html.Node, base *url.URL) map[*html.Node]int {
+	ids := make(map[*html.Node]int)
+	walkElements(root, func(node *html.Node) bool {
+		if node.DataAtom != atom.A {
+			return true
+		}
+		href := strings.TrimSpace(attrValue(node, "href"))
+		if href == "" || strings.HasPrefix(href, "#") {
+			return true
+		}
+		target, err := base.Parse(href)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+			return true
+		}
+		target.Fragment = ""
+
+		text := collapseSpace(textContent(node))
+		for _, fallback := range []string{attrValue(node, "title"), attrValue(node, "aria-label"), imageAlt(node)} {
+			if text == "" {
+				text = collapseSpace(fallback)
+			}
+		}
+		id := len(p.Links) + 1
+		p.Links = append(p.Links, pageLink{ID: id, Text: text, URL: target.String()})
+		ids[node] = id
+		return true
+	})
+	return ids
+}
+
+// collectForms 提取页面中的表单和字段
+func (p *browserPage) collectForms(root *html.Node, base *url.URL) {
+	walkElements(root, func(node *html.Node) bool {
+		if node.DataAtom != atom.Form {
+			return true
+		}
+		form := pageForm{
+			ID:      len(p.Forms) + 1,
+			Method:  strings.ToUpper(strings.TrimSpace(attrValue(node, "method"))),
+			Action:  p.URL,
+			Enctype: strings.ToLower(strings.TrimSpace(attrValue(node, "enctype"))),
+		}
+		if form.Method != "POST" {
+			form.Method = "GET"
+		}
+		if action := strings.TrimSpace(attrValue(node, "action")); action != "" {
+			if target, err := base.Parse(action); err == nil {
+				form.Action = target.String()
+			}
+		}
+		walkElements(node, func(child *html.Node) bool {
+			if field, ok := formFieldOf(child); ok {
+				form.Fields = append(form.Fields, field)
+			}
+			return true
+		})
+		p.Forms = append(p.Forms, form)
+		// 表单不能嵌套，不再检查子节点
+		return false
+	})
+}
+
+// formFieldOf 把表单控件转换为字段，没有名称或无法提交的控件返回false
+func formFieldOf(node *html.Node) (formField, bool) {
+	name := attrValue(node, "name")
+	if name == "" {
+		return formField{}, false
+	}
+	_, disabled := lookupAttr(node, "disabled")
+	if disabled {
+		return formField{}, false
+	}
+
+	switch node.DataAtom {
+	case atom.Input:
+		fieldType := strings.ToLower(attrValue(node, "type"))
+		if fieldType == "" {
+			fieldType = "text"
+		}
+		switch fieldType {
+		case "button", "reset", "image", "file":
+			return formField{}, false
+		}
+		value, hasValue := lookupAttr(node, "value")
+		if !hasValue && (fieldType == "checkbox" || fieldType == "radio") {
+			value = "on"
+		}
+		_, checked := lookupAttr(node, "checked")
+		return formField{Name: name, Type: fieldType, Value: value, Checked: checked}, true
+	case atom.Textarea:
+		return formField{Name: name, Type: "textarea", Value: textContent(node)}, true
+	case atom.Select:
+		field := formField{Name: name, Type: "select"}
+		selected := ""
+		walkElements(node, func(option *html.Node) bool {
+			if option.DataAtom != atom.Option {
+				return true
+			}
+			value, ok := lookupAttr(option, "value")
+			if !ok {
+				value = collapseSpace(textContent(option))
+			}
+			field.Options = append(field.Options, value)
+			if _, isSelected := lookupAttr(option, "selected"); isSelected && selected == "" {
+				selected = value
+			}
+			return false
+		})
+		field.Value = selected
+		if field.Value == "" && len(field.Options) > 0 {
+			field.Value = field.Options[0]
+		}
+		return field, true
+	case atom.Button:
+		fieldType := strings.ToLower(attrValue(node, "type"))
+		if fieldType != "" && fieldType != "submit" {
+			return formField{}, false
+		}
+		value, ok := lookupAttr(node, "value")
+		if !ok {
+			value = collapseSpace(textContent(node))
+		}
+		return formField{Name: name, Type: "submit", Value: value}, true
+	}
+	return formField{}, false
+}
+
+// values 返回提交表单时的字段值：先使用页面中的默认值，再用fields覆盖
+// 提交按钮只有在fields中指定时才会提交，复选框的值为空、false或off时表示不选中
+func (f *pageForm) values(fields map[string]string) (url.Values, error) {
+	values := url.Values{}
+	known := make(map[string]formField)
+	for _, field := range f.Fields {
+		if _, exists := known[field.Name]; !exists {
+			known[field.Name] = field
+		}
+		switch field.Type {
+		case "checkbox", "radio":
+			if field.Checked {
+				values.Add(field.Name, field.Value)
+			}
+		case "submit":
+		default:
+			values.Add(field.Name, field.Value)
+		}
+	}
+
+	for name, value := range fields {
+		field, exists := known[name]
+		if !exists {
+			return nil, fmt.Errorf("表单 [%d] 没有字段 %s，可用的字段: %s", f.ID, name, strings.Join(f.fieldNames(), ", "))
+		}
+		values.Del(name)
+		if field.Type == "checkbox" {
+			switch strings.ToLower(value) {
+			case "", "false", "off", "0":
+				continue
+			case "true", "on", "1":
+				value = field.Value
+			}
+		}
+		values.Set(name, value)
+	}
+	return values, nil
+}
+
+// fieldNames 返回表单中不重复的字段名称
+func (f *pageForm) fieldNames() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, field := range f.Fields {
+		if !seen[field.Name] {
+			seen[field.Name] = true
+			names = append(names, field.Name)
+		}
+	}
+	return names
+}
+
+// describe 返回表单的说明，用于list_forms
+func (f *pageForm) describe() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "表单 [%d] %s %s\n", f.ID, f.Method, f.Action)
+	if len(f.Fields) == 0 {
+		b.WriteString("  (没有可提交的字段)\n")
+	}
+	for _, field := range f.Fields {
+		fmt.Fprintf(&b, "  - %s (%s)", field.Name, field.Type)
+		switch field.Type {
+		case "password":
+		case "checkbox", "radio":
+			state := "未选中"
+			if field.Checked {
+				state = "已选中"
+			}
+			fmt.Fprintf(&b, " %s，值: %s", state, field.Value)
+		case "select":
+			fmt.Fprintf(&b, " = %q，可选: %s", field.Value, strings.Join(field.Options, ", "))
+		default:
+			fmt.Fprintf(&b, " = %q", truncateRunes(field.Value, 100))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// readableRoot 返回正文所在的节点：优先使用文本最多的main或article元素，
+// 没有时使用body，此时fullPage为true，导航栏、页脚等区域会被跳过
+func readableRoot(root *html.Node) (node *html.Node, fullPage bool) {
+	var best *html.Node
+	bestLength := 0
+	walkElements(root, func(n *html.Node) bool {
+		if n.DataAtom == atom.Main || n.DataAtom == atom.Article || attrValue(n, "role") == "main" {
+			if length := utf8.RuneCountInString(collapseSpace(textContent(n))); length > bestLength {
+				best, bestLength = n, length
+			}
+		}
+		return true
+	})
+	if best != nil && bestLength >= 200 {
+		return best, false
+	}
+	if body := findElement(root, atom.Body); body != nil {
+		return body, true
+	}
+	return root, true
+}
+
+// textRenderer 把HTML节点转换为可读文本：块级元素换行，标题加#，列表项加-，链接后标注编号
+type textRenderer struct {
+	b          strings.Builder
+	links      map[*html.Node]int
+	skipChrome bool // 是否跳过导航栏、页脚、侧边栏
+	space      bool // 下一段文字前是否需要空格
+	pre        int  // 所在pre元素的层数，pre中保留空白
+}
+
+// skippedElements 是不包含可读文本的元素
+var skippedElements = map[atom.Atom]bool{
+	atom.Head: true, atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Svg: true, atom.Iframe: true, atom.Object: true, atom.Canvas: true, atom.Select: true,
+	atom.Textarea: true, atom.Button: true, atom.Input: true,
+}
+
+// chromeElements 是使用整个body时跳过的页面框架元素
+var chromeElements = map[atom.Atom]bool{
+	atom.Nav: true, atom.Footer: true, atom.Aside: true,
+}
+
+// blockElements 是前后需要换行的元素
+var blockElements = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Blockquote: true, atom.Dd: true, atom.Details: true,
+	atom.Div: true, atom.Dl: true, atom.Dt: true, atom.Fieldset: true, atom.Figcaption: true,
+	atom.Figure: true, atom.Footer: true, atom.Form: true, atom.Header: true, atom.Li: true,
+	atom.Main: true, atom.Nav: true, atom.Ol: true, atom.P: true, atom.Pre: true, atom.Section: true,
+	atom.Summary: true, atom.Table: true, atom.Tr: true, atom.Ul: true, atom.Caption: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+}
+
+// headingLevels 是标题元素的级别
+var headingLevels = map[atom.Atom]int{
+	atom.H1: 1, atom.H2: 2, atom.H3: 3, atom.H4: 4, atom.H5: 5, atom.H6: 6,
+}
+
+// render 输出节点及其子节点的文本
+func (r *textRenderer) render(node *html.Node) {
+	switch node.Type {
+	case html.TextNode:
+		r.text(node.Data)
+		return
+	case html.ElementNode:
+	case html.DocumentNode:
+		r.children(node)
+		return
+	default:
+		return
+	}
+
+	if skippedElements[node.DataAtom] || (r.skipChrome && chromeElements[node.DataAtom]) || hiddenElement(node) {
+		return
+	}
+
+	switch node.DataAtom {
+	case atom.Br:
+		r.newline()
+		return
+	case atom.Hr:
+		r.paragraph()
+		r.write("---")
+		r.paragraph()
+		return
+	case atom.Img:
+		if alt := collapseSpace(attrValue(node, "alt")); alt != "" {
+			r.write("[图片: " + alt + "]")
+		}
+		return
+	case atom.Td, atom.Th:
+		if !r.lineEmpty() {
+			r.write(" | ")
+			r.space = false
+		}
+		r.children(node)
+		return
+	}
+
+	if level, ok := headingLevels[node.DataAtom]; ok {
+		r.paragraph()
+		r.write(strings.Repeat("#", level) + " ")
+		r.space = false
+		r.children(node)
+		r.paragraph()
+		return
+	}
+	if node.DataAtom == atom.P || node.DataAtom == atom.Blockquote || node.DataAtom == atom.Pre {
+		r.paragraph()
+		if node.DataAtom == atom.Pre {
+			r.pre++
+			defer func() { r.pre-- }()
+		}
+		r.children(node)
+		r.paragraph()
+		return
+	}
+	if blockElements[node.DataAtom] {
+		r.newline()
+		if node.DataAtom == atom.Li {
+			r.write("- ")
+			r.space = false
+		}
+		r.children(node)
+		r.newline()
+		return
+	}
+
+	r.children(node)
+	if id, ok := r.links[node]; ok {
+		r.write(fmt.Sprintf("[%d]", id))
+	}
+}
+
+// children 输出所有子节点的文本
+func (r *textRenderer) children(node *html.Node) {
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		r.render(child)
+	}
+}
+
+// text 输出文本节点，pre之外的连续空白合并为一个空格
+func (r *textRenderer) text(data string) {
+	if r.pre > 0 {
+		r.write(data)
+		return
+	}
+	if data == "" {
+		return
+	}
+	words := strings.Fields(data)
+	if len(words) == 0 {
+		r.space = true
+		return
+	}
+	if isSpace(data[0]) {
+		r.space = true
+	}
+	r.write(strings.Join(words, " "))
+	if isSpace(data[len(data)-1]) {
+		r.space = true
+	}
+}
+
+// write 输出文字，需要时在前面补一个空格
+func (r *textRenderer) write(s string) {
+	if r.space && !r.lineEmpty() {
+		r.b.WriteByte(' ')
+	}
+	r.space = false
+	r.b.WriteString(s)
+}
+
+// newline 结束当前行
+func (r *textRenderer) newline() {
+	r.space = false
+	if !r.lineEmpty() {
+		r.b.WriteByte('\n')
+	}
+}
+
+// paragraph 结束当前段落，段落之间空一行
+func (r *textRenderer) paragraph() {
+	r.newline()
+	if s := r.b.String(); s != "" && !strings.HasSuffix(s, "\n\n") {
+		r.b.WriteByte('\n')
+	}
+}
+
+// lineEmpty 检查当前行是否还没有内容
+func (r *textRenderer) lineEmpty() bool {
+	s := r.b.String()
+	return s == "" || strings.HasSuffix(s, "\n")
+}
+
+// String 返回整理后的文本
+func (r *textRenderer) String() string {
+	lines := strings.Split(r.b.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	text := strings.Join(lines, "\n")
+	return strings.TrimSpace(blankLines.ReplaceAllString(text, "\n\n"))
+}
+
+// blankLines 匹配连续的多个空行
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// isSpace 检查字节是否是HTML中的空白字符
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// hiddenElement 检查元素是否被标记为隐藏
+func hiddenElement(node *html.Node) bool {
+	if _, hidden := lookupAttr(node, "hidden"); hidden {
+		return true
+	}
+	if attrValue(node, "aria-hidden") == "true" {
+		return true
+	}
+	style := strings.ReplaceAll(strings.ToLower(attrValue(node, "style")), " ", "")
+	return strings.Contains(style, "display:none") || strings.Contains(style, "visibility:hidden")
+}
+
+// walkElements 按文档顺序遍历元素节点，visit返回false时不再遍历该元素的子节点
+func walkElements(node *html.Node, visit func(*html.Node) bool) {
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode && !visit(child) {
+			continue
+		}
+		walkElements(child, visit)
+	}
+}
+
+// findElement 返回第一个指定类型的元素
+func findElement(root *html.Node, a atom.Atom) *html.Node {
+	var found *html.Node
+	walkElements(root, func(node *html.Node) bool {
+		if found != nil {
+			return false
+		}
+		if node.DataAtom == a {
+			found = node
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// lookupAttr 返回元素的属性值以及属性是否存在
+func lookupAttr(node *html.Node, key string) (string, bool) {
+	for _, attr := range node.Attr {
+		if attr.Namespace == "" && strings.EqualFold(attr.Key, key) {
+			return attr.Val, true
+		}
+	}
+	return "", false
+}
+
+// attrValue 返回元素的属性值，属性不存在时返回空字符串
+func attrValue(node *html.Node, key string) string {
+	value, _ := lookupAttr(node, key)
+	return value
+}
+
+// textContent 返回节点中不在脚本和样式里的全部文字
+func textContent(node *html.Node) string {
+	var b strings.Builder
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+			b.WriteByte(' ')
+			return
+		}
+		if n.Type == html.ElementNode && (n.DataAtom == atom.Script || n.DataAtom == atom.Style) {
+			return
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			collect(child)
+		}
+	}
+	collect(node)
+	return b.String()
+}
+
+// imageAlt 返回元素中第一张图片的替代文字
+func imageAlt(node *html.Node) string {
+	if img := findElement(node, atom.Img); img != nil {
+		return attrValue(img, "alt")
+	}
+	return ""
+}
+
+// collapseSpace 把连续空白合并为一个空格并去掉首尾空白
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// truncateRunes 把文字截断为最多limit个字符
+func truncateRunes(s string, limit int) string {
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	return string([]rune(s)[:limit]) + "..."
+}
+
+// paginate 返回内容的第page页（从1开始）和总页数，按字符分页，尽量在换行处分页
+func paginate(content string, page int) (string, int, error) {
+	runes := []rune(content)
+	var pages [][]rune
+	for len(runes) > 0 {
+		end := len(runes)
+		if end > browserPageSize {
+			end = browserPageSize
+			// 在后四分之一中寻找换行，避免把一行拆到两页
+			for i := end - 1; i > browserPageSize*3/4; i-- {
+				if runes[i] == '\n' {
+					end = i + 1
+					break
+				}
+			}
+		}
+		pages = append(pages, runes[:end])
+		runes = runes[end:]
+	}
+	if len(pages) == 0 {
+		pages = append(pages, nil)
+	}
+	if page < 1 || page > len(pages) {
+		return "", len(pages), fmt.Errorf("页码 %d 超出范围，共 %d 页", page, len(pages))
+	}
+	return string(pages[page-1]), len(pages), nil
+}
@@ -0,0 +1,235 @@
+package tool
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseHTMLPage(t *testing.T) {
+	tests := []struct {
+		name      string
+		url       string
+		source    string
+		wantTitle string
+		wantText  []string // 可读文本中应该包含的内容
+		wantLinks []pageLink
+		wantForms []pageForm
+	}{
+		{
+			name: "按文档顺序为链接编号",
+			url:  "http://example.com/dir/page",
+			source: `<html><head><title> 链接
+				测试 </title></head><body>
+				<p><a href="/a">A</a> 和 <a href="b#frag">B</a></p>
+				<a href="#top">页内锚点</a>
+				<a href="mailto:someone@example.com">邮件</a>
+				<a href="javascript:void(0)">脚本</a>
+				<a href="https://other.test/c"><img alt="图片链接"></a>
+				<a href="/d" title="标题链接"></a>
+			</body></html>`,
+			wantTitle: "链接 测试",
+			wantText:  []string{"A[1] 和 B[2]", "[图片: 图片链接][3]"},
+			wantLinks: []pageLink{
+				{ID: 1, Text: "A", URL: "http://example.com/a"},
+				{ID: 2, Text: "B", URL: "http://example.com/dir/b"},
+				{ID: 3, Text: "图片链接", URL: "https://other.test/c"},
+				{ID: 4, Text: "标题链接", URL: "http://example.com/d"},
+			},
+		},
+		{
+			name: "相对地址按base解析",
+			url:  "http://example.com/dir/page",
+			source: `<html><head><base href="http://static.test/root/"></head><body>
+				<a href="x">X</a>
+				<form action="submit"><input name="q"></form>
+			</body></html>`,
+			wantLinks: []pageLink{{ID: 1, Text: "X", URL: "http://static.test/root/x"}},
+			wantForms: []pageForm{{
+				ID: 1, Method: "GET", Action: "http://static.test/root/submit",
+				Fields: []formField{{Name: "q", Type: "text"}},
+			}},
+		},
+		{
+			name: "表单字段和下拉框",
+			url:  "http://example.com/login",
+			source: `<body>
+				<form method="post" action="/session" enctype="Multipart/Form-Data">
+					<input name="user" value="guest">
+					<input type="hidden" name="token" value="t1">
+					<input type="password" name="password">
+					<input type="checkbox" name="remember" checked>
+					<input type="radio" name="role" value="admin">
+					<input type="radio" name="role" value="user" checked>
+					<input name="old" value="x" disabled>
+					<input type="button" name="noop" value="忽略">
+					<input value="没有名称">
+					<select name="lang"><option value="go">Go</option><option selected>Rust</option></select>
+					<select name="size"><optgroup label="尺寸"><option>小</option><option>大</option></optgroup></select>
+					<button name="go">登录</button>
+					<button type="reset" name="reset">重置</button>
+				</form>
+				<form><input name="q"></form>
+			</body>`,
+			wantForms: []pageForm{
+				{
+					ID: 1, Method: "POST", Action: "http://example.com/session", Enctype: "multipart/form-data",
+					Fields: []formField{
+						{Name: "user", Type: "text", Value: "guest"},
+						{Name: "token", Type: "hidden", Value: "t1"},
+						{Name: "password", Type: "password"},
+						{Name: "remember", Type: "checkbox", Value: "on", Checked: true},
+						{Name: "role", Type: "radio", Value: "admin"},
+						{Name: "role", Type: "radio", Value: "user", Checked: true},
+						{Name: "lang", Type: "select", Value: "Rust", Options: []string{"go", "Rust"}},
+						{Name: "size", Type: "select", Value: "小", Options: []string{"小", "大"}},
+						{Name: "go", Type: "submit", Value: "登录"},
+					},
+				},
+				{
+					ID: 2, Method: "GET", Action: "http://example.com/login",
+					Fields: []formField{{Name: "q", Type: "text"}},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pageURL, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			page, err := parseHTMLPage(pageURL, tt.source)
+			if err != nil {
+				t.Fatalf("解析页面失败: %v", err)
+			}
+			if page.Title != tt.wantTitle {
+				t.Errorf("标题为 %q，期望 %q", page.Title, tt.wantTitle)
+			}
+			for _, want := range tt.wantText {
+				if !strings.Contains(page.Text, want) {
+					t.Errorf("文本中没有 %q:\n%s", want, page.Text)
+				}
+			}
+			if !reflect.DeepEqual(page.Links, tt.wantLinks) {
+				t.Errorf("链接为 %+v，期望 %+v", page.Links, tt.wantLinks)
+			}
+			if !reflect.DeepEqual(page.Forms, tt.wantForms) {
+				t.Errorf("表单为 %+v，期望 %+v", page.Forms, tt.wantForms)
+			}
+		})
+	}
+}
+
+func TestPageFormValues(t *testing.T) {
+	form := &pageForm{ID: 1, Fields: []formField{
+		{Name: "q", Type: "text", Value: "默认"},
+		{Name: "remember", Type: "checkbox", Value: "yes", Checked: true},
+		{Name: "news", Type: "checkbox", Value: "on"},
+		{Name: "color", Type: "radio", Value: "red", Checked: true},
+		{Name: "color", Type: "radio", Value: "blue"},
+		{Name: "go", Type: "submit", Value: "搜索"},
+	}}
+
+	tests := []struct {
+		name    string
+		fields  map[string]string
+		want    url.Values
+		wantErr string
+	}{
+		{
+			name: "使用页面中的默认值，不提交按钮和未选中的复选框",
+			want: url.Values{"q": {"默认"}, "remember": {"yes"}, "color": {"red"}},
+		},
+		{
+			name:   "覆盖文本字段和单选框",
+			fields: map[string]string{"q": "golang", "color": "blue"},
+			want:   url.Values{"q": {"golang"}, "remember": {"yes"}, "color": {"blue"}},
+		},
+		{
+			name:   "复选框填写true时提交复选框自己的值",
+			fields: map[string]string{"news": "true", "remember": "on"},
+			want:   url.Values{"q": {"默认"}, "remember": {"yes"}, "news": {"on"}, "color": {"red"}},
+		},
+		{
+			name:   "复选框填写false、off、0或空时不提交",
+			fields: map[string]string{"remember": "false", "news": "0"},
+			want:   url.Values{"q": {"默认"}, "color": {"red"}},
+		},
+		{
+			name:   "复选框的其他值原样提交",
+			fields: map[string]string{"news": "weekly"},
+			want:   url.Values{"q": {"默认"}, "remember": {"yes"}, "news": {"weekly"}, "color": {"red"}},
+		},
+		{
+			name:   "指定提交按钮时提交按钮的值",
+			fields: map[string]string{"go": "搜索"},
+			want:   url.Values{"q": {"默认"}, "remember": {"yes"}, "color": {"red"}, "go": {"搜索"}},
+		},
+		{
+			name:    "不存在的字段",
+			fields:  map[string]string{"missing": "x"},
+			wantErr: "表单 [1] 没有字段 missing，可用的字段: q, remember, news, color, go",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := form.values(tt.fields)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("错误为 %v，期望 %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("获取表单值失败: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("表单值为 %v，期望 %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	long := strings.Repeat("a", browserPageSize+1000)
+	lines := strings.Repeat("a", browserPageSize-500) + "\n" + strings.Repeat("b", 1000)
+	wide := strings.Repeat("中", browserPageSize) + "文"
+
+	tests := []struct {
+		name      string
+		content   string
+		page      int
+		want      string
+		wantTotal int
+		wantErr   bool
+	}{
+		{name: "空内容只有一页", content: "", page: 1, want: "", wantTotal: 1},
+		{name: "短内容", content: "hello", page: 1, want: "hello", wantTotal: 1},
+		{name: "没有换行时按字符数分页", content: long, page: 1, want: long[:browserPageSize], wantTotal: 2},
+		{name: "最后一页", content: long, page: 2, want: long[browserPageSize:], wantTotal: 2},
+		{name: "在换行处分页", content: lines, page: 1, want: lines[:browserPageSize-499], wantTotal: 2},
+		{name: "换行后的内容在下一页", content: lines, page: 2, want: strings.Repeat("b", 1000), wantTotal: 2},
+		{name: "按字符而不是字节分页", content: wide, page: 2, want: "文", wantTotal: 2},
+		{name: "页码为0", content: "hello", page: 0, wantTotal: 1, wantErr: true},
+		{name: "页码超出范围", content: long, page: 3, wantTotal: 2, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, total, err := paginate(tt.content, tt.page)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("错误为 %v，期望出错: %v", err, tt.wantErr)
+			}
+			if total != tt.wantTotal {
+				t.Errorf("总页数为 %d，期望 %d", total, tt.wantTotal)
+			}
+			if got != tt.want {
+				t.Errorf("第 %d 页的长度为 %d，期望 %d", tt.page, len([]rune(got)), len([]rune(tt.want)))
+			}
+		})
+	}
+}
@@ -1,82 +1,295 @@
 package tool
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"gomanus/internal/cdp"
+	"gomanus/internal/policy"
+	"gomanus/pkg/logger"
+
+	"golang.org/x/net/html/charset"
+)
+
+// 浏览器的默认设置
+const (
+	defaultBrowserUserAgent = "Mozilla/5.0 (compatible; GoManus/0.8; text-mode browser)"
+	defaultBrowserTimeout   = 30 * time.Second
+	maxBrowserBody          = 5 * 1024 * 1024
+	maxBrowserRedirects     = 10
+	maxBrowserHistory       = 50
 )
 
-// BrowserUseTool 是一个用于与网页浏览器交互的工具
+// BrowserUseTool 是一个网页浏览器工具：默认通过HTTP加载页面，提取可读文本、链接和表单，不执行JavaScript；
+// 配置为cdp后端时通过Chrome DevTools协议驱动本地的Chromium，无法启动浏览器时使用HTTP方式。
+// 每个标签页有独立的Cookie和历史记录
 type BrowserUseTool struct {
 	*BaseTool
 	parameters map[string]interface{}
+	userAgent  string
+	timeout    time.Duration
+	chromium   *chromium       // 使用cdp后端时共享的浏览器，为nil时使用HTTP方式
+	tools      *ToolCollection // 会话的工具集合，点击链接、提交表单和重定向时按它的权限策略检查目标地址
+	forSession bool            // 由ForSession创建的会话实例，关闭时只关闭自己的标签页
 	mu         sync.Mutex
 	sessions   map[string]*BrowserSession
+	nextTab    int
 }
 
-// BrowserSession 表示一个浏览器会话
+// BrowserSession 表示一个浏览器标签页
 type BrowserSession struct {
 	ID      string
-	URL     string
-	Content string
+	URL     string // 当前页面的地址
+	client  *http.Client
+	page    *browserPage
+	history []string // 之前访问的页面地址，用于back
+
+	chrome    *cdp.Page    // 浏览器中的页面，为nil时标签页使用HTTP方式加载页面
+	chromeErr error        // 无法使用浏览器的原因
+	scope     atomic.Value // 最近一次操作的policy.Scope，用于检查页面自己发起的导航
+}
+
+// BrowserUseSettings 是 [tools.browser_use] 中的配置项
+type BrowserUseSettings struct {
+	Backend    string `mapstructure:"backend"`     // http或cdp，默认为http
+	UserAgent  string `mapstructure:"user_agent"`  // HTTP方式请求使用的User-Agent
+	Timeout    int    `mapstructure:"timeout"`     // 单次页面加载的超时秒数，默认为30
+	ChromePath string `mapstructure:"chrome_path"` // cdp后端启动的Chromium，为空时自动查找
+	CDPURL     string `mapstructure:"cdp_url"`     // cdp后端连接的已运行的浏览器，设置后不启动新的浏览器
+	Headless   *bool  `mapstructure:"headless"`    // cdp后端是否以无界面模式启动浏览器，默认为true
 }
 
 // NewBrowserUseTool 创建新的浏览器使用工具
 func NewBrowserUseTool() *BrowserUseTool {
-	description := `与网页浏览器交互，执行各种操作如导航、获取HTML内容和执行JavaScript。支持的操作包括：
-- 'navigate': 导航到特定URL
-- 'get_html': 获取页面HTML内容
-- 'execute_js': 执行JavaScript代码
-- 'new_tab': 打开新标签页
-- 'close_tab': 关闭当前标签页`
-
-	baseTool := NewBaseTool("browser_use", description)
-	
-	// 定义参数
-	parameters := map[string]interface{}{
-		"type": "object",
-		"properties": map[string]interface{}{
-			"action": map[string]interface{}{
-				"type": "string",
-				"enum": []string{
-					"navigate",
-					"get_html",
-					"execute_js",
-					"new_tab",
-					"close_tab",
-				},
-				"description": "要执行的浏览器操作",
-			},
-			"url": map[string]interface{}{
-				"type":        "string",
-				"description": "'navigate'或'new_tab'操作的URL",
-			},
-			"script": map[string]interface{}{
-				"type":        "string",
-				"description": "'execute_js'操作的JavaScript代码",
-			},
-			"tab_id": map[string]interface{}{
-				"type":        "string",
-				"description": "操作的标签页ID",
-			},
-		},
-		"required": []string{"action"},
-	}
-	
 	return &BrowserUseTool{
-		BaseTool:   baseTool,
-		parameters: parameters,
+		BaseTool:   NewBaseTool("browser_use", browserUseDescription(false)),
+		parameters: browserUseParameters(false),
+		userAgent:  defaultBrowserUserAgent,
+		timeout:    defaultBrowserTimeout,
 		sessions:   make(map[string]*BrowserSession),
 	}
 }
 
+// browserUseDescription 返回工具描述，withChromium表示使用Chromium浏览器
+func browserUseDescription(withChromium bool) string {
+	var s strings.Builder
+	if withChromium {
+		s.WriteString("通过Chromium浏览器加载网页并执行页面中的JavaScript，提取渲染后的可读文本、链接和表单。支持的操作包括：\n")
+	} else {
+		s.WriteString("文本模式的网页浏览器，加载网页并提取可读文本、链接和表单，不执行JavaScript。支持的操作包括：\n")
+	}
+	s.WriteString(`- 'navigate': 在标签页中打开URL，返回页面摘要和第一页文本
+- 'get_text': 分页获取页面的可读文本，文本中的 [编号] 是链接的编号
+- 'get_html': 分页获取页面的HTML源码
+- 'list_links': 列出页面中的链接及其编号
+- 'click_link': 打开指定编号的链接
+- 'list_forms': 列出页面中的表单、字段和默认值
+- 'submit_form': 填写并提交指定编号的表单
+- 'back': 返回上一个页面
+`)
+	if withChromium {
+		s.WriteString(`- 'execute_js': 在页面中执行JavaScript，返回表达式的值
+- 'click': 点击CSS选择器匹配的元素
+- 'type': 清空CSS选择器匹配的输入框并输入文本
+- 'wait_for': 等待CSS选择器匹配的元素出现
+- 'screenshot': 把页面截图保存为PNG文件
+- 'pdf': 把页面保存为PDF文件
+`)
+	}
+	s.WriteString(`- 'new_tab': 打开新标签页，可以同时打开URL
+- 'list_tabs': 列出所有标签页
+- 'close_tab': 关闭标签页
+每个标签页有独立的Cookie，登录等状态在同一个标签页中保持。`)
+	return s.String()
+}
+
+// browserUseParameters 返回工具参数定义，withChromium表示使用Chromium浏览器
+func browserUseParameters(withChromium bool) map[string]interface{} {
+	actions := []string{
+		"navigate",
+		"get_text",
+		"get_html",
+		"list_links",
+		"click_link",
+		"list_forms",
+		"submit_form",
+		"back",
+		"execute_js",
+	}
+	scriptDescription := "'execute_js'操作的JavaScript代码（文本模式不支持执行）"
+	if withChromium {
+		actions = append(actions, "click", "type", "wait_for", "screenshot", "pdf")
+		scriptDescription = "'execute_js'操作的JavaScript表达式，返回Promise时等待它完成"
+	}
+	actions = append(actions, "new_tab", "list_tabs", "close_tab")
+
+	properties := map[string]interface{}{
+		"action": map[string]interface{}{
+			"type":        "string",
+			"enum":        actions,
+			"description": "要执行的浏览器操作",
+		},
+		"url": map[string]interface{}{
+			"type":        "string",
+			"description": "'navigate'或'new_tab'操作的URL，省略协议时使用https",
+		},
+		"tab_id": map[string]interface{}{
+			"type":        "string",
+			"description": "操作的标签页ID，默认为'default'；'new_tab'操作省略时自动生成",
+		},
+		"link_id": map[string]interface{}{
+			"type":        "integer",
+			"description": "'click_link'操作的链接编号",
+		},
+		"form_id": map[string]interface{}{
+			"type":        "integer",
+			"description": "'submit_form'操作的表单编号",
+		},
+		"fields": map[string]interface{}{
+			"type":                 "object",
+			"description":          "'submit_form'操作要填写的字段，键为字段名称，未填写的字段使用页面中的默认值；复选框填写true或false，指定提交按钮的名称可以提交该按钮的值",
+			"additionalProperties": map[string]interface{}{"type": "string"},
+		},
+		"page": map[string]interface{}{
+			"type":        "integer",
+			"description": "'get_text'、'get_html'、'list_links'操作的页码，从1开始，默认为1",
+			"default":     1,
+		},
+		"script": map[string]interface{}{
+			"type":        "string",
+			"description": scriptDescription,
+		},
+	}
+	if withChromium {
+		properties["selector"] = map[string]interface{}{
+			"type":        "string",
+			"description": "'click'、'type'、'wait_for'操作的CSS选择器，匹配多个元素时使用第一个",
+		}
+		properties["text"] = map[string]interface{}{
+			"type":        "string",
+			"description": "'type'操作输入的文本",
+		}
+		properties["timeout"] = map[string]interface{}{
+			"type":        "integer",
+			"description": "'wait_for'操作等待的秒数，默认与页面加载的超时时间相同",
+		}
+		properties["file_path"] = map[string]interface{}{
+			"type":        "string",
+			"description": "'screenshot'或'pdf'操作保存的文件路径",
+		}
+		properties["full_page"] = map[string]interface{}{
+			"type":        "boolean",
+			"description": "'screenshot'操作是否截取整个页面，默认只截取可见区域",
+			"default":     false,
+		}
+	}
+
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   []string{"action"},
+	}
+}
+
+// newBrowserUseFromSettings 根据配置项创建浏览器工具
+func newBrowserUseFromSettings(deps Dependencies, settings Settings) (Tool, error) {
+	var cfg BrowserUseSettings
+	if err := settings.Decode(&cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Timeout < 0 {
+		return nil, fmt.Errorf("timeout不能为负数")
+	}
+
+	b := NewBrowserUseTool()
+	if cfg.UserAgent != "" {
+		b.userAgent = cfg.UserAgent
+	}
+	if cfg.Timeout > 0 {
+		b.timeout = time.Duration(cfg.Timeout) * time.Second
+	}
+
+	switch cfg.Backend {
+	case "", "http":
+		if cfg.ChromePath != "" || cfg.CDPURL != "" || cfg.Headless != nil {
+			return nil, fmt.Errorf("chrome_path、cdp_url和headless只在backend为cdp时使用")
+		}
+	case "cdp":
+		b.chromium = &chromium{path: cfg.ChromePath, endpoint: cfg.CDPURL, headless: true, timeout: b.timeout}
+		if cfg.Headless != nil {
+			b.chromium.headless = *cfg.Headless
+		}
+		b.BaseTool = NewBaseTool("browser_use", browserUseDescription(true))
+		b.parameters = browserUseParameters(true)
+	default:
+		return nil, fmt.Errorf("未知的backend '%s'，可选: http、cdp", cfg.Backend)
+	}
+	return b, nil
+}
+
 // Parameters 返回工具参数定义
 func (b *BrowserUseTool) Parameters() map[string]interface{} {
 	return b.parameters
 }
 
+// ConcurrencySafe 返回false，浏览器会话是有状态的，需要独占执行
+func (b *BrowserUseTool) ConcurrencySafe() bool {
+	return false
+}
+
+// ForSession 为每个会话创建独立的浏览器工具，会话之间不共享标签页和Cookie，但共享同一个Chromium进程
+func (b *BrowserUseTool) ForSession(tools *ToolCollection) Tool {
+	session := NewBrowserUseTool()
+	session.BaseTool = b.BaseTool
+	session.parameters = b.parameters
+	session.userAgent = b.userAgent
+	session.timeout = b.timeout
+	session.chromium = b.chromium
+	session.tools = tools
+	session.forSession = true
+	return session
+}
+
+// Close 释放浏览器资源：会话实例只关闭自己的标签页，共享的Chromium继续供其他会话使用；
+// 原始实例关闭cdp后端启动的浏览器，所有会话的标签页都会失效
+func (b *BrowserUseTool) Close() error {
+	if b.forSession {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for tabID := range b.sessions {
+			b.closeTab(tabID)
+		}
+		return nil
+	}
+	if b.chromium == nil {
+		return nil
+	}
+	return b.chromium.Close()
+}
+
+// Artifacts 返回截图和PDF操作保存的文件
+func (b *BrowserUseTool) Artifacts(params map[string]interface{}) []string {
+	action, _ := params["action"].(string)
+	filePath, _ := params["file_path"].(string)
+	if (action != "screenshot" && action != "pdf") || filePath == "" {
+		return nil
+	}
+	return []string{filePath}
+}
+
 // Execute 执行工具
 func (b *BrowserUseTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
 	// 获取操作参数
@@ -84,138 +297,559 @@ func (b *BrowserUseTool) Execute(ctx context.Context, params map[string]interfac
 	if !ok || action == "" {
 		return nil, fmt.Errorf("无效的操作参数")
 	}
-	
-	// 获取URL参数
-	url, _ := params["url"].(string)
-	
-	// 获取脚本参数
-	script, _ := params["script"].(string)
-	
-	// 获取标签页ID参数
-	tabID, _ := params["tab_id"].(string)
+
+	rawURL, _ := params["url"].(string)
+	requestedTab, _ := params["tab_id"].(string)
+	tabID := requestedTab
 	if tabID == "" {
 		tabID = "default"
 	}
-	
-	// 执行相应的操作
+	page := 1
+	if pageParam, ok := params["page"].(float64); ok {
+		page = int(pageParam)
+	}
+
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	
-	// 确保会话存在
-	if _, exists := b.sessions[tabID]; !exists && action != "new_tab" {
-		b.sessions[tabID] = &BrowserSession{
-			ID:  tabID,
-			URL: "",
+
+	switch action {
+	case "new_tab":
+		return b.newTab(ctx, requestedTab, rawURL)
+	case "list_tabs":
+		return b.listTabs(), nil
+	case "close_tab":
+		return b.closeTab(tabID)
+	}
+
+	// 标签页不存在时自动创建
+	tab, exists := b.sessions[tabID]
+	if !exists {
+		tab = b.openTab(ctx, tabID)
+	}
+
+	// 使用浏览器时页面可能被脚本修改，读取内容前重新提取渲染后的页面
+	switch action {
+	case "get_text", "get_html", "list_links", "list_forms":
+		if tab.chrome != nil && tab.page != nil {
+			refreshCtx, cancel := b.chromiumContext(ctx, tab)
+			err := b.refresh(refreshCtx, tab)
+			cancel()
+			if err != nil {
+				return nil, err
+			}
+		}
+	case "click", "type", "wait_for", "screenshot", "pdf":
+		if tab.chrome == nil {
+			return nil, b.chromiumRequired(tab, action)
 		}
 	}
-	
+
+	selector, _ := params["selector"].(string)
 	switch action {
 	case "navigate":
-		return b.navigate(tabID, url)
+		return b.navigate(ctx, tab, rawURL)
+	case "get_text":
+		return b.getText(tab, page)
 	case "get_html":
-		return b.getHTML(tabID)
+		return b.getHTML(tab, page)
+	case "list_links":
+		return b.listLinks(tab, page)
+	case "click_link":
+		linkID, ok := params["link_id"].(float64)
+		if !ok {
+			return nil, fmt.Errorf("click_link操作需要link_id参数")
+		}
+		return b.clickLink(ctx, tab, int(linkID))
+	case "list_forms":
+		return b.listForms(tab)
+	case "submit_form":
+		formID, ok := params["form_id"].(float64)
+		if !ok {
+			return nil, fmt.Errorf("submit_form操作需要form_id参数")
+		}
+		fields := make(map[string]string)
+		if fieldsParam, ok := params["fields"].(map[string]interface{}); ok {
+			for name, value := range fieldsParam {
+				fields[name] = fmt.Sprint(value)
+			}
+		}
+		return b.submitForm(ctx, tab, int(formID), fields)
+	case "back":
+		return b.back(ctx, tab)
 	case "execute_js":
-		return b.executeJS(tabID, script)
-	case "new_tab":
-		return b.newTab(url)
-	case "close_tab":
-		return b.closeTab(tabID)
+		if tab.chromeErr != nil {
+			return nil, b.chromiumRequired(tab, action)
+		}
+		if tab.chrome == nil {
+			return nil, fmt.Errorf("文本模式的浏览器不能执行JavaScript，请使用get_text、list_links、click_link和submit_form操作页面")
+		}
+		script, _ := params["script"].(string)
+		return b.executeJS(ctx, tab, script)
+	case "click":
+		return b.clickElement(ctx, tab, selector)
+	case "type":
+		text, _ := params["text"].(string)
+		return b.typeText(ctx, tab, selector, text)
+	case "wait_for":
+		timeout := 0
+		if timeoutParam, ok := params["timeout"].(float64); ok {
+			timeout = int(timeoutParam)
+		}
+		return b.waitFor(ctx, tab, selector, timeout)
+	case "screenshot", "pdf":
+		filePath, _ := params["file_path"].(string)
+		fullPage, _ := params["full_page"].(bool)
+		return b.capture(ctx, tab, action, filePath, fullPage)
 	default:
 		return nil, fmt.Errorf("不支持的操作: %s", action)
 	}
 }
 
-// navigate 导航到指定URL
-func (b *BrowserUseTool) navigate(tabID, url string) (interface{}, error) {
-	if url == "" {
-		return nil, fmt.Errorf("URL不能为空")
+// openTab 创建有独立Cookie的标签页，使用cdp后端时在浏览器中打开页面，失败时使用HTTP方式
+func (b *BrowserUseTool) openTab(ctx context.Context, tabID string) *BrowserSession {
+	tab := &BrowserSession{ID: tabID}
+	b.sessions[tabID] = tab
+	if b.chromium != nil {
+		if err := b.openChromiumTab(ctx, tab); err != nil {
+			logger.Warn("无法使用浏览器，标签页 %s 使用HTTP方式加载页面: %v", tabID, err)
+			tab.chromeErr = err
+		} else {
+			return tab
+		}
+	}
+
+	// cookiejar.New在没有提供选项时不会返回错误
+	jar, _ := cookiejar.New(nil)
+	tab.client = &http.Client{
+		Jar:     jar,
+		Timeout: b.timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxBrowserRedirects {
+				return fmt.Errorf("重定向次数超过 %d 次", maxBrowserRedirects)
+			}
+			return b.checkURL(req.Context(), req.URL.String())
+		},
+	}
+	return tab
+}
+
+// chromiumRequired 返回标签页没有使用浏览器时不支持操作的错误
+func (b *BrowserUseTool) chromiumRequired(tab *BrowserSession, action string) error {
+	if tab.chromeErr != nil {
+		return fmt.Errorf("标签页 %s 无法使用浏览器（%v），不支持 %s 操作", tab.ID, tab.chromeErr, action)
 	}
-	
-	// 发送HTTP请求获取页面内容
-	resp, err := http.Get(url)
+	return fmt.Errorf("%s 操作需要浏览器，请在 [tools.browser_use] 中设置 backend = \"cdp\"", action)
+}
+
+// checkURL 按会话的权限策略检查由页面产生的地址，与直接导航到该地址的检查相同
+func (b *BrowserUseTool) checkURL(ctx context.Context, target string) error {
+	if b.tools == nil {
+		return nil
+	}
+	return b.tools.GetPolicy().Check(ctx, b.Name(), map[string]interface{}{"action": "navigate", "url": target})
+}
+
+// navigate 在标签页中打开URL
+func (b *BrowserUseTool) navigate(ctx context.Context, tab *BrowserSession, rawURL string) (interface{}, error) {
+	target, err := normalizeURL(rawURL)
 	if err != nil {
-		return nil, fmt.Errorf("导航到 %s 失败: %v", url, err)
+		return nil, err
 	}
-	defer resp.Body.Close()
-	
-	// 读取响应内容
-	body, err := io.ReadAll(resp.Body)
+	if tab.chrome != nil {
+		return b.chromiumLoad(ctx, tab, func(ctx context.Context) error {
+			return tab.chrome.Navigate(ctx, target)
+		})
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
 	if err != nil {
-		return nil, fmt.Errorf("读取页面内容失败: %v", err)
+		return nil, fmt.Errorf("无效的URL: %w", err)
+	}
+	return b.load(tab, req)
+}
+
+// clickLink 打开页面中指定编号的链接
+func (b *BrowserUseTool) clickLink(ctx context.Context, tab *BrowserSession, linkID int) (interface{}, error) {
+	if tab.page == nil {
+		return nil, fmt.Errorf("标签页 %s 还没有打开页面", tab.ID)
+	}
+	if linkID < 1 || linkID > len(tab.page.Links) {
+		return nil, fmt.Errorf("链接编号 %d 不存在，当前页面有 %d 个链接", linkID, len(tab.page.Links))
 	}
-	
-	// 更新会话信息
-	b.sessions[tabID] = &BrowserSession{
-		ID:      tabID,
-		URL:     url,
-		Content: string(body),
+	link := tab.page.Links[linkID-1]
+	if err := b.checkURL(ctx, link.URL); err != nil {
+		return nil, err
+	}
+	if tab.chrome != nil {
+		return b.chromiumLoad(ctx, tab, func(ctx context.Context) error {
+			return tab.chrome.Navigate(ctx, link.URL)
+		})
 	}
-	
-	return fmt.Sprintf("已导航到 %s", url), nil
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("无效的链接地址: %w", err)
+	}
+	req.Header.Set("Referer", tab.page.URL)
+	return b.load(tab, req)
 }
 
-// getHTML 获取页面HTML内容
-func (b *BrowserUseTool) getHTML(tabID string) (interface{}, error) {
-	session, exists := b.sessions[tabID]
-	if !exists || session.Content == "" {
-		return nil, fmt.Errorf("标签页 %s 不存在或未加载内容", tabID)
+// submitForm 填写并提交页面中指定编号的表单
+func (b *BrowserUseTool) submitForm(ctx context.Context, tab *BrowserSession, formID int, fields map[string]string) (interface{}, error) {
+	if tab.page == nil {
+		return nil, fmt.Errorf("标签页 %s 还没有打开页面", tab.ID)
 	}
-	
-	// 截取前2000个字符
-	content := session.Content
-	if len(content) > 2000 {
-		content = content[:2000] + "..."
+	if formID < 1 || formID > len(tab.page.Forms) {
+		return nil, fmt.Errorf("表单编号 %d 不存在，当前页面有 %d 个表单", formID, len(tab.page.Forms))
 	}
-	
-	return content, nil
+	form := tab.page.Forms[formID-1]
+	values, err := form.values(fields)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.checkURL(ctx, form.Action); err != nil {
+		return nil, err
+	}
+	if tab.chrome != nil {
+		return b.chromiumSubmitForm(ctx, tab, formID, fields)
+	}
+
+	var req *http.Request
+	if form.Method == http.MethodGet {
+		target, err := url.Parse(form.Action)
+		if err != nil {
+			return nil, fmt.Errorf("无效的表单地址: %w", err)
+		}
+		target.RawQuery = values.Encode()
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("创建表单请求失败: %w", err)
+		}
+	} else {
+		body, contentType, err := encodeForm(form.Enctype, values)
+		if err != nil {
+			return nil, err
+		}
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, form.Action, body)
+		if err != nil {
+			return nil, fmt.Errorf("创建表单请求失败: %w", err)
+		}
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Referer", tab.page.URL)
+	return b.load(tab, req)
 }
 
-// executeJS 执行JavaScript代码
-func (b *BrowserUseTool) executeJS(tabID, script string) (interface{}, error) {
-	if script == "" {
-		return nil, fmt.Errorf("脚本不能为空")
+// encodeForm 按表单的enctype编码POST请求体
+func encodeForm(enctype string, values url.Values) (io.Reader, string, error) {
+	if enctype != "multipart/form-data" {
+		return strings.NewReader(values.Encode()), "application/x-www-form-urlencoded", nil
 	}
-	
-	session, exists := b.sessions[tabID]
-	if !exists {
-		return nil, fmt.Errorf("标签页 %s 不存在", tabID)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range values[name] {
+			if err := writer.WriteField(name, value); err != nil {
+				return nil, "", fmt.Errorf("编码表单失败: %w", err)
+			}
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", fmt.Errorf("编码表单失败: %w", err)
+	}
+	return &body, writer.FormDataContentType(), nil
+}
+
+// back 返回上一个页面，重新以GET请求加载
+func (b *BrowserUseTool) back(ctx context.Context, tab *BrowserSession) (interface{}, error) {
+	if tab.chrome != nil {
+		return b.chromiumBack(ctx, tab)
+	}
+	if len(tab.history) == 0 {
+		return nil, fmt.Errorf("标签页 %s 没有可以返回的页面", tab.ID)
+	}
+	previous := tab.history[len(tab.history)-1]
+	if err := b.checkURL(ctx, previous); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, previous, nil)
+	if err != nil {
+		return nil, fmt.Errorf("无效的URL: %w", err)
+	}
+
+	history := tab.history[:len(tab.history)-1]
+	result, err := b.load(tab, req)
+	if err != nil {
+		return nil, err
 	}
-	
-	// 模拟JavaScript执行
-	// 在实际实现中，这里应该使用WebDriver或其他浏览器自动化工具
-	return fmt.Sprintf("在 %s 上执行脚本: %s", session.URL, script), nil
+	// load会把当前页面加入历史记录，返回时需要丢弃
+	tab.history = history
+	return result, nil
 }
 
-// newTab 打开新标签页
-func (b *BrowserUseTool) newTab(url string) (interface{}, error) {
-	if url == "" {
-		return nil, fmt.Errorf("URL不能为空")
+// load 发送请求并解析响应，成功后把原来的页面加入历史记录
+func (b *BrowserUseTool) load(tab *BrowserSession, req *http.Request) (interface{}, error) {
+	req.Header.Set("User-Agent", b.userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,text/plain;q=0.9,*/*;q=0.8")
+	req.Header.Set("Accept-Language", "zh-CN,zh;q=0.9,en;q=0.8")
+
+	resp, err := tab.client.Do(req)
+	if err != nil {
+		// 权限策略拒绝重定向时直接返回拒绝的原因
+		var denied *policy.DeniedError
+		if errors.As(err, &denied) {
+			return nil, denied
+		}
+		return nil, fmt.Errorf("打开 %s 失败: %w", req.URL, err)
+	}
+	defer resp.Body.Close()
+
+	page, err := readPage(resp)
+	if err != nil {
+		return nil, err
+	}
+	if tab.page != nil {
+		tab.history = append(tab.history, tab.page.URL)
+		if len(tab.history) > maxBrowserHistory {
+			tab.history = tab.history[len(tab.history)-maxBrowserHistory:]
+		}
+	}
+	tab.page = page
+	tab.URL = page.URL
+	return b.summary(tab), nil
+}
+
+// readPage 读取响应并按Content-Type和页面声明的字符集转换为UTF-8，HTML页面会被解析
+func readPage(resp *http.Response) (*browserPage, error) {
+	contentType := resp.Header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBrowserBody))
+	if err != nil {
+		return nil, fmt.Errorf("读取页面内容失败: %w", err)
+	}
+	if mediaType == "" {
+		mediaType, _, _ = mime.ParseMediaType(http.DetectContentType(data))
+	}
+
+	page := &browserPage{URL: resp.Request.URL.String(), Status: resp.StatusCode, ContentType: mediaType}
+	textual := strings.HasPrefix(mediaType, "text/") || mediaType == "application/xhtml+xml" ||
+		strings.HasSuffix(mediaType, "json") || strings.HasSuffix(mediaType, "xml") || mediaType == "application/javascript"
+	if !textual {
+		page.Text = fmt.Sprintf("[非文本内容: %s，%d 字节]", mediaType, len(data))
+		return page, nil
+	}
+
+	reader, err := charset.NewReader(bytes.NewReader(data), contentType)
+	if err != nil {
+		// 不认识的字符集按UTF-8处理
+		reader = bytes.NewReader(data)
 	}
-	
-	// 生成新的标签页ID
-	tabID := fmt.Sprintf("tab_%d", len(b.sessions)+1)
-	
-	// 导航到URL
-	_, err := b.navigate(tabID, url)
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("转换页面编码失败: %w", err)
+	}
+	source := strings.ToValidUTF8(string(decoded), "�")
+
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		page.Source = source
+		page.Text = source
+		return page, nil
+	}
+	parsed, err := parseHTMLPage(resp.Request.URL, source)
 	if err != nil {
 		return nil, err
 	}
-	
-	return fmt.Sprintf("已打开新标签页 %s 并导航到 %s", tabID, url), nil
+	parsed.Status = page.Status
+	parsed.ContentType = mediaType
+	return parsed, nil
+}
+
+// summary 返回页面的摘要和第一页文本
+func (b *BrowserUseTool) summary(tab *BrowserSession) string {
+	page := tab.page
+	var s strings.Builder
+	fmt.Fprintf(&s, "标签页: %s\n", tab.ID)
+	if page.Title != "" {
+		fmt.Fprintf(&s, "标题: %s\n", page.Title)
+	}
+	fmt.Fprintf(&s, "地址: %s\n", page.URL)
+	// 浏览器加载的页面没有状态码
+	if page.Status != 0 && page.Status != http.StatusOK {
+		fmt.Fprintf(&s, "状态: %d %s\n", page.Status, http.StatusText(page.Status))
+	}
+	if len(page.Links) > 0 || len(page.Forms) > 0 {
+		fmt.Fprintf(&s, "链接: %d 个，表单: %d 个（使用 list_links 和 list_forms 查看）\n", len(page.Links), len(page.Forms))
+	}
+
+	text, total, _ := paginate(page.Text, 1)
+	if total > 1 {
+		fmt.Fprintf(&s, "\n内容（第 1/%d 页，使用 get_text 和 page 参数查看其他页）:\n", total)
+	} else {
+		s.WriteString("\n内容:\n")
+	}
+	s.WriteString(text)
+	return s.String()
+}
+
+// getText 分页获取页面的可读文本
+func (b *BrowserUseTool) getText(tab *BrowserSession, page int) (interface{}, error) {
+	if tab.page == nil {
+		return nil, fmt.Errorf("标签页 %s 还没有打开页面", tab.ID)
+	}
+	return pagedResult(tab.page.Text, page)
+}
+
+// getHTML 分页获取页面的HTML源码
+func (b *BrowserUseTool) getHTML(tab *BrowserSession, page int) (interface{}, error) {
+	if tab.page == nil {
+		return nil, fmt.Errorf("标签页 %s 还没有打开页面", tab.ID)
+	}
+	if tab.page.Source == "" {
+		return nil, fmt.Errorf("当前页面不是文本内容: %s", tab.page.ContentType)
+	}
+	return pagedResult(tab.page.Source, page)
+}
+
+// listLinks 分页列出页面中的链接
+func (b *BrowserUseTool) listLinks(tab *BrowserSession, page int) (interface{}, error) {
+	if tab.page == nil {
+		return nil, fmt.Errorf("标签页 %s 还没有打开页面", tab.ID)
+	}
+	if len(tab.page.Links) == 0 {
+		return "当前页面没有链接", nil
+	}
+	var s strings.Builder
+	for _, link := range tab.page.Links {
+		fmt.Fprintf(&s, "[%d] %s - %s\n", link.ID, truncateRunes(link.Text, 80), link.URL)
+	}
+	return pagedResult(s.String(), page)
+}
+
+// listForms 列出页面中的表单
+func (b *BrowserUseTool) listForms(tab *BrowserSession) (interface{}, error) {
+	if tab.page == nil {
+		return nil, fmt.Errorf("标签页 %s 还没有打开页面", tab.ID)
+	}
+	if len(tab.page.Forms) == 0 {
+		return "当前页面没有表单", nil
+	}
+	var s strings.Builder
+	for _, form := range tab.page.Forms {
+		s.WriteString(form.describe())
+	}
+	return s.String(), nil
+}
+
+// pagedResult 返回内容的一页，有多页时注明页码
+func pagedResult(content string, page int) (string, error) {
+	text, total, err := paginate(content, page)
+	if err != nil {
+		return "", err
+	}
+	if total == 1 {
+		return text, nil
+	}
+	return fmt.Sprintf("（第 %d/%d 页）\n%s", page, total, text), nil
+}
+
+// newTab 打开新标签页，没有指定标签页ID时自动生成，提供URL时同时打开该页面
+func (b *BrowserUseTool) newTab(ctx context.Context, tabID, rawURL string) (interface{}, error) {
+	if _, exists := b.sessions[tabID]; exists {
+		return nil, fmt.Errorf("标签页 %s 已存在", tabID)
+	}
+	for tabID == "" {
+		b.nextTab++
+		tabID = fmt.Sprintf("tab_%d", b.nextTab)
+		if _, exists := b.sessions[tabID]; exists {
+			tabID = ""
+		}
+	}
+	tab := b.openTab(ctx, tabID)
+	if rawURL == "" {
+		return fmt.Sprintf("已打开新标签页 %s", tabID), nil
+	}
+
+	result, err := b.navigate(ctx, tab, rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("已打开新标签页 %s，但%w", tabID, err)
+	}
+	return result, nil
+}
+
+// listTabs 列出所有标签页
+func (b *BrowserUseTool) listTabs() string {
+	if len(b.sessions) == 0 {
+		return "没有打开的标签页"
+	}
+	ids := make([]string, 0, len(b.sessions))
+	for id := range b.sessions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var s strings.Builder
+	for _, id := range ids {
+		tab := b.sessions[id]
+		switch {
+		case tab.page == nil:
+			fmt.Fprintf(&s, "%s: (空白)\n", id)
+		case tab.page.Title != "":
+			fmt.Fprintf(&s, "%s: %s - %s\n", id, tab.page.Title, tab.URL)
+		default:
+			fmt.Fprintf(&s, "%s: %s\n", id, tab.URL)
+		}
+	}
+	return s.String()
 }
 
 // closeTab 关闭标签页
 func (b *BrowserUseTool) closeTab(tabID string) (interface{}, error) {
-	if _, exists := b.sessions[tabID]; !exists {
+	tab, exists := b.sessions[tabID]
+	if !exists {
 		return nil, fmt.Errorf("标签页 %s 不存在", tabID)
 	}
-	
+
 	// 删除会话
 	delete(b.sessions, tabID)
-	
+	if tab.chrome != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := tab.chrome.Close(ctx); err != nil {
+			logger.Warn("关闭标签页 %s 的浏览器页面失败: %v", tabID, err)
+		}
+	}
+
 	return fmt.Sprintf("已关闭标签页 %s", tabID), nil
 }
 
+// normalizeURL 检查导航地址，省略协议时使用https，只支持http和https
+func normalizeURL(rawURL string) (string, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return "", fmt.Errorf("URL不能为空")
+	}
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "https://" + rawURL
+	}
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("无效的URL: %w", err)
+	}
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return "", fmt.Errorf("不支持的协议 %s，只支持http和https", target.Scheme)
+	}
+	if target.Host == "" {
+		return "", fmt.Errorf("无效的URL: 缺少主机名")
+	}
+	return target.String(), nil
+}
+
 // GetToolDefinition 返回工具定义
 func (b *BrowserUseTool) GetToolDefinition() map[string]interface{} {
 	return map[string]interface{}{
@@ -0,0 +1,255 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gomanus/internal/config"
+	"gomanus/internal/policy"
+)
+
+// newBrowserTestServer 返回一个模拟网站：首页有登录和机密页面的链接以及搜索表单，
+// 登录后通过Cookie记住用户，/gbk 返回GBK编码的页面
+func newBrowserTestServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><head><title>首页</title></head><body>
+			<a href="/login">登录</a> <a href="/secret">机密</a>
+			<form action="/search"><input name="q"><button name="go">搜索</button></form>
+		</body></html>`)
+	})
+	mux.HandleFunc("/search", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><head><title>搜索结果</title></head><body><p>搜索: %s，按钮: %s</p></body></html>`,
+			r.URL.Query().Get("q"), r.URL.Query().Get("go"))
+	})
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><head><title>登录</title></head><body>
+			<form method="post" action="/session">
+				<input name="user"><input type="checkbox" name="remember" value="yes" checked>
+			</form>
+		</body></html>`)
+	})
+	mux.HandleFunc("/session", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Referer") == "" {
+			http.Error(w, "需要从登录页面提交", http.StatusBadRequest)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "user", Value: r.PostFormValue("user") + "-" + r.PostFormValue("remember"), Path: "/"})
+		http.Redirect(w, r, "/home", http.StatusSeeOther)
+	})
+	mux.HandleFunc("/home", func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie("user"); err == nil {
+			fmt.Fprintf(w, `<html><head><title>主页</title></head><body><p>欢迎 %s</p></body></html>`, cookie.Value)
+			return
+		}
+		fmt.Fprint(w, `<html><head><title>主页</title></head><body><p>未登录</p></body></html>`)
+	})
+	mux.HandleFunc("/to-secret", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/secret", http.StatusFound)
+	})
+	mux.HandleFunc("/secret", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><body><p>机密内容</p></body></html>`)
+	})
+	// "你好，世界" 的GBK编码
+	gbk := "\xc4\xe3\xba\xc3\xa3\xac\xca\xc0\xbd\xe7"
+	mux.HandleFunc("/gbk", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=gbk")
+		fmt.Fprintf(w, `<html><body><p>%s</p></body></html>`, gbk)
+	})
+	mux.HandleFunc("/gbk-meta", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<html><head><meta charset="gbk"></head><body><p>%s</p></body></html>`, gbk)
+	})
+	return httptest.NewServer(mux)
+}
+
+// newTestBrowser 创建一个会话的浏览器工具，权限策略禁止访问 /secret
+func newTestBrowser(t *testing.T) *BrowserUseTool {
+	t.Helper()
+	engine, err := policy.NewEngine(&config.PolicyConfig{
+		Enabled: true,
+		Rules: []config.PolicyRule{{
+			Name:     "no_secret",
+			Tool:     "browser_use",
+			Effect:   "deny",
+			Argument: "url",
+			Pattern:  "/secret$",
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tools := NewToolCollection()
+	tools.SetPolicy(engine)
+	return NewBrowserUseTool().ForSession(tools).(*BrowserUseTool)
+}
+
+// browse 执行浏览器操作并返回结果文本
+func browse(t *testing.T, b *BrowserUseTool, params map[string]interface{}) string {
+	t.Helper()
+	result, err := b.Execute(context.Background(), params)
+	if err != nil {
+		t.Fatalf("%v 失败: %v", params, err)
+	}
+	return fmt.Sprint(result)
+}
+
+func TestBrowserUseNavigation(t *testing.T) {
+	server := newBrowserTestServer()
+	defer server.Close()
+	b := newTestBrowser(t)
+
+	steps := []struct {
+		name   string
+		params map[string]interface{}
+		want   []string
+	}{
+		{
+			name:   "打开首页",
+			params: map[string]interface{}{"action": "navigate", "url": server.URL + "/"},
+			want:   []string{"标题: 首页", "链接: 2 个，表单: 1 个", "登录[1] 机密[2]"},
+		},
+		{
+			name:   "提交GET表单",
+			params: map[string]interface{}{"action": "submit_form", "form_id": float64(1), "fields": map[string]interface{}{"q": "go 语言", "go": "搜索"}},
+			want:   []string{"标题: 搜索结果", "地址: " + server.URL + "/search?", "搜索: go 语言，按钮: 搜索"},
+		},
+		{
+			name:   "返回首页",
+			params: map[string]interface{}{"action": "back"},
+			want:   []string{"标题: 首页", "地址: " + server.URL + "/"},
+		},
+		{
+			name:   "点击链接",
+			params: map[string]interface{}{"action": "click_link", "link_id": float64(1)},
+			want:   []string{"标题: 登录"},
+		},
+		{
+			name:   "提交POST表单后跟随重定向",
+			params: map[string]interface{}{"action": "submit_form", "form_id": float64(1), "fields": map[string]interface{}{"user": "alice"}},
+			want:   []string{"标题: 主页", "地址: " + server.URL + "/home", "欢迎 alice-yes"},
+		},
+		{
+			name:   "返回登录页",
+			params: map[string]interface{}{"action": "back"},
+			want:   []string{"标题: 登录"},
+		},
+		{
+			name:   "再次返回首页",
+			params: map[string]interface{}{"action": "back"},
+			want:   []string{"标题: 首页"},
+		},
+	}
+	for _, step := range steps {
+		result := browse(t, b, step.params)
+		for _, want := range step.want {
+			if !strings.Contains(result, want) {
+				t.Errorf("%s: 结果中没有 %q:\n%s", step.name, want, result)
+			}
+		}
+	}
+
+	if _, err := b.Execute(context.Background(), map[string]interface{}{"action": "back"}); err == nil {
+		t.Error("没有历史记录时返回应该出错")
+	}
+}
+
+func TestBrowserUsePolicy(t *testing.T) {
+	server := newBrowserTestServer()
+	defer server.Close()
+	b := newTestBrowser(t)
+
+	tests := []struct {
+		name   string
+		params map[string]interface{}
+	}{
+		{"点击被禁止的链接", map[string]interface{}{"action": "click_link", "link_id": float64(2)}},
+		{"重定向到被禁止的地址", map[string]interface{}{"action": "navigate", "url": server.URL + "/to-secret"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			browse(t, b, map[string]interface{}{"action": "navigate", "url": server.URL + "/"})
+			_, err := b.Execute(context.Background(), tt.params)
+			var denied *policy.DeniedError
+			if !errors.As(err, &denied) || denied.Rule != "no_secret" {
+				t.Fatalf("错误为 %v，期望被策略 no_secret 拒绝", err)
+			}
+			// 被拒绝的操作不改变当前页面
+			if text := browse(t, b, map[string]interface{}{"action": "get_text"}); !strings.Contains(text, "登录[1]") {
+				t.Errorf("被拒绝后当前页面发生了变化:\n%s", text)
+			}
+		})
+	}
+}
+
+func TestBrowserUseTabsHaveSeparateCookies(t *testing.T) {
+	server := newBrowserTestServer()
+	defer server.Close()
+	b := newTestBrowser(t)
+
+	browse(t, b, map[string]interface{}{"action": "navigate", "url": server.URL + "/login"})
+	browse(t, b, map[string]interface{}{"action": "submit_form", "form_id": float64(1), "fields": map[string]interface{}{"user": "bob", "remember": "false"}})
+
+	tests := []struct {
+		name   string
+		params map[string]interface{}
+		want   string
+	}{
+		{"新标签页没有登录", map[string]interface{}{"action": "new_tab", "tab_id": "other", "url": server.URL + "/home"}, "未登录"},
+		{"原标签页保持登录", map[string]interface{}{"action": "navigate", "url": server.URL + "/home"}, "欢迎 bob-"},
+		{"新标签页中的导航不影响原标签页", map[string]interface{}{"action": "navigate", "tab_id": "other", "url": server.URL + "/home"}, "未登录"},
+	}
+	for _, tt := range tests {
+		if result := browse(t, b, tt.params); !strings.Contains(result, tt.want) {
+			t.Errorf("%s: 结果中没有 %q:\n%s", tt.name, tt.want, result)
+		}
+	}
+}
+
+func TestBrowserUseDecodesCharset(t *testing.T) {
+	server := newBrowserTestServer()
+	defer server.Close()
+	b := newTestBrowser(t)
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{"Content-Type声明的字符集", "/gbk"},
+		{"页面meta声明的字符集", "/gbk-meta"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := browse(t, b, map[string]interface{}{"action": "navigate", "url": server.URL + tt.path})
+			if !strings.Contains(result, "你好，世界") {
+				t.Errorf("页面没有转换为UTF-8:\n%s", result)
+			}
+		})
+	}
+}
+
+func TestBrowserUseSessionCloseKeepsOtherSessions(t *testing.T) {
+	server := newBrowserTestServer()
+	defer server.Close()
+	root := NewBrowserUseTool()
+	first := root.ForSession(NewToolCollection()).(*BrowserUseTool)
+	second := root.ForSession(NewToolCollection()).(*BrowserUseTool)
+
+	browse(t, first, map[string]interface{}{"action": "navigate", "url": server.URL + "/home"})
+	browse(t, second, map[string]interface{}{"action": "navigate", "url": server.URL + "/home"})
+	if err := first.Close(); err != nil {
+		t.Fatalf("关闭会话的浏览器失败: %v", err)
+	}
+
+	if len(first.sessions) != 0 {
+		t.Errorf("关闭后仍有 %d 个标签页", len(first.sessions))
+	}
+	if result := browse(t, second, map[string]interface{}{"action": "list_tabs"}); !strings.Contains(result, "default") {
+		t.Errorf("其他会话的标签页被关闭了:\n%s", result)
+	}
+}
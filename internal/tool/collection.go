@@ -2,14 +2,33 @@ package tool
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"sort"
 	"sync"
+
+	"gomanus/internal/policy"
 )
 
 // ToolCollection 管理一组工具
+// 通过View创建的视图不复制工具，而是按过滤规则引用基础集合中的工具，
+// 视图中添加或移除工具不会修改基础集合，基础集合之后添加的工具也会出现在视图中
 type ToolCollection struct {
-	tools map[string]Tool
-	mu    sync.RWMutex
+	tools  map[string]Tool // 集合自己的工具，视图中与基础集合同名的工具会覆盖基础集合的工具
+	policy *policy.Engine  // 为nil时视图使用基础集合的权限策略
+	mu     sync.RWMutex
+
+	base  *ToolCollection // 视图的基础集合，为nil表示独立的集合
+	allow map[string]bool // 视图可以使用的基础集合工具，为nil表示不限制
+	deny  map[string]bool // 视图排除的基础集合工具，优先于allow
+}
+
+// ViewOptions 描述工具集合视图的过滤规则
+type ViewOptions struct {
+	Allow []string // 只使用基础集合中的这些工具，为nil表示使用全部工具
+	Deny  []string // 排除基础集合中的这些工具
+	Extra []Tool   // 只添加到视图中的工具，与基础集合中的工具同名时覆盖基础集合的工具
 }
 
 // NewToolCollection 创建新的工具集合
@@ -19,7 +38,29 @@ func NewToolCollection() *ToolCollection {
 	}
 }
 
-// AddTool 添加工具到集合
+// View 创建基于当前集合的视图，创建视图不复制基础集合中的工具，可以按代理或会话随时创建
+func (tc *ToolCollection) View(opts ViewOptions) *ToolCollection {
+	view := &ToolCollection{
+		tools: make(map[string]Tool, len(opts.Extra)),
+		base:  tc,
+		deny:  make(map[string]bool, len(opts.Deny)),
+	}
+	if opts.Allow != nil {
+		view.allow = make(map[string]bool, len(opts.Allow))
+		for _, name := range opts.Allow {
+			view.allow[name] = true
+		}
+	}
+	for _, name := range opts.Deny {
+		view.deny[name] = true
+	}
+	for _, tool := range opts.Extra {
+		view.tools[tool.Name()] = tool
+	}
+	return view
+}
+
+// AddTool 添加工具到集合，视图中添加的工具只属于视图
 func (tc *ToolCollection) AddTool(tool Tool) error {
 	tc.mu.Lock()
 	defer tc.mu.Unlock()
@@ -29,7 +70,7 @@ func (tc *ToolCollection) AddTool(tool Tool) error {
 		return fmt.Errorf("工具名称不能为空")
 	}
 
-	if _, exists := tc.tools[name]; exists {
+	if _, exists := tc.getLocked(name); exists {
 		return fmt.Errorf("工具 %s 已存在", name)
 	}
 
@@ -37,12 +78,29 @@ func (tc *ToolCollection) AddTool(tool Tool) error {
 	return nil
 }
 
+// SetPolicy 设置工具调用的权限策略，nil表示不做限制，视图中为nil时使用基础集合的策略
+func (tc *ToolCollection) SetPolicy(engine *policy.Engine) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	tc.policy = engine
+}
+
+// GetPolicy 获取工具调用的权限策略
+func (tc *ToolCollection) GetPolicy() *policy.Engine {
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+	if tc.policy == nil && tc.base != nil {
+		return tc.base.GetPolicy()
+	}
+	return tc.policy
+}
+
 // GetTool 根据名称获取工具
 func (tc *ToolCollection) GetTool(name string) (Tool, error) {
 	tc.mu.RLock()
 	defer tc.mu.RUnlock()
 
-	tool, exists := tc.tools[name]
+	tool, exists := tc.getLocked(name)
 	if !exists {
 		return nil, fmt.Errorf("工具 %s 不存在", name)
 	}
@@ -50,39 +108,144 @@ func (tc *ToolCollection) GetTool(name string) (Tool, error) {
 	return tool, nil
 }
 
-// RemoveTool 从集合中移除工具
+// RemoveTool 从集合中移除工具，视图中移除基础集合的工具只是在视图中隐藏该工具
 func (tc *ToolCollection) RemoveTool(name string) error {
 	tc.mu.Lock()
 	defer tc.mu.Unlock()
 
-	if _, exists := tc.tools[name]; !exists {
+	if _, exists := tc.tools[name]; exists {
+		delete(tc.tools, name)
+		// 视图中的工具覆盖了基础集合的同名工具时，同时隐藏基础集合的工具
+		if tc.base != nil {
+			if _, err := tc.base.GetTool(name); err == nil {
+				tc.deny[name] = true
+			}
+		}
+		return nil
+	}
+	if _, exists := tc.getLocked(name); !exists {
 		return fmt.Errorf("工具 %s 不存在", name)
 	}
 
-	delete(tc.tools, name)
+	tc.deny[name] = true
 	return nil
 }
 
-// GetAllTools 获取所有工具
-func (tc *ToolCollection) GetAllTools() []Tool {
-	tc.mu.RLock()
-	defer tc.mu.RUnlock()
+// Subset 创建只包含指定工具的视图，集合中不存在的工具会被忽略
+func (tc *ToolCollection) Subset(names []string) *ToolCollection {
+	if names == nil {
+		names = []string{}
+	}
+	return tc.View(ViewOptions{Allow: names})
+}
 
+// ForSession 创建供一个会话使用的视图，无状态的工具与原集合共享，
+// 实现了SessionScoped的工具在视图中替换为会话独立的实例
+func (tc *ToolCollection) ForSession() *ToolCollection {
+	session := tc.View(ViewOptions{})
+	for name, tool := range tc.snapshot() {
+		if scoped, ok := tool.(SessionScoped); ok {
+			session.tools[name] = scoped.ForSession(session)
+		}
+	}
+	return session
+}
+
+// Close 关闭集合自己的工具中实现了io.Closer的工具，视图不会关闭基础集合中的工具，
+// 因此关闭ForSession返回的视图只释放会话独立的工具
+func (tc *ToolCollection) Close() error {
+	tc.mu.RLock()
 	tools := make([]Tool, 0, len(tc.tools))
 	for _, tool := range tc.tools {
 		tools = append(tools, tool)
 	}
+	tc.mu.RUnlock()
 
-	return tools
+	var errs []error
+	for _, tool := range tools {
+		if closer, ok := tool.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("关闭工具 %s 失败: %w", tool.Name(), err))
+			}
+		}
+	}
+	return errors.Join(errs...)
 }
 
-// GetToolDefinitions 获取所有工具的定义，用于LLM
-func (tc *ToolCollection) GetToolDefinitions() []map[string]interface{} {
+// getLocked 查找工具，调用者需要持有tc.mu
+// 视图先查找自己的工具，再查找基础集合中未被过滤的工具
+func (tc *ToolCollection) getLocked(name string) (Tool, bool) {
+	if tool, exists := tc.tools[name]; exists {
+		return tool, true
+	}
+	if tc.base == nil || !tc.visibleLocked(name) {
+		return nil, false
+	}
+
+	tc.base.mu.RLock()
+	defer tc.base.mu.RUnlock()
+	return tc.base.getLocked(name)
+}
+
+// visibleLocked 检查基础集合中的工具是否可以在视图中使用，调用者需要持有tc.mu
+func (tc *ToolCollection) visibleLocked(name string) bool {
+	if tc.deny[name] {
+		return false
+	}
+	return tc.allow == nil || tc.allow[name]
+}
+
+// snapshot 返回集合中当前可以使用的全部工具
+func (tc *ToolCollection) snapshot() map[string]Tool {
 	tc.mu.RLock()
 	defer tc.mu.RUnlock()
 
-	definitions := make([]map[string]interface{}, 0, len(tc.tools))
-	for _, tool := range tc.tools {
+	tools := make(map[string]Tool, len(tc.tools))
+	if tc.base != nil {
+		for name, tool := range tc.base.snapshot() {
+			if tc.visibleLocked(name) {
+				tools[name] = tool
+			}
+		}
+	}
+	for name, tool := range tc.tools {
+		tools[name] = tool
+	}
+	return tools
+}
+
+// Count 返回集合中工具的数量
+func (tc *ToolCollection) Count() int {
+	return len(tc.snapshot())
+}
+
+// Names 返回集合中所有工具的名称，按名称排序
+func (tc *ToolCollection) Names() []string {
+	tools := tc.snapshot()
+	names := make([]string, 0, len(tools))
+	for name := range tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetAllTools 获取所有工具
+func (tc *ToolCollection) GetAllTools() []Tool {
+	all := tc.snapshot()
+	tools := make([]Tool, 0, len(all))
+	for _, tool := range all {
+		tools = append(tools, tool)
+	}
+
+	return tools
+}
+
+// GetToolDefinitions 获取所有工具的定义，用于LLM
+func (tc *ToolCollection) GetToolDefinitions() []map[string]interface{} {
+	tools := tc.snapshot()
+	definitions := make([]map[string]interface{}, 0, len(tools))
+	for _, tool := range tools {
 		// 基本定义
 		functionDef := map[string]interface{}{
 			"name":        tool.Name(),
@@ -112,11 +275,23 @@ func (tc *ToolCollection) GetToolDefinitions() []map[string]interface{} {
 	return definitions
 }
 
-// ExecuteTool 执行指定的工具
+// ExecuteTool 执行指定的工具，执行前先按参数定义校验参数，再检查权限策略
+// 参数不符合定义时返回*ValidationError
 func (tc *ToolCollection) ExecuteTool(ctx context.Context, name string, params map[string]interface{}) (interface{}, error) {
 	tool, err := tc.GetTool(name)
 	if err != nil {
 		return nil, err
 	}
+
+	params, err = ValidateParams(tool, params)
+	if err != nil {
+		return nil, err
+	}
+
+	// 检查权限策略，被拒绝时返回*policy.DeniedError
+	if err := tc.GetPolicy().Check(ctx, name, params); err != nil {
+		return nil, err
+	}
+
 	return tool.Execute(ctx, params)
 }
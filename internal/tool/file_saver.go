@@ -12,6 +12,7 @@ import (
 	"strings"
 
 	"gomanus/internal/llm"
+	"gomanus/internal/policy"
 	"gomanus/internal/schema"
 	"gomanus/pkg/logger"
 )
@@ -19,7 +20,52 @@ import (
 // FileOperator 是一个用于文件操作的工具，支持读取和保存
 type FileOperator struct {
 	*BaseTool
-	parameters map[string]interface{}
+	parameters  map[string]interface{}
+	allowedDirs []string // 允许读写的目录（绝对路径），为空表示不限制
+}
+
+// FileOperatorSettings 是 [tools.file_operator] 中的配置项
+type FileOperatorSettings struct {
+	AllowedDirs []string `mapstructure:"allowed_dirs"` // 允许读写的目录，相对路径相对于当前工作目录，留空表示不限制
+}
+
+// newFileOperatorFromSettings 根据配置项创建文件操作工具
+func newFileOperatorFromSettings(deps Dependencies, settings Settings) (Tool, error) {
+	var cfg FileOperatorSettings
+	if err := settings.Decode(&cfg); err != nil {
+		return nil, err
+	}
+
+	f := NewFileOperator()
+	for _, dir := range cfg.AllowedDirs {
+		absDir, err := policy.ResolvePath(dir)
+		if err != nil {
+			return nil, fmt.Errorf("allowed_dirs中的目录 %s 无效: %w", dir, err)
+		}
+		f.allowedDirs = append(f.allowedDirs, absDir)
+	}
+	return f, nil
+}
+
+// allowed 检查路径是否位于允许读写的目录之内，路径中的符号链接先被解析，不能通过链接访问目录之外的文件
+func (f *FileOperator) allowed(path string) bool {
+	if len(f.allowedDirs) == 0 {
+		return true
+	}
+	absPath, err := policy.ResolvePath(path)
+	if err != nil {
+		return false
+	}
+	for _, dir := range f.allowedDirs {
+		rel, err := filepath.Rel(dir, absPath)
+		if err != nil {
+			continue
+		}
+		if rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))) {
+			return true
+		}
+	}
+	return false
 }
 
 // NewFileOperator 创建新的文件操作工具
@@ -75,6 +121,27 @@ func (f *FileOperator) Parameters() map[string]interface{} {
 	return f.parameters
 }
 
+// ConcurrencySafe 返回false，文件写入依赖执行顺序，需要独占执行
+func (f *FileOperator) ConcurrencySafe() bool {
+	return false
+}
+
+// ConcurrencySafeFor 读取操作可以并发执行，写入和追加需要独占执行
+func (f *FileOperator) ConcurrencySafeFor(params map[string]interface{}) bool {
+	operation, _ := params["operation"].(string)
+	return operation == "read"
+}
+
+// Artifacts 返回写入操作保存的文件
+func (f *FileOperator) Artifacts(params map[string]interface{}) []string {
+	operation, _ := params["operation"].(string)
+	filePath, _ := params["file_path"].(string)
+	if operation != "write" || filePath == "" {
+		return nil
+	}
+	return []string{filePath}
+}
+
 // Execute 执行工具
 func (f *FileOperator) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
 	// 获取操作类型
@@ -88,6 +155,9 @@ func (f *FileOperator) Execute(ctx context.Context, params map[string]interface{
 	if !ok || filePath == "" {
 		return nil, fmt.Errorf("无效的文件路径参数")
 	}
+	if !f.allowed(filePath) {
+		return nil, fmt.Errorf("文件路径 %s 不在允许读写的目录中: %s", filePath, strings.Join(f.allowedDirs, ", "))
+	}
 	
 	// 根据操作类型执行不同的操作
 	if operation == "read" {
@@ -0,0 +1,57 @@
+package tool
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gomanus/internal/policy"
+)
+
+func TestFileOperatorAllowedResolvesSymlinks(t *testing.T) {
+	allowed := t.TempDir()
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(allowed, "escape")); err != nil {
+		t.Skipf("无法创建符号链接: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "missing.txt"), filepath.Join(allowed, "dangling.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(allowed, "inner"), filepath.Join(allowed, "inner-link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(allowed, "inner"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := policy.ResolvePath(allowed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := NewFileOperator()
+	f.allowedDirs = []string{dir}
+
+	tests := []struct {
+		name string
+		path string
+		want bool
+	}{
+		{"目录中的文件", filepath.Join(allowed, "a.txt"), true},
+		{"不存在的多级目录", filepath.Join(allowed, "new", "sub", "a.txt"), true},
+		{"指向目录内的链接", filepath.Join(allowed, "inner-link", "a.txt"), true},
+		{"相对路径越界", filepath.Join(allowed, "..", filepath.Base(outside), "secret.txt"), false},
+		{"通过链接读取目录外的文件", filepath.Join(allowed, "escape", "secret.txt"), false},
+		{"通过链接写入目录外的新文件", filepath.Join(allowed, "escape", "new", "a.txt"), false},
+		{"指向目录外的悬空链接", filepath.Join(allowed, "dangling.txt"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := f.allowed(tt.path); got != tt.want {
+				t.Errorf("allowed(%s) = %v，期望 %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
@@ -3,97 +3,132 @@ package tool
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"os"
+	"time"
 )
 
+// defaultGoogleSearchURL 是默认的SerpAPI搜索接口地址
+const defaultGoogleSearchURL = "https://serpapi.com/search.json"
+
 // GoogleSearch 是一个用于执行Google搜索的工具
 type GoogleSearch struct {
-	*BaseTool
-	parameters map[string]interface{}
+	*TypedTool[GoogleSearchArgs]
+	apiKey  string
+	baseURL string
+	client  *http.Client
+}
+
+// GoogleSearchSettings 是 [tools.google_search] 中的配置项
+type GoogleSearchSettings struct {
+	APIKey  string `mapstructure:"api_key"`  // SerpAPI的密钥，可以用 ${VAR} 引用环境变量
+	BaseURL string `mapstructure:"base_url"` // 搜索接口地址，默认为SerpAPI
+	Timeout int    `mapstructure:"timeout"`  // 请求的超时秒数，默认为30
+}
+
+// GoogleSearchArgs 是Google搜索工具的参数
+type GoogleSearchArgs struct {
+	Query      string `json:"query" description:"(必填) 提交给Google的搜索查询。" required:"true"`
+	NumResults int    `json:"num_results" description:"(可选) 返回的搜索结果数量。默认为10。" default:"10"`
 }
 
 // NewGoogleSearch 创建新的Google搜索工具
 func NewGoogleSearch() *GoogleSearch {
 	description := "执行Google搜索并返回相关链接列表。当需要查找网络信息、获取最新数据或研究特定主题时使用此工具。"
-	baseTool := NewBaseTool("google_search", description)
-	
-	// 定义参数
-	parameters := map[string]interface{}{
-		"type": "object",
-		"properties": map[string]interface{}{
-			"query": map[string]interface{}{
-				"type":        "string",
-				"description": "(必填) 提交给Google的搜索查询。",
-			},
-			"num_results": map[string]interface{}{
-				"type":        "integer",
-				"description": "(可选) 返回的搜索结果数量。默认为10。",
-				"default":     10,
-			},
-		},
-		"required": []string{"query"},
+	g := &GoogleSearch{
+		baseURL: defaultGoogleSearchURL,
+		client:  &http.Client{Timeout: 30 * time.Second},
 	}
-	
-	return &GoogleSearch{
-		BaseTool:   baseTool,
-		parameters: parameters,
+	g.TypedTool = NewTypedTool("google_search", description, g.search)
+	return g
+}
+
+// newGoogleSearchFromSettings 根据配置项创建Google搜索工具
+func newGoogleSearchFromSettings(deps Dependencies, settings Settings) (Tool, error) {
+	var cfg GoogleSearchSettings
+	if err := settings.Decode(&cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Timeout < 0 {
+		return nil, fmt.Errorf("timeout不能为负数")
+	}
+
+	g := NewGoogleSearch()
+	g.apiKey = os.ExpandEnv(cfg.APIKey)
+	if cfg.BaseURL != "" {
+		if _, err := url.ParseRequestURI(cfg.BaseURL); err != nil {
+			return nil, fmt.Errorf("base_url无效: %w", err)
+		}
+		g.baseURL = cfg.BaseURL
+	}
+	if cfg.Timeout > 0 {
+		g.client.Timeout = time.Duration(cfg.Timeout) * time.Second
 	}
+	return g, nil
 }
 
-// Parameters 返回工具参数定义
-func (g *GoogleSearch) Parameters() map[string]interface{} {
-	return g.parameters
+// ConcurrencySafe 返回true，搜索只读取外部数据，可以与其他工具调用并发执行
+func (g *GoogleSearch) ConcurrencySafe() bool {
+	return true
 }
 
-// Execute 执行工具
-func (g *GoogleSearch) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
-	// 获取查询参数
-	query, ok := params["query"].(string)
-	if !ok || query == "" {
+// ReadOnly 返回true，搜索不修改任何状态
+func (g *GoogleSearch) ReadOnly() bool {
+	return true
+}
+
+// search 执行搜索，结果数量限制在1到20之间
+func (g *GoogleSearch) search(ctx context.Context, args GoogleSearchArgs) (interface{}, error) {
+	if args.Query == "" {
 		return nil, fmt.Errorf("无效的查询参数")
 	}
-	
-	// 获取结果数量参数
-	numResults := 10
-	if numResultsParam, ok := params["num_results"]; ok {
-		if numResultsFloat, ok := numResultsParam.(float64); ok {
-			numResults = int(numResultsFloat)
-		}
-	}
-	
-	// 限制结果数量在合理范围内
+
+	numResults := args.NumResults
 	if numResults < 1 {
 		numResults = 1
 	} else if numResults > 20 {
 		numResults = 20
 	}
-	
-	// 执行搜索
-	results, err := g.performSearch(query, numResults)
+
+	results, err := g.performSearch(ctx, args.Query, numResults)
 	if err != nil {
 		return nil, fmt.Errorf("搜索失败: %v", err)
 	}
-	
+
 	return results, nil
 }
 
 // performSearch 执行实际的搜索操作
-func (g *GoogleSearch) performSearch(query string, numResults int) ([]string, error) {
+func (g *GoogleSearch) performSearch(ctx context.Context, query string, numResults int) ([]string, error) {
 	// 构建搜索URL
 	searchURL := fmt.Sprintf(
-		"https://serpapi.com/search.json?q=%s&num=%d&engine=google",
+		"%s?q=%s&num=%d&engine=google",
+		g.baseURL,
 		url.QueryEscape(query),
 		numResults,
 	)
+	if g.apiKey != "" {
+		searchURL += "&api_key=" + url.QueryEscape(g.apiKey)
+	}
 	
 	// 发送HTTP请求
-	resp, err := http.Get(searchURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, searchURL, nil)
 	if err != nil {
 		return nil, err
 	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		// url.Error中的地址包含密钥，只返回底层的错误
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return nil, urlErr.Err
+		}
+		return nil, err
+	}
 	defer resp.Body.Close()
 	
 	// 读取响应
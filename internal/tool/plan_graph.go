@@ -0,0 +1,122 @@
+package tool
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PlanStep 表示计划中的一个步骤及其依赖关系
+type PlanStep struct {
+	Index       int      `json:"index"`
+	ID          string   `json:"id"`
+	Description string   `json:"description"`
+	Status      string   `json:"status"`
+	Notes       string   `json:"notes,omitempty"`
+	DependsOn   []string `json:"depends_on,omitempty"`
+}
+
+// parseSteps 解析步骤参数，步骤可以是字符串，也可以是包含id、description和depends_on的对象
+// 字符串形式的步骤没有显式依赖，按顺序依赖前一个步骤，与旧的顺序执行方式保持一致
+func parseSteps(stepsParam []interface{}) ([]PlanStep, error) {
+	steps := make([]PlanStep, len(stepsParam))
+	for i, item := range stepsParam {
+		step := PlanStep{Index: i, Status: "not_started"}
+
+		switch v := item.(type) {
+		case string:
+			step.Description = v
+			if i > 0 {
+				step.DependsOn = []string{steps[i-1].ID}
+			}
+		case map[string]interface{}:
+			step.Description, _ = v["description"].(string)
+			step.ID, _ = v["id"].(string)
+			if deps, ok := v["depends_on"].([]interface{}); ok {
+				for _, dep := range deps {
+					depID, ok := dep.(string)
+					if !ok {
+						return nil, fmt.Errorf("步骤 %d 的依赖必须是步骤ID字符串", i+1)
+					}
+					step.DependsOn = append(step.DependsOn, depID)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("步骤必须是字符串或包含description的对象")
+		}
+
+		if strings.TrimSpace(step.Description) == "" {
+			return nil, fmt.Errorf("步骤 %d 缺少描述", i+1)
+		}
+		if step.ID == "" {
+			step.ID = fmt.Sprintf("s%d", i+1)
+		}
+		steps[i] = step
+	}
+
+	if err := validateSteps(steps); err != nil {
+		return nil, err
+	}
+	return steps, nil
+}
+
+// validateSteps 检查步骤ID唯一、依赖的步骤存在且依赖关系中没有循环
+func validateSteps(steps []PlanStep) error {
+	index := make(map[string]int, len(steps))
+	for i, step := range steps {
+		if _, exists := index[step.ID]; exists {
+			return fmt.Errorf("步骤ID '%s' 重复", step.ID)
+		}
+		index[step.ID] = i
+	}
+
+	for _, step := range steps {
+		for _, dep := range step.DependsOn {
+			if dep == step.ID {
+				return fmt.Errorf("步骤 '%s' 不能依赖自身", step.ID)
+			}
+			if _, exists := index[dep]; !exists {
+				return fmt.Errorf("步骤 '%s' 依赖的步骤 '%s' 不存在", step.ID, dep)
+			}
+		}
+	}
+
+	// 深度优先搜索检测循环，state: 0未访问 1访问中 2已完成
+	state := make(map[string]int, len(steps))
+	var path []string
+	var visit func(id string) error
+	visit = func(id string) error {
+		switch state[id] {
+		case 1:
+			// 从路径中找出循环的起点
+			start := 0
+			for i, p := range path {
+				if p == id {
+					start = i
+					break
+				}
+			}
+			cycle := append(append([]string(nil), path[start:]...), id)
+			return fmt.Errorf("计划步骤存在循环依赖: %s", strings.Join(cycle, " -> "))
+		case 2:
+			return nil
+		}
+
+		state[id] = 1
+		path = append(path, id)
+		for _, dep := range steps[index[id]].DependsOn {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[id] = 2
+		return nil
+	}
+
+	for _, step := range steps {
+		if err := visit(step.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
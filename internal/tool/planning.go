@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -13,6 +14,7 @@ type PlanningTool struct {
 	parameters map[string]interface{}
 	plans      map[string]map[string]interface{} // 存储计划的数据
 	activePlan string                            // 当前活动计划的ID
+	mu         sync.RWMutex                      // 保护plans和activePlan，计划步骤并行执行时会同时读写
 }
 
 // NewPlanningTool 创建新的规划工具
@@ -39,24 +41,56 @@ func NewPlanningTool() *PlanningTool {
 			},
 			"steps": map[string]interface{}{
 				"type":        "array",
-				"description": "计划步骤列表。对于create命令是必需的，对于update命令是可选的。",
+				"description": "计划步骤列表。对于create命令是必需的，对于update命令是可选的。没有依赖关系的步骤会被并行执行。",
 				"items": map[string]interface{}{
-					"type": "string",
+					// 步骤可以是描述字符串（依赖上一个步骤），也可以是包含依赖关系的对象
+					"anyOf": []interface{}{
+						map[string]interface{}{"type": "string"},
+						map[string]interface{}{
+							"type": "object",
+							"properties": map[string]interface{}{
+								"id": map[string]interface{}{
+									"type":        "string",
+									"description": "步骤的唯一标识，例如s1、s2，留空时按顺序生成。",
+								},
+								"description": map[string]interface{}{
+									"type":        "string",
+									"description": "步骤的具体内容。",
+								},
+								"depends_on": map[string]interface{}{
+									"type":        "array",
+									"description": "此步骤依赖的步骤ID列表，依赖的步骤全部完成后才会执行此步骤。",
+									"items": map[string]interface{}{
+										"type": "string",
+									},
+								},
+							},
+							"required": []string{"description"},
+						},
+					},
 				},
 			},
 			"step_index": map[string]interface{}{
 				"type":        "integer",
-				"description": "要更新的步骤索引（从0开始）。对于mark_step命令是必需的。",
+				"description": "要更新的步骤索引（从0开始）。对于mark_step命令，需要提供step_index或step_id。",
+			},
+			"step_id": map[string]interface{}{
+				"type":        "string",
+				"description": "要更新的步骤ID。对于mark_step命令，可以代替step_index使用。",
 			},
 			"step_status": map[string]interface{}{
 				"type":        "string",
-				"description": "为步骤设置的状态。与mark_step命令一起使用。",
-				"enum":        []string{"not_started", "in_progress", "completed", "blocked"},
+				"description": "为步骤设置的状态。与mark_step命令一起使用。不再需要的步骤可以标记为skipped。",
+				"enum":        []string{"not_started", "in_progress", "completed", "blocked", "skipped"},
 			},
 			"step_notes": map[string]interface{}{
 				"type":        "string",
 				"description": "步骤的附加说明。对于mark_step命令是可选的。",
 			},
+			"reason": map[string]interface{}{
+				"type":        "string",
+				"description": "修改计划的原因。对于update命令是可选的，会记录在计划的修订历史中。",
+			},
 		},
 		"required": []string{"command"},
 	}
@@ -73,6 +107,11 @@ func (p *PlanningTool) Parameters() map[string]interface{} {
 	return p.parameters
 }
 
+// ConcurrencySafe 返回false，计划状态的修改依赖执行顺序，需要独占执行
+func (p *PlanningTool) ConcurrencySafe() bool {
+	return false
+}
+
 // Execute 执行工具
 func (p *PlanningTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
 	// 获取命令参数
@@ -81,6 +120,9 @@ func (p *PlanningTool) Execute(ctx context.Context, params map[string]interface{
 		return nil, fmt.Errorf("无效的命令参数")
 	}
 
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
 	// 根据命令执行相应的操作
 	switch command {
 	case "create":
@@ -132,36 +174,18 @@ func (p *PlanningTool) createPlan(params map[string]interface{}) (interface{}, e
 		return nil, fmt.Errorf("创建计划需要步骤列表")
 	}
 
-	// 转换步骤为字符串数组
-	steps := make([]string, len(stepsParam))
-	for i, step := range stepsParam {
-		stepStr, ok := step.(string)
-		if !ok {
-			return nil, fmt.Errorf("步骤必须是字符串")
-		}
-		steps[i] = stepStr
+	// 解析步骤并检查依赖关系
+	steps, err := parseSteps(stepsParam)
+	if err != nil {
+		return nil, err
 	}
 
-	// 创建计划
+	// 创建计划，所有步骤状态初始化为"not_started"
 	plan := map[string]interface{}{
-		"plan_id":       planID,
-		"title":         title,
-		"steps":         steps,
-		"step_statuses": make([]string, len(steps)),
-		"step_notes":    make([]string, len(steps)),
-	}
-
-	// 初始化所有步骤状态为"not_started"
-	statuses := plan["step_statuses"].([]string)
-	for i := range statuses {
-		statuses[i] = "not_started"
-	}
-
-	// 初始化所有步骤说明为空字符串
-	notes := plan["step_notes"].([]string)
-	for i := range notes {
-		notes[i] = ""
+		"plan_id": planID,
+		"title":   title,
 	}
+	storeSteps(plan, steps)
 
 	// 保存计划
 	p.plans[planID] = plan
@@ -191,40 +215,40 @@ func (p *PlanningTool) updatePlan(params map[string]interface{}) (interface{}, e
 
 	// 更新步骤（如果提供）
 	if stepsParam, ok := params["steps"].([]interface{}); ok && len(stepsParam) > 0 {
-		// 转换步骤为字符串数组
-		steps := make([]string, len(stepsParam))
-		for i, step := range stepsParam {
-			stepStr, ok := step.(string)
-			if !ok {
-				return nil, fmt.Errorf("步骤必须是字符串")
-			}
-			steps[i] = stepStr
+		steps, err := parseSteps(stepsParam)
+		if err != nil {
+			return nil, err
 		}
 
-		// 保存旧步骤和状态
-		oldSteps := plan["steps"].([]string)
-		oldStatuses := plan["step_statuses"].([]string)
-		oldNotes := plan["step_notes"].([]string)
-
-		// 创建新状态和说明数组
-		newStatuses := make([]string, len(steps))
-		newNotes := make([]string, len(steps))
-
-		// 对于相同位置的相同步骤，保留原状态和说明
+		// 按步骤ID匹配：ID和内容都相同且已经完成或跳过的步骤保留原状态和说明，
+		// 其他步骤（包括被阻塞后保留的步骤）重新开始执行
+		previous := planSteps(plan)
+		oldSteps := make(map[string]PlanStep, len(previous))
+		for _, step := range previous {
+			oldSteps[step.ID] = step
+		}
 		for i, step := range steps {
-			if i < len(oldSteps) && step == oldSteps[i] {
-				newStatuses[i] = oldStatuses[i]
-				newNotes[i] = oldNotes[i]
-			} else {
-				newStatuses[i] = "not_started"
-				newNotes[i] = ""
+			old, exists := oldSteps[step.ID]
+			if !exists || old.Description != step.Description {
+				continue
+			}
+			if old.Status == "completed" || old.Status == "skipped" {
+				steps[i].Status = old.Status
+				steps[i].Notes = old.Notes
 			}
 		}
 
-		// 更新计划
-		plan["steps"] = steps
-		plan["step_statuses"] = newStatuses
-		plan["step_notes"] = newNotes
+		// 在修订历史中记录修改前的步骤
+		reason, _ := params["reason"].(string)
+		revisions, _ := plan["revisions"].([]PlanRevision)
+		plan["revisions"] = append(revisions, PlanRevision{
+			Version: len(revisions) + 1,
+			Reason:  reason,
+			Time:    time.Now(),
+			Steps:   previous,
+		})
+
+		storeSteps(plan, steps)
 	}
 
 	return p.formatPlan(plan), nil
@@ -306,15 +330,31 @@ func (p *PlanningTool) markStep(params map[string]interface{}) (interface{}, err
 		return nil, fmt.Errorf("计划ID '%s' 不存在", planID)
 	}
 
-	// 获取步骤索引
-	stepIndexFloat, ok := params["step_index"].(float64)
-	if !ok {
-		return nil, fmt.Errorf("标记步骤需要步骤索引")
+	// 获取步骤索引，也可以通过步骤ID指定
+	steps := plan["steps"].([]string)
+	stepIndex := -1
+	switch v := params["step_index"].(type) {
+	case float64:
+		stepIndex = int(v)
+	case int:
+		stepIndex = v
+	default:
+		stepID, _ := params["step_id"].(string)
+		if stepID == "" {
+			return nil, fmt.Errorf("标记步骤需要步骤索引或步骤ID")
+		}
+		for i, id := range plan["step_ids"].([]string) {
+			if id == stepID {
+				stepIndex = i
+				break
+			}
+		}
+		if stepIndex < 0 {
+			return nil, fmt.Errorf("步骤ID '%s' 不存在", stepID)
+		}
 	}
-	stepIndex := int(stepIndexFloat)
 
 	// 检查步骤索引是否有效
-	steps := plan["steps"].([]string)
 	if stepIndex < 0 || stepIndex >= len(steps) {
 		return nil, fmt.Errorf("步骤索引 %d 超出范围 (0-%d)", stepIndex, len(steps)-1)
 	}
@@ -326,7 +366,7 @@ func (p *PlanningTool) markStep(params map[string]interface{}) (interface{}, err
 	}
 
 	// 验证步骤状态
-	validStatuses := []string{"not_started", "in_progress", "completed", "blocked"}
+	validStatuses := []string{"not_started", "in_progress", "completed", "blocked", "skipped"}
 	isValidStatus := false
 	for _, status := range validStatuses {
 		if stepStatus == status {
@@ -382,11 +422,13 @@ func (p *PlanningTool) formatPlan(plan map[string]interface{}) string {
 	steps := plan["steps"].([]string)
 	statuses := plan["step_statuses"].([]string)
 	notes := plan["step_notes"].([]string)
+	ids := plan["step_ids"].([]string)
+	dependencies := plan["step_dependencies"].([][]string)
 
-	// 计算完成步骤数
+	// 计算完成步骤数，跳过的步骤也视为已处理
 	completed := 0
 	for _, status := range statuses {
-		if status == "completed" {
+		if status == "completed" || status == "skipped" {
 			completed++
 		}
 	}
@@ -403,6 +445,7 @@ func (p *PlanningTool) formatPlan(plan map[string]interface{}) string {
 		"in_progress": 0,
 		"blocked":     0,
 		"not_started": 0,
+		"skipped":     0,
 	}
 	for _, status := range statuses {
 		statusCounts[status]++
@@ -413,9 +456,14 @@ func (p *PlanningTool) formatPlan(plan map[string]interface{}) string {
 	result += strings.Repeat("=", len(result)) + "\n\n"
 
 	result += fmt.Sprintf("进度: %d/%d 步骤已完成 (%.1f%%)\n", completed, len(steps), progress)
-	result += fmt.Sprintf("状态: %d 已完成, %d 进行中, %d 已阻塞, %d 未开始\n\n",
+	result += fmt.Sprintf("状态: %d 已完成, %d 进行中, %d 已阻塞, %d 未开始, %d 已跳过\n",
 		statusCounts["completed"], statusCounts["in_progress"],
-		statusCounts["blocked"], statusCounts["not_started"])
+		statusCounts["blocked"], statusCounts["not_started"], statusCounts["skipped"])
+	if revisions, _ := plan["revisions"].([]PlanRevision); len(revisions) > 0 {
+		last := revisions[len(revisions)-1]
+		result += fmt.Sprintf("修订: 已修改 %d 次，最近一次原因: %s\n", len(revisions), last.Reason)
+	}
+	result += "\n"
 
 	result += "步骤:\n"
 	for i, step := range steps {
@@ -427,11 +475,17 @@ func (p *PlanningTool) formatPlan(plan map[string]interface{}) string {
 			statusMark = "[→]"
 		case "blocked":
 			statusMark = "[!]"
+		case "skipped":
+			statusMark = "[-]"
 		default: // not_started
 			statusMark = "[ ]"
 		}
 
-		result += fmt.Sprintf("%d. %s %s\n", i+1, statusMark, step)
+		result += fmt.Sprintf("%d. %s %s: %s", i+1, statusMark, ids[i], step)
+		if len(dependencies[i]) > 0 {
+			result += fmt.Sprintf(" (依赖: %s)", strings.Join(dependencies[i], ", "))
+		}
+		result += "\n"
 		if notes[i] != "" {
 			result += fmt.Sprintf("   备注: %s\n", notes[i])
 		}
@@ -440,6 +494,145 @@ func (p *PlanningTool) formatPlan(plan map[string]interface{}) string {
 	return result
 }
 
+// storeSteps 将步骤写入计划数据
+func storeSteps(plan map[string]interface{}, steps []PlanStep) {
+	descriptions := make([]string, len(steps))
+	statuses := make([]string, len(steps))
+	notes := make([]string, len(steps))
+	ids := make([]string, len(steps))
+	dependencies := make([][]string, len(steps))
+	for i, step := range steps {
+		descriptions[i] = step.Description
+		statuses[i] = step.Status
+		notes[i] = step.Notes
+		ids[i] = step.ID
+		dependencies[i] = append([]string(nil), step.DependsOn...)
+	}
+
+	plan["steps"] = descriptions
+	plan["step_statuses"] = statuses
+	plan["step_notes"] = notes
+	plan["step_ids"] = ids
+	plan["step_dependencies"] = dependencies
+}
+
+// planSteps 从计划数据中读取步骤
+func planSteps(plan map[string]interface{}) []PlanStep {
+	descriptions := plan["steps"].([]string)
+	statuses := plan["step_statuses"].([]string)
+	notes := plan["step_notes"].([]string)
+	ids := plan["step_ids"].([]string)
+	dependencies := plan["step_dependencies"].([][]string)
+
+	steps := make([]PlanStep, len(descriptions))
+	for i := range descriptions {
+		steps[i] = PlanStep{
+			Index:       i,
+			ID:          ids[i],
+			Description: descriptions[i],
+			Status:      statuses[i],
+			Notes:       notes[i],
+			DependsOn:   append([]string(nil), dependencies[i]...),
+		}
+	}
+	return steps
+}
+
+// PlanRevision 表示计划的一次修订，记录修订原因和修订前的步骤
+type PlanRevision struct {
+	Version int        `json:"version"`
+	Reason  string     `json:"reason,omitempty"`
+	Time    time.Time  `json:"time"`
+	Steps   []PlanStep `json:"steps"`
+}
+
+// GetRevisions 返回指定计划的修订历史
+func (p *PlanningTool) GetRevisions(planID string) ([]PlanRevision, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	plan, exists := p.plans[planID]
+	if !exists {
+		return nil, fmt.Errorf("计划ID '%s' 不存在", planID)
+	}
+	revisions, _ := plan["revisions"].([]PlanRevision)
+	return append([]PlanRevision(nil), revisions...), nil
+}
+
+// GetSteps 返回指定计划的步骤及其状态和依赖关系
+func (p *PlanningTool) GetSteps(planID string) ([]PlanStep, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	plan, exists := p.plans[planID]
+	if !exists {
+		return nil, fmt.Errorf("计划ID '%s' 不存在", planID)
+	}
+	return planSteps(plan), nil
+}
+
+// PlanSnapshot 表示计划的可序列化快照，用于检查点
+type PlanSnapshot struct {
+	PlanID           string         `json:"plan_id"`
+	Title            string         `json:"title"`
+	Steps            []string       `json:"steps"`
+	StepStatuses     []string       `json:"step_statuses"`
+	StepNotes        []string       `json:"step_notes"`
+	StepIDs          []string       `json:"step_ids,omitempty"`
+	StepDependencies [][]string     `json:"step_dependencies,omitempty"`
+	Revisions        []PlanRevision `json:"revisions,omitempty"`
+}
+
+// ExportPlan 导出指定计划的快照
+func (p *PlanningTool) ExportPlan(planID string) (*PlanSnapshot, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	plan, exists := p.plans[planID]
+	if !exists {
+		return nil, fmt.Errorf("计划ID '%s' 不存在", planID)
+	}
+
+	revisions, _ := plan["revisions"].([]PlanRevision)
+	return &PlanSnapshot{
+		PlanID:           plan["plan_id"].(string),
+		Title:            plan["title"].(string),
+		Steps:            append([]string(nil), plan["steps"].([]string)...),
+		StepStatuses:     append([]string(nil), plan["step_statuses"].([]string)...),
+		StepNotes:        append([]string(nil), plan["step_notes"].([]string)...),
+		StepIDs:          append([]string(nil), plan["step_ids"].([]string)...),
+		StepDependencies: append([][]string(nil), plan["step_dependencies"].([][]string)...),
+		Revisions:        revisions,
+	}, nil
+}
+
+// ImportPlan 从快照恢复计划，并将其设置为活动计划
+func (p *PlanningTool) ImportPlan(snapshot *PlanSnapshot) error {
+	if snapshot == nil || snapshot.PlanID == "" {
+		return fmt.Errorf("无效的计划快照")
+	}
+	count := len(snapshot.Steps)
+	if len(snapshot.StepStatuses) != count || len(snapshot.StepNotes) != count ||
+		len(snapshot.StepIDs) != count || len(snapshot.StepDependencies) != count {
+		return fmt.Errorf("计划快照 '%s' 的步骤数据不一致", snapshot.PlanID)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.plans[snapshot.PlanID] = map[string]interface{}{
+		"plan_id":           snapshot.PlanID,
+		"title":             snapshot.Title,
+		"steps":             append([]string(nil), snapshot.Steps...),
+		"step_statuses":     append([]string(nil), snapshot.StepStatuses...),
+		"step_notes":        append([]string(nil), snapshot.StepNotes...),
+		"step_ids":          append([]string(nil), snapshot.StepIDs...),
+		"step_dependencies": append([][]string(nil), snapshot.StepDependencies...),
+		"revisions":         append([]PlanRevision(nil), snapshot.Revisions...),
+	}
+	p.activePlan = snapshot.PlanID
+	return nil
+}
+
 // GetToolDefinition 返回工具定义
 func (p *PlanningTool) GetToolDefinition() map[string]interface{} {
 	return map[string]interface{}{
@@ -0,0 +1,232 @@
+package tool
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"gomanus/pkg/logger"
+)
+
+// PluginManifestFile 是插件目录中描述插件的清单文件名
+const PluginManifestFile = "plugin.json"
+
+// 插件输出的大小限制，超出标准错误限制的部分会被丢弃
+const (
+	maxPluginOutput = 1024 * 1024
+	maxPluginStderr = 4 * 1024
+)
+
+// pluginNamePattern 是插件工具名称允许的格式，与模型接口的函数名称要求一致
+var pluginNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// PluginManifest 描述一个外部可执行插件
+type PluginManifest struct {
+	Name            string                 `json:"name"`             // 工具名称
+	Description     string                 `json:"description"`      // 工具描述
+	Command         string                 `json:"command"`          // 可执行文件，相对路径相对于插件目录
+	Args            []string               `json:"args"`             // 命令行参数
+	Env             []string               `json:"env"`              // 额外的环境变量，格式为 KEY=VALUE
+	Parameters      map[string]interface{} `json:"parameters"`       // 参数的JSON Schema，调用前按它校验参数
+	Timeout         int                    `json:"timeout"`          // 单次调用的超时秒数，0表示使用默认值
+	ConcurrencySafe bool                   `json:"concurrency_safe"` // 是否可以与其他工具调用并发执行
+	ReadOnly        bool                   `json:"read_only"`        // 是否只读，通过MCP对外提供时作为readOnlyHint
+}
+
+// LoadPluginManifest 读取并检查插件目录中的清单
+func LoadPluginManifest(dir string) (*PluginManifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, PluginManifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("读取插件清单失败: %w", err)
+	}
+	return parsePluginManifest(data)
+}
+
+// parsePluginManifest 解析并检查插件清单的内容
+func parsePluginManifest(data []byte) (*PluginManifest, error) {
+	var manifest PluginManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("解析插件清单失败: %w", err)
+	}
+	if !pluginNamePattern.MatchString(manifest.Name) {
+		return nil, fmt.Errorf("插件名称 '%s' 无效，只能包含字母、数字、下划线和连字符，且不超过64个字符", manifest.Name)
+	}
+	if strings.TrimSpace(manifest.Description) == "" {
+		return nil, fmt.Errorf("插件 %s 缺少description", manifest.Name)
+	}
+	if manifest.Command == "" {
+		return nil, fmt.Errorf("插件 %s 缺少command", manifest.Name)
+	}
+	if manifest.Parameters == nil {
+		manifest.Parameters = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+	} else if schemaType, _ := manifest.Parameters["type"].(string); schemaType != "object" {
+		return nil, fmt.Errorf("插件 %s 的parameters必须是type为object的JSON Schema", manifest.Name)
+	}
+	if manifest.Timeout < 0 {
+		return nil, fmt.Errorf("插件 %s 的timeout不能为负数", manifest.Name)
+	}
+	return &manifest, nil
+}
+
+// PluginTool 把外部可执行插件包装为工具：参数以JSON写入插件的标准输入，
+// 插件把JSON结果写入标准输出，{"error": "..."} 表示执行失败，{"result": ...} 中的值作为工具结果
+type PluginTool struct {
+	*BaseTool
+	manifest *PluginManifest
+	dir      string
+	timeout  time.Duration
+}
+
+// NewPluginTool 创建插件工具，dir是插件目录，defaultTimeout在清单没有声明超时时间时使用
+func NewPluginTool(dir string, manifest *PluginManifest, defaultTimeout time.Duration) *PluginTool {
+	timeout := defaultTimeout
+	if manifest.Timeout > 0 {
+		timeout = time.Duration(manifest.Timeout) * time.Second
+	}
+	return &PluginTool{
+		BaseTool: NewBaseTool(manifest.Name, manifest.Description),
+		manifest: manifest,
+		dir:      dir,
+		timeout:  timeout,
+	}
+}
+
+// Parameters 返回清单中声明的参数定义
+func (t *PluginTool) Parameters() map[string]interface{} {
+	return t.manifest.Parameters
+}
+
+// ConcurrencySafe 返回清单中声明的并发安全性
+func (t *PluginTool) ConcurrencySafe() bool {
+	return t.manifest.ConcurrencySafe
+}
+
+// ReadOnly 返回清单中声明的只读性
+func (t *PluginTool) ReadOnly() bool {
+	return t.manifest.ReadOnly
+}
+
+// Dir 返回插件目录
+func (t *PluginTool) Dir() string {
+	return t.dir
+}
+
+// Execute 启动插件进程，写入参数并解析插件的输出
+func (t *PluginTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	input, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("编码插件参数失败: %w", err)
+	}
+
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctxWithTimeout, t.commandPath(), t.manifest.Args...)
+	cmd.Dir = t.dir
+	cmd.Env = append(os.Environ(), t.manifest.Env...)
+	cmd.Env = append(cmd.Env, "GOMANUS_PLUGIN_DIR="+t.dir)
+	if workDir, err := os.Getwd(); err == nil {
+		cmd.Env = append(cmd.Env, "GOMANUS_WORKDIR="+workDir)
+	}
+	cmd.Stdin = bytes.NewReader(input)
+	stdout := &cappedBuffer{limit: maxPluginOutput}
+	stderr := &cappedBuffer{limit: maxPluginStderr}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	setProcessGroup(cmd)
+	cmd.WaitDelay = 2 * time.Second
+
+	runErr := cmd.Run()
+	if errors.Is(ctxWithTimeout.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+		return nil, fmt.Errorf("插件 %s 执行超时 (%v)%s", t.Name(), t.timeout, stderr.suffix())
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if runErr != nil {
+		return nil, fmt.Errorf("插件 %s 执行失败: %w%s", t.Name(), runErr, stderr.suffix())
+	}
+	if stdout.truncated {
+		return nil, fmt.Errorf("插件 %s 的输出超过 %d 字节", t.Name(), maxPluginOutput)
+	}
+	if text := strings.TrimSpace(stderr.String()); text != "" {
+		logger.Debug("插件 %s 的标准错误: %s", t.Name(), text)
+	}
+	return t.parseOutput(stdout.Bytes(), stderr)
+}
+
+// commandPath 返回插件的可执行文件路径，包含路径分隔符或位于插件目录中的命令相对于插件目录，其他命令从PATH中查找
+func (t *PluginTool) commandPath() string {
+	command := t.manifest.Command
+	if filepath.IsAbs(command) {
+		return command
+	}
+	if strings.ContainsRune(command, '/') || strings.ContainsRune(command, filepath.Separator) {
+		return filepath.Join(t.dir, command)
+	}
+	if _, err := os.Stat(filepath.Join(t.dir, command)); err == nil {
+		return filepath.Join(t.dir, command)
+	}
+	return command
+}
+
+// parseOutput 解析插件写入标准输出的JSON结果
+func (t *PluginTool) parseOutput(output []byte, stderr *cappedBuffer) (interface{}, error) {
+	output = bytes.TrimSpace(output)
+	if len(output) == 0 {
+		return nil, fmt.Errorf("插件 %s 没有输出结果%s", t.Name(), stderr.suffix())
+	}
+
+	var result interface{}
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("插件 %s 的输出不是有效的JSON: %w%s", t.Name(), err, stderr.suffix())
+	}
+	if object, ok := result.(map[string]interface{}); ok {
+		if message, exists := object["error"]; exists && message != nil && message != "" {
+			return nil, fmt.Errorf("插件 %s 返回错误: %v", t.Name(), message)
+		}
+		if value, exists := object["result"]; exists {
+			return value, nil
+		}
+	}
+	return result, nil
+}
+
+// cappedBuffer 只保存前limit个字节的输出，超出的部分被丢弃，不会让子进程因为写入失败而退出
+type cappedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+// Write 实现io.Writer接口
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if remaining := b.limit - b.Len(); remaining < len(p) {
+		b.truncated = true
+		if remaining > 0 {
+			b.Buffer.Write(p[:remaining])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// suffix 返回附加到错误信息后的标准错误输出
+func (b *cappedBuffer) suffix() string {
+	text := strings.TrimSpace(b.String())
+	if text == "" {
+		return ""
+	}
+	return "\n标准错误: " + text
+}
@@ -0,0 +1,216 @@
+package tool
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"gomanus/pkg/logger"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// pluginReloadDelay 是插件目录变化后等待的时间，合并复制文件等操作产生的多个事件
+const pluginReloadDelay = 500 * time.Millisecond
+
+// loadedPlugin 记录已注册的插件，清单内容不变时重新扫描不会替换工具
+type loadedPlugin struct {
+	name     string
+	manifest []byte
+}
+
+// PluginManager 扫描插件目录，把每个包含清单的子目录注册为工具集合中的工具
+// 插件目录变化时重新扫描，新增、修改和删除的插件会同步到工具集合，基于该集合的视图随之更新
+type PluginManager struct {
+	dir            string
+	tools          *ToolCollection
+	defaultTimeout time.Duration
+
+	mu      sync.Mutex
+	loaded  map[string]loadedPlugin // 插件目录 -> 已注册的插件
+	skipped map[string][]byte       // 插件目录 -> 无法注册的清单，清单不变时不再重复警告
+}
+
+// NewPluginManager 创建插件管理器，插件注册到tools中
+func NewPluginManager(dir string, tools *ToolCollection, defaultTimeout time.Duration) (*PluginManager, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("解析插件目录失败: %w", err)
+	}
+	return &PluginManager{
+		dir:            absDir,
+		tools:          tools,
+		defaultTimeout: defaultTimeout,
+		loaded:         make(map[string]loadedPlugin),
+		skipped:        make(map[string][]byte),
+	}, nil
+}
+
+// Dir 返回插件目录的绝对路径
+func (m *PluginManager) Dir() string {
+	return m.dir
+}
+
+// Names 返回已注册的插件工具名称
+func (m *PluginManager) Names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.loaded))
+	for _, plugin := range m.loaded {
+		names = append(names, plugin.name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Load 扫描插件目录并同步工具集合，无效的插件会被跳过并记录警告
+func (m *PluginManager) Load() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries, err := os.ReadDir(m.dir)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("读取插件目录失败: %w", err)
+	}
+
+	found := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		pluginDir := filepath.Join(m.dir, entry.Name())
+		data, err := os.ReadFile(filepath.Join(pluginDir, PluginManifestFile))
+		if err != nil {
+			continue
+		}
+		found[pluginDir] = true
+
+		previous, exists := m.loaded[pluginDir]
+		if exists && bytes.Equal(previous.manifest, data) {
+			continue
+		}
+		if skipped, ok := m.skipped[pluginDir]; ok && bytes.Equal(skipped, data) {
+			continue
+		}
+		if exists {
+			m.unregisterLocked(pluginDir)
+		}
+		m.registerLocked(pluginDir, data)
+	}
+
+	for pluginDir := range m.loaded {
+		if !found[pluginDir] {
+			m.unregisterLocked(pluginDir)
+		}
+	}
+	for pluginDir := range m.skipped {
+		if !found[pluginDir] {
+			delete(m.skipped, pluginDir)
+		}
+	}
+	return nil
+}
+
+// registerLocked 加载插件清单并注册工具，调用前需要持有锁
+func (m *PluginManager) registerLocked(pluginDir string, data []byte) {
+	delete(m.skipped, pluginDir)
+	manifest, err := parsePluginManifest(data)
+	if err == nil {
+		err = m.tools.AddTool(NewPluginTool(pluginDir, manifest, m.defaultTimeout))
+	}
+	if err != nil {
+		logger.Warn("跳过插件 %s: %v", filepath.Base(pluginDir), err)
+		m.skipped[pluginDir] = data
+		return
+	}
+	m.loaded[pluginDir] = loadedPlugin{name: manifest.Name, manifest: data}
+	logger.Info("已加载插件工具 %s (%s)", manifest.Name, pluginDir)
+}
+
+// unregisterLocked 从工具集合中移除插件，调用前需要持有锁
+func (m *PluginManager) unregisterLocked(pluginDir string) {
+	plugin := m.loaded[pluginDir]
+	delete(m.loaded, pluginDir)
+	// 只移除由该插件注册的工具，避免误删同名的其他工具
+	if current, err := m.tools.GetTool(plugin.name); err == nil {
+		if pluginTool, ok := current.(*PluginTool); ok && pluginTool.Dir() == pluginDir {
+			m.tools.RemoveTool(plugin.name)
+			logger.Info("已卸载插件工具 %s", plugin.name)
+		}
+	}
+}
+
+// Watch 监视插件目录，目录或插件清单变化时重新加载插件，直到ctx被取消
+func (m *PluginManager) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("创建插件目录监视器失败: %w", err)
+	}
+	defer watcher.Close()
+
+	// fsnotify不会递归监视，插件目录和每个插件的子目录需要分别添加
+	if err := watcher.Add(m.dir); err != nil {
+		return fmt.Errorf("监视插件目录失败: %w", err)
+	}
+	m.watchPluginDirs(watcher)
+
+	var reload <-chan time.Time
+	var timer *time.Timer
+	for {
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			logger.Debug("插件目录变化: %s", event)
+			if timer == nil {
+				timer = time.NewTimer(pluginReloadDelay)
+			} else {
+				timer.Reset(pluginReloadDelay)
+			}
+			reload = timer.C
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			logger.Warn("监视插件目录出错: %v", err)
+		case <-reload:
+			reload = nil
+			m.watchPluginDirs(watcher)
+			if err := m.Load(); err != nil {
+				logger.Warn("重新加载插件失败: %v", err)
+			}
+		}
+	}
+}
+
+// watchPluginDirs 把新出现的插件子目录添加到监视器中，已删除的目录由监视器自动移除
+func (m *PluginManager) watchPluginDirs(watcher *fsnotify.Watcher) {
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		return
+	}
+	watched := make(map[string]bool)
+	for _, path := range watcher.WatchList() {
+		watched[path] = true
+	}
+	for _, entry := range entries {
+		pluginDir := filepath.Join(m.dir, entry.Name())
+		if entry.IsDir() && !watched[pluginDir] {
+			if err := watcher.Add(pluginDir); err != nil {
+				logger.Warn("监视插件目录 %s 失败: %v", pluginDir, err)
+			}
+		}
+	}
+}
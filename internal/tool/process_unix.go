@@ -0,0 +1,20 @@
+//go:build !windows
+
+package tool
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup 让命令在独立的进程组中运行，取消时终止整个进程组，避免子进程成为孤儿进程
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		if cmd.Process == nil {
+			return nil
+		}
+		// 负的PID表示向整个进程组发送信号
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
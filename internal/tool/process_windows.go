@@ -0,0 +1,25 @@
+//go:build windows
+
+package tool
+
+import (
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// setProcessGroup 让命令在新的进程组中运行，取消时终止整个进程树，避免子进程成为孤儿进程
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+	cmd.Cancel = func() error {
+		if cmd.Process == nil {
+			return nil
+		}
+		// taskkill /T 会同时终止所有子进程
+		kill := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid))
+		if err := kill.Run(); err != nil {
+			return cmd.Process.Kill()
+		}
+		return nil
+	}
+}
@@ -0,0 +1,136 @@
+package tool
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gomanus/internal/config"
+	"gomanus/internal/llm"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// Dependencies 是工厂创建工具时可以使用的共享依赖
+type Dependencies struct {
+	LLM   *llm.LLM        // 默认的语言模型
+	Tools *ToolCollection // 工具注册到的集合，需要调用其他工具的工具可以引用它
+}
+
+// Settings 是工具在 [tools.<name>] 表中的配置项
+type Settings map[string]interface{}
+
+// Decode 把配置项解码到带mapstructure标签的结构体中，不认识的配置项会返回错误
+func (s Settings) Decode(out interface{}) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Result:           out,
+		ErrorUnused:      true,
+		WeaklyTypedInput: true,
+	})
+	if err != nil {
+		return err
+	}
+	if err := decoder.Decode(map[string]interface{}(s)); err != nil {
+		// 把mapstructure的多行错误合并为一行，便于在启动错误中显示
+		var decodeErr *mapstructure.Error
+		if errors.As(err, &decodeErr) {
+			message := strings.Join(decodeErr.Errors, "; ")
+			return errors.New(strings.ReplaceAll(message, "'' has invalid keys: ", "不支持的配置项: "))
+		}
+		return err
+	}
+	return nil
+}
+
+// Factory 根据工具的配置项创建工具，返回nil表示该工具不加入共享的工具集合
+type Factory func(deps Dependencies, settings Settings) (Tool, error)
+
+// Registry 按名称登记工具的工厂，启动时根据 [tools] 配置创建启用的工具
+type Registry struct {
+	factories map[string]Factory
+	names     []string // 登记顺序，创建工具时按该顺序
+}
+
+// NewRegistry 创建空的工具注册表
+func NewRegistry() *Registry {
+	return &Registry{factories: make(map[string]Factory)}
+}
+
+// Register 登记工具的工厂，名称重复时panic
+func (r *Registry) Register(name string, factory Factory) {
+	if _, exists := r.factories[name]; exists {
+		panic(fmt.Sprintf("工具 %s 重复登记", name))
+	}
+	r.factories[name] = factory
+	r.names = append(r.names, name)
+}
+
+// Names 按登记顺序返回已登记的工具名称
+func (r *Registry) Names() []string {
+	return append([]string(nil), r.names...)
+}
+
+// Build 创建配置中启用的工具并添加到deps.Tools中，返回添加的工具名称
+// 配置中出现未登记的工具或工具的配置无效时返回错误，错误中包含工具名称
+func (r *Registry) Build(cfg config.ToolsConfig, deps Dependencies) ([]string, error) {
+	var unknown []string
+	for name := range cfg {
+		if _, exists := r.factories[name]; !exists {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("未知的工具 %s，可用的工具: %s", strings.Join(unknown, ", "), strings.Join(r.names, ", "))
+	}
+
+	var added []string
+	for _, name := range r.names {
+		toolCfg := cfg[name]
+		if !toolCfg.Enabled {
+			continue
+		}
+		t, err := r.factories[name](deps, Settings(toolCfg.Settings))
+		if err != nil {
+			return added, fmt.Errorf("工具 %s 的配置无效: %w", name, err)
+		}
+		if t == nil {
+			continue
+		}
+		if t.Name() != name {
+			return added, fmt.Errorf("工具 %s 的工厂创建了名称为 %s 的工具", name, t.Name())
+		}
+		if err := deps.Tools.AddTool(t); err != nil {
+			return added, fmt.Errorf("添加工具 %s 失败: %w", name, err)
+		}
+		added = append(added, name)
+	}
+	return added, nil
+}
+
+// RegisterBuiltinTools 登记工具包中的内置工具
+func RegisterBuiltinTools(r *Registry) {
+	r.Register("terminate", withoutSettings(func() Tool { return NewTerminate() }))
+	r.Register("google_search", newGoogleSearchFromSettings)
+	r.Register("zhihu_search", withoutSettings(func() Tool { return NewZhihuSearch() }))
+	r.Register("baidu_baike_search", withoutSettings(func() Tool { return NewBaiduBaikeSearch() }))
+	r.Register("wikipedia_search", withoutSettings(func() Tool { return NewWikipediaSearch() }))
+	r.Register("browser_use", newBrowserUseFromSettings)
+	r.Register("file_operator", newFileOperatorFromSettings)
+	r.Register("terminal_executor", newTerminalExecutorFromSettings)
+	// 规划工具保存计划状态，由规划代理各自创建，不加入共享的工具集合
+	r.Register("planning", func(deps Dependencies, settings Settings) (Tool, error) {
+		return nil, settings.Decode(&struct{}{})
+	})
+}
+
+// withoutSettings 把没有配置项的工具构造函数包装为工厂，配置了任何配置项都会返回错误
+func withoutSettings(create func() Tool) Factory {
+	return func(deps Dependencies, settings Settings) (Tool, error) {
+		if err := settings.Decode(&struct{}{}); err != nil {
+			return nil, err
+		}
+		return create(), nil
+	}
+}
@@ -13,7 +13,13 @@ import (
 // TerminalExecutor 是一个用于执行终端命令的工具
 type TerminalExecutor struct {
 	*BaseTool
-	parameters map[string]interface{}
+	parameters     map[string]interface{}
+	defaultTimeout int // 调用没有指定timeout时的超时秒数
+}
+
+// TerminalExecutorSettings 是 [tools.terminal_executor] 中的配置项
+type TerminalExecutorSettings struct {
+	DefaultTimeout int `mapstructure:"default_timeout"` // 调用没有指定timeout时的超时秒数，默认为30
 }
 
 // NewTerminalExecutor 创建新的终端命令执行工具
@@ -54,9 +60,34 @@ func NewTerminalExecutor() *TerminalExecutor {
 	}
 	
 	return &TerminalExecutor{
-		BaseTool:   baseTool,
-		parameters: parameters,
+		BaseTool:       baseTool,
+		parameters:     parameters,
+		defaultTimeout: 30,
+	}
+}
+
+// newTerminalExecutorFromSettings 根据配置项创建终端命令执行工具
+func newTerminalExecutorFromSettings(deps Dependencies, settings Settings) (Tool, error) {
+	var cfg TerminalExecutorSettings
+	if err := settings.Decode(&cfg); err != nil {
+		return nil, err
+	}
+	if cfg.DefaultTimeout < 0 {
+		return nil, fmt.Errorf("default_timeout不能为负数")
+	}
+
+	t := NewTerminalExecutor()
+	if cfg.DefaultTimeout > 0 {
+		t.defaultTimeout = cfg.DefaultTimeout
+		// 参数定义中的默认值和说明同步为配置的超时时间
+		properties := t.parameters["properties"].(map[string]interface{})
+		properties["timeout"] = map[string]interface{}{
+			"type":        "integer",
+			"description": fmt.Sprintf("(可选) 命令执行超时时间(秒)。默认为%d秒。", cfg.DefaultTimeout),
+			"default":     cfg.DefaultTimeout,
+		}
 	}
+	return t, nil
 }
 
 // Parameters 返回工具参数定义
@@ -64,6 +95,11 @@ func (t *TerminalExecutor) Parameters() map[string]interface{} {
 	return t.parameters
 }
 
+// ConcurrencySafe 返回false，终端命令可能修改文件系统或依赖执行顺序，需要独占执行
+func (t *TerminalExecutor) ConcurrencySafe() bool {
+	return false
+}
+
 // Execute 执行工具
 func (t *TerminalExecutor) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
 	// 获取命令参数
@@ -85,7 +121,7 @@ func (t *TerminalExecutor) Execute(ctx context.Context, params map[string]interf
 	}
 	
 	// 获取超时参数
-	timeout := 30
+	timeout := t.defaultTimeout
 	if timeoutParam, ok := params["timeout"]; ok {
 		if timeoutFloat, ok := timeoutParam.(float64); ok {
 			timeout = int(timeoutFloat)
@@ -154,8 +190,18 @@ func (t *TerminalExecutor) executeCommand(ctx context.Context, command, shellTyp
 		cmd.Dir = workingDir
 	}
 	
+	// 在独立的进程组中运行，取消或超时时终止所有子进程
+	setProcessGroup(cmd)
+	// 子进程被终止后，不再等待仍持有输出管道的孙进程
+	cmd.WaitDelay = 2 * time.Second
+
 	// 执行命令并捕获输出
 	stdout, err := cmd.Output()
+
+	// 请求被用户取消时直接返回，不再把被终止的命令当作正常结果
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("命令已被取消: %w", ctx.Err())
+	}
 	var stderr []byte
 	var exitCode int
 	
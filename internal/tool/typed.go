@@ -0,0 +1,319 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// TypedTool 使用Go结构体声明参数的工具
+// 参数定义根据结构体字段的标签生成，Execute把参数解码为结构体后交给处理函数。支持的标签:
+//
+//	json:"name"           参数名称，省略时使用字段名，"-"表示忽略该字段
+//	description:"说明"    参数说明
+//	enum:"a,b,c"          可选值，按字段类型解析
+//	default:"5"           默认值，按字段类型解析，参数缺失时使用
+//	required:"true"       必填参数
+//
+// 与encoding/json一样，没有json名称的匿名嵌入结构体的字段提升为外层的参数
+//
+// 具体的工具通常嵌入*TypedTool，再按需实现ConcurrencySafe等可选接口
+type TypedTool[T any] struct {
+	*BaseTool
+	parameters map[string]interface{}
+	defaults   map[string]interface{}
+	handler    func(ctx context.Context, args T) (interface{}, error)
+}
+
+// NewTypedTool 创建使用结构体参数的工具，参数结构体的标签无效时panic
+func NewTypedTool[T any](name, description string, handler func(ctx context.Context, args T) (interface{}, error)) *TypedTool[T] {
+	parameters, defaults, err := structSchema(reflect.TypeOf((*T)(nil)).Elem())
+	if err != nil {
+		panic(fmt.Sprintf("工具 %s 的参数定义无效: %v", name, err))
+	}
+
+	return &TypedTool[T]{
+		BaseTool:   NewBaseTool(name, description),
+		parameters: parameters,
+		defaults:   defaults,
+		handler:    handler,
+	}
+}
+
+// Parameters 返回根据参数结构体生成的参数定义
+func (t *TypedTool[T]) Parameters() map[string]interface{} {
+	return t.parameters
+}
+
+// Execute 校验参数并补充默认值，解码为参数结构体后调用处理函数
+func (t *TypedTool[T]) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	params, err := ValidateParams(t, params)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range t.defaults {
+		if _, exists := params[name]; !exists {
+			params[name] = value
+		}
+	}
+
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("编码参数失败: %w", err)
+	}
+	var args T
+	if err := json.Unmarshal(data, &args); err != nil {
+		return nil, fmt.Errorf("解析参数失败: %w", err)
+	}
+
+	return t.handler(ctx, args)
+}
+
+// GetToolDefinition 返回工具定义
+func (t *TypedTool[T]) GetToolDefinition() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "function",
+		"function": map[string]interface{}{
+			"name":        t.Name(),
+			"description": t.Description(),
+			"parameters":  t.Parameters(),
+		},
+	}
+}
+
+// structSchema 根据结构体类型生成object类型的参数定义，同时返回各参数的默认值
+func structSchema(typ reflect.Type) (map[string]interface{}, map[string]interface{}, error) {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil, nil, fmt.Errorf("参数类型必须是结构体，实际为 %s", typ)
+	}
+
+	properties := make(map[string]interface{})
+	defaults := make(map[string]interface{})
+	var required []string
+	for _, param := range structParams(typ) {
+		field, name := param.field, param.name
+
+		prop, err := typeSchema(field.Type)
+		if err != nil {
+			return nil, nil, fmt.Errorf("字段 %s: %w", field.Name, err)
+		}
+		if description := field.Tag.Get("description"); description != "" {
+			prop["description"] = description
+		}
+		if enum := field.Tag.Get("enum"); enum != "" {
+			var values []interface{}
+			for _, text := range strings.Split(enum, ",") {
+				value, err := parseTagValue(strings.TrimSpace(text), field.Type)
+				if err != nil {
+					return nil, nil, fmt.Errorf("字段 %s 的可选值: %w", field.Name, err)
+				}
+				values = append(values, value)
+			}
+			prop["enum"] = values
+		}
+		if text, ok := field.Tag.Lookup("default"); ok {
+			value, err := parseTagValue(text, field.Type)
+			if err != nil {
+				return nil, nil, fmt.Errorf("字段 %s 的默认值: %w", field.Name, err)
+			}
+			prop["default"] = value
+			defaults[name] = value
+		}
+		if isRequired, _ := strconv.ParseBool(field.Tag.Get("required")); isRequired {
+			required = append(required, name)
+		}
+		properties[name] = prop
+	}
+
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema, defaults, nil
+}
+
+// structParam 是结构体中对应一个参数的字段
+type structParam struct {
+	field  reflect.StructField
+	name   string
+	depth  int  // 字段所在的嵌入层级，外层结构体的字段为0
+	tagged bool // 字段是否在json标签中指定了名称
+}
+
+// structParams 按encoding/json的规则返回结构体中对应参数的字段，保持字段的声明顺序：
+// 没有json名称的匿名嵌入结构体的字段提升到外层，同名的字段中层级最浅的生效，
+// 同一层级有多个同名字段时使用指定了json名称的字段，仍无法区分时忽略这些字段
+func structParams(typ reflect.Type) []structParam {
+	var all []structParam
+	collectStructParams(typ, 0, map[reflect.Type]bool{}, &all)
+
+	byName := make(map[string][]structParam)
+	for _, param := range all {
+		byName[param.name] = append(byName[param.name], param)
+	}
+
+	var params []structParam
+	for _, param := range all {
+		if dominant, ok := dominantParam(byName[param.name]); ok && slices.Equal(dominant.field.Index, param.field.Index) {
+			params = append(params, param)
+		}
+	}
+	return params
+}
+
+// collectStructParams 递归收集结构体及其嵌入结构体中的字段，visited避免嵌入的类型形成循环
+func collectStructParams(typ reflect.Type, depth int, visited map[reflect.Type]bool, params *[]structParam) {
+	if visited[typ] {
+		return
+	}
+	visited[typ] = true
+	defer delete(visited, typ)
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tagName, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if field.Anonymous {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			// 未导出的非结构体类型不能被编码
+			if !field.IsExported() && embedded.Kind() != reflect.Struct {
+				continue
+			}
+			if tagName == "" && embedded.Kind() == reflect.Struct {
+				before := len(*params)
+				collectStructParams(embedded, depth+1, visited, params)
+				// 提升的字段的Index记录从外层结构体开始的完整路径，用于区分同名的字段
+				for j := before; j < len(*params); j++ {
+					(*params)[j].field.Index = append([]int{i}, (*params)[j].field.Index...)
+				}
+				continue
+			}
+		} else if !field.IsExported() {
+			continue
+		}
+
+		name := fieldName(field)
+		if name == "" {
+			continue
+		}
+		*params = append(*params, structParam{field: field, name: name, depth: depth, tagged: tagName != ""})
+	}
+}
+
+// dominantParam 从同名的字段中选出生效的字段，无法区分时返回false
+func dominantParam(candidates []structParam) (structParam, bool) {
+	if len(candidates) == 0 {
+		return structParam{}, false
+	}
+	depth := candidates[0].depth
+	for _, param := range candidates {
+		if param.depth < depth {
+			depth = param.depth
+		}
+	}
+
+	var shallowest, tagged []structParam
+	for _, param := range candidates {
+		if param.depth != depth {
+			continue
+		}
+		shallowest = append(shallowest, param)
+		if param.tagged {
+			tagged = append(tagged, param)
+		}
+	}
+	switch {
+	case len(shallowest) == 1:
+		return shallowest[0], true
+	case len(tagged) == 1:
+		return tagged[0], true
+	}
+	return structParam{}, false
+}
+
+// typeSchema 生成Go类型对应的参数定义
+func typeSchema(typ reflect.Type) (map[string]interface{}, error) {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	switch typ.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}, nil
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}, nil
+	case reflect.Slice, reflect.Array:
+		items, err := typeSchema(typ.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"type": "array", "items": items}, nil
+	case reflect.Map:
+		if typ.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("map的键必须是字符串")
+		}
+		return map[string]interface{}{"type": "object"}, nil
+	case reflect.Struct:
+		schema, _, err := structSchema(typ)
+		return schema, err
+	case reflect.Interface:
+		// interface{}可以接受任意类型的参数
+		return map[string]interface{}{}, nil
+	}
+	return nil, fmt.Errorf("不支持的参数类型 %s", typ)
+}
+
+// fieldName 返回字段对应的参数名称，忽略的字段返回空字符串
+func fieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return field.Name
+	}
+	return name
+}
+
+// parseTagValue 按字段类型解析标签中的值
+func parseTagValue(text string, typ reflect.Type) (interface{}, error) {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	switch typ.Kind() {
+	case reflect.String:
+		return text, nil
+	case reflect.Bool:
+		return strconv.ParseBool(text)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.Atoi(text)
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(text, 64)
+	}
+
+	// 其他类型的值使用JSON表示
+	var value interface{}
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return nil, fmt.Errorf("无法解析 %q: %w", text, err)
+	}
+	return value, nil
+}
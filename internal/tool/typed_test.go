@@ -0,0 +1,387 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// schemaJSON 把参数定义编码为发送给模型的JSON形式，忽略[]string和[]interface{}等Go类型的差异
+func schemaJSON(t *testing.T, schema map[string]interface{}) interface{} {
+	t.Helper()
+	data, err := json.Marshal(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+// 嵌入结构体的测试类型
+type (
+	pagingArgs struct {
+		Page  int `json:"page" default:"1"`
+		Limit int `json:"limit" description:"每页数量"`
+	}
+	queryArgs struct {
+		Query string `json:"query" required:"true"`
+	}
+	embeddedArgs struct {
+		queryArgs
+		*pagingArgs
+		Limit  string     `json:"limit"` // 外层的字段覆盖嵌入结构体的同名字段
+		Nested pagingArgs `json:"nested"`
+	}
+	ambiguousA struct {
+		Name string
+	}
+	ambiguousB struct {
+		Name string
+	}
+	ambiguousArgs struct {
+		ambiguousA
+		ambiguousB
+		Other string `json:"other"`
+	}
+	taggedEmbedArgs struct {
+		pagingArgs `json:"paging"`
+	}
+	taggedWinsA struct {
+		Name string `json:"name"`
+	}
+	taggedWinsB struct {
+		Name string
+	}
+	taggedWinsArgs struct {
+		taggedWinsA
+		taggedWinsB `json:"-"`
+	}
+)
+
+func TestStructSchema(t *testing.T) {
+	tests := []struct {
+		name         string
+		args         interface{}
+		want         map[string]interface{}
+		wantDefaults map[string]interface{}
+	}{
+		{
+			name: "基本类型和标签",
+			args: struct {
+				Name    string            `json:"name" description:"名称" required:"true"`
+				Count   int               `json:"count,omitempty" default:"3"`
+				Ratio   float64           `json:"ratio"`
+				Enabled *bool             `json:"enabled"`
+				Mode    string            `json:"mode" enum:"fast, slow"`
+				Level   int               `json:"level" enum:"1,2"`
+				Tags    []string          `json:"tags"`
+				Labels  map[string]string `json:"labels"`
+				Any     interface{}       `json:"any"`
+				Raw     string
+				Ignored string `json:"-"`
+				private string
+			}{},
+			want: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"name":    map[string]interface{}{"type": "string", "description": "名称"},
+					"count":   map[string]interface{}{"type": "integer", "default": 3},
+					"ratio":   map[string]interface{}{"type": "number"},
+					"enabled": map[string]interface{}{"type": "boolean"},
+					"mode":    map[string]interface{}{"type": "string", "enum": []interface{}{"fast", "slow"}},
+					"level":   map[string]interface{}{"type": "integer", "enum": []interface{}{1, 2}},
+					"tags":    map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+					"labels":  map[string]interface{}{"type": "object"},
+					"any":     map[string]interface{}{},
+					"Raw":     map[string]interface{}{"type": "string"},
+				},
+				"required": []string{"name"},
+			},
+			wantDefaults: map[string]interface{}{"count": 3},
+		},
+		{
+			name: "嵌套结构体和结构体数组",
+			args: &struct {
+				Steps []struct {
+					ID string `json:"id" required:"true"`
+				} `json:"steps"`
+			}{},
+			want: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"steps": map[string]interface{}{
+						"type": "array",
+						"items": map[string]interface{}{
+							"type":       "object",
+							"properties": map[string]interface{}{"id": map[string]interface{}{"type": "string"}},
+							"required":   []string{"id"},
+						},
+					},
+				},
+			},
+			wantDefaults: map[string]interface{}{},
+		},
+		{
+			name: "嵌入结构体的字段提升到外层",
+			args: embeddedArgs{},
+			want: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"query": map[string]interface{}{"type": "string"},
+					"page":  map[string]interface{}{"type": "integer", "default": 1},
+					"limit": map[string]interface{}{"type": "string"},
+					"nested": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"page":  map[string]interface{}{"type": "integer", "default": 1},
+							"limit": map[string]interface{}{"type": "integer", "description": "每页数量"},
+						},
+					},
+				},
+				"required": []string{"query"},
+			},
+			wantDefaults: map[string]interface{}{"page": 1},
+		},
+		{
+			name: "同一层级无法区分的同名字段被忽略",
+			args: ambiguousArgs{},
+			want: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{"other": map[string]interface{}{"type": "string"}},
+			},
+			wantDefaults: map[string]interface{}{},
+		},
+		{
+			name: "指定了json名称的嵌入结构体作为对象参数",
+			args: taggedEmbedArgs{},
+			want: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"paging": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"page":  map[string]interface{}{"type": "integer", "default": 1},
+							"limit": map[string]interface{}{"type": "integer", "description": "每页数量"},
+						},
+					},
+				},
+			},
+			wantDefaults: map[string]interface{}{},
+		},
+		{
+			name: "忽略json标签为-的嵌入结构体",
+			args: taggedWinsArgs{},
+			want: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{"name": map[string]interface{}{"type": "string"}},
+			},
+			wantDefaults: map[string]interface{}{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, defaults, err := structSchema(reflect.TypeOf(tt.args))
+			if err != nil {
+				t.Fatalf("生成参数定义失败: %v", err)
+			}
+			if !reflect.DeepEqual(schema, tt.want) {
+				t.Errorf("参数定义为\n%#v\n期望\n%#v", schema, tt.want)
+			}
+			if !reflect.DeepEqual(defaults, tt.wantDefaults) {
+				t.Errorf("默认值为 %v，期望 %v", defaults, tt.wantDefaults)
+			}
+		})
+	}
+}
+
+func TestStructSchemaMatchesEncodingJSON(t *testing.T) {
+	// 参数定义中的名称与encoding/json编码结构体得到的名称一致
+	data, err := json.Marshal(embeddedArgs{pagingArgs: &pagingArgs{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var encoded map[string]interface{}
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		t.Fatal(err)
+	}
+	schema, _, err := structSchema(reflect.TypeOf(embeddedArgs{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	properties := schema["properties"].(map[string]interface{})
+	for name := range encoded {
+		if _, ok := properties[name]; !ok {
+			t.Errorf("参数定义中缺少 %s", name)
+		}
+	}
+	if len(properties) != len(encoded) {
+		t.Errorf("参数定义有 %d 个参数，JSON编码有 %d 个字段", len(properties), len(encoded))
+	}
+}
+
+func TestStructSchemaErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args interface{}
+	}{
+		{"不是结构体", "text"},
+		{"map的键不是字符串", struct {
+			M map[int]string `json:"m"`
+		}{}},
+		{"不支持的类型", struct {
+			C chan int `json:"c"`
+		}{}},
+		{"无效的可选值", struct {
+			N int `json:"n" enum:"1,two"`
+		}{}},
+		{"无效的默认值", struct {
+			B bool `json:"b" default:"yes"`
+		}{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := structSchema(reflect.TypeOf(tt.args)); err == nil {
+				t.Error("应该返回错误")
+			}
+		})
+	}
+}
+
+func TestParseTagValue(t *testing.T) {
+	tests := []struct {
+		text    string
+		typ     interface{}
+		want    interface{}
+		wantErr bool
+	}{
+		{"abc", "", "abc", false},
+		{"true", false, true, false},
+		{"maybe", false, nil, true},
+		{"42", 0, 42, false},
+		{"-1", uint(0), -1, false},
+		{"1.5", 0, nil, true},
+		{"1.5", 0.0, 1.5, false},
+		{"1.5", new(float64), 1.5, false},
+		{`["a","b"]`, []string{}, []interface{}{"a", "b"}, false},
+		{`{"k":1}`, map[string]int{}, map[string]interface{}{"k": float64(1)}, false},
+		{"[a", []string{}, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseTagValue(tt.text, reflect.TypeOf(tt.typ))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseTagValue(%q, %T) 的错误为 %v", tt.text, tt.typ, err)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseTagValue(%q, %T) = %#v，期望 %#v", tt.text, tt.typ, got, tt.want)
+		}
+	}
+}
+
+func TestTypedToolAppliesDefaults(t *testing.T) {
+	type args struct {
+		Query string `json:"query" required:"true"`
+		Limit int    `json:"limit" default:"5"`
+		Exact bool   `json:"exact" default:"true"`
+	}
+	var got args
+	typed := NewTypedTool("typed", "测试", func(ctx context.Context, a args) (interface{}, error) {
+		got = a
+		return "ok", nil
+	})
+
+	tests := []struct {
+		name   string
+		params map[string]interface{}
+		want   args
+	}{
+		{"缺少的参数使用默认值", map[string]interface{}{"query": "go"}, args{Query: "go", Limit: 5, Exact: true}},
+		{"提供的参数覆盖默认值", map[string]interface{}{"query": "go", "limit": "2", "exact": false}, args{Query: "go", Limit: 2, Exact: false}},
+		{"null按未提供处理", map[string]interface{}{"query": "go", "limit": nil}, args{Query: "go", Limit: 5, Exact: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = args{}
+			if _, err := typed.Execute(context.Background(), tt.params); err != nil {
+				t.Fatalf("执行失败: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("参数为 %+v，期望 %+v", got, tt.want)
+			}
+		})
+	}
+
+	var invalid *ValidationError
+	if _, err := typed.Execute(context.Background(), map[string]interface{}{"limit": 1}); !errors.As(err, &invalid) {
+		t.Errorf("缺少必填参数时错误为 %v，期望*ValidationError", err)
+	}
+	if typed.Parameters()["properties"].(map[string]interface{})["limit"].(map[string]interface{})["default"] != 5 {
+		t.Error("默认值没有写入参数定义")
+	}
+}
+
+func TestTypedToolSchemasMatchHandWritten(t *testing.T) {
+	// 迁移到TypedTool之前手写的参数定义
+	tests := []struct {
+		tool interface{ Parameters() map[string]interface{} }
+		want map[string]interface{}
+	}{
+		{NewTerminate(), map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"status": map[string]interface{}{
+					"type":        "string",
+					"description": "交互的完成状态",
+					"enum":        []string{"success", "failure"},
+				},
+				"message": map[string]interface{}{
+					"type":        "string",
+					"description": "(可选) 结束时的总结，说明完成了什么或无法继续的原因",
+				},
+			},
+			"required": []string{"status"},
+		}},
+		{NewGoogleSearch(), map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"query": map[string]interface{}{
+					"type":        "string",
+					"description": "(必填) 提交给Google的搜索查询。",
+				},
+				"num_results": map[string]interface{}{
+					"type":        "integer",
+					"description": "(可选) 返回的搜索结果数量。默认为10。",
+					"default":     10,
+				},
+			},
+			"required": []string{"query"},
+		}},
+		{NewBaiduBaikeSearch(), map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"query": map[string]interface{}{
+					"type":        "string",
+					"description": "(必填) 提交给百度百科的搜索查询。",
+				},
+				"num_results": map[string]interface{}{
+					"type":        "integer",
+					"description": "(可选) 返回的搜索结果数量。默认为5。",
+					"default":     5,
+				},
+			},
+			"required": []string{"query"},
+		}},
+	}
+	for _, tt := range tests {
+		name := tt.tool.(Tool).Name()
+		if got, want := schemaJSON(t, tt.tool.Parameters()), schemaJSON(t, tt.want); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s 的参数定义为 %v，期望 %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,409 @@
+package tool
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ValidationIssue 描述一个不符合参数定义的参数
+type ValidationIssue struct {
+	Path    string `json:"path"`    // 参数路径，例如 steps[0].id
+	Message string `json:"message"` // 问题说明
+}
+
+// ValidationError 表示模型提供的参数不符合工具的参数定义
+type ValidationError struct {
+	Tool   string
+	Issues []ValidationIssue
+}
+
+// Error 实现error接口
+func (e *ValidationError) Error() string {
+	issues := make([]string, 0, len(e.Issues))
+	for _, issue := range e.Issues {
+		issues = append(issues, issue.Path+": "+issue.Message)
+	}
+	return fmt.Sprintf("工具 %s 的参数无效: %s", e.Tool, strings.Join(issues, "; "))
+}
+
+// ToolMessage 返回提供给模型的结构化错误内容，模型可以据此修正参数后重新调用
+func (e *ValidationError) ToolMessage() string {
+	payload := map[string]interface{}{
+		"error": map[string]interface{}{
+			"type":   "invalid_arguments",
+			"tool":   e.Tool,
+			"issues": e.Issues,
+			"hint":   "请按照工具的参数定义修正以上参数后重新调用",
+		},
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return e.Error()
+	}
+	return string(data)
+}
+
+// ValidateParams 按工具的Parameters()定义校验参数，返回转换后的参数副本
+// 类型不符时先尝试安全的转换，例如字符串"2"转换为数字、单个值转换为只有一个元素的数组，
+// 无法转换或缺少必填参数时返回*ValidationError。未提供参数定义的工具不做校验
+func ValidateParams(tool Tool, params map[string]interface{}) (map[string]interface{}, error) {
+	provider, ok := tool.(interface{ Parameters() map[string]interface{} })
+	if !ok || provider.Parameters() == nil {
+		return params, nil
+	}
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+
+	v := &validator{}
+	result := v.validate("", params, provider.Parameters())
+	if len(v.issues) > 0 {
+		return nil, &ValidationError{Tool: tool.Name(), Issues: v.issues}
+	}
+	coerced, _ := result.(map[string]interface{})
+	return coerced, nil
+}
+
+// validator 递归校验参数并收集问题
+type validator struct {
+	issues []ValidationIssue
+}
+
+// fail 记录一个问题
+func (v *validator) fail(path, format string, args ...interface{}) {
+	if path == "" {
+		path = "参数"
+	}
+	v.issues = append(v.issues, ValidationIssue{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// validate 校验单个值，返回转换后的值
+func (v *validator) validate(path string, value interface{}, schema map[string]interface{}) interface{} {
+	value = normalizeValue(value)
+
+	if branches := schemaList(schema["anyOf"]); branches != nil {
+		return v.validateAnyOf(path, value, branches)
+	}
+	if branches := schemaList(schema["oneOf"]); branches != nil {
+		return v.validateAnyOf(path, value, branches)
+	}
+
+	if types := schemaTypes(schema); len(types) > 0 {
+		coerced, ok := coerceValue(value, types)
+		if !ok {
+			v.fail(path, "应为%s类型，实际为%s", strings.Join(types, "或"), valueType(value))
+			return value
+		}
+		value = coerced
+	}
+
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		value = v.validateObject(path, typed, schema)
+	case []interface{}:
+		value = v.validateArray(path, typed, schema)
+	}
+
+	if enum := schemaList(schema["enum"]); enum != nil && !containsValue(enum, value) {
+		v.fail(path, "取值 %v 无效，可选值: %s", value, formatValues(enum))
+	}
+	if number, ok := value.(float64); ok {
+		if minimum, ok := normalizeValue(schema["minimum"]).(float64); ok && number < minimum {
+			v.fail(path, "不能小于 %v", minimum)
+		}
+		if maximum, ok := normalizeValue(schema["maximum"]).(float64); ok && number > maximum {
+			v.fail(path, "不能大于 %v", maximum)
+		}
+	}
+	return value
+}
+
+// validateAnyOf 使用第一个校验通过的定义，全部不通过时记录问题
+func (v *validator) validateAnyOf(path string, value interface{}, branches []interface{}) interface{} {
+	var messages []string
+	for _, branch := range branches {
+		branchSchema, ok := branch.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		sub := &validator{}
+		result := sub.validate(path, value, branchSchema)
+		if len(sub.issues) == 0 {
+			return result
+		}
+		issue := sub.issues[0]
+		if issue.Path != path && path != "" {
+			issue.Message = issue.Path + " " + issue.Message
+		}
+		messages = append(messages, issue.Message)
+	}
+	v.fail(path, "不符合任何一种允许的格式: %s", strings.Join(messages, "；"))
+	return value
+}
+
+// validateObject 校验对象的必填参数和各个属性
+func (v *validator) validateObject(path string, object map[string]interface{}, schema map[string]interface{}) map[string]interface{} {
+	properties, _ := schema["properties"].(map[string]interface{})
+	required := make(map[string]bool)
+	for _, name := range schemaList(schema["required"]) {
+		if name, ok := name.(string); ok {
+			required[name] = true
+		}
+	}
+	closed := schema["additionalProperties"] == false
+
+	result := make(map[string]interface{}, len(object))
+	for _, key := range sortedKeys(object) {
+		value := object[key]
+		// 模型经常为可选参数传null，按未提供处理，必填参数为null时在下面报告缺少参数
+		if value == nil {
+			continue
+		}
+
+		propSchema, known := properties[key].(map[string]interface{})
+		switch {
+		case known:
+			result[key] = v.validate(joinPath(path, key), value, propSchema)
+		case closed:
+			v.fail(joinPath(path, key), "不支持该参数")
+		default:
+			result[key] = value
+		}
+	}
+
+	for _, name := range sortedKeys(required) {
+		if value, exists := object[name]; !exists || value == nil {
+			v.fail(joinPath(path, name), "缺少必填参数")
+		}
+	}
+	return result
+}
+
+// validateArray 校验数组中的每个元素
+func (v *validator) validateArray(path string, array []interface{}, schema map[string]interface{}) []interface{} {
+	items, ok := schema["items"].(map[string]interface{})
+	if !ok {
+		return array
+	}
+
+	result := make([]interface{}, len(array))
+	for i, item := range array {
+		result[i] = v.validate(fmt.Sprintf("%s[%d]", path, i), item, items)
+	}
+	return result
+}
+
+// coerceValue 把值转换为允许的类型之一，类型已经匹配时不做转换
+func coerceValue(value interface{}, types []string) (interface{}, bool) {
+	for _, t := range types {
+		if matchesType(value, t) {
+			return value, true
+		}
+	}
+	for _, t := range types {
+		if coerced, ok := coerceTo(value, t); ok {
+			return coerced, true
+		}
+	}
+	return nil, false
+}
+
+// matchesType 检查值是否是JSON Schema中的类型
+func matchesType(value interface{}, t string) bool {
+	switch t {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		number, ok := value.(float64)
+		return ok && number == math.Trunc(number)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "null":
+		return value == nil
+	}
+	return false
+}
+
+// coerceTo 尝试把值安全地转换为指定类型，不会丢失信息的转换才会执行
+func coerceTo(value interface{}, t string) (interface{}, bool) {
+	switch t {
+	case "number", "integer":
+		text, ok := value.(string)
+		if !ok {
+			return nil, false
+		}
+		number, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		if err != nil || (t == "integer" && number != math.Trunc(number)) {
+			return nil, false
+		}
+		return number, true
+	case "string":
+		switch typed := value.(type) {
+		case float64:
+			return strconv.FormatFloat(typed, 'f', -1, 64), true
+		case bool:
+			return strconv.FormatBool(typed), true
+		}
+	case "boolean":
+		if text, ok := value.(string); ok {
+			switch strings.ToLower(strings.TrimSpace(text)) {
+			case "true":
+				return true, true
+			case "false":
+				return false, true
+			}
+		}
+	case "array":
+		if value == nil {
+			return nil, false
+		}
+		// 模型有时把数组编码成JSON字符串
+		if text, ok := value.(string); ok && strings.HasPrefix(strings.TrimSpace(text), "[") {
+			var array []interface{}
+			if err := json.Unmarshal([]byte(text), &array); err == nil {
+				return array, true
+			}
+		}
+		return []interface{}{value}, true
+	case "object":
+		if text, ok := value.(string); ok && strings.HasPrefix(strings.TrimSpace(text), "{") {
+			var object map[string]interface{}
+			if err := json.Unmarshal([]byte(text), &object); err == nil {
+				return object, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// normalizeValue 把Go代码传入的整数和切片转换为JSON解码得到的类型
+func normalizeValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case nil, string, bool, float64, []interface{}, map[string]interface{}:
+		return value
+	case float32:
+		return float64(typed)
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	case reflect.Slice, reflect.Array:
+		list := make([]interface{}, rv.Len())
+		for i := range list {
+			list[i] = rv.Index(i).Interface()
+		}
+		return list
+	}
+	return value
+}
+
+// schemaTypes 返回定义中允许的类型，type可以是字符串或字符串列表
+func schemaTypes(schema map[string]interface{}) []string {
+	switch t := schema["type"].(type) {
+	case string:
+		return []string{t}
+	case nil:
+		return nil
+	}
+
+	var types []string
+	for _, item := range schemaList(schema["type"]) {
+		if name, ok := item.(string); ok {
+			types = append(types, name)
+		}
+	}
+	return types
+}
+
+// schemaList 把定义中的列表（[]string、[]interface{}等）转换为[]interface{}，不是列表时返回nil
+func schemaList(value interface{}) []interface{} {
+	if value == nil {
+		return nil
+	}
+	list, ok := normalizeValue(value).([]interface{})
+	if !ok {
+		return nil
+	}
+	// 复制后再转换，不修改工具共享的参数定义
+	result := make([]interface{}, len(list))
+	for i, item := range list {
+		result[i] = normalizeValue(item)
+	}
+	return result
+}
+
+// containsValue 检查值是否在列表中
+func containsValue(list []interface{}, value interface{}) bool {
+	for _, item := range list {
+		if reflect.DeepEqual(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatValues 格式化可选值列表
+func formatValues(list []interface{}) string {
+	values := make([]string, len(list))
+	for i, item := range list {
+		values[i] = fmt.Sprintf("%v", item)
+	}
+	return strings.Join(values, ", ")
+}
+
+// valueType 返回值的JSON类型名称，用于错误提示
+func valueType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// joinPath 拼接参数路径
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// sortedKeys 返回map的键，按名称排序，保证错误信息的顺序稳定
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
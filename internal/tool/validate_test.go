@@ -0,0 +1,295 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// schemaTool 是使用指定参数定义的工具
+type schemaTool struct {
+	*BaseTool
+	schema map[string]interface{}
+}
+
+func (s *schemaTool) Parameters() map[string]interface{} {
+	return s.schema
+}
+
+func (s *schemaTool) Execute(ctx context.Context, params map[string]interface{}) (interface{}, error) {
+	return params, nil
+}
+
+func TestValidateParamsBuiltinTools(t *testing.T) {
+	tests := []struct {
+		name       string
+		tool       Tool
+		params     map[string]interface{}
+		want       map[string]interface{}
+		wantIssues []ValidationIssue
+	}{
+		{
+			name:   "字符串形式的步骤索引转换为数字",
+			tool:   NewPlanningTool(),
+			params: map[string]interface{}{"command": "mark_step", "step_index": "2", "step_status": "completed"},
+			want:   map[string]interface{}{"command": "mark_step", "step_index": float64(2), "step_status": "completed"},
+		},
+		{
+			name:       "步骤索引不是整数",
+			tool:       NewPlanningTool(),
+			params:     map[string]interface{}{"command": "mark_step", "step_index": "第二步"},
+			wantIssues: []ValidationIssue{{Path: "step_index", Message: "应为integer类型，实际为string"}},
+		},
+		{
+			name:   "单个步骤转换为数组",
+			tool:   NewPlanningTool(),
+			params: map[string]interface{}{"command": "create", "title": "计划", "steps": "唯一的步骤"},
+			want:   map[string]interface{}{"command": "create", "title": "计划", "steps": []interface{}{"唯一的步骤"}},
+		},
+		{
+			name:       "无效的命令",
+			tool:       NewPlanningTool(),
+			params:     map[string]interface{}{"command": "remove"},
+			wantIssues: []ValidationIssue{{Path: "command", Message: "取值 remove 无效，可选值: create, update, list, get, set_active, mark_step, delete"}},
+		},
+		{
+			name:   "字符串形式的超时转换为数字",
+			tool:   NewTerminalExecutor(),
+			params: map[string]interface{}{"command": "ls", "timeout": "10"},
+			want:   map[string]interface{}{"command": "ls", "timeout": float64(10)},
+		},
+		{
+			name:       "类型错误的超时不再被忽略",
+			tool:       NewTerminalExecutor(),
+			params:     map[string]interface{}{"command": "ls", "timeout": "十秒"},
+			wantIssues: []ValidationIssue{{Path: "timeout", Message: "应为integer类型，实际为string"}},
+		},
+		{
+			name:       "超时不是整数",
+			tool:       NewTerminalExecutor(),
+			params:     map[string]interface{}{"command": "ls", "timeout": 1.5},
+			wantIssues: []ValidationIssue{{Path: "timeout", Message: "应为integer类型，实际为number"}},
+		},
+		{
+			name:       "缺少终端命令",
+			tool:       NewTerminalExecutor(),
+			params:     map[string]interface{}{"timeout": 10},
+			wantIssues: []ValidationIssue{{Path: "command", Message: "缺少必填参数"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkValidation(t, tt.tool, tt.params, tt.want, tt.wantIssues)
+		})
+	}
+}
+
+func TestValidateParamsSchema(t *testing.T) {
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"name":    map[string]interface{}{"type": "string"},
+			"count":   map[string]interface{}{"type": "integer", "minimum": 1, "maximum": 10},
+			"enabled": map[string]interface{}{"type": "boolean"},
+			"tags":    map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+			"options": map[string]interface{}{
+				"type":                 "object",
+				"properties":           map[string]interface{}{"depth": map[string]interface{}{"type": "number"}},
+				"additionalProperties": false,
+			},
+			"target": map[string]interface{}{"anyOf": []interface{}{
+				map[string]interface{}{"type": "integer"},
+				map[string]interface{}{"type": "string", "enum": []string{"all"}},
+			}},
+			"steps": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type":       "object",
+					"properties": map[string]interface{}{"id": map[string]interface{}{"type": "string"}},
+					"required":   []string{"id"},
+				},
+			},
+		},
+		"required": []string{"name"},
+	}
+	tool := &schemaTool{BaseTool: NewBaseTool("schema", "测试参数定义"), schema: schema}
+
+	tests := []struct {
+		name       string
+		params     map[string]interface{}
+		want       map[string]interface{}
+		wantIssues []ValidationIssue
+	}{
+		{
+			name:   "类型匹配时不做转换",
+			params: map[string]interface{}{"name": "a", "count": float64(3), "enabled": true},
+			want:   map[string]interface{}{"name": "a", "count": float64(3), "enabled": true},
+		},
+		{
+			name:   "Go代码传入的整数和切片",
+			params: map[string]interface{}{"name": "a", "count": 3, "tags": []string{"x", "y"}},
+			want:   map[string]interface{}{"name": "a", "count": float64(3), "tags": []interface{}{"x", "y"}},
+		},
+		{
+			name:   "数字和布尔值转换为字符串",
+			params: map[string]interface{}{"name": float64(42), "tags": []interface{}{true, 1.5}},
+			want:   map[string]interface{}{"name": "42", "tags": []interface{}{"true", "1.5"}},
+		},
+		{
+			name:   "字符串转换为布尔值",
+			params: map[string]interface{}{"name": "a", "enabled": " FALSE "},
+			want:   map[string]interface{}{"name": "a", "enabled": false},
+		},
+		{
+			name:   "JSON字符串转换为数组和对象",
+			params: map[string]interface{}{"name": "a", "tags": `["x", "y"]`, "options": `{"depth": 2}`},
+			want:   map[string]interface{}{"name": "a", "tags": []interface{}{"x", "y"}, "options": map[string]interface{}{"depth": float64(2)}},
+		},
+		{
+			name:   "可选参数为null时按未提供处理",
+			params: map[string]interface{}{"name": "a", "count": nil, "tags": nil},
+			want:   map[string]interface{}{"name": "a"},
+		},
+		{
+			name:   "未定义的参数原样保留",
+			params: map[string]interface{}{"name": "a", "extra": "x"},
+			want:   map[string]interface{}{"name": "a", "extra": "x"},
+		},
+		{
+			name:   "anyOf使用第一个匹配的定义",
+			params: map[string]interface{}{"name": "a", "target": "5"},
+			want:   map[string]interface{}{"name": "a", "target": float64(5)},
+		},
+		{
+			name:   "anyOf匹配第二个定义",
+			params: map[string]interface{}{"name": "a", "target": "all"},
+			want:   map[string]interface{}{"name": "a", "target": "all"},
+		},
+		{
+			name:   "anyOf没有匹配的定义",
+			params: map[string]interface{}{"name": "a", "target": "none"},
+			wantIssues: []ValidationIssue{{
+				Path:    "target",
+				Message: "不符合任何一种允许的格式: 应为integer类型，实际为string；取值 none 无效，可选值: all",
+			}},
+		},
+		{
+			name:       "缺少必填参数",
+			params:     map[string]interface{}{},
+			wantIssues: []ValidationIssue{{Path: "name", Message: "缺少必填参数"}},
+		},
+		{
+			name:       "必填参数为null",
+			params:     map[string]interface{}{"name": nil},
+			wantIssues: []ValidationIssue{{Path: "name", Message: "缺少必填参数"}},
+		},
+		{
+			name:   "超出范围",
+			params: map[string]interface{}{"name": "a", "count": 0},
+			wantIssues: []ValidationIssue{
+				{Path: "count", Message: "不能小于 1"},
+			},
+		},
+		{
+			name:   "对象不支持未定义的参数",
+			params: map[string]interface{}{"name": "a", "options": map[string]interface{}{"depth": "x", "width": 1}},
+			wantIssues: []ValidationIssue{
+				{Path: "options.depth", Message: "应为number类型，实际为string"},
+				{Path: "options.width", Message: "不支持该参数"},
+			},
+		},
+		{
+			name:   "数组元素的路径",
+			params: map[string]interface{}{"name": "a", "steps": []interface{}{map[string]interface{}{"id": "s1"}, map[string]interface{}{"id": []interface{}{}}, map[string]interface{}{}}},
+			wantIssues: []ValidationIssue{
+				{Path: "steps[1].id", Message: "应为string类型，实际为array"},
+				{Path: "steps[2].id", Message: "缺少必填参数"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkValidation(t, tool, tt.params, tt.want, tt.wantIssues)
+		})
+	}
+}
+
+// checkValidation 校验参数并比较转换结果或问题列表
+func checkValidation(t *testing.T, tool Tool, params, want map[string]interface{}, wantIssues []ValidationIssue) {
+	t.Helper()
+	got, err := ValidateParams(tool, params)
+	if wantIssues != nil {
+		var invalid *ValidationError
+		if !errors.As(err, &invalid) {
+			t.Fatalf("错误为 %v，期望*ValidationError", err)
+		}
+		if invalid.Tool != tool.Name() || !reflect.DeepEqual(invalid.Issues, wantIssues) {
+			t.Errorf("问题为 %+v，期望 %+v", invalid.Issues, wantIssues)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("校验失败: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("转换后的参数为 %#v，期望 %#v", got, want)
+	}
+}
+
+func TestValidateParamsWithoutSchema(t *testing.T) {
+	params := map[string]interface{}{"anything": "2"}
+	got, err := ValidateParams(&customTool{NewBaseTool("custom", "没有参数定义")}, params)
+	if err != nil || !reflect.DeepEqual(got, params) {
+		t.Errorf("没有参数定义的工具返回 %v, %v，期望原样返回参数", got, err)
+	}
+}
+
+func TestExecuteToolCoercesArguments(t *testing.T) {
+	tools := NewToolCollection()
+	planning := NewPlanningTool()
+	if err := tools.AddTool(planning); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := tools.ExecuteTool(ctx, "planning", map[string]interface{}{"command": "create", "plan_id": "p", "title": "计划", "steps": []interface{}{"a", "b", "c"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tools.ExecuteTool(ctx, "planning", map[string]interface{}{"command": "mark_step", "plan_id": "p", "step_index": "2", "step_status": "completed"}); err != nil {
+		t.Fatalf("字符串形式的步骤索引应该被接受: %v", err)
+	}
+	steps, err := planning.GetSteps("p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if steps[2].Status != "completed" {
+		t.Errorf("步骤 3 的状态为 %s，期望 completed", steps[2].Status)
+	}
+}
+
+func TestValidationErrorToolMessage(t *testing.T) {
+	err := &ValidationError{Tool: "planning", Issues: []ValidationIssue{{Path: "step_index", Message: "缺少必填参数"}}}
+	if got := err.Error(); got != "工具 planning 的参数无效: step_index: 缺少必填参数" {
+		t.Errorf("错误信息为 %q", got)
+	}
+
+	var payload struct {
+		Error struct {
+			Type   string            `json:"type"`
+			Tool   string            `json:"tool"`
+			Issues []ValidationIssue `json:"issues"`
+			Hint   string            `json:"hint"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(err.ToolMessage()), &payload); err != nil {
+		t.Fatalf("工具消息不是有效的JSON: %v", err)
+	}
+	if payload.Error.Type != "invalid_arguments" || payload.Error.Tool != "planning" ||
+		!reflect.DeepEqual(payload.Error.Issues, err.Issues) || !strings.Contains(payload.Error.Hint, "修正") {
+		t.Errorf("工具消息不正确: %+v", payload)
+	}
+}
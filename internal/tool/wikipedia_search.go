@@ -49,6 +49,16 @@ func NewWikipediaSearch() *WikipediaSearch {
 	}
 }
 
+// ConcurrencySafe 返回true，搜索只读取外部数据，可以与其他工具调用并发执行
+func (w *WikipediaSearch) ConcurrencySafe() bool {
+	return true
+}
+
+// ReadOnly 返回true，搜索不修改任何状态
+func (w *WikipediaSearch) ReadOnly() bool {
+	return true
+}
+
 // Parameters 返回工具参数定义
 func (w *WikipediaSearch) Parameters() map[string]interface{} {
 	return w.parameters
@@ -48,6 +48,16 @@ func NewZhihuSearch() *ZhihuSearch {
 	}
 }
 
+// ConcurrencySafe 返回true，搜索只读取外部数据，可以与其他工具调用并发执行
+func (z *ZhihuSearch) ConcurrencySafe() bool {
+	return true
+}
+
+// ReadOnly 返回true，搜索不修改任何状态
+func (z *ZhihuSearch) ReadOnly() bool {
+	return true
+}
+
 // Parameters 返回工具参数定义
 func (z *ZhihuSearch) Parameters() map[string]interface{} {
 	return z.parameters
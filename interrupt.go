@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"os"
+	"sync"
+	"syscall"
+
+	"gomanus/pkg/logger"
+
+	"github.com/pterm/pterm"
+)
+
+// interruptHandler 处理中断信号：第一次 Ctrl+C 只取消正在执行的请求并回到交互式会话，
+// 空闲时或再次按下 Ctrl+C 时退出程序
+type interruptHandler struct {
+	mu          sync.Mutex
+	cancel      context.CancelFunc // 当前请求的取消函数，空闲时为nil
+	interrupted bool               // 当前请求是否已经被取消
+}
+
+// begin 记录正在执行的请求
+func (h *interruptHandler) begin(cancel context.CancelFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.cancel = cancel
+	h.interrupted = false
+}
+
+// end 在请求结束后清除记录
+func (h *interruptHandler) end() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.cancel = nil
+	h.interrupted = false
+}
+
+// watch 监听中断信号，exit 用于退出程序
+func (h *interruptHandler) watch(sigChan <-chan os.Signal, exit func()) {
+	for sig := range sigChan {
+		h.mu.Lock()
+		cancel, interrupted := h.cancel, h.interrupted
+
+		// SIGTERM、空闲时的中断或第二次中断都直接退出
+		if sig == syscall.SIGTERM || cancel == nil || interrupted {
+			h.mu.Unlock()
+			pterm.Warning.Println("\n⚠️  收到中断信号，正在退出...")
+			exit()
+			return
+		}
+
+		h.interrupted = true
+		h.mu.Unlock()
+
+		logger.Info("收到中断信号，取消当前请求")
+		pterm.Warning.Println("\n⚠️  收到中断信号，正在取消当前任务... (再次按 Ctrl+C 退出程序)")
+		cancel()
+	}
+}
@@ -2,23 +2,38 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
 	"gomanus/internal/agent"
+	"gomanus/internal/checkpoint"
 	"gomanus/internal/config"
 	"gomanus/internal/llm"
+	"gomanus/internal/policy"
 	"gomanus/internal/tool"
 	"gomanus/pkg/logger"
 
 	"github.com/pterm/pterm"
 )
 
+// cliSessionID 是交互式命令行使用的会话ID
+const cliSessionID = "cli"
+
 func main() {
 	// 设置日志级别
 	logger.SetLevel(logger.LevelInfo)
+	// gomanus mcp serve 通过标准输入输出提供MCP服务，标准输出只能用于协议消息，其他输出改为标准错误
+	serveMCP := len(os.Args) > 2 && os.Args[1] == "mcp" && os.Args[2] == "serve"
+	if serveMCP {
+		pterm.SetDefaultOutput(os.Stderr)
+		logger.SetOutput(os.Stderr)
+	}
 	// 显示欢迎信息
 	pterm.DefaultHeader.WithFullWidth().WithBackgroundStyle(pterm.NewStyle(pterm.BgCyan)).WithTextStyle(pterm.NewStyle(pterm.FgBlack)).Println("GoManus AI 助手 v 0.8.4 (达哥出品)")
 	// 从配置文件加载配置
@@ -45,113 +60,103 @@ func main() {
 		logger.Fatal("初始化语言模型失败: %v", err)
 	}
 	pterm.Success.Printf("✅ 语言模型初始化成功: %s\n", llmInstance.Model)
-	logger.Info("语言模型初始化成功:\n %s \n %s \n %s \n %s \n %s", llmInstance.Model, llmInstance.BaseURL, llmInstance.MaxTokens, llmInstance.Temperature, llmInstance.APIKey)
+	logger.Info("语言模型初始化成功:\n %s \n %s \n %d \n %v", llmInstance.Model, llmInstance.BaseURL, llmInstance.MaxTokens, llmInstance.Temperature)
 
 	// 创建工具集合
 	pterm.Info.Println("🔧 正在初始化工具集合...")
-	tools := tool.NewToolCollection()
+	tools := loadTools(llmInstance, toolsCfg)
+	defer closeTools(tools)
 
-	// 根据配置添加工具
-	pterm.Info.Println("📦 开始加载工具模块...")
+	// 挂载外部MCP服务器提供的工具
+	mcpClients := mountMCPServers(context.Background(), tools)
+	defer closeMCPClients(mcpClients)
 
-	// 添加Terminate工具
-	if toolsCfg.Terminate {
-		pterm.Debug.Println("  ⚡ 加载 Terminate 工具")
-		terminateTool := tool.NewTerminate()
-		if err := tools.AddTool(terminateTool); err != nil {
-			logger.Fatal("添加Terminate工具失败: %v", err)
-		}
-	}
+	// 加载插件目录中的外部可执行插件，目录变化时自动重新加载
+	stopPlugins := loadPlugins(tools)
+	defer stopPlugins()
 
-	// 添加GoogleSearch工具
-	if toolsCfg.GoogleSearch {
-		pterm.Debug.Println("  🔍 加载 Google Search 工具")
-		googleSearchTool := tool.NewGoogleSearch()
-		if err := tools.AddTool(googleSearchTool); err != nil {
-			logger.Fatal("添加GoogleSearch工具失败: %v", err)
-		}
-	}
+	pterm.Success.Println("✅ 工具模块加载完成")
 
-	// 添加ZhihuSearch工具
-	if toolsCfg.ZhihuSearch {
-		pterm.Debug.Println("  📚 加载 Zhihu Search 工具")
-		zhihuSearchTool := tool.NewZhihuSearch()
-		if err := tools.AddTool(zhihuSearchTool); err != nil {
-			logger.Fatal("添加ZhihuSearch工具失败: %v", err)
-		}
-	}
+	// 代理工厂根据内置代理和配置中的 [agents.<name>] 为每个会话创建独立的代理
+	profiles := agent.LoadAgentProfiles()
+	factory := agent.NewFactory(profiles, llmInstance, tools)
 
-	// 添加BaiduBaikeSearch工具
-	if toolsCfg.BaiduBaikeSearch {
-		pterm.Debug.Println("  📖 加载 Baidu Baike Search 工具")
-		baiduBaikeSearchTool := tool.NewBaiduBaikeSearch()
-		if err := tools.AddTool(baiduBaikeSearchTool); err != nil {
-			logger.Fatal("添加BaiduBaikeSearch工具失败: %v", err)
-		}
-	}
+	// 创建分类器代理，所有会话共享
+	pterm.Info.Println("🧠 正在创建输入分类器...")
+	factory.Classifier = agent.NewClassifierAgent("Classifier", llmInstance)
+	pterm.Success.Println("✅ 输入分类器创建成功")
 
-	// 添加WikipediaSearch工具
-	if toolsCfg.WikipediaSearch {
-		pterm.Debug.Println("  🌐 加载 Wikipedia Search 工具")
-		wikipediaSearchTool := tool.NewWikipediaSearch()
-		if err := tools.AddTool(wikipediaSearchTool); err != nil {
-			logger.Fatal("添加WikipediaSearch工具失败: %v", err)
-		}
+	// 根据配置创建验证代理
+	verifierCfg, err := config.GetVerifierConfig()
+	if err != nil {
+		logger.Fatal("获取验证代理配置失败: %v", err)
 	}
-
-	// 添加BrowserUseTool工具
-	if toolsCfg.BrowserUse {
-		pterm.Debug.Println("  🌍 加载 Browser Use 工具")
-		browserUseTool := tool.NewBrowserUseTool()
-		if err := tools.AddTool(browserUseTool); err != nil {
-			logger.Fatal("添加BrowserUseTool工具失败: %v", err)
+	if verifierCfg.Enabled {
+		pterm.Info.Println("🔎 正在创建验证代理...")
+		verifierLLM := llmInstance
+		if verifierCfg.Model != "" {
+			verifierLLM, err = llm.NewLLM(verifierCfg.Model)
+			if err != nil {
+				logger.Fatal("创建验证代理模型失败: %v", err)
+			}
+		}
+		verifierAgent := agent.NewVerifierAgent("Verifier", verifierLLM)
+		if verifierCfg.MaxRetries != nil {
+			verifierAgent.MaxRetries = *verifierCfg.MaxRetries
 		}
+		if verifierCfg.Answers {
+			factory.AnswerVerifier = verifierAgent
+		}
+		if verifierCfg.Steps {
+			factory.StepVerifier = verifierAgent
+		}
+		pterm.Success.Println("✅ 验证代理创建成功")
 	}
 
-	// 添加FileOperator工具
-	if toolsCfg.FileOperator {
-		pterm.Debug.Println("  📁 加载 File Operator 工具")
-		fileOperatorTool := tool.NewFileOperator()
-		if err := tools.AddTool(fileOperatorTool); err != nil {
-			logger.Fatal("添加FileOperator工具失败: %v", err)
+	// 配置检查点，使中断的任务可以恢复
+	var checkpointStore *checkpoint.Store
+	runtimeCfg, err := config.GetRuntimeConfig()
+	if err != nil {
+		logger.Fatal("获取运行时配置失败: %v", err)
+	}
+	if runtimeCfg.CheckpointEnabled {
+		checkpointStore, err = checkpoint.NewStore(runtimeCfg.CheckpointDir)
+		if err != nil {
+			logger.Fatal("初始化检查点存储失败: %v", err)
 		}
+		retention := time.Duration(runtimeCfg.CheckpointRetentionDays) * 24 * time.Hour
+		if removed, err := checkpointStore.Prune(retention); err != nil {
+			logger.Warn("清理检查点失败: %v", err)
+		} else if removed > 0 {
+			logger.Info("已清理 %d 个过期或已完成的检查点", removed)
+		}
+		factory.Checkpoints = checkpointStore
+		pterm.Success.Println("✅ 检查点已启用，中断的任务可通过 gomanus resume <run-id> 恢复")
 	}
 
-	// 添加TerminalExecutor工具
-	if toolsCfg.TerminalExecutor {
-		pterm.Debug.Println("  💻 加载 Terminal Executor 工具")
-		terminalExecutorTool := tool.NewTerminalExecutor()
-		if err := tools.AddTool(terminalExecutorTool); err != nil {
-			logger.Fatal("添加TerminalExecutor工具失败: %v", err)
+	// 交互式会话使用会话池中的一个会话，每个会话拥有独立的代理和记忆
+	pterm.Info.Println("🤖 正在创建代理...")
+	pool := agent.NewPool(factory, runtimeCfg.MaxSessions, time.Duration(runtimeCfg.SessionIdleTimeout)*time.Second)
+	if serveMCP {
+		runMCPServer(pool, tools, toolsCfg)
+		return
+	}
+	session, err := pool.Get(cliSessionID)
+	if err != nil {
+		logger.Fatal("%v", err)
+	}
+	agents := session.Agents
+	modes := make(map[string]agent.InputType, len(profiles)) // 代理对应的交互模式，用于权限策略
+	for _, profile := range profiles {
+		if err, skipped := session.Skipped[profile.Key]; skipped {
+			pterm.Warning.Printf("⚠️  跳过代理 %s: %v\n", profile.Key, err)
+			continue
 		}
+		modes[profile.Key] = profile.Mode()
+		pterm.Success.Printf("✅ 代理 %s 创建成功 (%s)\n", profile.Key, profile.Strategy)
 	}
-
-	pterm.Success.Println("✅ 工具模块加载完成")
-
-	// 创建Manus代理
-	pterm.Info.Println("🤖 正在创建 GoManus 代理...")
-	manusAgent := agent.NewManus("Manus", llmInstance, tools)
-	pterm.Success.Println("✅ Manus 代理创建成功")
-
-	// 创建聊天代理
-	pterm.Info.Println("💬 正在创建聊天代理...")
-	chatAgent := agent.NewChatAgent("ChatAgent", llmInstance)
-	pterm.Success.Println("✅ 聊天代理创建成功")
-
-	// 创建分类器代理
-	pterm.Info.Println("🧠 正在创建输入分类器...")
-	classifierAgent := agent.NewClassifierAgent("Classifier", llmInstance)
-	pterm.Success.Println("✅ 输入分类器创建成功")
-
-	// 根据配置创建规划代理
-	var planningAgent *agent.PlanningAgent
-	if toolsCfg.Planning {
-		pterm.Info.Println("📋 正在创建规划代理...")
-		planningAgent = agent.NewPlanningAgent("PlanningAgent", llmInstance, tools)
-		pterm.Success.Println("✅ 规划代理创建成功")
-
-		// 将Manus代理添加为规划代理的执行器
-		planningAgent.AddExecutor("default", manusAgent.ToolCallAgent)
+	if planningAgent, ok := agents[agent.AgentPlanning].(*agent.PlanningAgent); ok {
+		pterm.Success.Printf("✅ 规划代理已注册 %d 个专用执行器\n", len(planningAgent.ExecutorProfiles))
 	}
 
 	pterm.Success.Println("🎉 所有代理已准备就绪，开始交互式会话！")
@@ -161,11 +166,25 @@ func main() {
 	pterm.Info.Println("🧠 智能分类功能已启用，系统会自动判断您的输入类型：")
 	pterm.Info.Println("   💬 聊天模式：日常对话、问答交流")
 	pterm.Info.Println("   ⚡ 任务模式：执行具体操作和任务")
-	if toolsCfg.Planning {
+	if agents[agent.AgentPlanning] != nil {
 		pterm.Info.Println("   📋 计划模式：制定复杂的多步骤计划")
 	} else {
 		pterm.Warning.Println("   📋 计划模式：未启用（需要在配置中开启）")
 	}
+	pterm.Info.Println("🤖 输入 /agent 查看可用代理，/agent <名称> 指定代理，/agent auto 恢复自动分类")
+	pterm.Info.Println("🧭 输入 /strategy <名称> 切换任务的执行策略，/strategy default 恢复代理配置的策略")
+	pterm.Info.Println("🔍 输入 /steps 查看上一次运行的步骤和工具调用")
+
+	// --agent 参数指定启动时使用的代理
+	args, selectedAgent := parseAgentFlag(os.Args[1:])
+	selectedStrategy := ""          // /strategy 指定的执行策略，为空则使用代理配置的策略
+	var lastResult *agent.RunResult // 最近一次运行的结果，通过 /steps 查看步骤详情
+	if selectedAgent != "" {
+		if _, exists := agents[selectedAgent]; !exists {
+			logger.Fatal("代理 %s 不存在，可用代理: %s", selectedAgent, strings.Join(agentKeys(agents), ", "))
+		}
+		pterm.Info.Printf("🤖 已指定代理: %s\n", selectedAgent)
+	}
 	pterm.Println()
 
 	// 创建可取消的上下文
@@ -176,14 +195,23 @@ func main() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
-	// 启动信号处理协程
-	go func() {
-		<-sigChan
-		pterm.Warning.Println("\n⚠️  收到中断信号，正在取消当前任务...")
+	// 启动信号处理协程：第一次中断只取消当前任务，再次中断时退出
+	interrupts := &interruptHandler{}
+	go interrupts.watch(sigChan, func() {
 		cancel() // 取消当前执行的任务
-		pterm.Success.Println("✅ 任务已取消")
+		closeTools(tools)
+		pterm.Success.Println("👋 再见！感谢使用GoManus！")
 		os.Exit(0)
-	}()
+	})
+
+	// 处理 resume 子命令：恢复中断的运行后进入交互式会话
+	if len(args) > 0 && args[0] == "resume" {
+		resumeCtx, resumeCancel := context.WithCancel(ctx)
+		interrupts.begin(resumeCancel)
+		resumeRun(resumeCtx, args[1:], checkpointStore, session)
+		interrupts.end()
+		resumeCancel()
+	}
 
 	for {
 		// 使用PTerm的交互式输入提示，添加panic恢复机制
@@ -211,86 +239,147 @@ func main() {
 			continue
 		}
 
+		// 处理代理和执行策略选择命令
+		if input == "/agent" || strings.HasPrefix(input, "/agent ") {
+			selectedAgent = handleAgentCommand(input, agents, profiles, selectedAgent)
+			continue
+		}
+		if input == "/strategy" || strings.HasPrefix(input, "/strategy ") {
+			selectedStrategy = handleStrategyCommand(input, selectedStrategy)
+			continue
+		}
+		if input == "/steps" {
+			printRunSteps(lastResult)
+			continue
+		}
+
 		// 处理用户输入
 		logger.Debug("收到用户输入: %s", input)
 		logger.Debug("开始处理用户输入...")
 
-		var response string
+		var result *agent.RunResult
 		var err error
 
-		// 为每个请求创建新的可取消上下文
+		// 为每个请求创建新的可取消上下文，中断信号只会取消这个请求
 		requestCtx, requestCancel := context.WithCancel(ctx)
-		defer requestCancel()
-
-		// 使用分类器判断输入类型
-		pterm.Info.Println("🔍 正在分析输入类型...")
-		inputType, classifyErr := classifierAgent.ClassifyInput(requestCtx, input)
-		if classifyErr != nil {
-			logger.Error("输入分类失败: %v", classifyErr)
-			pterm.Warning.Printf("⚠️  输入分类失败，使用默认模式: %v\n", classifyErr)
-			inputType = agent.InputTypeTask // 默认为任务模式
-		}
+		interrupts.begin(requestCancel)
+
+		// 指定了代理时直接使用，否则由分类器根据输入类型选择内置代理
+		agentKey := selectedAgent
+		spinnerText := fmt.Sprintf("🤖 代理 %s 正在处理... (按 Ctrl+C 可取消)", selectedAgent)
+		inputType := modes[selectedAgent]
+		if selectedAgent == "" {
+			pterm.Info.Println("🔍 正在分析输入类型...")
+			var classifyErr error
+			inputType, classifyErr = session.Classifier.ClassifyInput(requestCtx, input)
+			if classifyErr != nil {
+				logger.Error("输入分类失败: %v", classifyErr)
+				pterm.Warning.Printf("⚠️  输入分类失败，使用默认模式: %v\n", classifyErr)
+				inputType = agent.InputTypeTask // 默认为任务模式
+			}
 
-		// 显示分类结果
-		switch inputType {
-		case agent.InputTypeChat:
-			pterm.Info.Println("💬 识别为：聊天模式")
-		case agent.InputTypeTask:
-			pterm.Info.Println("⚡ 识别为：任务模式")
-		case agent.InputTypePlan:
-			pterm.Info.Println("📋 识别为：计划模式")
+			// 显示分类结果并选择代理
+			switch inputType {
+			case agent.InputTypePlan:
+				pterm.Info.Println("📋 识别为：计划模式")
+				if agents[agent.AgentPlanning] != nil {
+					pterm.Info.Println("📋 启用规划模式 (按 Ctrl+C 可取消)")
+					agentKey, spinnerText = agent.AgentPlanning, "🧠 正在制定计划..."
+				} else {
+					pterm.Warning.Println("⚠️  规划模式未启用，将使用任务模式处理")
+					agentKey, spinnerText = agent.AgentManus, "⚡ 正在执行任务... (按 Ctrl+C 可取消)"
+				}
+			case agent.InputTypeTask:
+				pterm.Info.Println("⚡ 识别为：任务模式")
+				agentKey, spinnerText = agent.AgentManus, "⚡ 正在执行任务... (按 Ctrl+C 可取消)"
+			case agent.InputTypeChat:
+				pterm.Info.Println("💬 识别为：聊天模式")
+				agentKey, spinnerText = agent.AgentChat, "💬 正在聊天中... (按 Ctrl+C 可取消)"
+			default:
+				agentKey, spinnerText = agent.AgentManus, "🤔 正在思考中... (按 Ctrl+C 可取消)"
+			}
 		}
 
-		// 根据输入类型选择处理方式
-		switch inputType {
-		case agent.InputTypePlan:
-			// 计划模式
-			if toolsCfg.Planning {
-				logger.Info("使用规划代理处理计划请求: %s", input)
-				pterm.Info.Println("📋 启用规划模式 (按 Ctrl+C 可取消)")
-				spinner, _ := pterm.DefaultSpinner.Start("🧠 正在制定计划...")
-				response, err = planningAgent.Run(requestCtx, input)
-				spinner.Stop()
+		// 在上下文中记录当前模式，供权限策略使用
+		requestCtx = policy.WithMode(requestCtx, string(inputType))
+		if selectedStrategy != "" {
+			if _, ok := agents[agentKey].(*agent.ChatAgent); ok {
+				pterm.Warning.Printf("⚠️  代理 %s 不使用工具，不支持切换执行策略\n", agentKey)
 			} else {
-				pterm.Warning.Println("⚠️  规划模式未启用，将使用任务模式处理")
-				logger.Info("规划模式未启用，使用任务模式处理请求: %s", input)
-				spinner, _ := pterm.DefaultSpinner.Start("⚡ 正在执行任务... (按 Ctrl+C 可取消)")
-				response, err = manusAgent.Run(requestCtx, input)
-				spinner.Stop()
+				requestCtx = agent.WithStrategy(requestCtx, selectedStrategy)
 			}
-		case agent.InputTypeTask:
-			// 任务模式
-			logger.Info("使用任务模式处理请求: %s", input)
-			spinner, _ := pterm.DefaultSpinner.Start("⚡ 正在执行任务... (按 Ctrl+C 可取消)")
-			response, err = manusAgent.Run(requestCtx, input)
-			spinner.Stop()
-		case agent.InputTypeChat:
-			// 聊天模式
-			logger.Info("使用聊天模式处理请求: %s", input)
-			spinner, _ := pterm.DefaultSpinner.Start("💬 正在聊天中... (按 Ctrl+C 可取消)")
-			response, err = chatAgent.Run(requestCtx, input)
-			spinner.Stop()
-		default:
-			// 默认使用任务模式
-			logger.Info("使用默认任务模式处理请求: %s", input)
-			spinner, _ := pterm.DefaultSpinner.Start("🤔 正在思考中... (按 Ctrl+C 可取消)")
-			response, err = manusAgent.Run(requestCtx, input)
-			spinner.Stop()
 		}
 
+		logger.Info("使用代理 %s 处理请求: %s", agentKey, input)
+		spinner, _ := pterm.DefaultSpinner.Start(spinnerText)
+		result, err = session.Run(requestCtx, agentKey, input)
+		spinner.Stop()
+		if result != nil {
+			lastResult = result
+		}
+
+		interrupts.end()
+		requestCancel()
+
 		if err != nil {
 			// 检查是否是上下文取消错误
-			if err == context.Canceled {
+			if errors.Is(err, context.Canceled) {
 				pterm.Warning.Println("⚠️  任务已被用户取消")
-				continue
+			} else {
+				pterm.Error.Printf("❌ 处理消息时出错: %v\n", err)
+			}
+			if checkpointStore != nil && result != nil && result.RunID != "" {
+				pterm.Info.Printf("💾 运行状态已保存，可通过 gomanus resume %s 恢复\n", result.RunID)
 			}
-			pterm.Error.Printf("❌ 处理消息时出错: %v\n", err)
 			continue
 		}
 
-		// 输出响应
-		logger.Debug("处理完成，返回响应: %s", response)
-		pterm.DefaultBox.WithTitle("🤖 GoManus 回复").WithTitleTopCenter().WithBoxStyle(pterm.NewStyle(pterm.FgCyan)).Println(response)
-		pterm.Println()
+		// 输出最终回答，步骤详情通过 /steps 查看
+		logger.Debug("处理完成，状态: %s，返回回答: %s", result.Status, result.Answer)
+		printRunResult(result)
+	}
+}
+
+// loadTools 根据配置创建工具集合并加载权限策略
+func loadTools(llmInstance *llm.LLM, toolsCfg config.ToolsConfig) *tool.ToolCollection {
+	tools := tool.NewToolCollection()
+
+	// 加载工具权限策略
+	policyCfg, err := config.GetPolicyConfig()
+	if err != nil {
+		logger.Fatal("获取权限策略配置失败: %v", err)
+	}
+	policyEngine, err := policy.NewEngine(policyCfg)
+	if err != nil {
+		logger.Fatal("加载权限策略失败: %v", err)
+	}
+	tools.SetPolicy(policyEngine)
+	if policyCfg.Enabled {
+		pterm.Success.Printf("✅ 工具权限策略已启用: %d 条规则\n", len(policyCfg.Rules))
+	}
+
+	// 根据 [tools] 配置创建注册表中启用的工具
+	pterm.Info.Println("📦 开始加载工具模块...")
+	registry := tool.NewRegistry()
+	tool.RegisterBuiltinTools(registry)
+	// 子代理从同一个工具集合中选择工具
+	registry.Register("delegate_task", agent.DelegateToolFactory)
+	loaded, err := registry.Build(toolsCfg, tool.Dependencies{LLM: llmInstance, Tools: tools})
+	if err != nil {
+		logger.Fatal("加载工具失败: %v", err)
+	}
+	pterm.Debug.Printf("  ⚡ 已加载工具: %s\n", strings.Join(loaded, ", "))
+
+	return tools
+}
+
+// closeTools 释放工具占用的外部资源，例如浏览器工具启动的Chromium
+func closeTools(tools *tool.ToolCollection) {
+	for _, t := range tools.GetAllTools() {
+		if closer, ok := t.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				logger.Warn("关闭工具 %s 失败: %v", t.Name(), err)
+			}
+		}
 	}
 }
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+
+	"gomanus/internal/agent"
+	"gomanus/internal/config"
+	"gomanus/internal/mcp"
+	"gomanus/internal/tool"
+	"gomanus/pkg/logger"
+
+	"github.com/pterm/pterm"
+)
+
+// mountMCPServers 连接配置中启用的MCP服务器并注册它们的工具，连接失败的服务器会被跳过
+func mountMCPServers(ctx context.Context, tools *tool.ToolCollection) []*mcp.Client {
+	servers, err := config.GetMCPServersConfig()
+	if err != nil {
+		logger.Warn("获取MCP服务器配置失败: %v", err)
+		return nil
+	}
+
+	names := make([]string, 0, len(servers))
+	for name, server := range servers {
+		if server.Enabled {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var clients []*mcp.Client
+	for _, name := range names {
+		pterm.Debug.Printf("  🔌 连接 MCP 服务器 %s\n", name)
+		client, mounted, err := mcp.Mount(ctx, tools, name, servers[name])
+		if err != nil {
+			pterm.Warning.Printf("⚠️  跳过MCP服务器 %s: %v\n", name, err)
+			logger.Warn("挂载MCP服务器 %s 失败: %v", name, err)
+			continue
+		}
+		pterm.Success.Printf("✅ MCP服务器 %s 已连接，挂载 %d 个工具\n", name, len(mounted))
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// closeMCPClients 断开与MCP服务器的连接
+func closeMCPClients(clients []*mcp.Client) {
+	for _, client := range clients {
+		if err := client.Close(); err != nil {
+			logger.Warn("断开MCP服务器 %s 失败: %v", client.Name, err)
+		}
+	}
+}
+
+// mcpSessionID 是MCP服务器中gomanus_run工具使用的会话ID
+const mcpSessionID = "mcp"
+
+// runMCPServer 通过标准输入输出对外提供工具，直到客户端断开连接或收到中断信号
+func runMCPServer(pool *agent.Pool, tools *tool.ToolCollection, toolsCfg config.ToolsConfig) {
+	serveCfg, err := config.GetMCPServeConfig()
+	if err != nil {
+		logger.Fatal("获取MCP服务配置失败: %v", err)
+	}
+
+	// terminate只用于结束代理的循环，对外部客户端没有意义
+	deny := append([]string{"terminate"}, serveCfg.ExcludeTools...)
+	exposed := func(name string) bool {
+		for _, denied := range deny {
+			if name == denied {
+				return false
+			}
+		}
+		if len(serveCfg.Tools) == 0 {
+			return true
+		}
+		for _, allowed := range serveCfg.Tools {
+			if name == allowed {
+				return true
+			}
+		}
+		return false
+	}
+
+	// 规划工具和代理工具不在共享的工具集合中，只添加到对外提供的视图里
+	var extra []tool.Tool
+	if toolsCfg.Enabled("planning") && exposed("planning") {
+		extra = append(extra, tool.NewPlanningTool())
+	}
+	if serveCfg.ExposeAgent && exposed(runAgentToolName) {
+		extra = append(extra, newRunAgentTool(pool))
+	}
+	opts := tool.ViewOptions{Deny: deny, Extra: extra}
+	if len(serveCfg.Tools) > 0 {
+		opts.Allow = serveCfg.Tools
+	}
+	served := tools.ForSession().View(opts)
+
+	server := mcp.NewServer(served)
+	server.Instructions = "GoManus 提供文件操作、终端命令、网络搜索和计划管理等工具。"
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go pool.Reap(ctx)
+
+	pterm.Success.Printf("✅ MCP服务已启动，提供 %d 个工具: %s\n", served.Count(), strings.Join(served.Names(), ", "))
+	if err := server.ServeStdio(ctx, os.Stdin, os.Stdout); err != nil && !errors.Is(err, context.Canceled) {
+		logger.Error("MCP服务异常结束: %v", err)
+	}
+	logger.Info("MCP服务已停止")
+}
+
+// runAgentToolName 是由代理完成整个任务的工具名称
+const runAgentToolName = "gomanus_run"
+
+// runAgentArgs 是gomanus_run工具的参数
+type runAgentArgs struct {
+	Task  string `json:"task" description:"需要完成的任务，描述越具体越好" required:"true"`
+	Agent string `json:"agent,omitempty" description:"(可选) 处理任务的代理名称，默认为任务代理manus"`
+}
+
+// newRunAgentTool 创建由代理使用自身的工具自主完成整个任务的工具，所有调用在同一个会话中依次执行
+func newRunAgentTool(pool *agent.Pool) tool.Tool {
+	description := "把一个完整的任务交给GoManus代理，代理会自主规划并调用工具完成任务，返回最终回答和生成的文件。"
+	return tool.NewTypedTool(runAgentToolName, description, func(ctx context.Context, args runAgentArgs) (interface{}, error) {
+		if strings.TrimSpace(args.Task) == "" {
+			return nil, fmt.Errorf("任务不能为空")
+		}
+		key := args.Agent
+		if key == "" {
+			key = agent.AgentManus
+		}
+
+		session, err := pool.Get(mcpSessionID)
+		if err != nil {
+			return nil, err
+		}
+		result, err := session.Run(ctx, key, args.Task)
+		if err != nil {
+			return nil, fmt.Errorf("代理 %s 执行任务失败: %w", key, err)
+		}
+
+		var output strings.Builder
+		output.WriteString(result.Answer)
+		if !result.Succeeded() {
+			fmt.Fprintf(&output, "\n\n状态: %s", result.Status)
+		}
+		for _, warning := range result.Warnings {
+			fmt.Fprintf(&output, "\n注意: %s", warning)
+		}
+		if len(result.Artifacts) > 0 {
+			fmt.Fprintf(&output, "\n生成的文件: %s", strings.Join(result.Artifacts, ", "))
+		}
+		return output.String(), nil
+	})
+}
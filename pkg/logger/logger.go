@@ -2,6 +2,7 @@ package logger
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
@@ -29,6 +30,11 @@ func SetLevel(level int) {
 	currentLevel = level
 }
 
+// SetOutput 设置日志输出，默认输出到标准输出
+func SetOutput(w io.Writer) {
+	logger.SetOutput(w)
+}
+
 // GetLevel 获取当前日志级别
 func GetLevel() int {
 	return currentLevel
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"gomanus/internal/config"
+	"gomanus/internal/tool"
+	"gomanus/pkg/logger"
+
+	"github.com/pterm/pterm"
+)
+
+// defaultPluginTimeout 是插件和配置都没有声明超时时间时单次调用的超时时间
+const defaultPluginTimeout = 60 * time.Second
+
+// loadPlugins 把插件目录中的插件注册为工具，启用监视时在后台重新加载变化的插件
+// 返回的函数用于停止监视
+func loadPlugins(tools *tool.ToolCollection) func() {
+	pluginsCfg, err := config.GetPluginsConfig()
+	if err != nil {
+		logger.Warn("获取插件配置失败: %v", err)
+		return func() {}
+	}
+	if !pluginsCfg.Enabled {
+		return func() {}
+	}
+
+	dir := pluginsCfg.Dir
+	if dir == "" {
+		dir = "plugins"
+	}
+	timeout := defaultPluginTimeout
+	if pluginsCfg.Timeout > 0 {
+		timeout = time.Duration(pluginsCfg.Timeout) * time.Second
+	}
+
+	manager, err := tool.NewPluginManager(dir, tools, timeout)
+	if err != nil {
+		pterm.Warning.Printf("⚠️  跳过插件: %v\n", err)
+		return func() {}
+	}
+	pterm.Debug.Printf("  🧱 加载插件目录 %s\n", manager.Dir())
+	if err := manager.Load(); err != nil {
+		pterm.Warning.Printf("⚠️  加载插件失败: %v\n", err)
+		return func() {}
+	}
+	if names := manager.Names(); len(names) > 0 {
+		pterm.Success.Printf("✅ 已加载 %d 个插件工具: %s\n", len(names), strings.Join(names, ", "))
+	}
+	if !pluginsCfg.Watch {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		if err := manager.Watch(ctx); err != nil {
+			logger.Warn("插件目录不会自动重新加载: %v", err)
+		}
+	}()
+	return cancel
+}
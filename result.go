@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"gomanus/internal/agent"
+
+	"github.com/pterm/pterm"
+)
+
+// printRunResult 输出运行的最终回答，运行没有完成任务时先说明原因
+func printRunResult(result *agent.RunResult) {
+	switch result.Status {
+	case agent.RunStatusBudgetExceeded:
+		pterm.Warning.Println("⚠️  已达到最大步骤数，任务可能尚未完成")
+	case agent.RunStatusFailure:
+		pterm.Warning.Println("⚠️  代理未能完成任务")
+	}
+	for _, warning := range result.Warnings {
+		pterm.Warning.Printf("⚠️  %s\n", warning)
+	}
+
+	answer := result.Answer
+	if strings.TrimSpace(answer) == "" {
+		answer = "（没有回答）"
+	}
+	pterm.DefaultBox.WithTitle("🤖 GoManus 回复").WithTitleTopCenter().WithBoxStyle(pterm.NewStyle(pterm.FgCyan)).Println(answer)
+
+	if len(result.Artifacts) > 0 {
+		pterm.Info.Printf("📎 生成的文件: %s\n", strings.Join(result.Artifacts, ", "))
+	}
+	if len(result.Steps) > 1 || result.ToolCallCount() > 0 {
+		pterm.Info.Printf("共 %d 个步骤、%d 次工具调用，消耗 %d 个token，用时 %s，输入 /steps 查看步骤详情\n",
+			len(result.Steps), result.ToolCallCount(), result.TokensUsed, result.Duration.Round(time.Millisecond))
+	}
+	pterm.Println()
+}
+
+// printRunSteps 输出运行的步骤详情和每个步骤中的工具调用
+func printRunSteps(result *agent.RunResult) {
+	if result == nil {
+		pterm.Info.Println("还没有可以查看的运行")
+		return
+	}
+
+	pterm.Info.Printf("代理 %s 的运行 %s，状态: %s\n", result.Agent, result.RunID, result.Status)
+	data := pterm.TableData{{"步骤", "用时", "工具调用", "结果"}}
+	for _, step := range result.Steps {
+		var calls []string
+		for _, call := range step.ToolCalls {
+			mark := "✓"
+			if call.Failed {
+				mark = "✗"
+			}
+			calls = append(calls, pterm.Sprintf("%s %s (%s)", mark, call.Name, call.Duration.Round(time.Millisecond)))
+		}
+
+		output := step.Output
+		if step.Note != "" {
+			output = strings.TrimSpace(output + "\n" + step.Note)
+		}
+		data = append(data, []string{
+			pterm.Sprint(step.Number),
+			step.Duration.Round(time.Millisecond).String(),
+			strings.Join(calls, "\n"),
+			truncateText(output, 80),
+		})
+	}
+	pterm.DefaultTable.WithHasHeader().WithData(data).Render()
+}
+
+// truncateText 截断过长的文本，只保留第一行
+func truncateText(text string, limit int) string {
+	text = strings.TrimSpace(text)
+	if i := strings.Index(text, "\n"); i >= 0 {
+		text = text[:i] + " ..."
+	}
+	runes := []rune(text)
+	if len(runes) > limit {
+		return string(runes[:limit]) + "..."
+	}
+	return text
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"gomanus/internal/agent"
+	"gomanus/internal/checkpoint"
+	"gomanus/pkg/logger"
+
+	"github.com/pterm/pterm"
+)
+
+// resumeRun 从检查点恢复指定的运行；未指定运行ID时列出可恢复的运行
+func resumeRun(ctx context.Context, args []string, store *checkpoint.Store, session *agent.Session) {
+	if store == nil {
+		pterm.Error.Println("❌ 检查点未启用，请在配置中设置 runtime.checkpoint_enabled = true")
+		return
+	}
+
+	if len(args) == 0 {
+		listResumableRuns(store)
+		return
+	}
+
+	runID := args[0]
+	cp, err := store.Load(runID)
+	if err != nil {
+		pterm.Error.Printf("❌ 加载检查点失败: %v\n", err)
+		return
+	}
+	if !cp.Resumable() {
+		pterm.Warning.Printf("⚠️  运行 %s 已经完成，无需恢复\n", runID)
+		return
+	}
+
+	pterm.Info.Printf("🔄 正在恢复运行 %s (代理: %s, 第 %d 步)\n", cp.RunID, cp.Agent, cp.CurrentStep)
+	pterm.Info.Printf("   原始请求: %s\n", cp.Request)
+
+	// 由会话中保存检查点的代理继续执行
+	spinner, _ := pterm.DefaultSpinner.Start("⚡ 正在继续执行任务...")
+	result, err := session.Resume(ctx, cp)
+	spinner.Stop()
+
+	if errors.Is(err, context.Canceled) {
+		pterm.Warning.Printf("⚠️  任务已被用户取消，可通过 gomanus resume %s 再次恢复\n", cp.RunID)
+		return
+	}
+	if err != nil {
+		logger.Error("恢复运行失败: %v", err)
+		pterm.Error.Printf("❌ 恢复运行失败: %v\n", err)
+		return
+	}
+
+	printRunResult(result)
+}
+
+// listResumableRuns 列出可以恢复的运行
+func listResumableRuns(store *checkpoint.Store) {
+	checkpoints, err := store.List()
+	if err != nil {
+		pterm.Error.Printf("❌ 读取检查点失败: %v\n", err)
+		return
+	}
+
+	data := pterm.TableData{{"运行ID", "代理", "状态", "步骤", "更新时间", "请求"}}
+	for _, cp := range checkpoints {
+		if !cp.Resumable() {
+			continue
+		}
+		request := []rune(cp.Request)
+		if len(request) > 30 {
+			request = append(request[:30], []rune("...")...)
+		}
+		data = append(data, []string{
+			cp.RunID,
+			cp.Agent,
+			cp.Status,
+			pterm.Sprint(cp.CurrentStep),
+			cp.UpdatedAt.Format("2006-01-02 15:04:05"),
+			string(request),
+		})
+	}
+
+	if len(data) == 1 {
+		pterm.Info.Println("没有可以恢复的运行")
+		return
+	}
+	pterm.Info.Println("可以恢复的运行 (使用 gomanus resume <run-id> 恢复):")
+	pterm.DefaultTable.WithHasHeader().WithData(data).Render()
+}